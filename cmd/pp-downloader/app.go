@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/logfile"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// app is what every command shares: the config, logging set up from it and
+// the database, so paths and logs behave the same whichever command runs
+type app struct {
+	cfg     *config.Config
+	logger  *slog.Logger
+	logFile *logfile.Writer
+	db      *database.Database
+}
+
+// loadApp loads the config and sets up logging from it. The watcher logs to
+// stdout and LOG_FILE; other commands log to stderr only, so what they print
+// to stdout can be piped.
+func loadApp(watcher bool) (*app, error) {
+	cfg, err := config.LoadConfig(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	a := &app{cfg: cfg}
+
+	var out io.Writer = os.Stderr
+	if watcher {
+		out = os.Stdout
+		if a.logFile = openLogFile(cfg); a.logFile != nil {
+			out = io.MultiWriter(os.Stdout, a.logFile)
+		}
+	}
+	a.logger = newLogger(out, cfg.LogLevel, cfg.LogFormat)
+	slog.SetDefault(a.logger)
+	a.logger.Debug("Configuration loaded", "config", fmt.Sprintf("%+v", cfg))
+	return a, nil
+}
+
+// openDatabase opens the database DB_DRIVER names: the SQLite file at
+// DB_PATH, creating its folder, or the Postgres server at DB_DSN
+func (a *app) openDatabase() error {
+	dsn := a.cfg.DBDSN
+	if a.cfg.DBDriver != database.DriverPostgres {
+		if err := os.MkdirAll(filepath.Dir(a.cfg.DBPath), 0755); err != nil {
+			return fmt.Errorf("failed to create database directory: %w", err)
+		}
+		dsn = a.cfg.DBPath
+	}
+	db, err := database.Open(a.cfg.DBDriver, dsn)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	db.SetLogger(a.logger)
+	if err := db.SetLibraryRoot(a.cfg.MusicParentDir); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	a.db = db
+	return nil
+}
+
+// Close closes the database and the log file
+func (a *app) Close() {
+	if a.db != nil {
+		a.db.Close()
+	}
+	if a.logFile != nil {
+		a.logFile.Close()
+	}
+}
+
+// printVersion prints the version this binary was built as. Builds without
+// -ldflags fall back to the module version go install records.
+func printVersion(w io.Writer) {
+	v := version
+	if info, ok := debug.ReadBuildInfo(); ok && v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+	fmt.Fprintf(w, "pp-downloader %s (%s, %s/%s)\n", v, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/ytdlp"
+)
+
+// repairArt downloads again the videos whose cover art couldn't be embedded
+// because yt-dlp lacked a dependency, once the probe shows it is installed,
+// returning how many were repaired. Art missing for any other reason isn't
+// retried, and without a probe nothing is known about the dependencies, so
+// nothing is. Like the validator's repairs, downloads only run while inWindow
+// allows heavy work, checked every tick.
+func repairArt(ctx context.Context, db *database.Database, caps *ytdlp.Capabilities, inWindow func(time.Time) bool, tick time.Duration, redownload func(context.Context, database.Video) (bool, error)) int {
+	if caps == nil {
+		return 0
+	}
+	videos, err := db.GetVideosWithoutArt()
+	if err != nil {
+		slog.Warn("Failed to find videos without cover art", "error", err)
+		return 0
+	}
+
+	repaired := 0
+	for _, video := range videos {
+		if !caps.CanEmbedThumbnail(filepath.Ext(video.FilePath)) {
+			continue
+		}
+		if !waitForWindow(ctx, inWindow, tick) {
+			break
+		}
+		slog.Info("Repairing cover art", "video_id", video.YoutubeID, "installed", video.ArtMissing)
+		attempted, err := redownload(ctx, video)
+		switch {
+		case err != nil:
+			slog.Warn("Failed to repair cover art", "video_id", video.YoutubeID, "error", err)
+		case attempted:
+			repaired++
+		}
+	}
+	if repaired > 0 {
+		slog.Info("Repaired cover art", "videos", repaired)
+	}
+	return repaired
+}
+
+// waitForWindow blocks until inWindow allows heavy work, checking every tick.
+// It returns false if ctx is done first.
+func waitForWindow(ctx context.Context, inWindow func(time.Time) bool, tick time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if inWindow == nil || inWindow(time.Now()) {
+		return true
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case now := <-ticker.C:
+			if inWindow(now) {
+				return true
+			}
+		}
+	}
+}
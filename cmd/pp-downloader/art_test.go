@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/ytdlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairArt(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "Jazz")
+	require.NoError(t, err)
+	for _, r := range []database.DownloadRecord{
+		{YoutubeID: "aaaaaaaaaaa", FilePath: "/music/Jazz/a.mp3", ArtMissing: "ffmpeg"},
+		{YoutubeID: "bbbbbbbbbbb", FilePath: "/music/Jazz/b.m4a", ArtMissing: "mutagen or AtomicParsley"},
+		{YoutubeID: "ccccccccccc", FilePath: "/music/Jazz/c.mp3", ArtEmbedded: true},
+		{YoutubeID: "ddddddddddd", FilePath: "/music/Jazz/d.mp3", ArtMissing: "ffmpeg"},
+		{YoutubeID: "eeeeeeeeeee", FilePath: "/music/Jazz/e.mp3"}, // Embedding failed for another reason
+	} {
+		require.NoError(t, db.RecordDownload("PL_JAZZ", "Jazz", r))
+	}
+
+	var redownloaded []string
+	redownload := func(ctx context.Context, v database.Video) (bool, error) {
+		redownloaded = append(redownloaded, v.YoutubeID)
+		if v.YoutubeID == "ddddddddddd" {
+			return true, errors.New("video unavailable")
+		}
+		return true, nil
+	}
+
+	assert.Equal(t, 0, repairArt(context.Background(), db, nil, nil, time.Millisecond, redownload), "Nothing is known without a probe")
+	assert.Empty(t, redownloaded)
+
+	// ffmpeg is installed but neither mutagen nor AtomicParsley, so only the
+	// mp3s can be repaired
+	caps := &ytdlp.Capabilities{
+		Options:     map[string]bool{"--embed-thumbnail": true},
+		Libraries:   map[string]bool{},
+		Executables: map[string]bool{"ffmpeg": true},
+	}
+	assert.Equal(t, 1, repairArt(context.Background(), db, caps, nil, time.Millisecond, redownload))
+	assert.Equal(t, []string{"aaaaaaaaaaa", "ddddddddddd"}, redownloaded, "Only art missing ffmpeg is retried")
+}
+
+func TestRepairArtWaitsForWindow(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "Jazz")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_JAZZ", "Jazz", database.DownloadRecord{YoutubeID: "aaaaaaaaaaa", FilePath: "/music/Jazz/a.mp3", ArtMissing: "ffmpeg"}))
+	caps := &ytdlp.Capabilities{
+		Options:     map[string]bool{"--embed-thumbnail": true},
+		Executables: map[string]bool{"ffmpeg": true},
+	}
+
+	var checks atomic.Int32
+	opensLater := func(time.Time) bool { return checks.Add(1) > 3 }
+	var redownloaded []string
+	redownload := func(ctx context.Context, v database.Video) (bool, error) {
+		assert.Greater(t, checks.Load(), int32(3), "Downloads wait for the window")
+		redownloaded = append(redownloaded, v.YoutubeID)
+		return true, nil
+	}
+	assert.Equal(t, 1, repairArt(context.Background(), db, caps, opensLater, time.Millisecond, redownload))
+	assert.Equal(t, []string{"aaaaaaaaaaa"}, redownloaded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	closed := func(time.Time) bool { return false }
+	assert.Equal(t, 0, repairArt(ctx, db, caps, closed, time.Millisecond, redownload), "Shutdown stops waiting")
+}
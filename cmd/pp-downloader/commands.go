@@ -0,0 +1,1189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/downloader"
+	"github.com/sampiiiii/pp-downloader/internal/filename"
+	"github.com/sampiiiii/pp-downloader/internal/sidecar"
+	"github.com/sampiiiii/pp-downloader/internal/takeout"
+	"github.com/sampiiiii/pp-downloader/internal/validator"
+)
+
+const usage = `Usage:
+  pp-downloader [flags] [run] [--refresh-on-start]
+                                                  Run the playlist watcher; --refresh-on-start checks every
+                                                  playlist right away instead of when due
+  pp-downloader [flags] once [--summary <file>]   Check every playlist once, print what each did, then exit;
+                                                  same as run --once
+  pp-downloader [flags] --print-config            Show every setting, its value and where it was set
+  pp-downloader [flags] --send-digest-now         Email the activity digest now, to test the SMTP settings
+  pp-downloader [flags] <command>                 Run one of the commands below
+  pp-downloader version                           Show the version
+  pp-downloader healthcheck                       Exit 0 if the running watcher is healthy and 1 if not, through
+                                                  /healthz when API_ADDR is set or else HEARTBEAT_FILE
+  pp-downloader init [--format yaml|json|env] [--force]
+                                                  Write a starter config, with the ffmpeg and yt-dlp found on PATH
+  pp-downloader add-playlist <name> <url>         Add a playlist to the config file
+  pp-downloader list                              List the configured playlists and when each was last checked
+  pp-downloader import-archive <file> <playlist>  Mark videos in a yt-dlp archive as downloaded
+  pp-downloader import-library <dir> <playlist> [--pattern <regex>] [--dry-run]
+                                                  Record already downloaded files named with a video ID
+  pp-downloader import-takeout <dir> [--download]
+                                                  Record the playlists in a Google Takeout export; --download
+                                                  also adds them to the config file so the watcher downloads them
+  pp-downloader export-archive [file]             Write downloaded videos as a yt-dlp archive
+  pp-downloader failures [min-attempts]           List videos that keep failing to download
+  pp-downloader trial <playlist>                  Download a playlist once into a throwaway library
+  pp-downloader stats [--json]                    Show per-playlist video counts and disk usage
+  pp-downloader storage                           Show free disk space and the playlists using the most
+  pp-downloader export [--format json|csv] [--playlist <playlist>] [--since <date>] [file]
+                                                  Write video metadata as JSON or CSV
+  pp-downloader search <query>                    Find downloaded videos by title, channel or description
+  pp-downloader remove <video-id> [--keep-file] [--ignore]
+                                                  Delete a video; --ignore never downloads it again
+  pp-downloader block <video-id> [--purge]        Never download a video into any playlist; --purge deletes it
+                                                  if it was downloaded before
+  pp-downloader backup [file]                     Back up the database, by default into BACKUP_DIR
+  pp-downloader relocate <old-dir> [new-dir]      Point files recorded under old-dir at new-dir, by default
+                                                  MUSIC_PARENT_DIR, after moving the library
+  pp-downloader status [status]                   Count videos by status per playlist, or list videos with a
+                                                  status: pending, valid, missing, corrupt, error, failed, archived
+  pp-downloader maintenance [--purge-playlists] [--pending-days <n>] [--vacuum] [--dry-run]
+                                                  Delete rows of unconfigured playlists and stale pending
+                                                  videos, then optimize the database
+  pp-downloader orphans [--adopt | --delete]      List media files in MUSIC_PARENT_DIR that no video points at;
+                                                  --adopt records them by the video ID in their name
+  pp-downloader validate [--deep] [--report <file>] [--cleanup] [--dry-run]
+                                                  Check every file now and list missing and corrupt ones;
+                                                  --cleanup deletes the rows of files still missing
+  pp-downloader cleanup [--max-age <duration>] [--dry-run] [--staging]
+                                                  Delete leftover yt-dlp temp files; --staging also deletes
+                                                  interrupted downloads, so stop the watcher first
+  pp-downloader residecar [--format nfo|json] [--playlist <playlist>]
+                                                  Write the metadata sidecar of every downloaded file again,
+                                                  by default in SIDECAR_FORMAT
+
+Flags, which win over the environment and config files:
+  --playlist <name=URL>                           Watch a playlist; can be repeated
+  --music-dir <dir>                               Same as --music-parent-dir
+  --db <file>                                     Same as --db-path
+  --<setting> <value>                             Any setting, named after its environment variable,
+                                                  e.g. --link-mode symlink for LINK_MODE=symlink`
+
+// runCommand runs a one-off CLI command instead of the watcher
+func runCommand(cfg *config.Config, db *database.Database, args []string) error {
+	switch args[0] {
+	case "import-archive":
+		if len(args) != 3 {
+			return fmt.Errorf("import-archive needs an archive file and a playlist\n%s", usage)
+		}
+		return importArchive(cfg, db, args[1], args[2])
+	case "import-library":
+		return importLibrary(cfg, db, os.Stdout, args[1:])
+	case "import-takeout":
+		return importTakeout(cfg, db, os.Stdout, args[1:])
+	case "export-archive":
+		if len(args) > 2 {
+			return fmt.Errorf("export-archive takes at most one file\n%s", usage)
+		}
+		path := ""
+		if len(args) == 2 {
+			path = args[1]
+		}
+		return exportArchive(db, path)
+	case "failures":
+		if len(args) > 2 {
+			return fmt.Errorf("failures takes at most a minimum attempt count\n%s", usage)
+		}
+		minAttempts := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid attempt count %q\n%s", args[1], usage)
+			}
+			minAttempts = n
+		}
+		return listFailures(db, os.Stdout, minAttempts)
+	case "trial":
+		if len(args) != 2 {
+			return fmt.Errorf("trial needs a playlist\n%s", usage)
+		}
+		return runTrial(cfg, args[1])
+	case "stats":
+		if len(args) > 2 || (len(args) == 2 && args[1] != "--json") {
+			return fmt.Errorf("stats only takes --json\n%s", usage)
+		}
+		return showStats(db, os.Stdout, cfg.LowBitrate, len(args) == 2)
+	case "storage":
+		if len(args) > 1 {
+			return fmt.Errorf("storage takes no arguments\n%s", usage)
+		}
+		return showStorage(cfg, db, os.Stdout)
+	case "export":
+		return exportVideos(cfg, db, args[1:])
+	case "search":
+		if len(args) < 2 {
+			return fmt.Errorf("search needs a query\n%s", usage)
+		}
+		return searchVideos(db, os.Stdout, strings.Join(args[1:], " "))
+	case "remove":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return fmt.Errorf("remove needs a video ID\n%s", usage)
+		}
+		deleteFile, ignore := true, false
+		for _, flag := range args[2:] {
+			switch flag {
+			case "--keep-file":
+				deleteFile = false
+			case "--ignore":
+				ignore = true
+			default:
+				return fmt.Errorf("unknown remove option %q\n%s", flag, usage)
+			}
+		}
+		return removeVideo(db, args[1], deleteFile, ignore)
+	case "block":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return fmt.Errorf("block needs a video ID\n%s", usage)
+		}
+		purge := false
+		for _, flag := range args[2:] {
+			switch flag {
+			case "--purge":
+				purge = true
+			default:
+				return fmt.Errorf("unknown block option %q\n%s", flag, usage)
+			}
+		}
+		return blockVideo(db, args[1], purge)
+	case "status":
+		if len(args) > 2 {
+			return fmt.Errorf("status takes at most one status\n%s", usage)
+		}
+		if len(args) == 1 {
+			return showStatusCounts(db, os.Stdout)
+		}
+		return listVideosByStatus(db, os.Stdout, args[1])
+	case "backup":
+		if len(args) > 2 {
+			return fmt.Errorf("backup takes at most one file\n%s", usage)
+		}
+		path := ""
+		if len(args) == 2 {
+			path = args[1]
+		}
+		return backup(cfg, db, path)
+	case "relocate":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("relocate needs the old library directory\n%s", usage)
+		}
+		newDir := cfg.MusicParentDir
+		if len(args) == 3 {
+			newDir = args[2]
+		}
+		return relocate(db, args[1], newDir)
+	case "maintenance":
+		return maintenance(cfg, db, os.Stdout, args[1:])
+	case "orphans":
+		return orphans(cfg, db, os.Stdout, args[1:])
+	case "validate":
+		return validate(cfg, db, os.Stdout, args[1:])
+	case "cleanup":
+		return cleanup(cfg, db, os.Stdout, args[1:])
+	case "residecar":
+		return residecar(cfg, db, os.Stdout, args[1:])
+	case "list":
+		if len(args) > 1 {
+			return fmt.Errorf("list takes no arguments\n%s", usage)
+		}
+		return listPlaylists(cfg, db, os.Stdout)
+	case "add-playlist":
+		if len(args) != 3 {
+			return fmt.Errorf("add-playlist needs a name and a URL\n%s", usage)
+		}
+		return addPlaylist(cfg, args[1], args[2])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+// importPlaylist resolves the playlist an import goes into: a name from
+// playlists.json, a playlist or channel URL, or a bare playlist ID. It
+// returns the playlist ID and the name to create it with.
+func importPlaylist(cfg *config.Config, playlist string) (string, string) {
+	playlistID, name := playlist, ""
+	if pl, ok := cfg.Playlists[playlist]; ok {
+		playlistID, name = pl.URL, playlist
+	}
+	playlistID = downloader.PlaylistID(playlistID)
+	if name == "" {
+		name = playlistID
+	}
+	return playlistID, name
+}
+
+// importArchive imports a yt-dlp archive file into a playlist
+func importArchive(cfg *config.Config, db *database.Database, path, playlist string) error {
+	playlistID, name := importPlaylist(cfg, playlist)
+
+	// Create the playlist up front so it keeps its friendly name
+	if _, err := db.GetOrCreatePlaylist(playlistID, name); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	stats, err := db.ImportArchive(f, playlistID)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Imported archive", "playlist_id", playlistID, "imported", stats.Imported,
+		"existing", stats.Existing, "duplicate_lines", stats.Duplicates, "skipped_lines", stats.Skipped)
+	return nil
+}
+
+// importLibrary parses the import-library command's flags, scans the
+// directory for files named with a video ID and records them in the
+// playlist. Files without an ID are always listed; with --dry-run nothing
+// is written.
+func importLibrary(cfg *config.Config, db *database.Database, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("import-library", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	pattern := fs.String("pattern", database.DefaultLibraryIDPattern, "regular expression matching the video ID")
+	dryRun := fs.Bool("dry-run", false, "only report what would be imported")
+	// Flags may come after the directory and playlist
+	var positional []string
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return fmt.Errorf("invalid import-library arguments\n%s", usage)
+		}
+		args = fs.Args()
+		if len(args) > 0 {
+			positional = append(positional, args[0])
+			args = args[1:]
+		}
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("import-library needs a directory and a playlist\n%s", usage)
+	}
+	dir := positional[0]
+	playlistID, name := importPlaylist(cfg, positional[1])
+
+	scan, err := database.ScanLibrary(dir, *pattern)
+	if err != nil {
+		return err
+	}
+	for _, path := range scan.Unrecognized {
+		fmt.Fprintf(w, "no video ID: %s\n", path)
+	}
+	for _, path := range scan.Duplicates {
+		fmt.Fprintf(w, "duplicate video ID: %s\n", path)
+	}
+
+	if *dryRun {
+		ids := make([]string, len(scan.Files))
+		for i, f := range scan.Files {
+			ids[i] = f.YoutubeID
+		}
+		known, err := db.GetExistingVideoIDs(ids)
+		if err != nil {
+			return err
+		}
+		for _, f := range scan.Files {
+			state := "new"
+			if known[f.YoutubeID] {
+				state = "known"
+			}
+			fmt.Fprintf(w, "%s %s: %s\n", state, f.YoutubeID, f.Path)
+		}
+		slog.Info("Dry run: files would be imported", "playlist_id", playlistID, "files", len(scan.Files),
+			"known", len(known), "unrecognized", len(scan.Unrecognized), "duplicates", len(scan.Duplicates))
+		return nil
+	}
+
+	// Create the playlist up front so it keeps its friendly name
+	if _, err := db.GetOrCreatePlaylist(playlistID, name); err != nil {
+		return err
+	}
+	stats, err := db.ImportLibrary(playlistID, scan.Files)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Imported library", "playlist_id", playlistID, "imported", stats.Imported+stats.Updated, "updated", stats.Updated,
+		"existing", stats.Existing, "unrecognized", len(scan.Unrecognized), "duplicates", len(scan.Duplicates))
+	return nil
+}
+
+// importTakeout parses the import-takeout command's flags and records the
+// videos of each playlist in a Google Takeout export as known, without
+// downloading them. With --download, playlists the export has an ID for
+// are also added to the config file, so the watcher downloads them.
+func importTakeout(cfg *config.Config, db *database.Database, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("import-takeout", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	download := fs.Bool("download", false, "add the playlists to the config file to download them")
+	// The flag may come after the directory
+	var positional []string
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return fmt.Errorf("invalid import-takeout arguments\n%s", usage)
+		}
+		args = fs.Args()
+		if len(args) > 0 {
+			positional = append(positional, args[0])
+			args = args[1:]
+		}
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("import-takeout needs a directory\n%s", usage)
+	}
+	dir := positional[0]
+	if _, err := os.Stat(cfg.PlaylistsFile()); *download && errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("the playlists are only set in the environment; run init to create a config file to add them to")
+	}
+
+	playlists, err := takeout.Read(dir)
+	if err != nil {
+		return err
+	}
+	if len(playlists) == 0 {
+		return fmt.Errorf("no playlists found in %s; point import-takeout at the unpacked export", dir)
+	}
+
+	// Playlists already watched, by ID, so none is added twice
+	watched := make(map[string]bool, len(cfg.Playlists))
+	for _, p := range cfg.Playlists {
+		watched[downloader.PlaylistID(p.URL)] = true
+	}
+
+	var total database.KnownImportStats
+	malformed := 0
+	for _, p := range playlists {
+		// A playlist without an ID is kept under its name, as import-archive does
+		playlistID, name := p.YoutubeID, p.Name
+		if playlistID == "" {
+			playlistID, name = importPlaylist(cfg, p.Name)
+		}
+		videos := make([]database.KnownVideo, len(p.Videos))
+		for i, v := range p.Videos {
+			videos[i] = database.KnownVideo{YoutubeID: v.YoutubeID, AddedAt: v.AddedAt}
+		}
+		stats, err := db.ImportKnownVideos(playlistID, name, videos)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		fmt.Fprintf(w, "%s (%s): %d listed, %d new, %d already downloaded", name, playlistID, len(videos), stats.Imported, stats.Downloaded)
+		if p.Malformed > 0 {
+			fmt.Fprintf(w, ", %d malformed rows skipped", p.Malformed)
+		}
+		fmt.Fprintln(w)
+		total.Imported += stats.Imported
+		total.Existing += stats.Existing
+		total.Downloaded += stats.Downloaded
+		malformed += p.Malformed
+
+		if !*download {
+			continue
+		}
+		switch _, named := cfg.Playlists[name]; {
+		case p.YoutubeID == "":
+			fmt.Fprintf(w, "  not downloading: the export has no playlist ID\n")
+		case watched[p.YoutubeID] || named:
+			fmt.Fprintf(w, "  already in the config\n")
+		default:
+			if err := addPlaylist(cfg, name, "https://www.youtube.com/playlist?list="+url.QueryEscape(p.YoutubeID)); err != nil {
+				return err
+			}
+			watched[p.YoutubeID] = true
+		}
+	}
+
+	slog.Info("Imported takeout", "playlists", len(playlists), "imported", total.Imported, "existing", total.Existing,
+		"downloaded", total.Downloaded, "malformed_rows", malformed)
+	return nil
+}
+
+// backup writes a verified copy of the database to path, or a timestamped
+// one in BackupDir when path is empty
+func backup(cfg *config.Config, db *database.Database, path string) error {
+	if path == "" {
+		var err error
+		if path, err = backupDatabase(cfg, db); err != nil {
+			return err
+		}
+	} else if err := db.Backup(path); err != nil {
+		return err
+	}
+	slog.Info("Backed up the database", "path", path)
+	return nil
+}
+
+// relocate rewrites recorded file paths for a library moved from oldDir to newDir
+func relocate(db *database.Database, oldDir, newDir string) error {
+	n, err := db.RelocatePaths(oldDir, newDir)
+	if err != nil {
+		return err
+	}
+	slog.Info("Relocated file paths", "count", n, "from", oldDir, "to", newDir)
+	return nil
+}
+
+// maintenance runs the housekeeping steps selected by args and prints what
+// they did
+func maintenance(cfg *config.Config, db *database.Database, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("maintenance", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	purge := fs.Bool("purge-playlists", false, "delete playlists missing from playlists.json")
+	pendingDays := fs.Int("pending-days", 0, "delete videos pending without a file for this many days")
+	vacuum := fs.Bool("vacuum", false, "rebuild the database file to reclaim space")
+	dryRun := fs.Bool("dry-run", false, "only report what would be deleted")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *pendingDays < 0 {
+		return fmt.Errorf("invalid maintenance arguments\n%s", usage)
+	}
+
+	opts := database.HousekeepingOptions{
+		PurgePlaylists: *purge,
+		PendingMaxAge:  time.Duration(*pendingDays) * 24 * time.Hour,
+		Vacuum:         *vacuum,
+		DryRun:         *dryRun,
+	}
+	if *purge {
+		// An empty or unreadable playlists.json would otherwise purge everything
+		if len(cfg.Playlists) == 0 {
+			return fmt.Errorf("no playlists configured; refusing to purge every playlist")
+		}
+		for _, pl := range cfg.Playlists {
+			opts.KeepPlaylists = append(opts.KeepPlaylists, downloader.PlaylistID(pl.URL))
+		}
+	}
+
+	report, err := db.Housekeeping(opts)
+	if err != nil {
+		return err
+	}
+
+	verb := "Deleted"
+	if *dryRun {
+		verb = "Would delete"
+	}
+	for _, id := range report.PurgedPlaylists {
+		fmt.Fprintf(w, "%s playlist %s\n", verb, id)
+	}
+	for _, id := range report.SharedPlaylists {
+		fmt.Fprintf(w, "Kept playlist %s: configured playlists share its videos\n", id)
+	}
+	if *purge {
+		fmt.Fprintf(w, "%s %d playlists with %d videos\n", verb, len(report.PurgedPlaylists), report.PurgedVideos)
+	}
+	if *pendingDays > 0 {
+		fmt.Fprintf(w, "%s %d videos pending for over %d days\n", verb, report.PurgedPending, *pendingDays)
+	}
+	if *dryRun {
+		fmt.Fprintln(w, "Dry run: nothing was changed")
+		return nil
+	}
+	fmt.Fprintln(w, "Optimized the database")
+	if report.Vacuumed {
+		fmt.Fprintf(w, "Vacuumed the database, freeing %s\n", formatBytes(report.FreedBytes))
+	}
+	return nil
+}
+
+// orphans lists media files no video points at, optionally adopting or
+// deleting them
+func orphans(cfg *config.Config, db *database.Database, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("orphans", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	adopt := fs.Bool("adopt", false, "record files by the video ID in their name")
+	remove := fs.Bool("delete", false, "delete the files")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || (*adopt && *remove) {
+		return fmt.Errorf("invalid orphans arguments\n%s", usage)
+	}
+
+	v := validator.NewValidator(db, cfg.MusicParentDir, 0, validator.Options{})
+	files, err := v.FindOrphans()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SIZE\tVIDEO\tFILE")
+	var total int64
+	for _, f := range files {
+		id := f.YoutubeID
+		if id == "" {
+			id = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", formatBytes(f.Size), id, f.Path)
+		total += f.Size
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d orphaned files, %s\n", len(files), formatBytes(total))
+
+	switch {
+	case *adopt:
+		// Configured playlists keep their friendly names
+		playlists := make(map[string]string)
+		for name, pl := range cfg.Playlists {
+			id := downloader.PlaylistID(pl.URL)
+			if _, err := db.GetOrCreatePlaylist(id, name); err != nil {
+				return err
+			}
+			dir := filename.Sanitize(name, id)
+			if pl.OutputSubdir != "" {
+				dir = pl.OutputSubdir
+			}
+			playlists[filepath.Join(cfg.MusicParentDir, dir)] = id
+		}
+		adopted, err := v.AdoptOrphans(files, playlists)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Adopted %d files\n", adopted)
+	case *remove:
+		deleted, freed := v.DeleteOrphans(files)
+		fmt.Fprintf(w, "Deleted %d files, freeing %s\n", deleted, formatBytes(freed))
+	}
+	return nil
+}
+
+// validate checks every file now, lists the missing and corrupt ones and
+// optionally writes the report as JSON and cleans up missing rows
+func validate(cfg *config.Config, db *database.Database, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	deep := fs.Bool("deep", false, "re-hash and probe every file")
+	reportPath := fs.String("report", "", "write the report as JSON to this file")
+	cleanup := fs.Bool("cleanup", false, "delete the rows of files still missing")
+	dryRun := fs.Bool("dry-run", false, "only list the rows --cleanup would delete")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || (*dryRun && !*cleanup) {
+		return fmt.Errorf("invalid validate arguments\n%s", usage)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	opts := validator.Options{
+		MaxBytesPerSecond:        cfg.ValidationMaxRate,
+		ReportPath:               *reportPath,
+		FFprobePath:              cfg.FFprobePath,
+		Workers:                  cfg.ValidationWorkers,
+		DurationTolerance:        cfg.DurationTolerance,
+		DurationTolerancePercent: cfg.DurationTolerancePercent,
+	}
+	// Files only kept remotely are checked there with --deep
+	uploads, err := newUploadQueue(cfg, db, slog.Default())
+	if err != nil {
+		return err
+	}
+	if uploads != nil {
+		opts.StatRemote = uploads.Stat
+	}
+	v := validator.NewValidator(db, cfg.MusicParentDir, 0, opts)
+	report, err := v.ValidateAll(ctx, *deep)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tVIDEO\tTITLE\tFILE\tPROBLEM")
+	for _, e := range report.Broken {
+		problem := e.Error
+		if problem == "" {
+			problem = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Status, e.YoutubeID, e.Title, e.FilePath, problem)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Checked %d files: %d videos, %d missing, %d corrupt\n", report.Checked, report.Total,
+		report.Counts[database.StatusMissing], report.Counts[database.StatusCorrupt])
+
+	if *cleanup {
+		removed, err := v.CleanupMissingFiles(*dryRun)
+		if err != nil {
+			return err
+		}
+		for _, video := range removed {
+			fmt.Fprintf(w, "%s\t%s\n", video.YoutubeID, video.Title)
+		}
+		if *dryRun {
+			fmt.Fprintf(w, "Would delete %d rows of missing files\n", len(removed))
+		} else {
+			fmt.Fprintf(w, "Deleted %d rows of missing files\n", len(removed))
+		}
+	}
+	return nil
+}
+
+// cleanup deletes leftover yt-dlp temp files from the library and, with
+// --staging, interrupted downloads from TEMP_DIR. Only use --staging while
+// the watcher is stopped, or it deletes downloads in progress.
+func cleanup(cfg *config.Config, db *database.Database, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	maxAge := fs.Duration("max-age", cfg.TempFileMaxAge, "only delete temp files older than this")
+	dryRun := fs.Bool("dry-run", false, "only list the temp files that would be deleted")
+	staging := fs.Bool("staging", false, "also empty the staging directory")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || (*staging && *dryRun) {
+		return fmt.Errorf("invalid cleanup arguments\n%s", usage)
+	}
+
+	v := validator.NewValidator(db, cfg.MusicParentDir, 0, validator.Options{})
+	stats, err := v.CleanupTempFiles(*maxAge, *dryRun)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintf(w, "Would delete %d temp files, %s\n", stats.Files, formatBytes(stats.Bytes))
+	} else {
+		fmt.Fprintf(w, "Deleted %d temp files, %s\n", stats.Files, formatBytes(stats.Bytes))
+	}
+
+	if *staging {
+		return newDownloader(cfg, db, nil, nil, nil, slog.Default()).CleanStaging()
+	}
+	return nil
+}
+
+// residecar writes the sidecars of downloaded videos again from the
+// database, e.g. after turning sidecars on for an existing library or
+// changing the tag settings. Videos whose files are missing are skipped.
+func residecar(cfg *config.Config, db *database.Database, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("residecar", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", cfg.SidecarFormat, "nfo or json")
+	playlist := fs.String("playlist", "", "only this playlist's videos")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf("invalid residecar arguments\n%s", usage)
+	}
+	if !slices.Contains(sidecar.Formats, *format) {
+		return fmt.Errorf("residecar needs --format nfo or json when SIDECAR_FORMAT isn't set\n%s", usage)
+	}
+
+	var opts database.ListOptions
+	if *playlist != "" {
+		opts.PlaylistYoutubeID, _ = importPlaylist(cfg, *playlist)
+	}
+	videos, err := db.ExportedVideos(opts)
+	if err != nil {
+		return err
+	}
+
+	dl := newDownloader(cfg, db, nil, nil, nil, slog.Default())
+	positions := make(map[string]map[string]int) // Playlist to video to position
+	var written, failed int
+	for _, v := range videos {
+		owner := v.Playlist.YoutubeID
+		if positions[owner] == nil {
+			entries, err := db.GetPlaylistVideosOrdered(owner)
+			if err != nil {
+				return err
+			}
+			positions[owner] = make(map[string]int, len(entries))
+			for _, e := range entries {
+				positions[owner][e.YoutubeID] = e.Position
+			}
+		}
+
+		name, plOpts := ownerPlaylist(cfg, owner, v.Playlist.Title)
+		n, err := dl.RewriteSidecars(v, *format, positions[owner][v.YoutubeID], name, plOpts)
+		written += n
+		if err != nil {
+			failed++
+			slog.Warn("Failed to write sidecar", "video_id", v.YoutubeID, "error", err)
+		}
+	}
+
+	fmt.Fprintf(w, "Wrote %d sidecars\n", written)
+	if failed > 0 {
+		return fmt.Errorf("failed to write the sidecars of %d videos", failed)
+	}
+	return nil
+}
+
+// listPlaylists prints the configured playlists with when each was last
+// checked
+func listPlaylists(cfg *config.Config, db *database.Database, w io.Writer) error {
+	schedules, err := db.GetPlaylistSchedules()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(cfg.Playlists))
+	for name := range cfg.Playlists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tENABLED\tTYPE\tINTERVAL\tLAST CHECKED\tURL")
+	for _, name := range names {
+		p := cfg.Playlists[name]
+		schedule := schedules[downloader.PlaylistID(p.URL)]
+		checked := "never"
+		if !schedule.LastChecked.IsZero() {
+			checked = schedule.LastChecked.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%t\t%s\t%s\t%s\t%s\n", name, p.IsEnabled(), cfg.PlaylistMediaType(p),
+			cfg.PlaylistInterval(p, schedule.LastChanged), checked, p.URL)
+	}
+	return tw.Flush()
+}
+
+// exportArchive writes the archive to path, or stdout when path is empty
+func exportArchive(db *database.Database, path string) error {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := db.ExportArchive(w)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Exported videos", "count", count)
+	return nil
+}
+
+// listFailures writes a table of videos that failed on at least minAttempts passes
+func listFailures(db *database.Database, w io.Writer, minAttempts int) error {
+	failed, err := db.GetFailedVideos(minAttempts)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VIDEO\tPLAYLIST\tATTEMPTS\tCLASS\tEXIT\tLAST ATTEMPT\tERROR")
+	for _, f := range failed {
+		exit := "-"
+		if f.ExitCode != 0 {
+			exit = strconv.Itoa(f.ExitCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", f.YoutubeID, f.PlaylistYoutubeID, f.Attempts, f.ErrorClass, exit,
+			f.LastAttemptAt.Local().Format("2006-01-02 15:04"), errorSummary(f.LastError))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	slog.Info("Listed failed videos", "count", len(failed), "min_attempts", minAttempts)
+	return nil
+}
+
+// exportVideos parses the export command's flags and writes the matching
+// videos to the given file, or stdout
+func exportVideos(cfg *config.Config, db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", database.ExportJSON, "json or csv")
+	playlist := fs.String("playlist", "", "only videos in this playlist")
+	since := fs.String("since", "", "only videos downloaded after this date")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return fmt.Errorf("invalid export arguments\n%s", usage)
+	}
+
+	var opts database.ListOptions
+	if *playlist != "" {
+		_, pl := resolvePlaylist(cfg, *playlist)
+		opts.PlaylistYoutubeID = downloader.PlaylistID(pl.URL)
+	}
+	if *since != "" {
+		t, err := parseDate(*since)
+		if err != nil {
+			return err
+		}
+		opts.DownloadedAfter = t
+	}
+
+	var w io.Writer = os.Stdout
+	if fs.NArg() == 1 {
+		f, err := os.Create(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	return db.ExportVideos(w, *format, opts)
+}
+
+// parseDate accepts an RFC3339 timestamp or a plain 2006-01-02 date in UTC
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD or RFC3339", s)
+	}
+	return t, nil
+}
+
+// searchLimit caps the results printed by the search command
+const searchLimit = 50
+
+// searchVideos writes a table of the videos best matching query
+func searchVideos(db *database.Database, w io.Writer, query string) error {
+	videos, err := db.SearchVideos(query, searchLimit)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TITLE\tCHANNEL\tPLAYLIST\tFILE")
+	for _, v := range videos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Title, v.Channel, v.PlaylistTitle, v.FilePath)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	slog.Info("Searched videos", "count", len(videos), "query", query)
+	return nil
+}
+
+// showStatusCounts prints every playlist's video counts by status
+func showStatusCounts(db *database.Database, w io.Writer) error {
+	playlists, err := db.GetPlaylistStatusCounts()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLAYLIST\tVIDEOS")
+	for _, p := range playlists {
+		fmt.Fprintf(tw, "%s\t%s\n", p.Title, formatStatusCounts(p.Counts))
+	}
+	return tw.Flush()
+}
+
+// listVideosByStatus prints the videos with a status, with the latest
+// error for ones that failed
+func listVideosByStatus(db *database.Database, w io.Writer, status string) error {
+	videos, err := db.GetVideosByStatus(status)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VIDEO\tTITLE\tPLAYLIST\tRETRIES\tFILE\tLAST ERROR")
+	for _, v := range videos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", v.YoutubeID, v.Title, v.PlaylistYoutubeID, v.RetryCount, v.FilePath, errorSummary(v.LastError))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	slog.Info("Listed videos", "count", len(videos), "status", status)
+	return nil
+}
+
+// removeVideo deletes a video from the library, optionally keeping its file
+// and marking it so it is never downloaded again. A video that was never
+// downloaded can still be ignored.
+func removeVideo(db *database.Database, youtubeID string, deleteFile, ignore bool) error {
+	err := db.DeleteVideo(youtubeID, deleteFile)
+	if err != nil && !(ignore && errors.Is(err, sql.ErrNoRows)) {
+		return err
+	}
+	if err == nil {
+		slog.Info("Removed video", "video_id", youtubeID)
+	}
+
+	if ignore {
+		if err := db.IgnoreVideo(youtubeID, "removed"); err != nil {
+			return err
+		}
+		slog.Info("Video will not be downloaded again", "video_id", youtubeID)
+	}
+	return nil
+}
+
+// blockVideo makes sure no playlist downloads or links a video, optionally
+// deleting it if it was downloaded before
+func blockVideo(db *database.Database, youtubeID string, purge bool) error {
+	if err := db.IgnoreVideo(youtubeID, database.IgnoreBlocked); err != nil {
+		return err
+	}
+	slog.Info("Blocked video", "video_id", youtubeID)
+
+	if !purge {
+		return nil
+	}
+	err := db.DeleteVideo(youtubeID, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Info("Video was never downloaded", "video_id", youtubeID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	slog.Info("Deleted video", "video_id", youtubeID)
+	return nil
+}
+
+// toolSettings are the external tools init looks for, by the setting
+// holding their path
+var toolSettings = []struct{ key, name string }{
+	{"FFMPEG_PATH", "ffmpeg"},
+	{"FFPROBE_PATH", "ffprobe"},
+	{"YTDLP_PATH", "yt-dlp"},
+}
+
+// initConfig parses the init command's flags and writes a starter config
+// where LoadConfig looks for it, with the paths of the tools lookPath finds.
+// An existing file is only replaced with --force.
+func initConfig(args []string, lookPath func(string) (string, error)) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", config.FormatYAML, "yaml, json or env")
+	force := fs.Bool("force", false, "overwrite an existing file")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return fmt.Errorf("invalid init arguments\n%s", usage)
+	}
+	path, err := config.ExamplePath(*format)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]string)
+	for _, tool := range toolSettings {
+		toolPath, err := lookPath(tool.name)
+		if err != nil {
+			slog.Warn("Tool not found on PATH; set its path once it's installed", "tool", tool.name, "setting", tool.key)
+			continue
+		}
+		if abs, err := filepath.Abs(toolPath); err == nil {
+			toolPath = abs
+		}
+		slog.Info("Found tool", "tool", tool.name, "path", toolPath)
+		found[tool.key] = toolPath
+	}
+	if *format == config.FormatJSON && len(found) > 0 {
+		slog.Info("playlists.json only holds playlists; set the tool paths in the environment if they differ from the defaults")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, mode, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists; use --force to overwrite it", path)
+	} else if err != nil {
+		return err
+	}
+	if err := config.WriteExample(f, *format, found); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	slog.Info("Wrote a starter config; replace the example playlists with yours", "path", path)
+	return nil
+}
+
+// addPlaylist adds a playlist to the file the playlists are read from,
+// once its URL is known to be usable
+func addPlaylist(cfg *config.Config, name, url string) error {
+	if err := downloader.ValidateURL(url); err != nil {
+		return err
+	}
+	if _, ok := cfg.Playlists[name]; ok {
+		return fmt.Errorf("playlist %q already exists", name)
+	}
+	path := cfg.PlaylistsFile()
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("the playlists are only set in the environment; add %s to PLAYLISTS or run init to create a config file", name)
+	}
+	if err := config.AddPlaylist(path, name, url); err != nil {
+		return err
+	}
+	slog.Info("Added playlist", "playlist", name, "path", path)
+	return nil
+}
+
+// errorSummary picks the most useful line of a stored error: yt-dlp's last
+// ERROR line, or the first line otherwise
+func errorSummary(msg string) string {
+	lines := strings.Split(strings.TrimSpace(msg), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); strings.HasPrefix(line, "ERROR:") {
+			return line
+		}
+	}
+	return strings.TrimSpace(lines[0])
+}
+
+// resolvePlaylist looks up a playlist by its name in playlists.json, falling
+// back to treating it as a URL or ID with default settings
+func resolvePlaylist(cfg *config.Config, playlist string) (string, config.PlaylistConfig) {
+	if pl, ok := cfg.Playlists[playlist]; ok {
+		return playlist, pl
+	}
+	return downloader.PlaylistID(playlist), config.PlaylistConfig{URL: playlist}
+}
+
+// runTrial processes one playlist a single time against a throwaway database
+// and library, then prints what was recorded. Useful for trying settings
+// without touching the real library.
+func runTrial(cfg *config.Config, playlist string) error {
+	name, pl := resolvePlaylist(cfg, playlist)
+
+	dir, err := os.MkdirTemp("", "pp-downloader-trial-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	db, err := database.NewDatabase(filepath.Join(dir, "trial.db"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	trialCfg := *cfg
+	trialCfg.MusicParentDir = filepath.Join(dir, "music")
+	trialCfg.TempDir = ""
+	if err := db.SetLibraryRoot(trialCfg.MusicParentDir); err != nil {
+		return err
+	}
+	slog.Info("Downloading playlist", "playlist", name, "dir", trialCfg.MusicParentDir)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	dl := newDownloader(&trialCfg, db, nil, nil, nil, slog.Default())
+	if err := dl.ProcessPlaylist(ctx, pl.URL, name, playlistOptions(&trialCfg, pl), nil); err != nil {
+		return err
+	}
+	return listRecent(db, os.Stdout, 20)
+}
+
+// listRecent writes a table of the most recently downloaded videos
+func listRecent(db *database.Database, w io.Writer, limit int) error {
+	videos, err := db.ListVideos(database.ListOptions{Limit: limit})
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VIDEO\tPLAYLIST\tDOWNLOADED\tTITLE\tFILE")
+	for _, v := range videos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", v.YoutubeID, v.PlaylistTitle, v.DownloadedAt.Local().Format("2006-01-02 15:04"), v.Title, v.FilePath)
+	}
+	return tw.Flush()
+}
+
+// showStats writes per-playlist statistics as a table, or as JSON. Files
+// below lowBitrate bits per second are counted as low bitrate.
+func showStats(db *database.Database, w io.Writer, lowBitrate int, asJSON bool) error {
+	stats, err := db.GetPlaylistStats(lowBitrate)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLAYLIST\tVIDEOS\tLINKED\tDOWNLOADED\tMISSING\tFAILED\tLOW BITRATE\tSIZE\tDURATION\tLAST CHECKED")
+	for _, s := range append(stats.Playlists, stats.Total) {
+		lastChecked := "-"
+		if !s.LastChecked.IsZero() {
+			lastChecked = s.LastChecked.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", s.Title, s.Videos, s.Linked, s.Downloaded, s.Missing, s.Failed, s.LowBitrate,
+			formatBytes(s.SizeBytes), formatHours(s.Duration), lastChecked)
+	}
+	return tw.Flush()
+}
+
+// showStorage writes the free space left for downloads and a table of
+// playlists by the space their files take up
+func showStorage(cfg *config.Config, db *database.Database, w io.Writer) error {
+	stats, err := db.GetStorageStats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Library: %d files, %s\n", stats.Videos, formatBytes(stats.Bytes))
+	if free, err := downloader.FreeSpace(cfg.MusicParentDir); err != nil {
+		fmt.Fprintf(w, "Free: unknown (%v)\n", err)
+	} else if cfg.MinFreeSpace > 0 {
+		fmt.Fprintf(w, "Free: %s in %s, downloads pause below %s\n", formatBytes(free), cfg.MusicParentDir, formatBytes(cfg.MinFreeSpace))
+	} else {
+		fmt.Fprintf(w, "Free: %s in %s\n", formatBytes(free), cfg.MusicParentDir)
+	}
+	fmt.Fprintln(w)
+
+	// Shared videos count towards every playlist they are in
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLAYLIST\tFILES\tSIZE\tSHARE")
+	for _, p := range stats.Playlists {
+		share := 0.0
+		if stats.Bytes > 0 {
+			share = float64(p.Bytes) / float64(stats.Bytes) * 100
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.0f%%\n", p.Title, p.Videos, formatBytes(p.Bytes), share)
+	}
+	return tw.Flush()
+}
+
+// formatBytes formats a size with a binary unit, e.g. 1.5 GiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatHours formats seconds as hours and minutes, e.g. 12h05m
+func formatHours(seconds int64) string {
+	return fmt.Sprintf("%dh%02dm", seconds/3600, seconds%3600/60)
+}
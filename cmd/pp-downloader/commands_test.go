@@ -0,0 +1,719 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/sidecar"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveCommands(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg := &config.Config{Playlists: map[string]config.PlaylistConfig{
+		"jazz": {URL: "https://www.youtube.com/playlist?list=PL_JAZZ"},
+	}}
+
+	archive := filepath.Join(dir, "archive.txt")
+	require.NoError(t, os.WriteFile(archive, []byte("youtube aaaaaaaaaaa\nyoutube bbbbbbbbbbb\n"), 0644))
+	require.NoError(t, runCommand(cfg, db, []string{"import-archive", archive, "jazz"}))
+
+	// The configured name resolves to the playlist ID and keeps its title
+	playlist, err := db.GetOrCreatePlaylist("PL_JAZZ", "ignored")
+	require.NoError(t, err)
+	assert.Equal(t, "jazz", playlist.Title)
+	assert.Equal(t, 2, playlist.VideoCount)
+
+	exported := filepath.Join(dir, "export.txt")
+	require.NoError(t, runCommand(cfg, db, []string{"export-archive", exported}))
+	data, err := os.ReadFile(exported)
+	require.NoError(t, err)
+	assert.Equal(t, "youtube aaaaaaaaaaa\nyoutube bbbbbbbbbbb\n", string(data))
+
+	assert.Error(t, runCommand(cfg, db, []string{"import-archive", archive}))
+	assert.Error(t, runCommand(cfg, db, []string{"bogus"}))
+}
+
+func TestFailuresCommand(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.RecordDownloadFailure("blockedvid01", "PL_A", "yt-dlp download failed: exit status 1\nOutput: [youtube] x\nERROR: [youtube] blockedvid01: not made this video available in your country", true))
+		require.NoError(t, db.RecordDownloadAttempt(database.DownloadAttempt{YoutubeID: "blockedvid01", ErrorClass: "blocked", ExitCode: 1}))
+	}
+	require.NoError(t, db.RecordDownloadFailure("oncevid0001", "PL_A", "timed out", false))
+
+	var out strings.Builder
+	require.NoError(t, listFailures(db, &out, 2))
+	assert.Contains(t, out.String(), "blockedvid01")
+	assert.Contains(t, out.String(), "ERROR: [youtube] blockedvid01: not made this video available in your country")
+	assert.NotContains(t, out.String(), "oncevid0001")
+
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"failures", "zero"}))
+}
+
+func TestStatusCommand(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.GetOrCreatePlaylist("PL_A", "Jazz")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_A", "Jazz", database.DownloadRecord{
+		YoutubeID: "goodvid0001",
+		Metadata:  database.VideoMetadata{Title: "Song"},
+		FilePath:  "/music/Jazz/Song.mp3",
+	}))
+	require.NoError(t, db.RecordDownloadFailure("badvid00001", "PL_A", "timed out", false))
+
+	var out strings.Builder
+	require.NoError(t, runCommand(&config.Config{}, db, []string{"status"}))
+	require.NoError(t, showStatusCounts(db, &out))
+	assert.Contains(t, out.String(), "Jazz")
+	assert.Contains(t, out.String(), "1 valid, 1 failed")
+
+	out.Reset()
+	require.NoError(t, listVideosByStatus(db, &out, "failed"))
+	assert.Contains(t, out.String(), "badvid00001")
+	assert.Contains(t, out.String(), "timed out")
+	assert.NotContains(t, out.String(), "goodvid0001")
+
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"status", "bogus"}))
+}
+
+func TestRelocateCommand(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.GetOrCreatePlaylist("PL_A", "A")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_A", "A", database.DownloadRecord{YoutubeID: "aaaaaaaaaaa", FilePath: "/music/A/a.mp3"}))
+	require.NoError(t, db.SetLibraryRoot("/mnt/tank/music"))
+
+	cfg := &config.Config{MusicParentDir: "/mnt/tank/music"}
+	require.NoError(t, runCommand(cfg, db, []string{"relocate", "/music"}))
+	path, err := db.GetFilePath("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/tank/music/A/a.mp3", path)
+
+	assert.Error(t, runCommand(cfg, db, []string{"relocate"}))
+}
+
+func TestMaintenanceCommand(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, id := range []string{"PLkept", "PLgone"} {
+		_, err = db.GetOrCreatePlaylist(id, id)
+		require.NoError(t, err)
+		require.NoError(t, db.RecordDownload(id, id, database.DownloadRecord{YoutubeID: id + "vid", FilePath: "/music/" + id + ".mp3"}))
+	}
+	cfg := &config.Config{Playlists: map[string]config.PlaylistConfig{
+		"Kept": {URL: "https://www.youtube.com/playlist?list=PLkept"},
+	}}
+
+	var out strings.Builder
+	require.NoError(t, maintenance(cfg, db, &out, []string{"--purge-playlists", "--dry-run"}))
+	assert.Contains(t, out.String(), "Would delete playlist PLgone")
+	assert.Contains(t, out.String(), "nothing was changed")
+	exists, err := db.VideoExists("PLgonevid")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	out.Reset()
+	require.NoError(t, maintenance(cfg, db, &out, []string{"--purge-playlists", "--pending-days", "30", "--vacuum"}))
+	assert.Contains(t, out.String(), "Deleted 1 playlists with 1 videos")
+	assert.Contains(t, out.String(), "Deleted 0 videos pending for over 30 days")
+	assert.Contains(t, out.String(), "Vacuumed")
+	exists, err = db.VideoExists("PLgonevid")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = db.VideoExists("PLkeptvid")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.Error(t, maintenance(&config.Config{}, db, &out, []string{"--purge-playlists"}), "Nothing configured")
+	assert.Error(t, runCommand(cfg, db, []string{"maintenance", "--pending-days", "-1"}))
+}
+
+func TestRemoveCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	path := filepath.Join(dir, "song [aaaaaaaaaaa].mp3")
+	require.NoError(t, os.WriteFile(path, []byte("audio"), 0644))
+	_, err = db.GetOrCreatePlaylist("PL_A", "A")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_A", "A", database.DownloadRecord{YoutubeID: "aaaaaaaaaaa", FilePath: path, FileSize: 5}))
+
+	require.NoError(t, runCommand(&config.Config{}, db, []string{"remove", "aaaaaaaaaaa", "--ignore"}))
+	assert.NoFileExists(t, path)
+	ignored, err := db.IsIgnored("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.True(t, ignored)
+
+	// Videos that were never downloaded can be ignored, but not just removed
+	require.NoError(t, runCommand(&config.Config{}, db, []string{"remove", "bbbbbbbbbbb", "--ignore"}))
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"remove", "bbbbbbbbbbb"}))
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"remove", "--ignore"}))
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"remove", "aaaaaaaaaaa", "--force"}))
+}
+
+func TestBlockCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	path := filepath.Join(dir, "loop [aaaaaaaaaaa].mp3")
+	require.NoError(t, os.WriteFile(path, []byte("audio"), 0644))
+	_, err = db.GetOrCreatePlaylist("PL_A", "A")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_A", "A", database.DownloadRecord{YoutubeID: "aaaaaaaaaaa", FilePath: path, FileSize: 5}))
+
+	// Without --purge the file is kept
+	require.NoError(t, runCommand(&config.Config{}, db, []string{"block", "aaaaaaaaaaa"}))
+	assert.FileExists(t, path)
+	blocked, err := db.BlockedVideoIDs()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"aaaaaaaaaaa": true}, blocked)
+
+	require.NoError(t, runCommand(&config.Config{}, db, []string{"block", "aaaaaaaaaaa", "--purge"}))
+	assert.NoFileExists(t, path)
+	require.NoError(t, runCommand(&config.Config{}, db, []string{"block", "bbbbbbbbbbb", "--purge"}), "Videos never downloaded can be blocked")
+	blocked, err = db.BlockedVideoIDs()
+	require.NoError(t, err)
+	assert.Len(t, blocked, 2)
+
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"block", "--purge"}))
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"block", "aaaaaaaaaaa", "--force"}))
+}
+
+func TestInitCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	t.Setenv("CONFIG_FILE", path)
+	lookPath := func(name string) (string, error) {
+		if name == "yt-dlp" {
+			return "", exec.ErrNotFound
+		}
+		return "/opt/bin/" + name, nil
+	}
+
+	require.NoError(t, initConfig(nil, lookPath))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\nffmpeg_path: /opt/bin/ffmpeg\n", "Found tools are filled in")
+	assert.Contains(t, string(data), "\n# ytdlp_path: yt-dlp\n", "Missing tools keep their default")
+
+	require.NoError(t, os.WriteFile(path, []byte("kept\n"), 0644))
+	assert.ErrorContains(t, initConfig(nil, lookPath), "--force")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "kept\n", string(data), "An existing config is never overwritten")
+	require.NoError(t, initConfig([]string{"--force"}, lookPath))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "playlists:")
+
+	t.Setenv("JSON_PATH", filepath.Join(dir, "json", "playlists.json"))
+	require.NoError(t, initConfig([]string{"--format", "json"}, lookPath))
+	assert.FileExists(t, filepath.Join(dir, "json", "playlists.json"))
+
+	assert.Error(t, initConfig([]string{"--format", "toml"}, lookPath))
+	assert.Error(t, initConfig([]string{"extra"}, lookPath))
+}
+
+func TestAddPlaylistCommand(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	jsonPath := filepath.Join(dir, "playlists.json")
+	t.Setenv("JSON_PATH", jsonPath)
+	t.Setenv("MUSIC_PARENT_DIR", dir)
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"playlists": {"jazz": "PL_JAZZ"}}`), 0644))
+	cfg, err := config.LoadConfig(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, runCommand(cfg, db, []string{"add-playlist", "talks", "https://www.youtube.com/playlist?list=PL_TALKS"}))
+	cfg, err = config.LoadConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.youtube.com/playlist?list=PL_TALKS", cfg.Playlists["talks"].URL)
+
+	assert.ErrorContains(t, runCommand(cfg, db, []string{"add-playlist", "jazz", "PL_OTHER"}), "already exists")
+	assert.Error(t, runCommand(cfg, db, []string{"add-playlist", "news", "https://example.com/feed"}), "The URL is checked first")
+	assert.Error(t, runCommand(cfg, db, []string{"add-playlist", "news"}))
+
+	// Playlists only in the environment have no file to add to
+	require.NoError(t, os.Remove(jsonPath))
+	t.Setenv("PLAYLISTS", "jazz=PL_JAZZ")
+	cfg, err = config.LoadConfig(dir)
+	require.NoError(t, err)
+	assert.ErrorContains(t, runCommand(cfg, db, []string{"add-playlist", "talks", "PL_TALKS"}), "PLAYLISTS")
+}
+
+func TestImportTakeoutCommand(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	jsonPath := filepath.Join(dir, "playlists.json")
+	t.Setenv("JSON_PATH", jsonPath)
+	t.Setenv("MUSIC_PARENT_DIR", dir)
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"playlists": {"jazz": "PL_JAZZ"}}`), 0644))
+	cfg, err := config.LoadConfig(dir)
+	require.NoError(t, err)
+
+	export := filepath.Join(dir, "Takeout", "YouTube and YouTube Music", "playlists")
+	require.NoError(t, os.MkdirAll(export, 0755))
+	for name, content := range map[string]string{
+		"playlists.csv": "Playlist ID,Add new videos to top,Playlist Title (Original),Playlist Visibility\n" +
+			"PL_JAZZ,False,Jazz,Private\nPL_TALKS,False,Talks,Private\n",
+		"Jazz-videos.csv":        "Video ID,Playlist Video Creation Timestamp\naaaaaaaaaaa,2023-01-01T10:00:00+00:00\n",
+		"Talks-videos.csv":       "Video ID,Playlist Video Creation Timestamp\nbbbbbbbbbbb,2023-01-01T10:00:00+00:00\nbad,\n",
+		"Watch later-videos.csv": "Video ID,Playlist Video Creation Timestamp\nccccccccccc,\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(export, name), []byte(content), 0644))
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, importTakeout(cfg, db, &out, []string{filepath.Join(dir, "Takeout"), "--download"}))
+	assert.Equal(t, "Jazz (PL_JAZZ): 1 listed, 1 new, 0 already downloaded\n"+
+		"  already in the config\n"+
+		"Talks (PL_TALKS): 1 listed, 1 new, 0 already downloaded, 1 malformed rows skipped\n"+
+		"Watch later (Watch later): 1 listed, 1 new, 0 already downloaded\n"+
+		"  not downloading: the export has no playlist ID\n", out.String())
+
+	known, err := db.GetKnownVideos("PL_TALKS")
+	require.NoError(t, err)
+	require.Len(t, known, 1)
+	assert.Equal(t, "bbbbbbbbbbb", known[0].YoutubeID)
+	existing, err := db.GetExistingVideoIDs([]string{"aaaaaaaaaaa", "bbbbbbbbbbb"})
+	require.NoError(t, err)
+	assert.Empty(t, existing, "Known videos are left to download")
+
+	cfg, err = config.LoadConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.youtube.com/playlist?list=PL_TALKS", cfg.Playlists["Talks"].URL)
+	assert.Len(t, cfg.Playlists, 2)
+
+	// Running it again changes nothing
+	out.Reset()
+	require.NoError(t, importTakeout(cfg, db, &out, []string{"--download", filepath.Join(dir, "Takeout")}))
+	assert.Contains(t, out.String(), "Talks (PL_TALKS): 1 listed, 0 new, 0 already downloaded, 1 malformed rows skipped\n  already in the config\n")
+	cfg, err = config.LoadConfig(dir)
+	require.NoError(t, err)
+	assert.Len(t, cfg.Playlists, 2)
+
+	assert.ErrorContains(t, importTakeout(cfg, db, &out, []string{dir + "/music"}), "no such file")
+	assert.Error(t, importTakeout(cfg, db, &out, nil))
+}
+
+func TestExportCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg := &config.Config{Playlists: map[string]config.PlaylistConfig{
+		"jazz": {URL: "https://www.youtube.com/playlist?list=PL_JAZZ"},
+	}}
+	for _, playlist := range []string{"PL_JAZZ", "PL_ROCK"} {
+		_, err := db.GetOrCreatePlaylist(playlist, playlist)
+		require.NoError(t, err)
+		require.NoError(t, db.RecordDownload(playlist, playlist, database.DownloadRecord{
+			YoutubeID: playlist + "_vid",
+			Metadata:  database.VideoMetadata{Title: "Song", Channel: "Band"},
+		}))
+	}
+
+	out := filepath.Join(dir, "jazz.json")
+	require.NoError(t, runCommand(cfg, db, []string{"export", "--playlist", "jazz", "--since", "2000-01-01", out}))
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var videos []database.ExportedVideo
+	require.NoError(t, json.Unmarshal(data, &videos))
+	require.Len(t, videos, 1)
+	assert.Equal(t, "PL_JAZZ_vid", videos[0].YoutubeID)
+
+	out = filepath.Join(dir, "all.csv")
+	require.NoError(t, runCommand(cfg, db, []string{"export", "--format", "csv", out}))
+	data, err = os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 3)
+
+	assert.Error(t, runCommand(cfg, db, []string{"export", "--since", "yesterday"}))
+	assert.Error(t, runCommand(cfg, db, []string{"export", "--format", "xml", out}))
+	assert.Error(t, runCommand(cfg, db, []string{"export", "a", "b"}))
+}
+
+func TestImportLibraryCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	music := filepath.Join(dir, "music")
+	require.NoError(t, os.MkdirAll(music, 0755))
+	for _, name := range []string{"Song [aaaaaaaaaaa].mp3", "Untagged.mp3"} {
+		require.NoError(t, os.WriteFile(filepath.Join(music, name), []byte("audio"), 0644))
+	}
+	cfg := &config.Config{Playlists: map[string]config.PlaylistConfig{
+		"jazz": {URL: "https://www.youtube.com/playlist?list=PL_JAZZ"},
+	}}
+
+	var out bytes.Buffer
+	require.NoError(t, importLibrary(cfg, db, &out, []string{music, "jazz", "--dry-run"}))
+	assert.Contains(t, out.String(), "no video ID: "+filepath.Join(music, "Untagged.mp3"))
+	assert.Contains(t, out.String(), "new aaaaaaaaaaa: ")
+	known, err := db.GetExistingVideoIDs([]string{"aaaaaaaaaaa"})
+	require.NoError(t, err)
+	assert.Empty(t, known, "Dry run writes nothing")
+
+	out.Reset()
+	require.NoError(t, importLibrary(cfg, db, &out, []string{music, "jazz"}))
+	known, err = db.GetExistingVideoIDs([]string{"aaaaaaaaaaa"})
+	require.NoError(t, err)
+	assert.True(t, known["aaaaaaaaaaa"])
+	path, err := db.GetFilePath("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(music, "Song [aaaaaaaaaaa].mp3"), path)
+
+	assert.Error(t, runCommand(cfg, db, []string{"import-library", music}))
+	assert.Error(t, runCommand(cfg, db, []string{"import-library", "--pattern", "[", music, "jazz"}))
+}
+
+func TestBackupCommand(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "downloads.db")
+	db, err := database.NewDatabase(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg := &config.Config{DBPath: dbPath, BackupDir: filepath.Join(dir, "backups"), BackupKeep: 2}
+	require.NoError(t, os.MkdirAll(cfg.BackupDir, 0755))
+	for _, old := range []string{"downloads-20200101-000000.db", "downloads-20210101-000000.db"} {
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.BackupDir, old), []byte("old"), 0644))
+	}
+	other := filepath.Join(cfg.BackupDir, "notes.txt")
+	require.NoError(t, os.WriteFile(other, []byte("keep me"), 0644))
+
+	require.NoError(t, runCommand(cfg, db, []string{"backup"}))
+	backups, err := filepath.Glob(filepath.Join(cfg.BackupDir, "downloads-*.db"))
+	require.NoError(t, err)
+	require.Len(t, backups, 2, "Only the newest backups are kept")
+	assert.Equal(t, "downloads-20210101-000000.db", filepath.Base(backups[0]))
+	assert.FileExists(t, other)
+
+	explicit := filepath.Join(dir, "manual.db")
+	require.NoError(t, runCommand(cfg, db, []string{"backup", explicit}))
+	assert.FileExists(t, explicit)
+
+	assert.Error(t, runCommand(cfg, db, []string{"backup", "a", "b"}))
+}
+
+func TestSearchCommand(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.GetOrCreatePlaylist("PL_A", "Electronic")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_A", "Electronic", database.DownloadRecord{
+		YoutubeID: "aaaaaaaaaaa",
+		Metadata:  database.VideoMetadata{Title: "Around the World", Channel: "Daft Punk"},
+		FilePath:  "/music/Electronic/Around the World [aaaaaaaaaaa].mp3",
+	}))
+
+	var out strings.Builder
+	require.NoError(t, searchVideos(db, &out, "daft punk"))
+	assert.Contains(t, out.String(), "Around the World")
+	assert.Contains(t, out.String(), "Electronic")
+	assert.Contains(t, out.String(), "/music/Electronic/Around the World [aaaaaaaaaaa].mp3")
+
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"search"}))
+}
+
+func TestOnceHelpers(t *testing.T) {
+	cfg := &config.Config{Playlists: map[string]config.PlaylistConfig{
+		"jazz": {URL: "https://www.youtube.com/playlist?list=PL_JAZZ", SplitChapters: true},
+	}}
+	name, pl := resolvePlaylist(cfg, "jazz")
+	assert.Equal(t, "jazz", name)
+	assert.True(t, pl.SplitChapters, "Configured playlists keep their settings")
+	name, pl = resolvePlaylist(cfg, "https://www.youtube.com/playlist?list=PL_OTHER")
+	assert.Equal(t, "PL_OTHER", name)
+	assert.Equal(t, "https://www.youtube.com/playlist?list=PL_OTHER", pl.URL)
+
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "jazz")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_JAZZ", "jazz", database.DownloadRecord{
+		YoutubeID: "aaaaaaaaaaa",
+		Metadata:  database.VideoMetadata{Title: "Take Five"},
+		FilePath:  "/music/jazz/Take Five [aaaaaaaaaaa].mp3",
+	}))
+
+	var out strings.Builder
+	require.NoError(t, listRecent(db, &out, 10))
+	assert.Contains(t, out.String(), "Take Five")
+	assert.Contains(t, out.String(), "/music/jazz/Take Five [aaaaaaaaaaa].mp3")
+}
+
+func TestStatsCommand(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "jazz")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_JAZZ", "jazz", database.DownloadRecord{
+		YoutubeID: "aaaaaaaaaaa",
+		Metadata:  database.VideoMetadata{Title: "Take Five", Duration: 324},
+		FilePath:  "/music/jazz/Take Five [aaaaaaaaaaa].mp3",
+		FileSize:  3 << 20,
+	}))
+
+	var out strings.Builder
+	require.NoError(t, showStats(db, &out, 0, false))
+	assert.Contains(t, out.String(), "3.0 MiB")
+	assert.Contains(t, out.String(), "0h05m")
+	assert.Contains(t, out.String(), "Total")
+
+	out.Reset()
+	require.NoError(t, showStats(db, &out, 0, true))
+	var stats database.LibraryStats
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &stats))
+	assert.Equal(t, 1, stats.Total.Downloaded)
+
+	assert.Error(t, runCommand(&config.Config{}, db, []string{"stats", "--yaml"}))
+}
+
+func TestStorageCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, id := range []string{"PL_BIG", "PL_SMALL"} {
+		_, err = db.GetOrCreatePlaylist(id, id)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.RecordDownload("PL_SMALL", "PL_SMALL", database.DownloadRecord{YoutubeID: "aaaaaaaaaaa", FilePath: "/music/a.mp3", FileSize: 1 << 20}))
+	require.NoError(t, db.RecordDownload("PL_BIG", "PL_BIG", database.DownloadRecord{YoutubeID: "bbbbbbbbbbb", FilePath: "/music/b.mp3", FileSize: 3 << 20}))
+
+	var out strings.Builder
+	require.NoError(t, showStorage(&config.Config{MusicParentDir: dir, MinFreeSpace: 1 << 30}, db, &out))
+	assert.Contains(t, out.String(), "Library: 2 files, 4.0 MiB")
+	assert.Contains(t, out.String(), "downloads pause below 1.0 GiB")
+	big := strings.Index(out.String(), "PL_BIG")
+	assert.Positive(t, big)
+	assert.Less(t, big, strings.Index(out.String(), "PL_SMALL"), "Largest playlist first")
+	assert.Contains(t, out.String(), "75%")
+}
+
+func TestOrphansCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	music := filepath.Join(dir, "music")
+	path := filepath.Join(music, "Jazz", "Take Five [aaaaaaaaaaa].mp3")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("audio"), 0644))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+	cfg := &config.Config{MusicParentDir: music, Playlists: map[string]config.PlaylistConfig{
+		"Jazz": {URL: "https://www.youtube.com/playlist?list=PL_JAZZ"},
+	}}
+
+	var out strings.Builder
+	require.NoError(t, orphans(cfg, db, &out, nil))
+	assert.Contains(t, out.String(), "aaaaaaaaaaa")
+	assert.Contains(t, out.String(), "1 orphaned files, 5 B")
+
+	out.Reset()
+	require.NoError(t, orphans(cfg, db, &out, []string{"--adopt"}))
+	assert.Contains(t, out.String(), "Adopted 1 files")
+	recorded, err := db.GetFilePath("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, path, recorded)
+
+	out.Reset()
+	require.NoError(t, orphans(cfg, db, &out, []string{"--delete"}))
+	assert.Contains(t, out.String(), "0 orphaned files")
+	assert.FileExists(t, path)
+
+	assert.Error(t, orphans(cfg, db, &out, []string{"--adopt", "--delete"}))
+}
+
+func TestValidateCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.AddVideo("aaaaaaaaaaa", "PL_A", "A", database.VideoMetadata{Title: "Gone"}))
+	require.NoError(t, db.UpdateFileInfo("aaaaaaaaaaa", filepath.Join(dir, "gone.mp3"), 5, ""))
+	cfg := &config.Config{MusicParentDir: dir}
+
+	var out strings.Builder
+	report := filepath.Join(dir, "report.json")
+	require.NoError(t, validate(cfg, db, &out, []string{"--report", report, "--cleanup", "--dry-run"}))
+	assert.Contains(t, out.String(), "missing  aaaaaaaaaaa")
+	assert.Contains(t, out.String(), "Would delete 1 rows of missing files")
+	assert.FileExists(t, report)
+
+	out.Reset()
+	require.NoError(t, validate(cfg, db, &out, []string{"--cleanup"}))
+	assert.Contains(t, out.String(), "Deleted 1 rows of missing files")
+	exists, err := db.VideoExists("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Error(t, validate(cfg, db, &out, []string{"--dry-run"}))
+}
+
+func TestListCommand(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	disabled := false
+	cfg := &config.Config{WatchInterval: 15 * time.Minute, Playlists: map[string]config.PlaylistConfig{
+		"Jazz":  {URL: "https://www.youtube.com/playlist?list=PL_JAZZ", Interval: "1h"},
+		"Blues": {URL: "https://www.youtube.com/playlist?list=PL_BLUES", Enabled: &disabled},
+	}}
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "Jazz")
+	require.NoError(t, err)
+	require.NoError(t, db.MarkPlaylistChecked("PL_JAZZ", false))
+
+	var out strings.Builder
+	require.NoError(t, listPlaylists(cfg, db, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[1], "Blues")
+	assert.Contains(t, lines[1], "false")
+	assert.Contains(t, lines[1], "never")
+	assert.Contains(t, lines[2], "Jazz")
+	assert.Contains(t, lines[2], "1h0m0s")
+	assert.Contains(t, lines[2], time.Now().Format("2006-01-02"))
+
+	assert.Error(t, runCommand(cfg, db, []string{"list", "extra"}))
+}
+
+func TestCleanupCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	music := filepath.Join(dir, "music")
+	part := filepath.Join(music, "Jazz", "Take Five [aaaaaaaaaaa].mp3.part")
+	staged := filepath.Join(dir, "tmp", "Jazz", "Blue Rondo [bbbbbbbbbbb].mp3")
+	for _, path := range []string{part, staged} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("audio"), 0644))
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(part, old, old))
+	cfg := &config.Config{MusicParentDir: music, TempDir: filepath.Join(dir, "tmp"), TempFileMaxAge: 24 * time.Hour}
+
+	var out strings.Builder
+	require.NoError(t, cleanup(cfg, db, &out, []string{"--dry-run"}))
+	assert.Contains(t, out.String(), "Would delete 1 temp files, 5 B")
+	assert.FileExists(t, part)
+
+	out.Reset()
+	require.NoError(t, cleanup(cfg, db, &out, []string{"--max-age", "72h"}))
+	assert.Contains(t, out.String(), "Deleted 0 temp files")
+	assert.FileExists(t, part)
+
+	out.Reset()
+	require.NoError(t, cleanup(cfg, db, &out, []string{"--staging"}))
+	assert.Contains(t, out.String(), "Deleted 1 temp files")
+	assert.NoFileExists(t, part)
+	assert.NoFileExists(t, staged)
+
+	assert.Error(t, cleanup(cfg, db, &out, []string{"--staging", "--dry-run"}))
+	assert.Error(t, cleanup(cfg, db, &out, []string{"extra"}))
+}
+
+func TestResidecarCommand(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	music := filepath.Join(dir, "music")
+	cfg := &config.Config{MusicParentDir: music, Playlists: map[string]config.PlaylistConfig{
+		"jazz": {URL: "https://www.youtube.com/playlist?list=PL_JAZZ"},
+	}}
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "jazz")
+	require.NoError(t, err)
+	var files []string
+	for _, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb"} {
+		path := filepath.Join(music, "jazz", id+".mp3")
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("audio"), 0644))
+		require.NoError(t, db.RecordDownload("PL_JAZZ", "jazz", database.DownloadRecord{
+			YoutubeID: id,
+			Metadata:  database.VideoMetadata{Title: "Take Five", Channel: "Dave Brubeck", Description: "From Time Out"},
+			FilePath:  path,
+			Media:     database.MediaInfo{MediaType: "audio"},
+		}))
+		files = append(files, path)
+	}
+	require.NoError(t, os.Remove(files[1]))
+
+	var out strings.Builder
+	assert.Error(t, residecar(cfg, db, &out, nil), "Needs a format")
+	require.NoError(t, residecar(cfg, db, &out, []string{"--format", "nfo", "--playlist", "jazz"}))
+	assert.Contains(t, out.String(), "Wrote 1 sidecars")
+	data, err := os.ReadFile(sidecar.Path(files[0], sidecar.FormatNFO))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<plot>From Time Out</plot>")
+	assert.Contains(t, string(data), "<album>jazz</album>")
+	assert.NoFileExists(t, sidecar.Path(files[1], sidecar.FormatNFO), "Missing files are skipped")
+
+	cfg.SidecarFormat = sidecar.FormatJSON
+	require.NoError(t, residecar(cfg, db, &out, nil))
+	assert.FileExists(t, sidecar.Path(files[0], sidecar.FormatJSON))
+	assert.Error(t, residecar(cfg, db, &out, []string{"extra"}))
+}
+
+func TestPrintVersion(t *testing.T) {
+	var out strings.Builder
+	printVersion(&out)
+	assert.True(t, strings.HasPrefix(out.String(), "pp-downloader "))
+	assert.Contains(t, out.String(), runtime.Version())
+}
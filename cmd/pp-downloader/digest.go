@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/digest"
+	"github.com/sampiiiii/pp-downloader/internal/notify"
+)
+
+// mailer sends an email with plain text and HTML bodies
+type mailer interface {
+	Send(subject, text, html string) error
+}
+
+// newMailer creates the sender of digests from the SMTP settings; nil when
+// digests are off
+func newMailer(cfg *config.Config) (*notify.Email, error) {
+	if !cfg.DigestEnabled() {
+		return nil, nil
+	}
+	return notify.NewEmail(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom, cfg.SMTPTo)
+}
+
+// runDigests emails a digest whenever DIGEST_SCHEDULE is due until ctx is
+// done. A digest that fell due while the watcher was stopped is sent at
+// startup; one that fails to send is left to the next.
+func runDigests(ctx context.Context, cfg *config.Config, db *database.Database, m mailer) {
+	after := time.Now()
+	if last, err := db.LastDigest(); err != nil {
+		slog.Warn("Failed to read when the last digest was sent", "error", err)
+	} else if last = last.In(after.Location()); !last.IsZero() && cfg.NextDigest(last).Before(after) {
+		after = last
+	}
+
+	for {
+		next := cfg.NextDigest(after)
+		slog.Debug("Next digest", "at", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		if err := sendDigest(db, m, now); err != nil {
+			slog.Error("Failed to send digest", "error", err)
+		} else if err := db.RecordDigest(now); err != nil {
+			slog.Warn("Failed to record digest", "error", err)
+		}
+		after = now
+	}
+}
+
+// sendDigestNow emails the digest that's due next, for --send-digest-now to
+// test the SMTP settings. It covers the same period but isn't recorded, so
+// the scheduled digest still does too.
+func sendDigestNow(cfg *config.Config, db *database.Database) error {
+	m, err := newMailer(cfg)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return fmt.Errorf("digests are off: set SMTP_HOST, SMTP_FROM and SMTP_TO")
+	}
+	return sendDigest(db, m, time.Now())
+}
+
+// sendDigest emails the digest of everything since the last one, or the
+// last day before the first
+func sendDigest(db *database.Database, m mailer, now time.Time) error {
+	since, err := db.LastDigest()
+	if err != nil {
+		return err
+	}
+	if since.IsZero() {
+		since = now.Add(-24 * time.Hour)
+	}
+
+	d, err := digest.Gather(db, since, now)
+	if err != nil {
+		return err
+	}
+	text, err := d.Text()
+	if err != nil {
+		return err
+	}
+	html, err := d.HTML()
+	if err != nil {
+		return err
+	}
+	if err := m.Send(d.Subject(), text, html); err != nil {
+		return err
+	}
+	slog.Info("Sent digest", "since", since.Local().Format(time.RFC3339), "downloads", d.Downloads, "failures", d.Failures, "problems", d.Problems)
+	return nil
+}
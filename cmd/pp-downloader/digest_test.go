@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMailer records the subjects of the emails it's asked to send
+type fakeMailer struct {
+	mu       sync.Mutex
+	subjects []string
+	err      error
+}
+
+func (m *fakeMailer) Send(subject, text, html string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.subjects = append(m.subjects, subject)
+	return nil
+}
+
+func (m *fakeMailer) sent() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.subjects...)
+}
+
+func TestSendDigest(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "Jazz")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_JAZZ", "Jazz", database.DownloadRecord{
+		YoutubeID: "aaaaaaaaaaa",
+		Metadata:  database.VideoMetadata{Title: "Track"},
+		FilePath:  "/music/aaaaaaaaaaa.m4a",
+	}))
+
+	m := &fakeMailer{}
+	require.NoError(t, sendDigest(db, m, time.Now()))
+	assert.Equal(t, []string{"Playlist digest: 1 new track"}, m.sent(), "The first digest covers the last day")
+
+	require.NoError(t, db.RecordDigest(time.Now().Add(time.Second)))
+	require.NoError(t, sendDigest(db, m, time.Now().Add(time.Minute)))
+	assert.Equal(t, "Playlist digest: 0 new tracks", m.sent()[1], "Later ones start from the last")
+
+	m.err = errors.New("connection refused")
+	assert.Error(t, sendDigest(db, m, time.Now()))
+}
+
+func TestRunDigestsCatchesUp(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Hourly digests, the last sent two hours ago, so one was missed
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "playlists.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"playlists": {"jazz": "PL_JAZZ"}}`), 0644))
+	t.Setenv("JSON_PATH", jsonPath)
+	t.Setenv("MUSIC_PARENT_DIR", dir)
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_FROM", "pp@example.com")
+	t.Setenv("SMTP_TO", "me@example.com")
+	t.Setenv("DIGEST_SCHEDULE", "@hourly")
+	cfg, err := config.LoadConfig(dir)
+	require.NoError(t, err)
+	last := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, db.RecordDigest(last))
+
+	m := &fakeMailer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runDigests(ctx, cfg, db, m)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return len(m.sent()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	sentAt, err := db.LastDigest()
+	require.NoError(t, err)
+	assert.True(t, sentAt.After(last.Add(time.Hour)), "The missed digest is recorded")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/downloader"
+	"github.com/sampiiiii/pp-downloader/internal/feed"
+	"github.com/sampiiiii/pp-downloader/internal/filename"
+)
+
+// writeFeeds rewrites the podcast feed of each enabled playlist with feed
+// set, so it lists the newest files after every pass
+func writeFeeds(cfg *config.Config, db *database.Database) {
+	names := make([]string, 0, len(cfg.Playlists))
+	for name, p := range cfg.Playlists {
+		if p.Feed && p.IsEnabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c, err := playlistFeed(cfg, db, name, cfg.Playlists[name])
+		if err != nil {
+			slog.Error("Failed to load playlist for its feed", "playlist", name, "error", err)
+			continue
+		}
+		path := feedPath(cfg, name)
+		if err := feed.WriteFile(path, c); err != nil {
+			slog.Error("Failed to write podcast feed", "playlist", name, "error", err)
+			continue
+		}
+		slog.Debug("Wrote podcast feed", "playlist", name, "path", path, "items", len(c.Items))
+	}
+}
+
+// feedPath is where a playlist's feed is written, named after it
+func feedPath(cfg *config.Config, name string) string {
+	id := downloader.PlaylistID(cfg.Playlists[name].URL)
+	return filepath.Join(cfg.FeedDir, filename.Sanitize(name, id)+".xml")
+}
+
+// playlistFeed lays out a playlist as a podcast: its newest valid files,
+// by upload date, linked under FEED_BASE_URL. Videos split into chapters
+// and files no longer on disk, such as those only kept remotely, are left
+// out.
+func playlistFeed(cfg *config.Config, db *database.Database, name string, p config.PlaylistConfig) (feed.Channel, error) {
+	id := downloader.PlaylistID(p.URL)
+	pl, err := db.GetOrCreatePlaylist(id, name)
+	if err != nil {
+		return feed.Channel{}, err
+	}
+	videos, err := db.ExportedVideos(database.ListOptions{PlaylistYoutubeID: id, ValidationStatus: database.StatusValid})
+	if err != nil {
+		return feed.Channel{}, err
+	}
+
+	c := feed.Channel{
+		Title:       name,
+		Description: pl.Description.String,
+		Link:        p.URL,
+		Author:      pl.Channel.String,
+		Image:       pl.Thumbnail.String,
+	}
+	if !strings.Contains(c.Link, "://") {
+		c.Link = "https://www.youtube.com/playlist?list=" + url.QueryEscape(id)
+	}
+	if c.Description == "" {
+		c.Description = "Downloads of the YouTube playlist " + pl.Title
+	}
+
+	for _, v := range videos {
+		if v.FilePath == nil || *v.FilePath == "" {
+			continue
+		}
+		info, err := os.Stat(*v.FilePath)
+		if err != nil {
+			continue
+		}
+		link, ok := fileURL(cfg, *v.FilePath)
+		if !ok {
+			continue
+		}
+		item := feed.Item{
+			GUID:        v.YoutubeID,
+			Title:       v.Title,
+			Description: deref(v.Description),
+			Link:        "https://www.youtube.com/watch?v=" + v.YoutubeID,
+			URL:         link,
+			Size:        info.Size(),
+			Type:        feed.MIMEType(deref(v.Container), *v.FilePath),
+			Duration:    v.Duration,
+			Image:       deref(v.ThumbnailURL),
+		}
+		if published := deref(v.UploadDate); published != "" {
+			item.Published, _ = time.Parse(time.RFC3339, published)
+		} else if downloaded := deref(v.DownloadedAt); downloaded != "" {
+			item.Published, _ = time.Parse(time.RFC3339, downloaded)
+		}
+		c.Items = append(c.Items, item)
+	}
+
+	sort.SliceStable(c.Items, func(i, j int) bool { return c.Items[i].Published.After(c.Items[j].Published) })
+	if len(c.Items) > cfg.FeedMaxItems {
+		c.Items = c.Items[:cfg.FeedMaxItems]
+	}
+	if c.Image == "" && len(c.Items) > 0 {
+		c.Image = c.Items[0].Image
+	}
+	return c, nil
+}
+
+// fileURL is where a file under MUSIC_PARENT_DIR is served below
+// FEED_BASE_URL, each path segment escaped; false for files outside it
+func fileURL(cfg *config.Config, path string) (string, bool) {
+	rel, err := filepath.Rel(cfg.MusicParentDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.TrimSuffix(cfg.FeedBaseURL, "/") + "/" + strings.Join(segments, "/"), true
+}
+
+// deref returns the string s points at, or "" for nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFeeds(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	music := filepath.Join(dir, "music")
+	require.NoError(t, os.MkdirAll(filepath.Join(music, "Late Jazz"), 0o755))
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "Late Jazz")
+	require.NoError(t, err)
+	require.NoError(t, db.UpdatePlaylistMetadata("PL_JAZZ", database.PlaylistMetadata{Thumbnail: "https://i.ytimg.com/pl.jpg", Channel: "Jazz Channel"}))
+	for i, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc", "ddddddddddd"} {
+		path := filepath.Join(music, "Late Jazz", id+" #1.m4a")
+		if id != "ddddddddddd" { // Gone from disk, e.g. only kept remotely
+			require.NoError(t, os.WriteFile(path, []byte("audio"), 0o644))
+		}
+		require.NoError(t, db.RecordDownload("PL_JAZZ", "Late Jazz", database.DownloadRecord{
+			YoutubeID: id,
+			Metadata:  database.VideoMetadata{Title: "Track " + id, Duration: 60, UploadDate: time.Date(2024, 1, i+1, 0, 0, 0, 0, time.UTC)},
+			FilePath:  path,
+			Media:     database.MediaInfo{Container: "m4a"},
+		}))
+	}
+
+	cfg := &config.Config{
+		MusicParentDir: music,
+		FeedBaseURL:    "https://media.example.com/music/",
+		FeedDir:        filepath.Join(dir, "feeds"),
+		FeedMaxItems:   2,
+		Playlists: map[string]config.PlaylistConfig{
+			"Late Jazz": {URL: "PL_JAZZ", Feed: true},
+			"Talks":     {URL: "PL_TALKS"},
+		},
+	}
+	writeFeeds(cfg, db)
+
+	data, err := os.ReadFile(filepath.Join(cfg.FeedDir, "Late Jazz.xml"))
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(cfg.FeedDir, "Talks.xml"), "Only playlists with feed set")
+
+	var doc struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Link  string `xml:"link"`
+			Image struct {
+				URL string `xml:"url"`
+			} `xml:"image"`
+			Items []struct {
+				GUID      string `xml:"guid"`
+				PubDate   string `xml:"pubDate"`
+				Enclosure struct {
+					URL    string `xml:"url,attr"`
+					Length int64  `xml:"length,attr"`
+					Type   string `xml:"type,attr"`
+				} `xml:"enclosure"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &doc))
+	assert.Equal(t, "Late Jazz", doc.Channel.Title)
+	assert.Equal(t, "https://www.youtube.com/playlist?list=PL_JAZZ", doc.Channel.Link)
+	assert.Equal(t, "https://i.ytimg.com/pl.jpg", doc.Channel.Image.URL)
+	require.Len(t, doc.Channel.Items, 2, "Capped to FEED_MAX_ITEMS, leaving out files not on disk")
+	assert.Equal(t, "ccccccccccc", doc.Channel.Items[0].GUID, "Newest upload first")
+	assert.Equal(t, "Wed, 03 Jan 2024 00:00:00 +0000", doc.Channel.Items[0].PubDate)
+	assert.Equal(t, "https://media.example.com/music/Late%20Jazz/ccccccccccc%20%231.m4a", doc.Channel.Items[0].Enclosure.URL)
+	assert.Equal(t, int64(5), doc.Channel.Items[0].Enclosure.Length)
+	assert.Equal(t, "audio/mp4", doc.Channel.Items[0].Enclosure.Type)
+	assert.Equal(t, "bbbbbbbbbbb", doc.Channel.Items[1].GUID)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+)
+
+// flagAliases are shorter names for the settings most often given as flags
+var flagAliases = map[string]string{
+	"music-dir": "MUSIC_PARENT_DIR",
+	"db":        "DB_PATH",
+}
+
+// options is what the command line asks for
+type options struct {
+	flags          config.Flags
+	once           bool
+	summaryFile    string // With once, where the run's summary is written as JSON
+	refreshOnStart bool
+	printConfig    bool
+	sendDigestNow  bool
+
+	// command is a one-off command and its arguments, if any
+	command []string
+}
+
+// settingFlag turns a setting's environment variable name into its flag,
+// e.g. LINK_MODE into link-mode
+func settingFlag(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// parseArgs parses the flags before any command. Every setting is a flag
+// named after its environment variable, and --playlist name=URL can be
+// repeated; both win over the environment and config files.
+func parseArgs(args []string, output io.Writer) (options, error) {
+	opts := options{
+		flags: config.Flags{
+			Settings:  make(map[string]string),
+			Playlists: make(map[string]config.PlaylistConfig),
+		},
+	}
+	fs := flag.NewFlagSet("pp-downloader", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() { fmt.Fprintln(output, usage) }
+
+	addRunFlags(fs, &opts)
+	fs.BoolVar(&opts.printConfig, "print-config", false, "show every setting, its value and where it was set")
+	fs.BoolVar(&opts.sendDigestNow, "send-digest-now", false, "email the activity digest now, to test the SMTP settings")
+	fs.Func("playlist", "a playlist to watch as name=URL; can be repeated", func(value string) error {
+		name, playlist, err := config.ParsePlaylistFlag(value)
+		if err != nil {
+			return err
+		}
+		opts.flags.Playlists[name] = playlist
+		return nil
+	})
+	setting := func(key string) func(string) error {
+		return func(value string) error {
+			opts.flags.Settings[key] = value
+			return nil
+		}
+	}
+	for _, key := range config.SettingKeys() {
+		fs.Func(settingFlag(key), "sets "+key, setting(key))
+	}
+	for alias, key := range flagAliases {
+		fs.Func(alias, "sets "+key, setting(key))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+	opts.command = fs.Args()
+	if len(opts.command) > 0 && (opts.once || opts.refreshOnStart || opts.printConfig || opts.sendDigestNow) {
+		return options{}, fmt.Errorf("--once, --refresh-on-start, --print-config and --send-digest-now can't be used with a command\n%s", usage)
+	}
+
+	// run is the watcher, as is no command at all; once is run --once
+	if len(opts.command) > 0 {
+		switch name := opts.command[0]; name {
+		case "run", "once":
+			opts.once = name == "once"
+			run := flag.NewFlagSet(name, flag.ContinueOnError)
+			run.SetOutput(output)
+			run.Usage = func() { fmt.Fprintln(output, usage) }
+			addRunFlags(run, &opts)
+			if err := run.Parse(opts.command[1:]); err != nil {
+				return options{}, err
+			}
+			if run.NArg() > 0 {
+				return options{}, fmt.Errorf("%s takes no arguments\n%s", name, usage)
+			}
+			opts.command = nil
+		}
+	}
+
+	if opts.summaryFile != "" && !opts.once {
+		return options{}, fmt.Errorf("--summary only applies to --once\n%s", usage)
+	}
+	return opts, nil
+}
+
+// addRunFlags adds the watcher's own flags, which go before any command or
+// after run
+func addRunFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.once, "once", opts.once, "check every playlist once, then exit")
+	fs.StringVar(&opts.summaryFile, "summary", "", "with --once, also write the run's summary as JSON to this file")
+	fs.BoolVar(&opts.refreshOnStart, "refresh-on-start", false, "check every playlist at startup, not only those that are due")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArgs(t *testing.T) {
+	var out bytes.Buffer
+	opts, err := parseArgs([]string{
+		"--music-dir", "./out", "--db=./test.db", "--link-mode", "symlink",
+		"--playlist", "Chill=https://www.youtube.com/playlist?list=PL_CHILL",
+		"--playlist", "Focus=PL_FOCUS", "--once",
+	}, &out)
+	require.NoError(t, err)
+	assert.True(t, opts.once)
+	assert.False(t, opts.printConfig)
+	assert.Empty(t, opts.command)
+	assert.Equal(t, map[string]string{"MUSIC_PARENT_DIR": "./out", "DB_PATH": "./test.db", "LINK_MODE": "symlink"}, opts.flags.Settings)
+	assert.Equal(t, map[string]config.PlaylistConfig{
+		"Chill": {URL: "https://www.youtube.com/playlist?list=PL_CHILL"},
+		"Focus": {URL: "PL_FOCUS"},
+	}, opts.flags.Playlists)
+
+	opts, err = parseArgs([]string{"--db", "x.db", "stats", "--json"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stats", "--json"}, opts.command, "Flags after the command are the command's")
+
+	_, err = parseArgs([]string{"--playlist", "https://www.youtube.com/playlist?list=PL_NONAME"}, &out)
+	assert.ErrorContains(t, err, "use name=URL")
+
+	_, err = parseArgs([]string{"--no-such-setting", "1"}, &out)
+	assert.Error(t, err)
+
+	_, err = parseArgs([]string{"--once", "stats"}, &out)
+	assert.Error(t, err)
+
+	opts, err = parseArgs([]string{"--refresh-on-start"}, &out)
+	require.NoError(t, err)
+	assert.True(t, opts.refreshOnStart)
+
+	opts, err = parseArgs([]string{"--send-digest-now"}, &out)
+	require.NoError(t, err)
+	assert.True(t, opts.sendDigestNow)
+
+	_, err = parseArgs([]string{"--send-digest-now", "stats"}, &out)
+	assert.Error(t, err)
+
+	opts, err = parseArgs([]string{"--once", "--summary", "summary.json"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "summary.json", opts.summaryFile)
+
+	_, err = parseArgs([]string{"--summary", "summary.json"}, &out)
+	assert.ErrorContains(t, err, "--summary only applies to --once")
+
+	opts, err = parseArgs([]string{"--db", "x.db", "run", "--refresh-on-start"}, &out)
+	require.NoError(t, err)
+	assert.Empty(t, opts.command, "run is the watcher")
+	assert.True(t, opts.refreshOnStart)
+	assert.False(t, opts.once)
+
+	opts, err = parseArgs([]string{"once", "--summary", "summary.json"}, &out)
+	require.NoError(t, err)
+	assert.Empty(t, opts.command)
+	assert.True(t, opts.once, "once without a playlist is run --once")
+	assert.Equal(t, "summary.json", opts.summaryFile)
+
+	_, err = parseArgs([]string{"once", "Chill"}, &out)
+	assert.Error(t, err, "A playlist doesn't turn once into a trial run")
+
+	opts, err = parseArgs([]string{"trial", "Chill"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"trial", "Chill"}, opts.command)
+
+	_, err = parseArgs([]string{"run", "extra"}, &out)
+	assert.Error(t, err)
+
+	_, err = parseArgs([]string{"run", "--summary", "summary.json"}, &out)
+	assert.ErrorContains(t, err, "--summary only applies to --once")
+
+	out.Reset()
+	_, err = parseArgs([]string{"--help"}, &out)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.Contains(t, out.String(), "--playlist <name=URL>")
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/api"
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// healthTimeout bounds the database check and the healthcheck command's
+// request, so a wedged watcher is reported rather than waited on
+const healthTimeout = 5 * time.Second
+
+// healthMonitor tracks whether the watcher is working: the scheduler keeps
+// ticking, the database can be read and playlists aren't all failing
+type healthMonitor struct {
+	db       *database.Database
+	path     string        // Heartbeat file; none when empty
+	maxAge   time.Duration // Longest gap between ticks before the scheduler counts as stuck
+	lastTick atomic.Int64  // Unix nanoseconds
+}
+
+func newHealthMonitor(cfg *config.Config, db *database.Database) *healthMonitor {
+	h := &healthMonitor{
+		db:     db,
+		path:   cfg.HeartbeatFile,
+		maxAge: time.Duration(cfg.HealthMissedTicks) * cfg.WatchTick,
+	}
+	// Starting up counts as a tick, so the first one isn't already late
+	h.lastTick.Store(time.Now().UnixNano())
+	return h
+}
+
+// check reports the watcher's health. It reads no scheduler state but the
+// last tick, so it answers even when the scheduler is stuck.
+func (h *healthMonitor) check(ctx context.Context) api.Health {
+	now := time.Now()
+	health := api.Health{LastTick: time.Unix(0, h.lastTick.Load()).UTC(), CheckedAt: now.UTC()}
+
+	if since := now.Sub(health.LastTick); since > h.maxAge {
+		health.Problems = append(health.Problems, fmt.Sprintf("scheduler hasn't run for %s", since.Round(time.Second)))
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	if err := h.db.Ping(ctx); err != nil {
+		health.Problems = append(health.Problems, err.Error())
+	}
+	if allPlaylistsFailing.Load() {
+		health.Problems = append(health.Problems, "every playlist failed in the last pass")
+	}
+	health.Healthy = len(health.Problems) == 0
+	return health
+}
+
+// beat records a scheduler tick and writes the health to the heartbeat
+// file. The file is replaced through a rename so readers never see half of
+// it.
+func (h *healthMonitor) beat(ctx context.Context) {
+	h.lastTick.Store(time.Now().UnixNano())
+	if h.path == "" {
+		return
+	}
+	data, err := json.Marshal(h.check(ctx))
+	if err == nil {
+		err = writeFileAtomic(h.path, data)
+	}
+	if err != nil {
+		slog.Warn("Failed to write the heartbeat file", "path", h.path, "error", err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// healthcheck exits non-zero, through its error, unless the watcher is
+// healthy: by asking /healthz when the API is on, or else by reading the
+// heartbeat file
+func healthcheck(cfg *config.Config, w io.Writer) error {
+	var health api.Health
+	var err error
+	if cfg.APIAddr != "" {
+		health, err = probeHealth(cfg.APIAddr)
+	} else {
+		health, err = readHeartbeat(cfg.HeartbeatFile, time.Duration(cfg.HealthMissedTicks)*cfg.WatchTick)
+	}
+	if err != nil {
+		return err
+	}
+	if !health.Healthy {
+		return fmt.Errorf("unhealthy: %s", strings.Join(health.Problems, "; "))
+	}
+	fmt.Fprintf(w, "healthy; scheduler last ran %s\n", health.LastTick.Local().Format(time.RFC3339))
+	return nil
+}
+
+// probeHealth asks the watcher's API for its health. Wildcard addresses
+// like ":8080" are probed on localhost.
+func probeHealth(addr string) (api.Health, error) {
+	var health api.Health
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return health, fmt.Errorf("invalid API_ADDR %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+
+	client := &http.Client{Timeout: healthTimeout}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + "/healthz")
+	if err != nil {
+		return health, fmt.Errorf("watcher isn't answering: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return health, fmt.Errorf("invalid health response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	return health, nil
+}
+
+// readHeartbeat reads the health the watcher last wrote, which is itself a
+// problem when older than maxAge
+func readHeartbeat(path string, maxAge time.Duration) (api.Health, error) {
+	var health api.Health
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return health, fmt.Errorf("no heartbeat at %s; is the watcher running?", path)
+	} else if err != nil {
+		return health, err
+	}
+	if err := json.Unmarshal(data, &health); err != nil {
+		return health, fmt.Errorf("invalid heartbeat file %s: %w", path, err)
+	}
+	if since := time.Since(health.CheckedAt); since > maxAge {
+		return health, fmt.Errorf("unhealthy: no heartbeat for %s", since.Round(time.Second))
+	}
+	return health, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/api"
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthMonitor(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg := &config.Config{HeartbeatFile: filepath.Join(dir, "state", "heartbeat.json"), HealthMissedTicks: 3, WatchTick: time.Minute}
+	h := newHealthMonitor(cfg, db)
+	ctx := context.Background()
+	assert.True(t, h.check(ctx).Healthy)
+
+	// The heartbeat file is what the healthcheck reads without the API
+	h.beat(ctx)
+	var out strings.Builder
+	require.NoError(t, healthcheck(cfg, &out))
+	assert.Contains(t, out.String(), "healthy")
+
+	h.lastTick.Store(time.Now().Add(-4 * time.Minute).UnixNano())
+	health := h.check(ctx)
+	assert.False(t, health.Healthy)
+	assert.Contains(t, health.Problems[0], "scheduler hasn't run for 4m0s")
+
+	h.beat(ctx)
+	allPlaylistsFailing.Store(true)
+	defer allPlaylistsFailing.Store(false)
+	assert.Equal(t, []string{"every playlist failed in the last pass"}, h.check(ctx).Problems)
+	h.beat(ctx)
+	assert.ErrorContains(t, healthcheck(cfg, &out), "every playlist failed")
+	allPlaylistsFailing.Store(false)
+
+	// A heartbeat the watcher stopped writing is stale
+	old := time.Now().Add(-10 * time.Minute)
+	require.NoError(t, writeFileAtomic(cfg.HeartbeatFile, []byte(`{"healthy": true, "checked_at": "`+old.UTC().Format(time.RFC3339)+`"}`)))
+	assert.ErrorContains(t, healthcheck(cfg, &out), "no heartbeat for 10m")
+
+	require.NoError(t, os.Remove(cfg.HeartbeatFile))
+	assert.ErrorContains(t, healthcheck(cfg, &out), "is the watcher running?")
+
+	require.NoError(t, db.Close())
+	assert.False(t, h.check(ctx).Healthy, "An unreadable database is unhealthy")
+}
+
+func TestHealthcheckThroughAPI(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var healthy atomic.Bool
+	healthy.Store(true)
+	srv := &http.Server{Handler: api.NewServer(nil, newSchedulerAPI(), api.Options{
+		Health: func(context.Context) api.Health {
+			if healthy.Load() {
+				return api.Health{Healthy: true}
+			}
+			return api.Health{Problems: []string{"scheduler hasn't run for 10m0s"}}
+		},
+	}).Handler()}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+	cfg := &config.Config{APIAddr: ":" + port}
+
+	var out strings.Builder
+	require.NoError(t, healthcheck(cfg, &out))
+	healthy.Store(false)
+	assert.ErrorContains(t, healthcheck(cfg, &out), "unhealthy: scheduler hasn't run")
+
+	srv.Close()
+	assert.ErrorContains(t, healthcheck(cfg, &out), "watcher isn't answering")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/downloader"
+	"github.com/sampiiiii/pp-downloader/internal/hooks"
+)
+
+// hookPingTimeout bounds the startup check of a media server
+const hookPingTimeout = 10 * time.Second
+
+// newHooks creates the hooks run after a pass downloads new files. Media
+// servers are checked now, so wrong credentials show up at startup rather
+// than after the next download.
+func newHooks(ctx context.Context, cfg *config.Config) []hooks.Hook {
+	var hks []hooks.Hook
+	if cfg.PlexURL != "" {
+		plex, err := hooks.NewPlex(cfg.PlexURL, cfg.PlexToken, cfg.PlexSection, cfg.MusicParentDir, cfg.PlexLibraryPath, nil)
+		if err != nil {
+			slog.Error("Plex scans are off", "error", err)
+		} else if checkHook(ctx, plex, cfg.PlexURL) {
+			hks = append(hks, plex)
+		}
+	}
+	if cfg.JellyfinURL != "" {
+		jellyfin, err := hooks.NewJellyfin(cfg.JellyfinURL, cfg.JellyfinAPIKey, nil)
+		if err != nil {
+			slog.Error("Jellyfin refreshes are off", "error", err)
+		} else if checkHook(ctx, jellyfin, cfg.JellyfinURL) {
+			hks = append(hks, jellyfin)
+		}
+	}
+	if cfg.NavidromeURL != "" {
+		navidrome, err := hooks.NewNavidrome(cfg.NavidromeURL, cfg.NavidromeUser, cfg.NavidromePassword, nil)
+		if err != nil {
+			slog.Error("Navidrome scans are off", "error", err)
+		} else if checkHook(ctx, navidrome, cfg.NavidromeURL) {
+			hks = append(hks, navidrome)
+		}
+	}
+	if cfg.PostDownloadCommand != "" {
+		hks = append(hks, hooks.NewCommand(cfg.PostDownloadCommand))
+	}
+	return hks
+}
+
+// checkHook pings a media server, reporting whether to use it. Rejected
+// credentials turn it off; a server that can't be reached yet is kept, as
+// it may still be starting.
+func checkHook(ctx context.Context, hook interface {
+	hooks.Hook
+	hooks.Pinger
+}, url string) bool {
+	ctx, cancel := context.WithTimeout(ctx, hookPingTimeout)
+	defer cancel()
+	err := hook.Ping(ctx)
+	switch {
+	case errors.Is(err, hooks.ErrUnauthorized):
+		slog.Error("Media server rejected its credentials; it won't be told about new downloads", "hook", hook.Name(), "url", url, "error", err)
+		return false
+	case err != nil:
+		slog.Warn("Media server can't be checked; scans may fail", "hook", hook.Name(), "url", url, "error", err)
+	default:
+		slog.Info("Media server will scan new downloads", "hook", hook.Name(), "url", url)
+	}
+	return true
+}
+
+// runHooks runs each hook on the directories with new files from the
+// playlists it serves. Failures are only logged: the files are there
+// either way, and a media server's own periodic scan finds them later.
+func runHooks(ctx context.Context, hks []hooks.Hook, cfg *config.Config, summaries []playlistSummary) {
+	for _, hook := range hks {
+		dirs := newDirs(summaries, func(name string) bool {
+			return cfg.PlaylistUsesHook(cfg.Playlists[name], hook.Name())
+		})
+		if len(dirs) == 0 {
+			continue
+		}
+		if err := hook.Run(ctx, dirs); err != nil {
+			slog.Error("Post-download hook failed; new files wait for the next scan", "hook", hook.Name(), "error", err)
+			continue
+		}
+		slog.Debug("Ran post-download hook", "hook", hook.Name(), "dirs", len(dirs))
+	}
+}
+
+// syncPlexPlaylists mirrors the enabled playlists with plex_playlist set
+// as Plex playlists, in their YouTube order without videos since removed.
+// Every pass syncs them all, so files Plex hadn't scanned yet and syncs
+// that failed while Plex was down are caught up on the next one.
+func syncPlexPlaylists(ctx context.Context, hks []hooks.Hook, cfg *config.Config, db *database.Database) {
+	var plex *hooks.Plex
+	for _, hook := range hks {
+		if p, ok := hook.(*hooks.Plex); ok {
+			plex = p
+		}
+	}
+	if plex == nil {
+		return
+	}
+
+	names := make([]string, 0, len(cfg.Playlists))
+	for name, p := range cfg.Playlists {
+		if p.PlexPlaylist && p.IsEnabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := cfg.Playlists[name]
+		videos, err := db.GetPlaylistVideosOrdered(downloader.PlaylistID(p.URL))
+		if err != nil {
+			slog.Error("Failed to load playlist for Plex", "playlist", name, "error", err)
+			continue
+		}
+		pl := hooks.PlexPlaylist{Title: name, Video: cfg.PlaylistMediaType(p) == config.MediaTypeVideo}
+		for _, v := range videos {
+			if v.Position > 0 { // Videos no longer listed have none
+				pl.Files = append(pl.Files, v.FilePath)
+			}
+		}
+
+		missing, err := plex.SyncPlaylist(ctx, pl)
+		switch {
+		case err != nil:
+			slog.Warn("Failed to update Plex playlist; trying again after the next pass", "playlist", name, "error", err)
+		case missing > 0:
+			slog.Info("Updated Plex playlist; files Plex hasn't scanned yet are added after the next pass", "playlist", name, "not_scanned", missing)
+		default:
+			slog.Debug("Updated Plex playlist", "playlist", name, "tracks", len(pl.Files))
+		}
+	}
+}
+
+// newDirs lists the directories the included playlists downloaded into,
+// sorted and without duplicates, so a backfill of many videos triggers one
+// scan per directory
+func newDirs(summaries []playlistSummary, include func(playlist string) bool) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, s := range summaries {
+		if !include(s.Name) {
+			continue
+		}
+		for _, path := range s.files {
+			dir := filepath.Dir(path)
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
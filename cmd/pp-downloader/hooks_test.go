@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/hooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHook records the directories it's run on
+type fakeHook struct {
+	name string
+	runs [][]string
+	err  error
+}
+
+func (f *fakeHook) Name() string { return f.name }
+
+func (f *fakeHook) Run(ctx context.Context, dirs []string) error {
+	f.runs = append(f.runs, dirs)
+	return f.err
+}
+
+func TestNewDirs(t *testing.T) {
+	summaries := []playlistSummary{
+		{Name: "Talks", files: []string{"/music/Talks/b.mp3", "/music/Talks/a.mp3"}},
+		{Name: "Empty"},
+		{Name: "Jazz", files: []string{"/music/Jazz/a.mp3"}},
+	}
+	all := func(string) bool { return true }
+	assert.Equal(t, []string{"/music/Jazz", "/music/Talks"}, newDirs(summaries, all))
+	assert.Equal(t, []string{"/music/Jazz"}, newDirs(summaries, func(name string) bool { return name == "Jazz" }))
+	assert.Empty(t, newDirs([]playlistSummary{{Name: "Empty"}}, all))
+}
+
+func TestRunHooks(t *testing.T) {
+	cfg := &config.Config{Playlists: map[string]config.PlaylistConfig{
+		"Jazz":    {URL: "PL_JAZZ", Hooks: []string{config.HookNavidrome}},
+		"Lessons": {URL: "PL_LESSONS", Hooks: []string{config.HookJellyfin}},
+		"Talks":   {URL: "PL_TALKS"},
+	}}
+	summaries := []playlistSummary{
+		{Name: "Jazz", files: []string{"/music/Jazz/a.mp3"}},
+		{Name: "Lessons", files: []string{"/music/Lessons/a.mp4"}},
+		{Name: "Talks", files: []string{"/music/Talks/a.mp3"}},
+	}
+	jellyfin := &fakeHook{name: config.HookJellyfin, err: errors.New("jellyfin is down")}
+	navidrome := &fakeHook{name: config.HookNavidrome}
+	runHooks(context.Background(), []hooks.Hook{jellyfin, navidrome}, cfg, summaries)
+	assert.Equal(t, [][]string{{"/music/Lessons", "/music/Talks"}}, jellyfin.runs, "Playlists only go to the hooks they name")
+	assert.Equal(t, [][]string{{"/music/Jazz", "/music/Talks"}}, navidrome.runs, "A failing hook doesn't stop the others")
+
+	runHooks(context.Background(), []hooks.Hook{navidrome}, cfg, []playlistSummary{{Name: "Jazz"}})
+	assert.Len(t, navidrome.runs, 1, "Passes without downloads don't run hooks")
+}
+
+func TestNewHooks(t *testing.T) {
+	assert.Empty(t, newHooks(context.Background(), &config.Config{}))
+
+	hks := newHooks(context.Background(), &config.Config{PostDownloadCommand: "true"})
+	if assert.Len(t, hks, 1) {
+		assert.Equal(t, "command", hks[0].Name())
+	}
+
+	plex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Token") != "plex-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer plex.Close()
+	hks = newHooks(context.Background(), &config.Config{PlexURL: plex.URL, PlexToken: "plex-token", PlexSection: 1})
+	if assert.Len(t, hks, 1) {
+		assert.Equal(t, "plex", hks[0].Name())
+	}
+	hks = newHooks(context.Background(), &config.Config{PlexURL: plex.URL, PlexToken: "wrong", PlexSection: 1})
+	assert.Empty(t, hks, "A rejected token turns Plex scans off")
+}
+
+func TestSyncPlexPlaylists(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	music := filepath.Join(dir, "music")
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "Jazz")
+	require.NoError(t, err)
+	for i, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc"} {
+		require.NoError(t, db.RecordDownload("PL_JAZZ", "Jazz", database.DownloadRecord{
+			YoutubeID: id,
+			Metadata:  database.VideoMetadata{Title: id},
+			FilePath:  filepath.Join(music, "Jazz", id+".mp3"),
+			Position:  i + 1,
+		}))
+	}
+	// b moved to the top and c was removed from the playlist
+	require.NoError(t, db.SetPlaylistPositions("PL_JAZZ", map[string]int{"bbbbbbbbbbb": 1, "aaaaaaaaaaa": 2}))
+
+	var created []string
+	plex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []map[string]any
+		switch r.URL.Path {
+		case "/identity":
+			fmt.Fprint(w, `{"MediaContainer": {"machineIdentifier": "abc123"}}`)
+			return
+		case "/library/sections/3/all":
+			for key, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc"} {
+				file := filepath.Join(music, "Jazz", id+".mp3")
+				items = append(items, map[string]any{"ratingKey": fmt.Sprint(key + 1), "Media": []any{map[string]any{"Part": []any{map[string]any{"file": file}}}}})
+			}
+		case "/playlists":
+			if r.Method == http.MethodPost {
+				created = append(created, r.URL.Query().Get("title")+" "+r.URL.Query().Get("uri"))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"MediaContainer": map[string]any{"totalSize": len(items), "Metadata": items}})
+	}))
+	defer plex.Close()
+	p, err := hooks.NewPlex(plex.URL, "plex-token", 3, music, "", nil)
+	require.NoError(t, err)
+
+	cfg := &config.Config{Playlists: map[string]config.PlaylistConfig{
+		"Jazz":  {URL: "PL_JAZZ", PlexPlaylist: true},
+		"Talks": {URL: "PL_TALKS"},
+	}}
+	syncPlexPlaylists(context.Background(), []hooks.Hook{&fakeHook{name: "command"}}, cfg, db)
+	assert.Empty(t, created, "Nothing happens without Plex")
+
+	syncPlexPlaylists(context.Background(), []hooks.Hook{p}, cfg, db)
+	assert.Equal(t, []string{"Jazz server://abc123/com.plexapp.plugins.library/library/metadata/2,1"}, created)
+}
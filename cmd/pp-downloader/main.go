@@ -2,42 +2,93 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/sampiiiii/pp-downloader/internal/api"
+	"github.com/sampiiiii/pp-downloader/internal/artwork"
 	"github.com/sampiiiii/pp-downloader/internal/config"
 	"github.com/sampiiiii/pp-downloader/internal/database"
 	"github.com/sampiiiii/pp-downloader/internal/downloader"
+	"github.com/sampiiiii/pp-downloader/internal/hooks"
+	"github.com/sampiiiii/pp-downloader/internal/logfile"
+	"github.com/sampiiiii/pp-downloader/internal/notify"
+	"github.com/sampiiiii/pp-downloader/internal/validator"
+	"github.com/sampiiiii/pp-downloader/internal/ytdlp"
 )
 
+// persistentFailureAttempts is how many failed passes get a video listed in
+// the summary logged after each scheduler pass
+const persistentFailureAttempts = 2
+
+// allPlaylistsFailing is set while every playlist fails, so a broken yt-dlp
+// is only notified once
+var allPlaylistsFailing atomic.Bool
+
 // playlistState tracks the state of each playlist for adaptive polling
 type playlistState struct {
 	lastChecked time.Time
 	lastChange  time.Time
 	interval    time.Duration
+	running     bool // A pass over the playlist is in progress
 	mu          sync.Mutex
 }
 
 // calculateInterval determines the polling interval based on playlist activity
-func (ps *playlistState) calculateInterval() time.Duration {
+func (ps *playlistState) calculateInterval(cfg *config.Config, playlist config.PlaylistConfig) time.Duration {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	now := time.Now()
-	// If we've seen changes recently, poll more frequently
-	if now.Sub(ps.lastChange) < time.Hour*24 {
-		return time.Minute * 5 // Check every 5 minutes for active playlists
+	return cfg.PlaylistInterval(playlist, ps.lastChange)
+}
+
+// loadPlaylistStates seeds each playlist's state from when the database last
+// saw it checked and changed, so a restart doesn't recheck every playlist at
+// once or forget which ones are active
+func loadPlaylistStates(db *database.Database, cfg *config.Config) map[string]*playlistState {
+	schedules, err := db.GetPlaylistSchedules()
+	if err != nil {
+		slog.Warn("Failed to load playlist schedules; every playlist is checked now", "error", err)
+	}
+	states := make(map[string]*playlistState, len(cfg.Playlists))
+	for _, playlist := range cfg.Playlists {
+		schedule := schedules[downloader.PlaylistID(playlist.URL)]
+		states[playlist.URL] = &playlistState{
+			lastChecked: schedule.LastChecked,
+			lastChange:  schedule.LastChanged,
+			interval:    time.Minute * 5, // Start with 5 minute intervals
+		}
 	}
-	return time.Minute * 15 // Default to 15 minutes for less active playlists
+	return states
+}
+
+// start marks a pass over the playlist as started; it returns false if one
+// is already running, so a slow playlist isn't checked twice at once
+func (ps *playlistState) start() bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.running {
+		return false
+	}
+	ps.running = true
+	return true
 }
 
 // updateState updates the playlist state after a check
@@ -46,6 +97,7 @@ func (ps *playlistState) updateState(changed bool) {
 	defer ps.mu.Unlock()
 
 	now := time.Now()
+	ps.running = false
 	ps.lastChecked = now
 	if changed {
 		ps.lastChange = now
@@ -53,56 +105,207 @@ func (ps *playlistState) updateState(changed bool) {
 }
 
 func main() {
-	// Set up logging
-	logFile, err := os.OpenFile("pp-downloader.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		log.Printf("Failed to open log file: %v", err)
-	} else {
-		defer logFile.Close()
-		log.SetOutput(io.MultiWriter(os.Stdout, logFile))
+	opts, err := parseArgs(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	config.SetFlags(opts.flags)
+
+	// Commands log to stderr so exported data can go to stdout. Until the
+	// config is loaded, logs are text at the info level.
+	command := opts.command
+	watcher := len(command) == 0 && !opts.printConfig && !opts.sendDigestNow
+	var logOutput io.Writer = os.Stderr
+	if watcher {
+		logOutput = os.Stdout
 	}
+	slog.SetDefault(newLogger(logOutput, slog.LevelInfo, "text"))
 
-	log.Println("Starting Plex Playlist Downloader...")
+	// Neither needs a config; there's none to load until init writes one
+	if len(command) > 0 {
+		switch command[0] {
+		case "init":
+			if err := initConfig(command[1:], exec.LookPath); err != nil {
+				fatal("Init failed", "error", err)
+			}
+			return
+		case "version":
+			printVersion(os.Stdout)
+			return
+		}
+	}
 
-	// Load configuration
-	cfg, err := config.LoadConfig(".")
+	if watcher {
+		slog.Info("Starting Plex Playlist Downloader", "version", version)
+	}
+	a, err := loadApp(watcher)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to load config", "error", err)
 	}
-	log.Printf("Configuration loaded: %+v", cfg)
 
-	// Set default DB path if not specified
-	if cfg.DBPath == "" {
-		cfg.DBPath = "/config/downloads.db"
+	if opts.printConfig {
+		err := a.cfg.PrintConfig(os.Stdout)
+		a.Close()
+		if err != nil {
+			fatal("Failed to print config", "error", err)
+		}
+		return
 	}
 
-	// Ensure parent directory exists
-	if err := os.MkdirAll(filepath.Dir(cfg.DBPath), 0755); err != nil {
-		log.Fatalf("Failed to create database directory: %v", err)
+	// The healthcheck only talks to the running watcher
+	if len(command) > 0 && command[0] == "healthcheck" {
+		err := healthcheck(a.cfg, os.Stdout)
+		a.Close()
+		if err != nil {
+			fatal("Healthcheck failed", "error", err)
+		}
+		return
 	}
 
-	// Initialize database
-	db, err := database.NewDatabase(cfg.DBPath)
-	if err != nil {
-		log.Fatalf("Error initializing database: %v", err)
+	if err := a.openDatabase(); err != nil {
+		a.Close()
+		fatal("Failed to open the database", "error", err)
+	}
+
+	if opts.sendDigestNow {
+		err := sendDigestNow(a.cfg, a.db)
+		a.Close()
+		if err != nil {
+			fatal("Failed to send digest", "error", err)
+		}
+		return
 	}
-	defer db.Close()
+
+	if len(command) > 0 {
+		err := runCommand(a.cfg, a.db, command)
+		a.Close()
+		if err != nil {
+			fatal("Command failed", "command", command[0], "error", err)
+		}
+		return
+	}
+
+	code := runWatcher(a, opts)
+	a.Close()
+	os.Exit(code)
+}
+
+// runWatcher runs the playlist watcher until SIGINT or SIGTERM, or with
+// --once checks every playlist once. It returns the exit code.
+func runWatcher(a *app, opts options) int {
+	cfg, db, logger := a.cfg, a.db, a.logger
 
 	// Ensure music directory exists
 	if err := os.MkdirAll(cfg.MusicParentDir, 0755); err != nil {
-		log.Fatalf("Error creating music directory: %v", err)
+		slog.Error("Failed to create music directory", "error", err)
+		return exitFailed
 	}
 
-	// Create downloader
-	dl := downloader.NewDownloader(cfg.FFmpegPath, cfg.MusicParentDir, db)
+	// Old yt-dlp releases break as YouTube changes, so update before anything runs
+	if cfg.AutoUpdateYTDLP {
+		updateYTDLP(context.Background(), cfg)
+	}
+
+	caps, err := preflight(cfg)
+	if err != nil {
+		slog.Error("Preflight check failed", "error", err)
+		return exitFailed
+	}
+
+	notifier := notify.Discard
+	sinks, err := newSinks(cfg)
+	if err != nil {
+		slog.Error("Invalid notification settings", "error", err)
+		return exitFailed
+	}
+	if len(sinks) > 0 {
+		multi := make(notify.Multi, len(sinks))
+		for i, s := range sinks {
+			multi[i] = s
+		}
+		notifier = multi
+	}
+	mail, err := newMailer(cfg)
+	if err != nil {
+		slog.Error("Invalid email settings", "error", err)
+		return exitFailed
+	}
+
+	uploads, err := newUploadQueue(cfg, db, logger)
+	if err != nil {
+		slog.Error("Invalid upload settings", "error", err)
+		return exitFailed
+	}
+	var uploader downloader.Uploader // Left nil rather than a nil *upload.Queue
+	if uploads != nil {
+		uploader = uploads
+	}
+
+	dl := newDownloader(cfg, db, caps, notifier, uploader, logger)
+	logThrottling(cfg)
+
+	// Nothing is downloading yet, so anything staged is from a crash
+	if err := dl.CleanStaging(); err != nil {
+		slog.Warn("Failed to clean up interrupted downloads", "error", err)
+	}
+	validation := validator.Options{
+		MaxAge:            cfg.ValidationMaxAge,
+		DeepInterval:      cfg.DeepValidationInterval,
+		MaxBytesPerSecond: cfg.ValidationMaxRate,
+		ReportPath:        cfg.ValidationReport,
+		SampleSize:        cfg.ValidationSampleSize,
+		SamplePercent:     cfg.ValidationSamplePercent,
+		SampleInterval:    cfg.ValidationSampleInterval,
+		EscalateSample:    cfg.ValidationSampleEscalate,
+		InWindow:          cfg.Schedule.Allows,
+		Notifier:          notifier,
+		Logger:            logger,
+
+		FFprobePath:              cfg.FFprobePath,
+		Workers:                  cfg.ValidationWorkers,
+		DurationTolerance:        cfg.DurationTolerance,
+		DurationTolerancePercent: cfg.DurationTolerancePercent,
+	}
+	// Playlists can be reloaded while running; see reloadConfig
+	var live atomic.Pointer[config.Config]
+	live.Store(cfg)
+	if cfg.AutoRedownload {
+		validation.Redownload = redownloader(&live, dl)
+	}
+	if uploads != nil {
+		validation.StatRemote = uploads.Stat
+	}
+	v := validator.NewValidator(db, cfg.MusicParentDir, cfg.ValidationInterval, validation)
+	if _, err := v.CleanupTempFiles(cfg.TempFileMaxAge, cfg.CleanupDryRun); err != nil {
+		slog.Warn("Failed to clean up temp files", "error", err)
+	}
 
 	// Initialize playlist states
-	playlistStates := make(map[string]*playlistState)
-	for name, url := range cfg.Playlists {
-		playlistStates[url] = &playlistState{
-			interval: time.Minute * 5, // Start with 5 minute intervals
+	playlistStates := loadPlaylistStates(db, cfg)
+	for name, playlist := range cfg.Playlists {
+		if !playlist.IsEnabled() {
+			slog.Info("Playlist is disabled; it won't be checked", "playlist", name)
+			continue
 		}
-		log.Printf("Watching playlist: %s (%s)", name, url)
+		slog.Info("Watching playlist", "playlist", name, "url", playlist.URL, "media_type", cfg.PlaylistMediaType(playlist))
+	}
+
+	hks := newHooks(context.Background(), cfg)
+
+	if opts.once {
+		// One pass over every playlist, for cron jobs and smoke tests;
+		// validation, backups and notifications are left to the watcher
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		summaries := <-processAllPlaylists(ctx, cfg, db, dl, notify.Discard, hks, playlistStates, true)
+		if uploads != nil {
+			uploads.Drain(ctx)
+		}
+		interrupted := ctx.Err() != nil
+		stop()
+		return finishOnce(summaries, interrupted, os.Stdout, opts.summaryFile)
 	}
 
 	// Handle graceful shutdown
@@ -113,48 +316,275 @@ func main() {
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
 	var wg sync.WaitGroup
+	if len(sinks) > 0 {
+		slog.Info("Sending notifications", "count", len(sinks))
+	}
+	for _, sink := range sinks {
+		wg.Add(1)
+		go func(sink notify.Sink) {
+			defer wg.Done()
+			sink.Start(ctx)
+		}(sink)
+	}
+	if len(sinks) > 0 {
+		go sendStats(ctx, db, notifier, cfg.NotifyStatsInterval)
+	}
+
+	// The status API asks the scheduler about its playlists through calls;
+	// without the API nothing is ever sent
+	health := newHealthMonitor(cfg, db)
+	var calls chan schedulerCall
+	if cfg.APIAddr != "" {
+		scheduler := newSchedulerAPI()
+		calls = scheduler.calls
+		opts := api.Options{Token: cfg.APIToken, Health: health.check, Logger: logger}
+		if cfg.FeedsEnabled() {
+			opts.FeedDir = cfg.FeedDir
+		}
+		server := api.NewServer(db, scheduler, opts)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.ListenAndServe(ctx, cfg.APIAddr); err != nil {
+				slog.Error("Status API stopped", "error", err)
+			}
+		}()
+	}
+
+	if uploads != nil {
+		slog.Info("Uploading downloads", "delete_local", cfg.UploadDeleteLocal)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uploads.Start(ctx)
+		}()
+	}
+
+	reloads := watchForReloads(ctx, cfg.PlaylistsFile())
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runScheduler(ctx, cfg, dl, playlistStates)
+		runScheduler(ctx, &live, db, dl, notifier, hks, playlistStates, reloads, calls, health, opts.refreshOnStart)
 	}()
 
-	log.Println("Plex Playlist Downloader started. Press Ctrl+C to stop.")
+	if cfg.AutoUpdateYTDLP {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runYTDLPUpdater(ctx, cfg)
+		}()
+	}
+
+	// Art that couldn't be embedded before a dependency was installed
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		repairArt(ctx, db, caps, cfg.Schedule.Allows, cfg.WatchTick, redownloader(&live, dl))
+	}()
+
+	slog.Info("Validating files", "interval", cfg.ValidationInterval, "max_age", cfg.ValidationMaxAge)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		v.Start(ctx)
+	}()
+
+	if cfg.BackupInterval > 0 {
+		slog.Info("Backing up the database", "dir", cfg.BackupDir, "interval", cfg.BackupInterval, "keep", cfg.BackupKeep)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runBackups(ctx, cfg, db)
+		}()
+	}
+
+	if mail != nil {
+		slog.Info("Emailing digests", "to", cfg.SMTPTo, "schedule", cfg.DigestSchedule)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runDigests(ctx, cfg, db, mail)
+		}()
+	}
+
+	slog.Info("Plex Playlist Downloader started. Press Ctrl+C to stop.")
 
 	// Wait for shutdown signal
 	<-sigCh
-	log.Println("Shutting down...")
-	cancel()   // Signal tasks to stop
-	wg.Wait()  // Wait for scheduler to finish
-	log.Println("Shutdown complete.")
+	slog.Info("Shutting down")
+	cancel()  // Signal tasks to stop
+	wg.Wait() // Wait for scheduler to finish
+	slog.Info("Shutdown complete")
+	return exitOK
+}
+
+// preflight fails fast if the external tools are missing, and probes
+// yt-dlp so unsupported options can be dropped instead of failing. In auto
+// mode a missing yt-dlp only means downloads go through the native client,
+// and the returned capabilities are nil.
+func preflight(cfg *config.Config) (*ytdlp.Capabilities, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	ffmpegVersion, err := downloader.CheckFFmpeg(ctx, cfg.FFmpegPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DownloadBackend == downloader.BackendNative {
+		slog.Info("Using the native YouTube client", "ffmpeg_version", ffmpegVersion, "ffmpeg", cfg.FFmpegPath)
+		return nil, nil
+	}
+	ytdlpVersion, err := downloader.CheckYTDLP(ctx, cfg.YTDLPPath)
+	if err != nil {
+		if cfg.DownloadBackend == downloader.BackendYTDLP {
+			return nil, err
+		}
+		slog.Warn("Downloading with the native YouTube client, which can't list channels or keep video", "error", err)
+		return nil, nil
+	}
+
+	slog.Info("Using yt-dlp", "ytdlp_version", ytdlpVersion, "ytdlp", cfg.YTDLPPath, "ffmpeg_version", ffmpegVersion, "ffmpeg", cfg.FFmpegPath)
+	if cfg.MinYTDLPVersion != "" && ytdlp.CompareVersions(ytdlpVersion, cfg.MinYTDLPVersion) < 0 {
+		return nil, fmt.Errorf("yt-dlp %s is older than MIN_YTDLP_VERSION %s; update it (or set AUTO_UPDATE_YTDLP=true) and restart",
+			ytdlpVersion, cfg.MinYTDLPVersion)
+	}
+
+	caps, err := ytdlp.Probe(ctx, cfg.YTDLPPath)
+	if err != nil {
+		slog.Warn("Failed to probe yt-dlp capabilities, assuming full support", "error", err)
+		return nil, nil
+	}
+	slog.Info("Detected yt-dlp", "version", caps.Version, "options", len(caps.Options))
+	return caps, nil
 }
 
-// runScheduler manages the scheduling of playlist checks
-func runScheduler(ctx context.Context, cfg *config.Config, dl *downloader.Downloader, states map[string]*playlistState) {
-	// Initial processing
-	processAllPlaylists(ctx, cfg, dl, states, true)
+// newLogger returns a logger writing text or JSON records at level and
+// above to w
+func newLogger(w io.Writer, level slog.Level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// fatal logs an error and exits, like log.Fatal
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
 
-	// Create a ticker for the scheduler (runs every minute)
-	ticker := time.NewTicker(time.Minute)
+// openLogFile opens the log file for appending, rotated by size. It
+// returns nil when logging to a file is off or fails, so logs only go to
+// stdout.
+func openLogFile(cfg *config.Config) *logfile.Writer {
+	if cfg.LogFile == "none" {
+		return nil
+	}
+	w, err := logfile.Open(cfg.LogFile, cfg.LogMaxSize, cfg.LogKeep)
+	if err != nil {
+		slog.Warn("Failed to open log file, logging to stdout only", "error", err)
+		return nil
+	}
+	return w
+}
+
+// runScheduler manages the scheduling of playlist checks. The playlists are
+// reloaded on each value from reloads; states is only touched here, so a
+// reload can't race a pass in progress. With refresh, every playlist is
+// checked at startup rather than only those that are due.
+func runScheduler(ctx context.Context, live *atomic.Pointer[config.Config], db *database.Database, dl *downloader.Downloader, n notify.Notifier, hks []hooks.Hook, states map[string]*playlistState, reloads <-chan struct{}, calls <-chan schedulerCall, health *healthMonitor, refresh bool) {
+	cfg := live.Load()
+	if cfg.Schedule.Enabled() {
+		slog.Info("Downloading only within the schedule", "schedule", cfg.Schedule.String())
+	}
+	slog.Info("Checking playlists", "interval", cfg.WatchInterval, "active_interval", cfg.WatchActiveInterval, "active_window", cfg.WatchActiveWindow)
+	allowed := cfg.Schedule.Allows(time.Now())
+
+	// Passes run in the background, but on shutdown the scheduler waits for
+	// them so downloads that completed are recorded before the database
+	// closes
+	var passes sync.WaitGroup
+	defer passes.Wait()
+	pass := func(cfg *config.Config, force bool) {
+		done := processAllPlaylists(ctx, cfg, db, dl, n, hks, states, force)
+		passes.Add(1)
+		go func() {
+			defer passes.Done()
+			<-done
+		}()
+	}
+
+	// Initial processing; playlists checked recently before a restart wait
+	// for their interval unless asked otherwise
+	pass(cfg, refresh)
+	health.beat(ctx)
+
+	// Create a ticker for the scheduler, which decides when playlists are due
+	ticker := time.NewTicker(cfg.WatchTick)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Scheduler stopped")
+			slog.Info("Scheduler stopped")
 			return
+		case <-reloads:
+			if reloadConfig(live, states) {
+				// New playlists have no state yet, so they are checked now
+				pass(live.Load(), false)
+			}
+		case call := <-calls:
+			// From the status API; a refresh makes its playlist due
+			if cfg := live.Load(); call(cfg, states) {
+				pass(cfg, false)
+			}
 		case <-ticker.C:
-			processAllPlaylists(ctx, cfg, dl, states, false)
+			cfg := live.Load()
+			// Videos queued outside the window download as soon as it opens
+			opened := false
+			if inWindow := cfg.Schedule.Allows(time.Now()); inWindow != allowed {
+				allowed, opened = inWindow, inWindow
+				if inWindow {
+					slog.Info("Download window opened")
+				} else {
+					slog.Info("Download window closed; new videos are queued until it opens")
+				}
+			}
+			pass(cfg, opened)
+			health.beat(ctx)
 		}
 	}
 }
 
-// processAllPlaylists processes all playlists, either immediately or based on their schedule
-func processAllPlaylists(ctx context.Context, cfg *config.Config, dl *downloader.Downloader, states map[string]*playlistState, force bool) {
+// processAllPlaylists processes all playlists, either immediately or based
+// on their schedule. The returned channel receives what each checked
+// playlist did, by name, and is closed once the pass and its summary are
+// done.
+func processAllPlaylists(ctx context.Context, cfg *config.Config, db *database.Database, dl *downloader.Downloader, n notify.Notifier, hks []hooks.Hook, states map[string]*playlistState, force bool) <-chan []playlistSummary {
+	done := make(chan []playlistSummary, 1)
 	var wg sync.WaitGroup
+	var downloaded atomic.Bool
+	var failed atomic.Int32
+	var mu sync.Mutex
+	var summaries []playlistSummary
+	started := 0
 	now := time.Now()
 
-	for name, url := range cfg.Playlists {
+	// Outside the schedule's windows playlists are only listed, if at all
+	listOnly := !cfg.Schedule.Allows(now)
+	if listOnly && cfg.Schedule.PauseListing {
+		close(done)
+		return done
+	}
+
+	for name, playlist := range cfg.Playlists {
+		// Disabled playlists keep their state, rows and files
+		if !playlist.IsEnabled() {
+			continue
+		}
+		url := playlist.URL
 		state, exists := states[url]
 		if !exists {
 			state = &playlistState{
@@ -164,58 +594,515 @@ func processAllPlaylists(ctx context.Context, cfg *config.Config, dl *downloader
 		}
 
 		// Check if it's time to process this playlist
-		if force || now.Sub(state.lastChecked) >= state.calculateInterval() {
+		if (force || now.Sub(state.lastChecked) >= state.calculateInterval(cfg, playlist)) && state.start() {
 			wg.Add(1)
+			started++
+			opts := playlistOptions(cfg, playlist)
+			opts.ListOnly = listOnly
 			go func(name, url string, s *playlistState) {
 				defer wg.Done()
-				processPlaylist(ctx, dl, name, url, s)
+				summary, err := processPlaylist(ctx, db, dl, n, name, url, opts, s)
+				if summary.Downloaded > 0 {
+					downloaded.Store(true)
+				}
+				if err != nil && ctx.Err() == nil {
+					failed.Add(1)
+				}
+				mu.Lock()
+				summaries = append(summaries, summary)
+				mu.Unlock()
 			}(name, url, state)
 		}
 	}
 
-	// Don't wait for the initial processing to complete
-	// wg.Wait()
+	// Don't block the scheduler, but summarize failures once the pass is done
+	if started == 0 {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		wg.Wait()
+		if ctx.Err() == nil {
+			notifyPlaylistFailures(n, started, int(failed.Load()))
+			notifyFailingVideos(db, n, cfg.NotifyFailedAttempts)
+			logPersistentFailures(db)
+			logStatusSummary(db)
+			if downloaded.Load() {
+				logDownloadsToday(db)
+			}
+			runHooks(ctx, hks, cfg, summaries)
+			syncPlexPlaylists(ctx, hks, cfg, db)
+			writeFeeds(cfg, db)
+		}
+		sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+		done <- summaries
+	}()
+	return done
 }
 
-// processPlaylist processes a single playlist and updates its state
-func processPlaylist(ctx context.Context, dl *downloader.Downloader, name, url string, state *playlistState) {
-	log.Printf("Processing playlist: %s (%s)", name, url)
+// newSinks creates a webhook notifier for each NOTIFY_WEBHOOK_URL and a
+// notifier for each entry of the notifications config. They don't go
+// through PROXY, as webhooks are often on the local network. Errors leave
+// out URLs, which may hold a secret.
+func newSinks(cfg *config.Config) ([]notify.Sink, error) {
+	var sinks []notify.Sink
+	for i, rawURL := range cfg.NotifyWebhookURLs {
+		webhook, err := notify.NewWebhook(rawURL, cfg.NotifyWebhookToken, cfg.NotifyEvents, nil)
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL %d: %w", i+1, err)
+		}
+		if cfg.NotifyMessageTemplate != "" {
+			if err := webhook.SetMessageTemplate(cfg.NotifyMessageTemplate); err != nil {
+				return nil, err
+			}
+		}
+		sinks = append(sinks, webhook)
+	}
 
-	// Track if we made any changes
-	changed := false
+	for i, n := range cfg.Notifications {
+		var sink interface {
+			notify.Sink
+			SetMessageTemplate(string) error
+		}
+		var err error
+		switch n.Type {
+		case config.NotifyWebhook:
+			sink, err = notify.NewWebhook(n.URL, n.Token, n.Events, nil)
+		case config.NotifyDiscord:
+			sink, err = notify.NewDiscord(n.URL, n.Events, nil)
+		case config.NotifyNtfy:
+			sink, err = notify.NewNtfy(n.URL, n.Topic, n.Token, n.Priority, n.Events, nil)
+		default:
+			err = fmt.Errorf("unknown type %q", n.Type)
+		}
+		if err == nil && n.Template != "" {
+			err = sink.SetMessageTemplate(n.Template)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("notifications[%d]: %w", i, err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.MQTTBroker != "" {
+		mqtt, err := notify.NewMQTT(cfg.MQTTBroker, cfg.MQTTClientID, cfg.MQTTUsername, cfg.MQTTPassword, cfg.MQTTTopicPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("MQTT_BROKER: %w", err)
+		}
+		sinks = append(sinks, mqtt)
+	}
+	return sinks, nil
+}
+
+// notifyNewDownloads sends one event for everything a playlist's pass
+// downloaded, so a backfill of many videos is a single message
+func notifyNewDownloads(n notify.Notifier, playlist string, videos []notify.Video) {
+	if len(videos) == 0 {
+		return
+	}
+	message := fmt.Sprintf("%d new videos in %s", len(videos), playlist)
+	if len(videos) == 1 {
+		message = fmt.Sprintf("New in %s: %s", playlist, videos[0].Title)
+	}
+	n.Notify(notify.Event{
+		Type:    notify.EventNewDownloads,
+		Message: message,
+		Details: map[string]any{"playlist": playlist, "videos": videos},
+	})
+}
+
+// notifyPlaylistChecked sends what a playlist's pass did, for dashboards
+// showing each playlist's latest pass
+func notifyPlaylistChecked(n notify.Notifier, summary playlistSummary) {
+	message := fmt.Sprintf("Checked %s: %d downloaded, %d failed", summary.Name, summary.Downloaded, summary.Failed)
+	if summary.Error != "" {
+		message = fmt.Sprintf("Failed to check %s: %s", summary.Name, summary.Error)
+	}
+	n.Notify(notify.Event{
+		Type:    notify.EventPlaylistChecked,
+		Message: message,
+		Details: map[string]any{
+			"playlist":   summary.Name,
+			"downloaded": summary.Downloaded,
+			"skipped":    summary.Skipped,
+			"failed":     summary.Failed,
+			"error":      summary.Error,
+		},
+	})
+}
+
+// notifyPlaylistFailures notifies when every playlist failed in a pass,
+// which usually means yt-dlp is broken or YouTube is unreachable
+func notifyPlaylistFailures(n notify.Notifier, started, failed int) {
+	if failed < started {
+		allPlaylistsFailing.Store(false)
+		return
+	}
+	if allPlaylistsFailing.Swap(true) {
+		return
+	}
+	n.Notify(notify.Event{
+		Type:    notify.EventYTDLPBroken,
+		Message: fmt.Sprintf("All %d playlists checked failed; yt-dlp may be broken or YouTube unreachable", failed),
+		Details: map[string]any{"playlists": failed},
+	})
+}
+
+// notifyFailingVideos notifies about videos that have just failed their
+// attempts-th pass, so each is only reported once
+func notifyFailingVideos(db *database.Database, n notify.Notifier, attempts int) {
+	failed, err := db.GetFailedVideos(attempts)
+	if err != nil {
+		slog.Error("Failed to list failed videos", "error", err)
+		return
+	}
+	var videos []database.FailedVideo
+	for _, f := range failed {
+		if f.Attempts == attempts {
+			videos = append(videos, f)
+		}
+	}
+	if len(videos) == 0 {
+		return
+	}
+	n.Notify(notify.Event{
+		Type:    notify.EventDownloadFailing,
+		Message: fmt.Sprintf("%d videos have failed to download %d times", len(videos), attempts),
+		Details: map[string]any{"videos": videos},
+	})
+}
 
-	// Process the playlist
-	err := dl.ProcessPlaylist(url, name, func(videoID string, downloaded bool) {
-		if downloaded {
-			changed = true
-			log.Printf("Downloaded new video from %s: %s", name, videoID)
+// logPersistentFailures lists videos that have failed on more than one pass
+func logPersistentFailures(db *database.Database) {
+	failed, err := db.GetFailedVideos(persistentFailureAttempts)
+	if err != nil {
+		slog.Error("Failed to list failed videos", "error", err)
+		return
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	slog.Warn("Videos keep failing to download", "count", len(failed))
+	for _, f := range failed {
+		slog.Warn("Video keeps failing to download", "video_id", f.YoutubeID, "playlist_id", f.PlaylistYoutubeID,
+			"attempts", f.Attempts, "error_class", f.ErrorClass, "error", errorSummary(f.LastError))
+	}
+}
+
+// statusOrder is the order statuses are listed in summaries
+var statusOrder = []string{
+	database.StatusValid, database.StatusPending, database.StatusArchive, database.StatusMissing,
+	database.StatusCorrupt, database.StatusError, database.StatusFailed,
+}
+
+// formatStatusCounts lists non-zero counts, e.g. "120 valid, 2 missing"
+func formatStatusCounts(counts map[string]int) string {
+	var parts []string
+	for _, status := range statusOrder {
+		if n := counts[status]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+	if len(parts) == 0 {
+		return "no videos"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// logStatusSummary logs each playlist's video counts by status
+func logStatusSummary(db *database.Database) {
+	playlists, err := db.GetPlaylistStatusCounts()
+	if err != nil {
+		slog.Error("Failed to count videos by status", "error", err)
+		return
+	}
+	for _, p := range playlists {
+		slog.Info("Playlist status", "playlist", p.Title, "videos", formatStatusCounts(p.Counts))
+	}
+}
+
+// logDownloadsToday logs how many videos have been downloaded since midnight
+func logDownloadsToday(db *database.Database) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	videos, err := db.GetDownloadsSince(midnight)
+	if err != nil {
+		slog.Error("Failed to count today's downloads", "error", err)
+		return
+	}
+	slog.Info("New videos downloaded today", "count", len(videos))
+}
+
+// processPlaylist processes a single playlist, updates its state and
+// reports what it did
+func processPlaylist(ctx context.Context, db *database.Database, dl *downloader.Downloader, n notify.Notifier, name, url string, opts downloader.PlaylistOptions, state *playlistState) (playlistSummary, error) {
+	summary := playlistSummary{Name: name}
+	var downloaded []notify.Video
+
+	// Process the playlist; the downloader logs each video
+	err := dl.ProcessPlaylist(ctx, url, name, opts, func(result downloader.VideoResult) {
+		summary.count(result)
+		if result.Downloaded && result.Path != "" {
+			summary.files = append(summary.files, result.Path)
+		}
+		if result.Downloaded {
+			downloaded = append(downloaded, notify.Video{
+				Title:     result.Title,
+				Channel:   result.Channel,
+				Duration:  result.Duration,
+				URL:       "https://www.youtube.com/watch?v=" + result.VideoID,
+				Thumbnail: result.Thumbnail,
+			})
 		}
 	})
+	notifyNewDownloads(n, name, downloaded)
 
 	if err != nil {
-		log.Printf("Error processing playlist %s: %v", name, err)
+		summary.Error = err.Error()
+		slog.Error("Failed to process playlist", "playlist", name, "error", err)
+	}
+	if ctx.Err() == nil {
+		notifyPlaylistChecked(n, summary)
 	}
 
-	// Update the playlist state
+	// Track if we made any changes
+	changed := summary.Downloaded > 0
+
+	// Update the playlist state. A pass cut short by shutdown isn't saved,
+	// so it is done again after a restart.
 	state.updateState(changed)
+	if ctx.Err() == nil {
+		if err := db.MarkPlaylistChecked(downloader.PlaylistID(url), changed); err != nil {
+			slog.Warn("Failed to save playlist state", "playlist", name, "error", err)
+		}
+	}
 
 	if changed {
-		log.Printf("Playlist %s was updated with new videos", name)
+		slog.Info("Playlist was updated with new videos", "playlist", name)
+	}
+	return summary, err
+}
+
+// progressLogger logs download progress at most once per interval per video
+type progressLogger struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+func newProgressLogger(interval time.Duration) *progressLogger {
+	return &progressLogger{interval: interval, last: make(map[string]time.Time)}
+}
+
+func (p *progressLogger) log(videoID string, percent float64, speed, eta string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := p.last[videoID]; ok && now.Sub(last) < p.interval && percent < 100 {
+		return
+	}
+	if percent >= 100 {
+		delete(p.last, videoID)
+	} else {
+		p.last[videoID] = now
+	}
+
+	args := []any{"video_id", videoID, "percent", math.Round(percent*10) / 10}
+	if speed != "" {
+		args = append(args, "speed", speed)
+	}
+	if eta != "" {
+		args = append(args, "eta", eta)
+	}
+	slog.Info("Download progress", args...)
+}
+
+// newHTTPClient returns the client for the app's own requests, routed
+// through the configured proxy like yt-dlp is
+func newHTTPClient(cfg *config.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy := cfg.ProxyURL(); proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+		slog.Info("Using proxy", "proxy", proxy.Redacted())
+	}
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}
+}
+
+// updateYTDLP self-updates yt-dlp. A failed update is not fatal: the
+// existing binary keeps being used, but the warning is hard to miss.
+func updateYTDLP(ctx context.Context, cfg *config.Config) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	summary, err := ytdlp.Update(ctx, cfg.YTDLPPath)
+	if err != nil {
+		slog.Error("yt-dlp self-update failed; continuing with the installed version", "error", err)
+		return
+	}
+	slog.Info("Updated yt-dlp", "summary", summary)
+
+	if cfg.MinYTDLPVersion == "" {
+		return
+	}
+	if version, err := ytdlp.Version(ctx, cfg.YTDLPPath); err == nil && ytdlp.CompareVersions(version, cfg.MinYTDLPVersion) < 0 {
+		slog.Warn("yt-dlp is still older than MIN_YTDLP_VERSION", "version", version, "min_version", cfg.MinYTDLPVersion)
+	}
+}
+
+// runYTDLPUpdater updates yt-dlp every YTDLPUpdateInterval until ctx is cancelled
+func runYTDLPUpdater(ctx context.Context, cfg *config.Config) {
+	ticker := time.NewTicker(cfg.YTDLPUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			updateYTDLP(ctx, cfg)
+		}
 	}
 }
 
-func extractPlaylistID(url string) (string, error) {
-	// Extract playlist ID from URL
-	parts := strings.Split(url, "list=")
-	if len(parts) < 2 {
-		return "", fmt.Errorf("invalid playlist URL: %s", url)
+// backupDatabase writes a timestamped backup to BackupDir and deletes all
+// but the newest BackupKeep backups
+func backupDatabase(cfg *config.Config, db *database.Database) (string, error) {
+	ext := filepath.Ext(cfg.DBPath)
+	prefix := strings.TrimSuffix(filepath.Base(cfg.DBPath), ext) + "-"
+	path := filepath.Join(cfg.BackupDir, prefix+time.Now().UTC().Format("20060102-150405")+ext)
+	if err := db.Backup(path); err != nil {
+		return "", err
 	}
 
-	// Handle case where there are query parameters after the playlist ID
-	playlistID := parts[1]
-	if ampIdx := strings.Index(playlistID, "&"); ampIdx != -1 {
-		playlistID = playlistID[:ampIdx]
+	// Timestamped names sort oldest first
+	backups, err := filepath.Glob(filepath.Join(cfg.BackupDir, prefix+"*"+ext))
+	if err != nil {
+		return path, fmt.Errorf("failed to list backups: %w", err)
+	}
+	sort.Strings(backups)
+	for len(backups) > cfg.BackupKeep {
+		if err := os.Remove(backups[0]); err != nil {
+			return path, fmt.Errorf("failed to delete old backup: %w", err)
+		}
+		backups = backups[1:]
 	}
+	return path, nil
+}
+
+// runBackups backs up the database every BackupInterval until ctx is cancelled
+func runBackups(ctx context.Context, cfg *config.Config, db *database.Database) {
+	ticker := time.NewTicker(cfg.BackupInterval)
+	defer ticker.Stop()
 
-	return playlistID, nil
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if path, err := backupDatabase(cfg, db); err != nil {
+				slog.Error("Database backup failed", "error", err)
+			} else {
+				slog.Info("Backed up the database", "path", path)
+			}
+		}
+	}
+}
+
+// logThrottling reports the effective download rate limit and spacing
+func logThrottling(cfg *config.Config) {
+	rate := "unlimited"
+	if cfg.RateLimit != "" {
+		rate = cfg.RateLimit + "/s"
+	}
+	sleep := "off"
+	if cfg.SleepBetweenDownloads > 0 {
+		sleep = cfg.SleepBetweenDownloads.String()
+	}
+	slog.Info("Download throttling", "rate_limit", rate, "sleep_between_downloads", sleep, "concurrent_downloads", cfg.MaxConcurrentDownloads)
+}
+
+// newDownloader creates a downloader from the configuration
+func newDownloader(cfg *config.Config, db *database.Database, caps *ytdlp.Capabilities, n notify.Notifier, uploader downloader.Uploader, logger *slog.Logger) *downloader.Downloader {
+	return downloader.NewDownloader(cfg.FFmpegPath, cfg.MusicParentDir, db, downloader.Options{
+		Artwork:                artwork.NewFetcher(newHTTPClient(cfg), cfg.ArtworkCacheDir, cfg.ArtworkMaxDimension),
+		Capabilities:           caps,
+		LinkMode:               cfg.LinkMode,
+		MaxConcurrentDownloads: cfg.MaxConcurrentDownloads,
+		Retry: downloader.RetryPolicy{
+			Attempts:  cfg.RetryAttempts,
+			BaseDelay: cfg.RetryBaseDelay,
+			MaxDelay:  cfg.RetryMaxDelay,
+			MaxPasses: cfg.RetryMaxPasses,
+		},
+		RateLimit:             cfg.RateLimit,
+		SleepBetweenDownloads: cfg.SleepBetweenDownloads,
+		Proxy:                 cfg.Proxy,
+		YTDLPPath:             cfg.YTDLPPath,
+		Backend:               cfg.DownloadBackend,
+		HTTPClient:            &http.Client{Transport: newHTTPClient(cfg).Transport}, // Streams can take longer than the usual timeout
+		PlaylistFetchTimeout:  cfg.PlaylistFetchTimeout,
+		TempDir:               cfg.TempDir,
+		SkipChecksums:         cfg.SkipChecksums,
+		OnProgress:            newProgressLogger(15 * time.Second).log,
+		MinFreeSpace:          cfg.MinFreeSpace,
+		FullScanInterval:      cfg.WatchFullScanInterval,
+		FFprobePath:           cfg.FFprobePath,
+		SidecarFormat:         cfg.SidecarFormat,
+		Uploader:              uploader,
+		Notifier:              n,
+		Logger:                logger,
+	})
+}
+
+// redownloader downloads a video again into the folder of the configured
+// playlist holding its file, with that playlist's settings
+func redownloader(live *atomic.Pointer[config.Config], dl *downloader.Downloader) func(context.Context, database.Video) (bool, error) {
+	return func(ctx context.Context, video database.Video) (bool, error) {
+		name, opts := ownerPlaylist(live.Load(), video.PlaylistYoutubeID, video.PlaylistTitle)
+		return dl.Redownload(ctx, video, name, opts)
+	}
+}
+
+// ownerPlaylist returns the name and settings of the configured playlist
+// with a YouTube ID, or title and the global defaults for one no longer
+// configured
+func ownerPlaylist(cfg *config.Config, playlistYoutubeID, title string) (string, downloader.PlaylistOptions) {
+	for name, playlist := range cfg.Playlists {
+		if downloader.PlaylistID(playlist.URL) == playlistYoutubeID {
+			return name, playlistOptions(cfg, playlist)
+		}
+	}
+	return title, playlistOptions(cfg, config.PlaylistConfig{})
+}
+
+// playlistOptions resolves a playlist's download settings against the global defaults
+func playlistOptions(cfg *config.Config, playlist config.PlaylistConfig) downloader.PlaylistOptions {
+	include, exclude := playlist.TitleFilters.Patterns()
+	return downloader.PlaylistOptions{
+		Quality:          cfg.PlaylistQuality(playlist),
+		MediaType:        cfg.PlaylistMediaType(playlist),
+		AudioFormat:      cfg.PlaylistAudioFormat(playlist),
+		OutputSubdir:     playlist.OutputSubdir,
+		VideoContainer:   cfg.VideoContainer,
+		CookiesPath:      cfg.PlaylistCookies(playlist),
+		FilenameTemplate: cfg.PlaylistFilenameTemplate(playlist),
+		SplitChapters:    playlist.SplitChapters,
+		SyncDeletions:    playlist.SyncDeletions,
+		LoudnessTarget:   cfg.PlaylistLoudnessTarget(playlist),
+		MaxDuration:      cfg.PlaylistMaxDuration(playlist),
+		MinDuration:      cfg.PlaylistMinDuration(playlist),
+		TitleInclude:     include,
+		TitleExclude:     exclude,
+		BlockedIDs:       cfg.PlaylistBlockedIDs(playlist),
+		Tags: downloader.TagMapping{
+			Album:           playlist.Tags.Album,
+			Artist:          playlist.Tags.Artist,
+			Title:           playlist.Tags.Title,
+			SkipTrackNumber: playlist.Tags.TrackNumber != nil && !*playlist.Tags.TrackNumber,
+			ParseTitles:     playlist.Tags.ParseTitles,
+		},
+	}
 }
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/sampiiiii/pp-downloader/internal/config"
 	"github.com/sampiiiii/pp-downloader/internal/database"
 	"github.com/sampiiiii/pp-downloader/internal/downloader"
+	"github.com/sampiiiii/pp-downloader/internal/notify"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -56,13 +61,13 @@ func TestIntegration(t *testing.T) {
 	}
 
 	// Create downloader
-	dl := downloader.NewDownloader("ffmpeg", downloadDir, db)
+	dl := downloader.NewDownloader("ffmpeg", downloadDir, db, downloader.Options{})
 
 	// Test: Download playlist
 	t.Run("DownloadPlaylist", func(t *testing.T) {
 		for _, playlist := range config.Playlists {
-			err := dl.ProcessPlaylist(playlist.ID, playlist.Name, func(videoID string, downloaded bool) {
-				t.Logf("Processed video %s, downloaded: %v", videoID, downloaded)
+			err := dl.ProcessPlaylist(context.Background(), playlist.ID, playlist.Name, downloader.PlaylistOptions{}, func(result downloader.VideoResult) {
+				t.Logf("Processed video %s, downloaded: %v", result.VideoID, result.Downloaded)
 			})
 
 			if err != nil {
@@ -70,25 +75,12 @@ func TestIntegration(t *testing.T) {
 				t.FailNow()
 			}
 
-			// Get all videos from the database using public API
-			// For now, we'll just check if any video exists
-			// In a real test, we would have a way to list videos
-			videoIDs := []string{"dQw4w9WgXcQ"} // Default test video ID
-
-			// Check if any video exists in the database
-			hasVideos := false
-			for _, id := range videoIDs {
-				exists, err := db.VideoExists(id)
-				if err == nil && exists {
-					hasVideos = true
-					break
-				}
-			}
-
-			t.Logf("Found %d videos in database: %v", len(videoIDs), videoIDs)
+			videos, err := db.ListVideos(database.ListOptions{PlaylistYoutubeID: playlist.ID})
+			require.NoError(t, err, "Failed to list videos")
+			t.Logf("Found %d videos in database", len(videos))
 
 			// Verify at least one video was added
-			assert.True(t, hasVideos, "No videos found in database")
+			assert.NotEmpty(t, videos, "No videos found in database")
 		}
 	})
 
@@ -129,3 +121,212 @@ func TestIntegration(t *testing.T) {
 		assert.True(t, len(videos) > 0, "Expected to find videos needing validation")
 	})
 }
+
+func TestCalculateInterval(t *testing.T) {
+	cfg := &config.Config{
+		WatchInterval:       time.Hour,
+		WatchActiveInterval: 2 * time.Minute,
+		WatchActiveWindow:   6 * time.Hour,
+	}
+	quiet := &playlistState{lastChange: time.Now().Add(-7 * time.Hour)}
+	active := &playlistState{lastChange: time.Now().Add(-5 * time.Hour)}
+	never := &playlistState{}
+
+	assert.Equal(t, time.Hour, quiet.calculateInterval(cfg, config.PlaylistConfig{}))
+	assert.Equal(t, 2*time.Minute, active.calculateInterval(cfg, config.PlaylistConfig{}))
+	assert.Equal(t, time.Hour, never.calculateInterval(cfg, config.PlaylistConfig{}))
+
+	active.updateState(false)
+	assert.Equal(t, 2*time.Minute, active.calculateInterval(cfg, config.PlaylistConfig{}), "A check without changes keeps the playlist active")
+	quiet.updateState(true)
+	assert.Equal(t, 2*time.Minute, quiet.calculateInterval(cfg, config.PlaylistConfig{}))
+
+	archive := config.PlaylistConfig{Interval: "24h"}
+	assert.Equal(t, 24*time.Hour, quiet.calculateInterval(cfg, archive), "A fixed interval ignores activity")
+	assert.Equal(t, 24*time.Hour, never.calculateInterval(cfg, archive))
+}
+
+func TestLoadPlaylistStates(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.GetOrCreatePlaylist("PL_ACTIVE", "Active")
+	require.NoError(t, err)
+	require.NoError(t, db.MarkPlaylistChecked("PL_ACTIVE", true))
+
+	cfg := &config.Config{
+		WatchInterval:       time.Hour,
+		WatchActiveInterval: 2 * time.Minute,
+		WatchActiveWindow:   6 * time.Hour,
+		Playlists: map[string]config.PlaylistConfig{
+			"Active": {URL: "https://www.youtube.com/playlist?list=PL_ACTIVE"},
+			"New":    {URL: "PL_NEW"},
+		},
+	}
+	states := loadPlaylistStates(db, cfg)
+	require.Len(t, states, 2)
+
+	active := states["https://www.youtube.com/playlist?list=PL_ACTIVE"]
+	assert.WithinDuration(t, time.Now(), active.lastChecked, time.Minute, "Checked before the restart")
+	assert.Equal(t, 2*time.Minute, active.calculateInterval(cfg, cfg.Playlists["Active"]), "Still active after the restart")
+
+	assert.True(t, states["PL_NEW"].lastChecked.IsZero(), "Never checked, so due right away")
+}
+
+func TestNotifyNewDownloads(t *testing.T) {
+	var events []notify.Event
+	n := notify.Func(func(e notify.Event) { events = append(events, e) })
+
+	notifyNewDownloads(n, "Jazz", nil)
+	assert.Empty(t, events, "Passes without downloads send nothing")
+
+	videos := []notify.Video{
+		{Title: "Take Five", Channel: "Brubeck", Duration: 324, URL: "https://www.youtube.com/watch?v=aaaaaaaaaaa"},
+		{Title: "So What", Channel: "Davis", Duration: 562, URL: "https://www.youtube.com/watch?v=bbbbbbbbbbb"},
+	}
+	notifyNewDownloads(n, "Jazz", videos[:1])
+	notifyNewDownloads(n, "Jazz", videos)
+	require.Len(t, events, 2, "One event per pass, however many videos")
+	assert.Equal(t, "New in Jazz: Take Five", events[0].Message)
+	assert.Equal(t, notify.EventNewDownloads, events[1].Type)
+	assert.Equal(t, "2 new videos in Jazz", events[1].Message)
+	assert.Equal(t, videos, events[1].Details["videos"])
+	assert.Equal(t, "Jazz", events[1].Details["playlist"])
+}
+
+func TestNotifyPlaylistChecked(t *testing.T) {
+	var events []notify.Event
+	n := notify.Func(func(e notify.Event) { events = append(events, e) })
+
+	notifyPlaylistChecked(n, playlistSummary{Name: "Jazz", Downloaded: 3, Skipped: 10, Failed: 2})
+	notifyPlaylistChecked(n, playlistSummary{Name: "Talks", Error: "playlist is private"})
+	require.Len(t, events, 2)
+	assert.Equal(t, notify.EventPlaylistChecked, events[0].Type)
+	assert.Equal(t, "Checked Jazz: 3 downloaded, 2 failed", events[0].Message)
+	assert.Equal(t, "Jazz", events[0].Details["playlist"])
+	assert.Equal(t, 3, events[0].Details["downloaded"])
+	assert.Equal(t, 2, events[0].Details["failed"])
+	assert.Equal(t, "Failed to check Talks: playlist is private", events[1].Message)
+}
+
+func TestNewSinks(t *testing.T) {
+	sinks, err := newSinks(&config.Config{})
+	require.NoError(t, err)
+	assert.Empty(t, sinks)
+
+	sinks, err = newSinks(&config.Config{
+		NotifyWebhookURLs:     []string{"https://ntfy.sh/topic", "https://hooks.example.com/hook"},
+		NotifyMessageTemplate: "{{.Message}}",
+		Notifications: []config.Notification{
+			{Type: config.NotifyDiscord, URL: "https://discord.com/api/webhooks/1/abc", Events: []string{notify.EventNewDownloads}},
+			{Type: config.NotifyNtfy, Topic: "music", Priority: "high", Template: "{{.Message}}"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, sinks, 4)
+	assert.IsType(t, &notify.Discord{}, sinks[2])
+	assert.IsType(t, &notify.Ntfy{}, sinks[3])
+
+	_, err = newSinks(&config.Config{NotifyWebhookURLs: []string{"https://ntfy.sh/topic", "ftp://secret"}})
+	assert.ErrorContains(t, err, "NOTIFY_WEBHOOK_URL 2")
+	assert.NotContains(t, err.Error(), "secret")
+
+	_, err = newSinks(&config.Config{Notifications: []config.Notification{
+		{Type: config.NotifyNtfy, Topic: "music"},
+		{Type: config.NotifyNtfy, Topic: "music", Priority: "loud"},
+	}})
+	assert.ErrorContains(t, err, "notifications[1]")
+	_, err = newSinks(&config.Config{Notifications: []config.Notification{
+		{Type: config.NotifyDiscord, URL: "https://discord.com/api/webhooks/1/abc", Events: []string{"disk_full"}},
+	}})
+	assert.ErrorContains(t, err, "unknown event")
+
+	sinks, err = newSinks(&config.Config{MQTTBroker: "tcp://mosquitto:1883", MQTTClientID: "pp", MQTTTopicPrefix: "pp"})
+	require.NoError(t, err)
+	require.Len(t, sinks, 1)
+	assert.IsType(t, &notify.MQTT{}, sinks[0])
+	_, err = newSinks(&config.Config{MQTTBroker: "mosquitto", MQTTTopicPrefix: "pp"})
+	assert.ErrorContains(t, err, "MQTT_BROKER")
+}
+
+// slowYTDLP lists two videos and downloads the first right away; the second
+// never finishes, so a shutdown interrupts the pass
+const slowYTDLP = `#!/bin/sh
+url=""
+tmpl=""
+listing=""
+metadata=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+		--output) tmpl="$2"; shift ;;
+		--dump-single-json) listing=1 ;;
+		--dump-json) metadata=1 ;;
+		http*) url="$1" ;;
+	esac
+	shift
+done
+if [ -n "$listing" ]; then
+	echo '{"title":"Slow","entries":[{"id":"aaaaaaaaaaa","title":"Quick"},{"id":"bbbbbbbbbbb","title":"Stuck"}]}'
+	exit 0
+fi
+id="${url##*v=}"
+if [ -n "$metadata" ]; then
+	echo "{\"id\":\"$id\",\"title\":\"Title $id\",\"duration\":60}"
+	exit 0
+fi
+if [ "$id" = "bbbbbbbbbbb" ]; then
+	touch "$FAKE_STARTED"
+	exec sleep 30
+fi
+path=$(printf '%s' "$tmpl" | sed -e "s/%(title)s/Quick/g" -e "s/%(id)s/$id/g" -e "s/%(ext)s/mp3/g")
+mkdir -p "$(dirname "$path")"
+printf 'audio' > "$path"
+echo "$path"
+`
+
+func TestRunSchedulerWaitsForPasses(t *testing.T) {
+	dir := t.TempDir()
+	binDir := filepath.Join(dir, "bin")
+	require.NoError(t, os.MkdirAll(binDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "yt-dlp"), []byte(slowYTDLP), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	started := filepath.Join(dir, "started")
+	t.Setenv("FAKE_STARTED", started)
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	jsonPath := filepath.Join(dir, "playlists.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"playlists": {"Slow": "PL_SLOW"}}`), 0644))
+	t.Setenv("JSON_PATH", jsonPath)
+	t.Setenv("MUSIC_PARENT_DIR", filepath.Join(dir, "music"))
+	cfg, err := config.LoadConfig(dir)
+	require.NoError(t, err)
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var live atomic.Pointer[config.Config]
+	live.Store(cfg)
+	dl := downloader.NewDownloader("ffmpeg", cfg.MusicParentDir, db, downloader.Options{Backend: downloader.BackendYTDLP, BatchSize: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runScheduler(ctx, &live, db, dl, notify.Discard, nil, loadPlaylistStates(db, cfg), nil, nil, newHealthMonitor(cfg, db), true)
+		close(done)
+	}()
+
+	// Shut down while the second video downloads. Both are written as one
+	// batch, so the first is only recorded once the pass gives up on the
+	// second.
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(started)
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	exists, err := db.VideoExists("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.True(t, exists, "The completed download is recorded before the scheduler returns")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+)
+
+// watchForReloads signals reloads whenever the file holding the playlists,
+// playlists.json or the YAML config, changes or the process gets SIGHUP,
+// until ctx is cancelled. Triggers arriving while a reload is pending are
+// merged into it.
+func watchForReloads(ctx context.Context, path string) <-chan struct{} {
+	reloads := make(chan struct{}, 1)
+	trigger := func() {
+		select {
+		case reloads <- struct{}{}:
+		default:
+		}
+	}
+
+	if err := config.Watch(ctx, path, trigger); err != nil {
+		slog.Warn("Not watching the config file; send SIGHUP to reload it instead", "error", err)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				slog.Info("Got SIGHUP")
+				trigger()
+			}
+		}
+	}()
+	return reloads
+}
+
+// reloadConfig loads the configuration again and makes its playlists
+// current. Removed playlists stop being scheduled but keep their files and
+// rows; new ones have no state, so they are checked on the next pass.
+// Other settings are kept, as the downloader and validator were built from
+// them. An invalid config is rejected and the current one stays in effect.
+// It reports whether the playlists changed.
+func reloadConfig(live *atomic.Pointer[config.Config], states map[string]*playlistState) bool {
+	current := live.Load()
+	loaded, err := config.LoadConfig(".")
+	if err != nil {
+		slog.Error("Failed to reload config, keeping the current one", "error", err)
+		return false
+	}
+
+	added, removed, changed := diffPlaylists(current.Playlists, loaded.Playlists)
+	for _, name := range added {
+		playlist := loaded.Playlists[name]
+		if !playlist.IsEnabled() {
+			slog.Info("Playlist is disabled; it won't be checked", "playlist", name)
+			continue
+		}
+		slog.Info("Watching playlist", "playlist", name, "url", playlist.URL, "media_type", loaded.PlaylistMediaType(playlist))
+	}
+	for _, name := range removed {
+		slog.Info("Stopped watching playlist; its files are kept", "playlist", name)
+	}
+	for _, name := range changed {
+		was, now := current.Playlists[name].IsEnabled(), loaded.Playlists[name].IsEnabled()
+		switch {
+		case was && !now:
+			slog.Info("Paused playlist; its files are kept", "playlist", name)
+		case !was && now:
+			slog.Info("Resumed playlist", "playlist", name)
+		default:
+			slog.Info("Playlist changed; its new settings apply from its next pass", "playlist", name)
+		}
+	}
+
+	if !loaded.SettingsEqual(current) {
+		slog.Warn("Settings other than playlists take effect after a restart")
+	}
+	if len(added)+len(removed)+len(changed) == 0 {
+		slog.Info("Config reloaded; playlists are unchanged")
+		return false
+	}
+
+	next := *current
+	next.Playlists = loaded.Playlists
+
+	// Scheduling state is keyed by URL, so a playlist whose URL changed is
+	// treated as new
+	urls := make(map[string]bool, len(next.Playlists))
+	for _, playlist := range next.Playlists {
+		urls[playlist.URL] = true
+	}
+	for url := range states {
+		if !urls[url] {
+			delete(states, url)
+		}
+	}
+	live.Store(&next)
+	return true
+}
+
+// diffPlaylists lists, by name, the playlists only in next, only in
+// previous, and in both but with different settings
+func diffPlaylists(previous, next map[string]config.PlaylistConfig) (added, removed, changed []string) {
+	for name, playlist := range next {
+		old, ok := previous[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case !reflect.DeepEqual(old, playlist):
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := next[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadConfig(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "playlists.json")
+	t.Setenv("JSON_PATH", jsonPath)
+	t.Setenv("MUSIC_PARENT_DIR", dir)
+
+	write := func(playlists string) {
+		require.NoError(t, os.WriteFile(jsonPath, []byte(`{"playlists": {`+playlists+`}}`), 0644))
+	}
+	write(`"kept": "PL_KEPT", "tuned": "PL_TUNED", "dropped": "PL_DROPPED"`)
+	cfg, err := config.LoadConfig(dir)
+	require.NoError(t, err)
+	var live atomic.Pointer[config.Config]
+	live.Store(cfg)
+	states := map[string]*playlistState{"PL_KEPT": {}, "PL_TUNED": {}, "PL_DROPPED": {}}
+
+	write(`"kept": "PL_KEPT", "tuned": {"url": "PL_TUNED", "quality": "5", "title_filters": {"exclude": ["(?i)instrumental"]}}, "added": "PL_ADDED"`)
+	require.True(t, reloadConfig(&live, states))
+	assert.Len(t, live.Load().Playlists, 3)
+	assert.Equal(t, "5", live.Load().Playlists["tuned"].Quality)
+	assert.Equal(t, cfg.MusicParentDir, live.Load().MusicParentDir)
+	assert.Contains(t, states, "PL_KEPT")
+	assert.Contains(t, states, "PL_TUNED")
+	assert.NotContains(t, states, "PL_DROPPED", "Removed playlists stop being scheduled")
+
+	// Invalid config is rejected and the current one stays in effect
+	current := live.Load()
+	write(`"broken": {"url": "PL_BROKEN", "quality": "best"}`)
+	assert.False(t, reloadConfig(&live, states))
+	assert.Same(t, current, live.Load())
+
+	write(`"kept": "PL_KEPT", "tuned": {"url": "PL_TUNED", "quality": "5", "title_filters": {"exclude": ["(?i)instrumental"]}}, "added": "PL_ADDED"`)
+	assert.False(t, reloadConfig(&live, states), "Nothing changed")
+}
+
+func TestDiffPlaylists(t *testing.T) {
+	no := false
+	previous := map[string]config.PlaylistConfig{
+		"a": {URL: "PL_A"},
+		"b": {URL: "PL_B", Tags: config.TagConfig{TrackNumber: &no}},
+		"c": {URL: "PL_C"},
+	}
+	next := map[string]config.PlaylistConfig{
+		"a": {URL: "PL_A"},
+		"b": {URL: "PL_B"},
+		"d": {URL: "PL_D"},
+	}
+	added, removed, changed := diffPlaylists(previous, next)
+	assert.Equal(t, []string{"d"}, added)
+	assert.Equal(t, []string{"c"}, removed)
+	assert.Equal(t, []string{"b"}, changed)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/notify"
+)
+
+// libraryStats are what a stats event tells dashboards showing e.g. "last
+// download 2h ago, 3 new today, 2 failures"
+type libraryStats struct {
+	Videos         int // With a file
+	Bytes          int64
+	DownloadsToday int
+	LastDownload   time.Time // Zero before the first download
+	Pending        int       // Recorded without a file yet
+	Failed         int       // Failing to download, as /api/failures lists
+	Statuses       map[string]int
+}
+
+// details lays the statistics out as a stats event's details
+func (s libraryStats) details() map[string]any {
+	details := map[string]any{
+		"videos":          s.Videos,
+		"bytes":           s.Bytes,
+		"downloads_today": s.DownloadsToday,
+		"pending":         s.Pending,
+		"failed":          s.Failed,
+		"statuses":        s.Statuses,
+	}
+	if !s.LastDownload.IsZero() {
+		details["last_download"] = s.LastDownload.UTC()
+	}
+	return details
+}
+
+// sendStats sends a stats event now and every interval until ctx is done
+func sendStats(ctx context.Context, db *database.Database, n notify.Notifier, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		notifyStats(db, n)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notifyStats sends the library's statistics as a stats event
+func notifyStats(db *database.Database, n notify.Notifier) {
+	stats, err := gatherStats(db, time.Now())
+	if err != nil {
+		slog.Warn("Failed to gather library statistics", "error", err)
+		return
+	}
+	n.Notify(notify.Event{
+		Type:    notify.EventStats,
+		Message: fmt.Sprintf("%d videos, %d downloaded today, %d failed", stats.Videos, stats.DownloadsToday, stats.Failed),
+		Details: stats.details(),
+	})
+}
+
+// gatherStats reads the library's statistics as of now
+func gatherStats(db *database.Database, now time.Time) (libraryStats, error) {
+	var stats libraryStats
+	storage, err := db.GetStorageStats()
+	if err != nil {
+		return stats, err
+	}
+	stats.Videos, stats.Bytes = storage.Videos, storage.Bytes
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	today, err := db.GetDownloadsSince(midnight)
+	if err != nil {
+		return stats, err
+	}
+	stats.DownloadsToday = len(today)
+
+	newest, err := db.ListVideos(database.ListOptions{OrderBy: database.ListOrderNewest, Limit: 1})
+	if err != nil {
+		return stats, err
+	}
+	if len(newest) > 0 {
+		stats.LastDownload = newest[0].DownloadedAt
+	}
+
+	if stats.Statuses, err = db.GetStatusCounts(); err != nil {
+		return stats, err
+	}
+	stats.Pending = stats.Statuses[database.StatusPending]
+
+	failed, err := db.GetFailedVideos(1)
+	if err != nil {
+		return stats, err
+	}
+	stats.Failed = len(failed)
+	return stats, nil
+}
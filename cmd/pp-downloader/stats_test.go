@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyStats(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var events []notify.Event
+	n := notify.Func(func(e notify.Event) { events = append(events, e) })
+	notifyStats(db, n)
+	require.Len(t, events, 1)
+	assert.Equal(t, notify.EventStats, events[0].Type)
+	assert.Equal(t, 0, events[0].Details["videos"])
+	assert.NotContains(t, events[0].Details, "last_download", "Nothing downloaded yet")
+
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "Jazz")
+	require.NoError(t, err)
+	for _, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb"} {
+		require.NoError(t, db.RecordDownload("PL_JAZZ", "Jazz", database.DownloadRecord{
+			YoutubeID: id,
+			Metadata:  database.VideoMetadata{Title: id},
+			FilePath:  "/music/Jazz/" + id + ".mp3",
+			FileSize:  1000,
+		}))
+	}
+	require.NoError(t, db.RecordDownloadFailure("ccccccccccc", "PL_JAZZ", "HTTP Error 403", false))
+
+	notifyStats(db, n)
+	require.Len(t, events, 2)
+	details := events[1].Details
+	assert.Equal(t, 2, details["videos"])
+	assert.Equal(t, int64(2000), details["bytes"])
+	assert.Equal(t, 2, details["downloads_today"])
+	assert.Equal(t, 1, details["failed"])
+	assert.WithinDuration(t, time.Now(), details["last_download"].(time.Time), time.Minute)
+	assert.Equal(t, "2 videos, 2 downloaded today, 1 failed", events[1].Message)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/api"
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/downloader"
+)
+
+// schedulerTimeout is how long an API request waits for the scheduler
+const schedulerTimeout = 5 * time.Second
+
+// schedulerCall runs on the scheduler goroutine, which owns the playlist
+// states. It reports whether a pass should start, to pick up a playlist it
+// made due.
+type schedulerCall func(cfg *config.Config, states map[string]*playlistState) (process bool)
+
+// schedulerAPI implements api.Scheduler by handing calls to runScheduler
+type schedulerAPI struct {
+	calls chan schedulerCall
+}
+
+func newSchedulerAPI() *schedulerAPI {
+	return &schedulerAPI{calls: make(chan schedulerCall)}
+}
+
+// Playlists returns the status of every configured playlist
+func (s *schedulerAPI) Playlists(ctx context.Context) ([]api.PlaylistStatus, error) {
+	var statuses []api.PlaylistStatus
+	err := s.call(ctx, func(cfg *config.Config, states map[string]*playlistState) (bool, error) {
+		statuses = playlistStatuses(cfg, states, time.Now())
+		return false, nil
+	})
+	return statuses, err
+}
+
+// Refresh makes a playlist due, so the scheduler checks it straight away
+func (s *schedulerAPI) Refresh(ctx context.Context, id string) error {
+	return s.call(ctx, func(cfg *config.Config, states map[string]*playlistState) (bool, error) {
+		for _, playlist := range cfg.Playlists {
+			if !playlist.IsEnabled() || downloader.PlaylistID(playlist.URL) != id {
+				continue
+			}
+			state := states[playlist.URL]
+			if state == nil {
+				// Not checked yet, so it is due anyway
+				return true, nil
+			}
+			state.mu.Lock()
+			defer state.mu.Unlock()
+			if state.running {
+				return false, api.ErrInProgress
+			}
+			state.lastChecked = time.Time{}
+			return true, nil
+		}
+		return false, api.ErrUnknownPlaylist
+	})
+}
+
+// call runs fn on the scheduler goroutine and waits for it, giving up after
+// schedulerTimeout
+func (s *schedulerAPI) call(ctx context.Context, fn func(*config.Config, map[string]*playlistState) (bool, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, schedulerTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	call := func(cfg *config.Config, states map[string]*playlistState) bool {
+		process, err := fn(cfg, states)
+		done <- err
+		return process
+	}
+	select {
+	case s.calls <- call:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// The scheduler runs the call right away, so this doesn't wait long
+	return <-done
+}
+
+// playlistStatuses reports each configured playlist's schedule, sorted by
+// name. Playlists never checked are due now; disabled ones are never due.
+func playlistStatuses(cfg *config.Config, states map[string]*playlistState, now time.Time) []api.PlaylistStatus {
+	names := make([]string, 0, len(cfg.Playlists))
+	for name := range cfg.Playlists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := make([]api.PlaylistStatus, 0, len(names))
+	for _, name := range names {
+		playlist := cfg.Playlists[name]
+		status := api.PlaylistStatus{
+			ID:        downloader.PlaylistID(playlist.URL),
+			Name:      name,
+			URL:       playlist.URL,
+			Enabled:   playlist.IsEnabled(),
+			MediaType: cfg.PlaylistMediaType(playlist),
+		}
+		var lastChange time.Time
+		if state := states[playlist.URL]; state != nil {
+			state.mu.Lock()
+			status.LastChecked, status.InProgress, lastChange = state.lastChecked, state.running, state.lastChange
+			state.mu.Unlock()
+		}
+		switch {
+		case !status.Enabled:
+		case status.LastChecked.IsZero():
+			status.NextCheck = now
+		default:
+			status.NextCheck = status.LastChecked.Add(cfg.PlaylistInterval(playlist, lastChange))
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/api"
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerAPI(t *testing.T) {
+	disabled := false
+	cfg := &config.Config{
+		WatchInterval:       time.Hour,
+		WatchActiveInterval: 2 * time.Minute,
+		WatchActiveWindow:   6 * time.Hour,
+		Playlists: map[string]config.PlaylistConfig{
+			"Jazz":   {URL: "https://www.youtube.com/playlist?list=PL_JAZZ"},
+			"Blues":  {URL: "PL_BLUES"},
+			"Paused": {URL: "PL_PAUSED", Enabled: &disabled},
+		},
+	}
+	checked := time.Now().Add(-10 * time.Minute)
+	states := map[string]*playlistState{
+		"https://www.youtube.com/playlist?list=PL_JAZZ": {lastChecked: checked},
+		"PL_BLUES": {lastChecked: checked, running: true},
+	}
+
+	// Stand in for runScheduler, counting the passes calls ask for
+	s := newSchedulerAPI()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	passes := make(chan bool, 10)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case call := <-s.calls:
+				passes <- call(cfg, states)
+			}
+		}
+	}()
+
+	statuses, err := s.Playlists(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "Blues", statuses[0].Name)
+	assert.True(t, statuses[0].InProgress)
+	assert.Equal(t, "PL_JAZZ", statuses[1].ID)
+	assert.Equal(t, checked.Add(time.Hour), statuses[1].NextCheck)
+	assert.False(t, statuses[2].Enabled)
+	assert.True(t, statuses[2].NextCheck.IsZero(), "Disabled playlists are never due")
+	assert.False(t, <-passes)
+
+	require.NoError(t, s.Refresh(ctx, "PL_JAZZ"))
+	assert.True(t, <-passes)
+	assert.True(t, states["https://www.youtube.com/playlist?list=PL_JAZZ"].lastChecked.IsZero(), "Refreshed playlists are due")
+
+	assert.ErrorIs(t, s.Refresh(ctx, "PL_BLUES"), api.ErrInProgress)
+	assert.ErrorIs(t, s.Refresh(ctx, "PL_PAUSED"), api.ErrUnknownPlaylist)
+	assert.ErrorIs(t, s.Refresh(ctx, "PL_NONE"), api.ErrUnknownPlaylist)
+
+	// Without a scheduler to answer, calls time out instead of hanging
+	cancel()
+	timeout, stop := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer stop()
+	_, err = s.Playlists(timeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPlaylistStateStart(t *testing.T) {
+	state := &playlistState{}
+	assert.True(t, state.start())
+	assert.False(t, state.start(), "A running playlist isn't started twice")
+	state.updateState(false)
+	assert.True(t, state.start())
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sampiiiii/pp-downloader/internal/downloader"
+)
+
+// Exit codes of a --once run
+const (
+	exitOK          = 0
+	exitFailed      = 1   // A playlist couldn't be checked or a download failed
+	exitInterrupted = 130 // Stopped by SIGINT or SIGTERM, like a shell reports it
+)
+
+// playlistSummary is what one check of a playlist did
+type playlistSummary struct {
+	Name       string `json:"name"`
+	Downloaded int    `json:"downloaded"`
+	Skipped    int    `json:"skipped"`
+	Failed     int    `json:"failed"`
+	Error      string `json:"error,omitempty"` // Why the playlist couldn't be checked
+
+	files []string // What was downloaded, for the post-download hooks
+}
+
+// count adds a video's result to the summary
+func (s *playlistSummary) count(result downloader.VideoResult) {
+	switch {
+	case result.Err != nil:
+		s.Failed++
+	case result.Downloaded:
+		s.Downloaded++
+	case result.Skipped != "":
+		s.Skipped++
+	}
+}
+
+// ok reports whether the playlist was checked and nothing failed
+func (s playlistSummary) ok() bool {
+	return s.Error == "" && s.Failed == 0
+}
+
+// writeSummary prints a table of what each playlist did
+func writeSummary(w io.Writer, summaries []playlistSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLAYLIST\tDOWNLOADED\tSKIPPED\tFAILED\tERROR")
+	for _, s := range summaries {
+		errText := "-"
+		if s.Error != "" {
+			errText = errorSummary(s.Error)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", s.Name, s.Downloaded, s.Skipped, s.Failed, errText)
+	}
+	return tw.Flush()
+}
+
+// writeSummaryFile writes the summaries as JSON to path, for scripts
+func writeSummaryFile(path string, summaries []playlistSummary, code int) error {
+	if summaries == nil {
+		summaries = []playlistSummary{}
+	}
+	data, err := json.MarshalIndent(struct {
+		ExitCode  int               `json:"exit_code"`
+		Playlists []playlistSummary `json:"playlists"`
+	}{code, summaries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// finishOnce prints a --once run's summary, writes it to summaryFile if
+// set, and returns the exit code: exitFailed if any playlist or download
+// failed
+func finishOnce(summaries []playlistSummary, interrupted bool, w io.Writer, summaryFile string) int {
+	code := exitOK
+	for _, s := range summaries {
+		if !s.ok() {
+			code = exitFailed
+		}
+	}
+	if interrupted {
+		code = exitInterrupted
+	}
+
+	if err := writeSummary(w, summaries); err != nil {
+		slog.Error("Failed to print summary", "error", err)
+	}
+	if summaryFile != "" {
+		if err := writeSummaryFile(summaryFile, summaries, code); err != nil {
+			slog.Error("Failed to write summary", "path", summaryFile, "error", err)
+			if code == exitOK {
+				code = exitFailed
+			}
+		}
+	}
+	slog.Info("Checked every playlist once; exiting", "exit_code", code)
+	return code
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sampiiiii/pp-downloader/internal/downloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaylistSummaryCount(t *testing.T) {
+	var s playlistSummary
+	s.count(downloader.VideoResult{VideoID: "a", Downloaded: true})
+	s.count(downloader.VideoResult{VideoID: "b", Skipped: downloader.SkipDownloaded})
+	s.count(downloader.VideoResult{VideoID: "c", Skipped: downloader.SkipTitle})
+	s.count(downloader.VideoResult{VideoID: "d", Err: errors.New("HTTP Error 403")})
+	s.count(downloader.VideoResult{VideoID: "e", Removed: true})
+	assert.Equal(t, playlistSummary{Downloaded: 1, Skipped: 2, Failed: 1}, s)
+	assert.False(t, s.ok())
+}
+
+func TestFinishOnce(t *testing.T) {
+	good := playlistSummary{Name: "Chill", Downloaded: 2, Skipped: 10}
+	var out bytes.Buffer
+	assert.Equal(t, exitOK, finishOnce([]playlistSummary{good}, false, &out, ""))
+	assert.Contains(t, out.String(), "PLAYLIST")
+	assert.Regexp(t, `Chill\s+2\s+10\s+0\s+-`, out.String())
+
+	broken := playlistSummary{Name: "Focus", Error: "failed to get playlist videos: yt-dlp failed\nERROR: [youtube] This playlist does not exist"}
+	failing := playlistSummary{Name: "Gym", Failed: 1}
+	summaryPath := filepath.Join(t.TempDir(), "summary.json")
+	out.Reset()
+	assert.Equal(t, exitFailed, finishOnce([]playlistSummary{good, broken, failing}, false, &out, summaryPath))
+	assert.Contains(t, out.String(), "ERROR: [youtube] This playlist does not exist")
+
+	data, err := os.ReadFile(summaryPath)
+	require.NoError(t, err)
+	var written struct {
+		ExitCode  int               `json:"exit_code"`
+		Playlists []playlistSummary `json:"playlists"`
+	}
+	require.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, exitFailed, written.ExitCode)
+	assert.Equal(t, []playlistSummary{good, broken, failing}, written.Playlists)
+
+	assert.Equal(t, exitInterrupted, finishOnce([]playlistSummary{good}, true, &out, ""))
+
+	// A summary that can't be written fails the run
+	assert.Equal(t, exitFailed, finishOnce(nil, false, &out, filepath.Join(t.TempDir(), "missing", "summary.json")))
+}
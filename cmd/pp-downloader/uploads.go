@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+
+	"github.com/sampiiiii/pp-downloader/internal/config"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/upload"
+)
+
+// newUploadQueue creates the queue copying downloads to remote storage, or
+// returns nil when uploads are off. A missing rclone fails now rather than
+// on every upload.
+func newUploadQueue(cfg *config.Config, db *database.Database, logger *slog.Logger) (*upload.Queue, error) {
+	var remote upload.Remote
+	switch {
+	case cfg.RcloneRemote != "":
+		if _, err := exec.LookPath(cfg.RclonePath); err != nil {
+			return nil, fmt.Errorf("rclone not found: %w", err)
+		}
+		remote = upload.NewRclone(cfg.RclonePath, cfg.RcloneRemote)
+	case cfg.S3Bucket != "":
+		s3, err := upload.NewS3(upload.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			Prefix:          cfg.S3Prefix,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		remote = s3
+	default:
+		return nil, nil
+	}
+	return upload.NewQueue(remote, db, cfg.MusicParentDir, upload.Options{DeleteLocal: cfg.UploadDeleteLocal, Logger: logger}), nil
+}
@@ -0,0 +1,394 @@
+// Package api serves a small JSON API showing what the watcher is doing,
+// for dashboards that shouldn't have to parse logs
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// shutdownTimeout is how long requests in flight get to finish on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// Errors a Scheduler returns for a refresh it can't start
+var (
+	ErrUnknownPlaylist = errors.New("unknown playlist")
+	ErrInProgress      = errors.New("playlist is already being checked")
+)
+
+// PlaylistStatus is what the scheduler knows about a configured playlist
+type PlaylistStatus struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Enabled     bool      `json:"enabled"`
+	MediaType   string    `json:"media_type"`
+	LastChecked time.Time `json:"last_checked"`
+	NextCheck   time.Time `json:"next_check"`
+	InProgress  bool      `json:"in_progress"`
+}
+
+// Health is whether the watcher is working, as served by /healthz
+type Health struct {
+	Healthy   bool      `json:"healthy"`
+	Problems  []string  `json:"problems,omitempty"`
+	LastTick  time.Time `json:"last_tick"` // When the scheduler last ran
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Scheduler is the watcher's side of the API. Both methods are called from
+// request handlers and must give up when ctx is done rather than wait on a
+// busy scheduler.
+type Scheduler interface {
+	// Playlists returns every configured playlist, sorted by name
+	Playlists(ctx context.Context) ([]PlaylistStatus, error)
+
+	// Refresh checks a playlist, by its ID, straight away
+	Refresh(ctx context.Context, id string) error
+}
+
+// Options configures a Server
+type Options struct {
+	// Token, when set, must be sent as a bearer token with every request
+	// but those to /healthz
+	Token string
+
+	// Health reports the watcher's health for /healthz. It must not wait on
+	// the scheduler, which may be what is stuck.
+	Health func(context.Context) Health
+
+	// FeedDir, when set, is served at /feeds/ without the token, as podcast
+	// apps can't send one
+	FeedDir string
+
+	Logger *slog.Logger
+}
+
+// Server serves the API
+type Server struct {
+	db        *database.Database
+	scheduler Scheduler
+	token     string
+	health    func(context.Context) Health
+	feedDir   string
+	started   time.Time
+	logger    *slog.Logger
+}
+
+// NewServer creates a server reading the library from db and the
+// playlists' state from scheduler
+func NewServer(db *database.Database, scheduler Scheduler, opts Options) *Server {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Server{
+		db:        db,
+		scheduler: scheduler,
+		token:     opts.Token,
+		health:    opts.Health,
+		feedDir:   opts.FeedDir,
+		started:   time.Now(),
+		logger:    opts.Logger,
+	}
+}
+
+// ListenAndServe serves the API on addr until ctx is done, then waits a
+// little for requests in flight before returning
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	s.logger.Info("Serving the status API", "addr", ln.Addr().String(), "auth", s.token != "")
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down the status API: %w", err)
+	}
+	return nil
+}
+
+// Handler returns the API's routes. All but /healthz, which container
+// healthchecks probe without credentials, and the podcast feeds are behind
+// the token check.
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/api/status", s.get(s.status))
+	api.HandleFunc("/api/playlists", s.get(s.playlists))
+	api.HandleFunc("/api/playlists/", s.playlist)
+	api.HandleFunc("/api/failures", s.get(s.failures))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.get(s.healthz))
+	mux.Handle("/api/", s.authenticate(api))
+	if s.feedDir != "" {
+		mux.HandleFunc("/feeds/", s.get(s.feed))
+	}
+	return mux
+}
+
+// feed serves a podcast feed file. Only the .xml files themselves are
+// served, not listings of the directory.
+func (s *Server) feed(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/feeds/")
+	if !strings.HasSuffix(name, ".xml") || strings.ContainsAny(name, `/\`) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	http.ServeFile(w, r, filepath.Join(s.feedDir, name))
+}
+
+// authenticate rejects requests without the bearer token, when one is set
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "missing or invalid token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// get only lets GET requests through to h
+func (s *Server) get(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// playlist routes /api/playlists/{id}/videos and /api/playlists/{id}/refresh
+func (s *Server) playlist(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/playlists/"), "/")
+	if !ok || id == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	switch action {
+	case "videos":
+		s.get(func(w http.ResponseWriter, r *http.Request) { s.videos(w, r, id) })(w, r)
+	case "refresh":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.refresh(w, r, id)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// healthz answers 200 when the watcher is healthy and 503 when it isn't,
+// with the problems found
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	if s.health == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	health := s.health(r.Context())
+	code := http.StatusOK
+	if !health.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, health)
+}
+
+// statusResponse is what GET /api/status returns
+type statusResponse struct {
+	StartedAt     time.Time        `json:"started_at"`
+	UptimeSeconds int64            `json:"uptime_seconds"`
+	Playlists     []PlaylistStatus `json:"playlists"`
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	playlists, err := s.scheduler.Playlists(r.Context())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, statusResponse{
+		StartedAt:     s.started.UTC(),
+		UptimeSeconds: int64(time.Since(s.started).Seconds()),
+		Playlists:     playlists,
+	})
+}
+
+// playlistResponse is a playlist in GET /api/playlists: its status and how
+// many of its videos have each validation status
+type playlistResponse struct {
+	PlaylistStatus
+	Counts map[string]int `json:"counts"`
+}
+
+func (s *Server) playlists(w http.ResponseWriter, r *http.Request) {
+	playlists, err := s.scheduler.Playlists(r.Context())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	counts, err := s.db.GetPlaylistStatusCounts()
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	byID := make(map[string]map[string]int, len(counts))
+	for _, c := range counts {
+		byID[c.YoutubeID] = c.Counts
+	}
+
+	resp := make([]playlistResponse, 0, len(playlists))
+	for _, p := range playlists {
+		c := byID[p.ID]
+		if c == nil {
+			c = map[string]int{}
+		}
+		resp = append(resp, playlistResponse{PlaylistStatus: p, Counts: c})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// videos lists a playlist's videos. Query parameters: status, order
+// (newest, oldest or title), since (RFC 3339), limit and offset.
+func (s *Server) videos(w http.ResponseWriter, r *http.Request, id string) {
+	q := r.URL.Query()
+	opts := database.ListOptions{
+		PlaylistYoutubeID: id,
+		ValidationStatus:  q.Get("status"),
+		OrderBy:           q.Get("order"),
+	}
+	var err error
+	if opts.Limit, err = intParam(q.Get("limit")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	if opts.Offset, err = intParam(q.Get("offset")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+	if since := q.Get("since"); since != "" {
+		if opts.DownloadedAfter, err = time.Parse(time.RFC3339, since); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since: use RFC 3339, e.g. 2024-05-01T00:00:00Z")
+			return
+		}
+	}
+	if opts.OrderBy != "" && opts.OrderBy != database.ListOrderNewest && opts.OrderBy != database.ListOrderOldest && opts.OrderBy != database.ListOrderTitle {
+		writeError(w, http.StatusBadRequest, "invalid order: use newest, oldest or title")
+		return
+	}
+
+	videos, err := s.db.ListVideos(opts)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if videos == nil {
+		videos = []database.Video{}
+	}
+	writeJSON(w, http.StatusOK, videos)
+}
+
+// failures lists videos that keep failing; min_attempts defaults to 1
+func (s *Server) failures(w http.ResponseWriter, r *http.Request) {
+	minAttempts := 1
+	if v := r.URL.Query().Get("min_attempts"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "invalid min_attempts")
+			return
+		}
+		minAttempts = n
+	}
+	failed, err := s.db.GetFailedVideos(minAttempts)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if failed == nil {
+		failed = []database.FailedVideo{}
+	}
+	writeJSON(w, http.StatusOK, failed)
+}
+
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request, id string) {
+	err := s.scheduler.Refresh(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrUnknownPlaylist):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInProgress):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		s.fail(w, r, err)
+	default:
+		s.logger.Info("Playlist refresh requested through the API", "playlist_id", id)
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "refreshing"})
+	}
+}
+
+// fail logs an unexpected error and answers with a 500, or a 503 when the
+// scheduler didn't answer in time
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		writeError(w, http.StatusServiceUnavailable, "the watcher is busy; try again")
+		return
+	}
+	s.logger.Error("Status API request failed", "path", r.URL.Path, "error", err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+// intParam parses an optional non-negative integer query parameter
+func intParam(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", v)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeScheduler reports fixed playlists and records refreshes
+type fakeScheduler struct {
+	playlists []PlaylistStatus
+	refreshed []string
+}
+
+func (f *fakeScheduler) Playlists(ctx context.Context) ([]PlaylistStatus, error) {
+	return f.playlists, nil
+}
+
+func (f *fakeScheduler) Refresh(ctx context.Context, id string) error {
+	for _, p := range f.playlists {
+		if p.ID != id {
+			continue
+		}
+		if p.InProgress {
+			return ErrInProgress
+		}
+		f.refreshed = append(f.refreshed, id)
+		return nil
+	}
+	return ErrUnknownPlaylist
+}
+
+func newTestServer(t *testing.T, token string) (*httptest.Server, *fakeScheduler) {
+	t.Helper()
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.GetOrCreatePlaylist("PL_JAZZ", "Jazz")
+	require.NoError(t, err)
+	for i, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb"} {
+		require.NoError(t, db.RecordDownload("PL_JAZZ", "Jazz", database.DownloadRecord{
+			YoutubeID: id,
+			Metadata:  database.VideoMetadata{Title: []string{"Take Five", "Blue Rondo"}[i]},
+			FilePath:  "/music/Jazz/" + id + ".mp3",
+		}))
+	}
+	require.NoError(t, db.RecordDownloadFailure("ccccccccccc", "PL_JAZZ", "HTTP Error 403", false))
+
+	scheduler := &fakeScheduler{playlists: []PlaylistStatus{
+		{ID: "PL_BUSY", Name: "Busy", Enabled: true, InProgress: true},
+		{ID: "PL_JAZZ", Name: "Jazz", Enabled: true, LastChecked: time.Now().Add(-time.Minute)},
+	}}
+	srv := httptest.NewServer(NewServer(db, scheduler, Options{Token: token}).Handler())
+	t.Cleanup(srv.Close)
+	return srv, scheduler
+}
+
+// do sends a request and decodes the JSON response into v
+func do(t *testing.T, method, url, token string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	if v != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	srv, scheduler := newTestServer(t, "")
+
+	var status statusResponse
+	assert.Equal(t, http.StatusOK, do(t, "GET", srv.URL+"/api/status", "", &status))
+	assert.Len(t, status.Playlists, 2)
+	assert.True(t, status.Playlists[0].InProgress)
+	assert.False(t, status.StartedAt.IsZero())
+
+	var playlists []playlistResponse
+	assert.Equal(t, http.StatusOK, do(t, "GET", srv.URL+"/api/playlists", "", &playlists))
+	require.Len(t, playlists, 2)
+	assert.Empty(t, playlists[0].Counts, "Playlists without rows have no counts")
+	assert.Equal(t, 2, playlists[1].Counts[database.StatusValid])
+
+	var videos []database.Video
+	assert.Equal(t, http.StatusOK, do(t, "GET", srv.URL+"/api/playlists/PL_JAZZ/videos?order=title&limit=1", "", &videos))
+	require.Len(t, videos, 1)
+	assert.Equal(t, "Blue Rondo", videos[0].Title)
+	assert.Equal(t, http.StatusOK, do(t, "GET", srv.URL+"/api/playlists/PL_OTHER/videos", "", &videos))
+	assert.Empty(t, videos)
+	assert.Equal(t, http.StatusBadRequest, do(t, "GET", srv.URL+"/api/playlists/PL_JAZZ/videos?limit=-1", "", nil))
+	assert.Equal(t, http.StatusBadRequest, do(t, "GET", srv.URL+"/api/playlists/PL_JAZZ/videos?order=random", "", nil))
+	assert.Equal(t, http.StatusBadRequest, do(t, "GET", srv.URL+"/api/playlists/PL_JAZZ/videos?since=yesterday", "", nil))
+
+	var failures []database.FailedVideo
+	assert.Equal(t, http.StatusOK, do(t, "GET", srv.URL+"/api/failures", "", &failures))
+	require.Len(t, failures, 1)
+	assert.Equal(t, "ccccccccccc", failures[0].YoutubeID)
+	assert.Equal(t, http.StatusOK, do(t, "GET", srv.URL+"/api/failures?min_attempts=2", "", &failures))
+	assert.Empty(t, failures)
+
+	assert.Equal(t, http.StatusAccepted, do(t, "POST", srv.URL+"/api/playlists/PL_JAZZ/refresh", "", nil))
+	assert.Equal(t, []string{"PL_JAZZ"}, scheduler.refreshed)
+	assert.Equal(t, http.StatusConflict, do(t, "POST", srv.URL+"/api/playlists/PL_BUSY/refresh", "", nil))
+	assert.Equal(t, http.StatusNotFound, do(t, "POST", srv.URL+"/api/playlists/PL_NONE/refresh", "", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, "GET", srv.URL+"/api/playlists/PL_JAZZ/refresh", "", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, "POST", srv.URL+"/api/status", "", nil))
+	assert.Equal(t, http.StatusNotFound, do(t, "GET", srv.URL+"/api/playlists/PL_JAZZ", "", nil))
+}
+
+func TestServerToken(t *testing.T) {
+	srv, _ := newTestServer(t, "s3cret")
+
+	assert.Equal(t, http.StatusUnauthorized, do(t, "GET", srv.URL+"/api/status", "", nil))
+	assert.Equal(t, http.StatusUnauthorized, do(t, "GET", srv.URL+"/api/status", "wrong", nil))
+	assert.Equal(t, http.StatusOK, do(t, "GET", srv.URL+"/api/status", "s3cret", nil))
+	assert.Equal(t, http.StatusNotFound, do(t, "GET", srv.URL+"/healthz", "", nil), "Health isn't token protected")
+}
+
+func TestHealthz(t *testing.T) {
+	health := Health{Healthy: true}
+	s := NewServer(nil, &fakeScheduler{}, Options{
+		Token:  "s3cret",
+		Health: func(context.Context) Health { return health },
+	})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	var got Health
+	assert.Equal(t, http.StatusOK, do(t, "GET", srv.URL+"/healthz", "", &got))
+	assert.True(t, got.Healthy)
+
+	health = Health{Problems: []string{"scheduler hasn't run for 10m0s"}}
+	assert.Equal(t, http.StatusServiceUnavailable, do(t, "GET", srv.URL+"/healthz", "", &got))
+	assert.Equal(t, []string{"scheduler hasn't run for 10m0s"}, got.Problems)
+}
+
+func TestFeeds(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Jazz.xml"), []byte("<rss/>"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("secret"), 0o644))
+	srv := httptest.NewServer(NewServer(nil, &fakeScheduler{}, Options{Token: "s3cret", FeedDir: dir}).Handler())
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+	status, body := get("/feeds/Jazz.xml")
+	assert.Equal(t, http.StatusOK, status, "Feeds aren't token protected")
+	assert.Equal(t, "<rss/>", body)
+	for _, path := range []string{"/feeds/", "/feeds/notes.txt", "/feeds/Missing.xml", "/feeds/..%2fJazz.xml"} {
+		status, _ = get(path)
+		assert.Equal(t, http.StatusNotFound, status, path)
+	}
+	assert.Equal(t, http.StatusUnauthorized, do(t, "GET", srv.URL+"/api/status", "", nil))
+}
+
+func TestListenAndServeShutsDown(t *testing.T) {
+	// Find a free port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewServer(nil, &fakeScheduler{}, Options{})
+	errc := make(chan error, 1)
+	go func() { errc <- s.ListenAndServe(ctx, addr) }()
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/api/status")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-errc:
+		assert.NoError(t, err)
+	case <-time.After(2 * shutdownTimeout):
+		t.Fatal("Server didn't shut down")
+	}
+
+	_, err = http.Get("http://" + addr + "/api/status")
+	assert.Error(t, err, "Server should be closed")
+}
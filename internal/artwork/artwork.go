@@ -0,0 +1,245 @@
+package artwork
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultMaxDimension is the longest edge, in pixels, of prepared artwork
+const DefaultMaxDimension = 1200
+
+// maxImageBytes caps how much of a thumbnail response is read into memory
+const maxImageBytes = 10 << 20
+
+// thumbnailBaseURL is where YouTube serves video thumbnails
+const thumbnailBaseURL = "https://i.ytimg.com/vi"
+
+// thumbnailVariants are the YouTube thumbnail names tried, best first
+var thumbnailVariants = []string{"maxresdefault", "sddefault", "hqdefault"}
+
+// ErrNoArtwork is returned when none of the candidate thumbnails is usable
+var ErrNoArtwork = errors.New("no usable artwork found")
+
+// Fetcher downloads, verifies, and caches the best available thumbnail for a video
+type Fetcher struct {
+	client       *http.Client
+	baseURL      string
+	cacheDir     string
+	maxDimension int
+}
+
+// NewFetcher creates a Fetcher that caches prepared artwork in cacheDir
+func NewFetcher(client *http.Client, cacheDir string, maxDimension int) *Fetcher {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if maxDimension <= 0 {
+		maxDimension = DefaultMaxDimension
+	}
+	return &Fetcher{
+		client:       client,
+		baseURL:      thumbnailBaseURL,
+		cacheDir:     cacheDir,
+		maxDimension: maxDimension,
+	}
+}
+
+// Candidates returns the thumbnail URLs to try for a video, in order of preference
+func (f *Fetcher) Candidates(videoID, metadataURL string) []string {
+	urls := make([]string, 0, len(thumbnailVariants)+1)
+	for _, variant := range thumbnailVariants {
+		urls = append(urls, fmt.Sprintf("%s/%s/%s.jpg", f.baseURL, videoID, variant))
+	}
+	if metadataURL != "" {
+		urls = append(urls, metadataURL)
+	}
+	return urls
+}
+
+// CachePath returns where the prepared artwork for a video is stored
+func (f *Fetcher) CachePath(videoID string) string {
+	return filepath.Join(f.cacheDir, videoID+".jpg")
+}
+
+// Fetch returns the path to prepared artwork for a video, reusing the cached
+// copy when one exists so retag runs don't hit YouTube again
+func (f *Fetcher) Fetch(ctx context.Context, videoID, metadataURL string) (string, error) {
+	cachePath := f.CachePath(videoID)
+	if _, err := os.Stat(cachePath); err == nil {
+		return cachePath, nil
+	}
+
+	var lastErr error
+	for _, url := range f.Candidates(videoID, metadataURL) {
+		img, err := f.fetchImage(ctx, url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if err := f.store(cachePath, Downscale(img, f.maxDimension)); err != nil {
+			return "", err
+		}
+		return cachePath, nil
+	}
+
+	if lastErr != nil {
+		return "", fmt.Errorf("%w for %s: %v", ErrNoArtwork, videoID, lastErr)
+	}
+	return "", fmt.Errorf("%w for %s", ErrNoArtwork, videoID)
+}
+
+// fetchImage downloads and decodes a single candidate, rejecting placeholders
+func (f *Fetcher) fetchImage(ctx context.Context, url string) (image.Image, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", url, err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+
+	if IsPlaceholder(img) {
+		return nil, fmt.Errorf("placeholder image returned for %s", url)
+	}
+
+	return img, nil
+}
+
+// store writes img as a JPEG to path, replacing any previous file atomically
+func (f *Fetcher) store(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create artwork cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".artwork-*.jpg")
+	if err != nil {
+		return fmt.Errorf("failed to create artwork file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := jpeg.Encode(tmp, img, &jpeg.Options{Quality: 90}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode artwork: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write artwork: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// IsPlaceholder reports whether img looks like YouTube's grey "no thumbnail"
+// image, which is served with a 200 status for variants that don't exist
+func IsPlaceholder(img image.Image) bool {
+	b := img.Bounds()
+	if b.Dx() != 120 || b.Dy() != 90 {
+		return false
+	}
+
+	// The placeholder is entirely neutral grey; real 120x90 thumbnails have colour
+	var total, grey int
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x += 2 {
+			total++
+			if isNeutral(img.At(x, y)) {
+				grey++
+			}
+		}
+	}
+	return grey*100 >= total*98
+}
+
+// isNeutral reports whether c has (almost) no saturation
+func isNeutral(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	const tolerance = 12 << 8
+	return absDiff(r, g) <= tolerance && absDiff(g, b) <= tolerance && absDiff(r, b) <= tolerance
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// Downscale shrinks img so its longest edge is at most maxDimension pixels,
+// averaging source pixels so the result isn't aliased. Smaller images are
+// returned unchanged.
+func Downscale(img image.Image, maxDimension int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxDimension <= 0 || (w <= maxDimension && h <= maxDimension) {
+		return img
+	}
+
+	dw, dh := maxDimension, h*maxDimension/w
+	if h > w {
+		dw, dh = w*maxDimension/h, maxDimension
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		sy0 := b.Min.Y + dy*h/dh
+		sy1 := b.Min.Y + (dy+1)*h/dh
+		for dx := 0; dx < dw; dx++ {
+			sx0 := b.Min.X + dx*w/dw
+			sx1 := b.Min.X + (dx+1)*w/dw
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(dx, dy, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
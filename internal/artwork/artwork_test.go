@@ -0,0 +1,123 @@
+package artwork
+
+import (
+	"context"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadFixture(t *testing.T, name string) image.Image {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	require.NoError(t, err, "Failed to open fixture")
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	require.NoError(t, err, "Failed to decode fixture")
+	return img
+}
+
+// newThumbnailServer serves fixtures by variant name; routes maps a variant
+// (e.g. "maxresdefault") to a fixture file, and unmapped variants return 404
+func newThumbnailServer(t *testing.T, routes map[string]string, hits *[]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(filepath.Base(r.URL.Path), ".jpg")
+		*hits = append(*hits, name)
+		fixture, ok := routes[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", fixture))
+	}))
+}
+
+func TestIsPlaceholder(t *testing.T) {
+	assert.True(t, IsPlaceholder(loadFixture(t, "placeholder.jpg")), "Grey 120x90 image should be a placeholder")
+	assert.False(t, IsPlaceholder(loadFixture(t, "default.jpg")), "Colourful 120x90 thumbnail is real artwork")
+	assert.False(t, IsPlaceholder(loadFixture(t, "hqdefault.jpg")), "Larger images are never placeholders")
+}
+
+func TestFetchFallbackChain(t *testing.T) {
+	var hits []string
+	srv := newThumbnailServer(t, map[string]string{
+		"maxresdefault": "placeholder.jpg", // YouTube returns 200 with the grey image
+		"hqdefault":     "hqdefault.jpg",
+	}, &hits)
+	defer srv.Close()
+
+	f := NewFetcher(srv.Client(), t.TempDir(), 1200)
+	f.baseURL = srv.URL + "/vi"
+
+	path, err := f.Fetch(context.Background(), "abc123", "")
+	require.NoError(t, err, "Fetch should fall back to hqdefault")
+	assert.Equal(t, f.CachePath("abc123"), path)
+	assert.Equal(t, []string{"maxresdefault", "sddefault", "hqdefault"}, hits)
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	cfg, _, err := image.DecodeConfig(file)
+	require.NoError(t, err)
+	assert.Equal(t, 480, cfg.Width)
+	assert.Equal(t, 360, cfg.Height)
+
+	// A second fetch is served from the cache
+	hits = nil
+	_, err = f.Fetch(context.Background(), "abc123", "")
+	require.NoError(t, err)
+	assert.Empty(t, hits, "Cached artwork should not be refetched")
+}
+
+func TestFetchFallsBackToMetadataURL(t *testing.T) {
+	var hits []string
+	srv := newThumbnailServer(t, map[string]string{
+		"maxresdefault": "placeholder.jpg",
+		"sddefault":     "placeholder.jpg",
+		"default":       "default.jpg",
+	}, &hits)
+	defer srv.Close()
+
+	f := NewFetcher(srv.Client(), t.TempDir(), 1200)
+	f.baseURL = srv.URL + "/vi"
+
+	_, err := f.Fetch(context.Background(), "abc123", srv.URL+"/vi/abc123/default.jpg")
+	require.NoError(t, err, "Fetch should use the metadata URL as a last resort")
+	assert.Equal(t, []string{"maxresdefault", "sddefault", "hqdefault", "default"}, hits)
+}
+
+func TestFetchNoArtwork(t *testing.T) {
+	var hits []string
+	srv := newThumbnailServer(t, map[string]string{
+		"maxresdefault": "placeholder.jpg",
+	}, &hits)
+	defer srv.Close()
+
+	f := NewFetcher(srv.Client(), t.TempDir(), 1200)
+	f.baseURL = srv.URL + "/vi"
+
+	_, err := f.Fetch(context.Background(), "abc123", "")
+	assert.ErrorIs(t, err, ErrNoArtwork)
+	_, statErr := os.Stat(f.CachePath("abc123"))
+	assert.True(t, os.IsNotExist(statErr), "Nothing should be cached when every candidate fails")
+}
+
+func TestDownscale(t *testing.T) {
+	img := loadFixture(t, "maxresdefault.jpg")
+
+	scaled := Downscale(img, 1200)
+	assert.Equal(t, 1200, scaled.Bounds().Dx())
+	assert.Equal(t, 675, scaled.Bounds().Dy())
+
+	small := loadFixture(t, "hqdefault.jpg")
+	assert.Equal(t, small, Downscale(small, 1200), "Images within the limit are left alone")
+}
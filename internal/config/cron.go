@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week
+type cron struct {
+	minute [60]bool
+	hour   [24]bool
+	day    [32]bool
+	month  [13]bool
+	dow    [7]bool // Sunday is 0
+
+	// As in cron, when both days are restricted either may match
+	anyDay, anyDow bool
+}
+
+// cronMacros are the shorthands cron accepts for common schedules
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+var (
+	monthNames = strings.Fields("jan feb mar apr may jun jul aug sep oct nov dec")
+	dayNames   = strings.Fields("sun mon tue wed thu fri sat")
+)
+
+// parseCron parses an expression such as "0 8 * * mon-fri", or a macro
+// such as @daily
+func parseCron(expr string) (cron, error) {
+	var c cron
+	if macro, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("%q has %d fields, not 5: minute hour day-of-month month day-of-week", expr, len(fields))
+	}
+
+	var dow [8]bool // 7 is Sunday too
+	for _, f := range []struct {
+		name     string
+		set      []bool
+		min, max int
+		names    []string
+	}{
+		{"minute", c.minute[:], 0, 59, nil},
+		{"hour", c.hour[:], 0, 23, nil},
+		{"day of month", c.day[:], 1, 31, nil},
+		{"month", c.month[:], 1, 12, monthNames},
+		{"day of week", dow[:], 0, 7, dayNames},
+	} {
+		field := fields[0]
+		fields = fields[1:]
+		if err := parseCronField(field, f.set, f.min, f.max, f.names); err != nil {
+			return c, fmt.Errorf("invalid %s %q: %w", f.name, field, err)
+		}
+		switch f.name {
+		case "day of month":
+			c.anyDay = field == "*"
+		case "day of week":
+			c.anyDow = field == "*"
+		}
+	}
+	copy(c.dow[:], dow[:7])
+	c.dow[0] = c.dow[0] || dow[7]
+
+	if c.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return c, fmt.Errorf("%q never runs", expr)
+	}
+	return c, nil
+}
+
+// parseCronField sets the values a field's comma-separated list of values,
+// ranges and steps matches; names, when given, stand for min onwards
+func parseCronField(field string, set []bool, min, max int, names []string) error {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return i + min, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q is not between %d and %d", s, min, max)
+		}
+		return n, nil
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = value(bounds[0]); err != nil {
+				return err
+			}
+			if hi, err = value(bounds[1]); err != nil {
+				return err
+			}
+			if hi < lo {
+				return fmt.Errorf("range %q ends before it starts", rng)
+			}
+		default:
+			var err error
+			if lo, err = value(rng); err != nil {
+				return err
+			}
+			if step == 1 {
+				hi = lo // A step alone, like 5/15, runs to the end
+			}
+		}
+		for n := lo; n <= hi; n += step {
+			set[n] = true
+		}
+	}
+	return nil
+}
+
+// matchesDay reports whether the schedule runs on t's day
+func (c cron) matchesDay(t time.Time) bool {
+	day, dow := c.day[t.Day()], c.dow[t.Weekday()]
+	switch {
+	case c.anyDay && c.anyDow:
+		return true
+	case c.anyDay:
+		return dow
+	case c.anyDow:
+		return day
+	}
+	return day || dow
+}
+
+// Next returns the first time after after that the schedule runs, in
+// after's time zone; zero if it never does
+func (c cron) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Leap days can be up to eight years apart
+	for limit := t.AddDate(9, 0, 0); t.Before(limit); {
+		y, m, d := t.Date()
+		switch {
+		case !c.month[m]:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchesDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case !c.hour[t.Hour()]:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
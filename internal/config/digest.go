@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"time"
+)
+
+// DigestEnabled reports whether digests of activity are emailed
+func (c *Config) DigestEnabled() bool {
+	return c.SMTPHost != ""
+}
+
+// NextDigest returns when the first digest after after is due, in after's
+// time zone
+func (c *Config) NextDigest(after time.Time) time.Time {
+	return c.digest.Next(after)
+}
+
+// validateDigest parses DIGEST_SCHEDULE and checks digests have a sender
+// and recipients
+func (c *Config) validateDigest() error {
+	var err error
+	if c.digest, err = parseCron(c.DigestSchedule); err != nil {
+		return fmt.Errorf("DIGEST_SCHEDULE: %w", err)
+	}
+	if c.SMTPHost == "" {
+		return nil
+	}
+	if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+		return fmt.Errorf("invalid SMTP_PORT %d", c.SMTPPort)
+	}
+	if c.SMTPFrom == "" || len(c.SMTPTo) == 0 {
+		return fmt.Errorf("SMTP_HOST needs SMTP_FROM and SMTP_TO")
+	}
+	if c.SMTPPassword != "" && c.SMTPUsername == "" {
+		return fmt.Errorf("SMTP_PASSWORD needs SMTP_USERNAME")
+	}
+	for _, addr := range append([]string{c.SMTPFrom}, c.SMTPTo...) {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid email address %q: %w", addr, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExampleCoversEverySetting(t *testing.T) {
+	listed := make(map[string]bool)
+	for _, s := range exampleSettings {
+		assert.False(t, listed[s.key], "%s is listed twice", s.key)
+		listed[s.key] = true
+	}
+	for _, key := range settingKeys() {
+		assert.True(t, listed[key], "%s is missing from the starter config", key)
+	}
+}
+
+func TestWriteExample(t *testing.T) {
+	dir := t.TempDir()
+	useContainerDirs(t, filepath.Join(dir, "no-config"), filepath.Join(dir, "no-music"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("JSON_PATH", "")
+	found := map[string]string{"FFMPEG_PATH": "/opt/bin/ffmpeg"}
+
+	yamlPath, err := ExamplePath(FormatYAML)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "config", "pp-downloader", "config.yaml"), yamlPath)
+	jsonPath, err := ExamplePath(FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "config", "pp-downloader", "playlists.json"), jsonPath)
+	_, err = ExamplePath("toml")
+	assert.Error(t, err)
+
+	for _, format := range []string{FormatYAML, FormatJSON, FormatEnv} {
+		t.Run(format, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			formatDir := filepath.Join(dir, format)
+			require.NoError(t, os.MkdirAll(formatDir, 0755))
+			t.Setenv("JSON_PATH", filepath.Join(formatDir, "playlists.json"))
+
+			var out bytes.Buffer
+			require.NoError(t, WriteExample(&out, format, found))
+			path := map[string]string{
+				FormatYAML: filepath.Join(formatDir, "config.yaml"),
+				FormatJSON: filepath.Join(formatDir, "playlists.json"),
+				FormatEnv:  filepath.Join(formatDir, ".env"),
+			}[format]
+			require.NoError(t, os.WriteFile(path, out.Bytes(), 0644))
+
+			// Every format loads as written, with the example playlists
+			cfg, err := LoadConfig(formatDir)
+			require.NoError(t, err, out.String())
+			require.Len(t, cfg.Playlists, 2)
+			if format != FormatEnv {
+				assert.Equal(t, "opus", cfg.Playlists["Podcasts"].AudioFormat)
+			}
+			if format != FormatJSON {
+				assert.Equal(t, "/opt/bin/ffmpeg", cfg.FFmpegPath, "Found tools are set")
+				assert.Equal(t, "/opt/bin/ffprobe", cfg.FFprobePath, "Other settings keep their defaults")
+				assert.Equal(t, 1200, cfg.ArtworkMaxDimension)
+				assert.Contains(t, strings.ToUpper(out.String()), "LINK_MODE", "Every setting is listed")
+			}
+		})
+	}
+	assert.Error(t, WriteExample(&bytes.Buffer{}, "toml", nil))
+}
+
+func TestAddPlaylist(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte("# Library\nmusic_parent_dir: /library\nplaylists:\n  Jazz: PL_JAZZ # the good stuff\n"), 0644))
+	require.NoError(t, AddPlaylist(yamlPath, "Talks", "https://www.youtube.com/playlist?list=PL_TALKS"))
+	data, err := os.ReadFile(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, "# Library\nmusic_parent_dir: /library\nplaylists:\n  Jazz: PL_JAZZ # the good stuff\n  Talks: https://www.youtube.com/playlist?list=PL_TALKS\n", string(data), "Comments are kept")
+	assert.ErrorContains(t, AddPlaylist(yamlPath, "Jazz", "PL_OTHER"), "already exists")
+
+	// A YAML file without playlists gets them
+	require.NoError(t, os.WriteFile(yamlPath, []byte("music_parent_dir: /library\n"), 0644))
+	require.NoError(t, AddPlaylist(yamlPath, "Jazz", "PL_JAZZ"))
+	data, err = os.ReadFile(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, "music_parent_dir: /library\nplaylists:\n  Jazz: PL_JAZZ\n", string(data))
+
+	jsonPath := filepath.Join(dir, "playlists.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"proxy": "socks5://proxy:1080", "playlists": {"Jazz": {"url": "PL_JAZZ", "quality": "5"}}}`), 0644))
+	require.NoError(t, AddPlaylist(jsonPath, "Talks", "PL_TALKS"))
+	data, err = os.ReadFile(jsonPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Talks": "PL_TALKS"`)
+	assert.Contains(t, string(data), `"proxy": "socks5://proxy:1080"`)
+	assert.Contains(t, string(data), `"quality": "5"`)
+	assert.ErrorContains(t, AddPlaylist(jsonPath, "Talks", "PL_TALKS"), "already exists")
+
+	assert.Error(t, AddPlaylist(filepath.Join(dir, "missing.json"), "Jazz", "PL_JAZZ"))
+}
@@ -0,0 +1,27 @@
+package config
+
+import "fmt"
+
+// FeedsEnabled reports whether any playlist is published as a podcast feed
+func (c *Config) FeedsEnabled() bool {
+	for _, p := range c.Playlists {
+		if p.Feed {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFeeds checks playlists publishing a feed have somewhere for its
+// files to be downloaded from
+func (c *Config) validateFeeds() error {
+	if c.FeedBaseURL != "" && !isHTTPURL(c.FeedBaseURL) {
+		return fmt.Errorf("invalid FEED_BASE_URL %q: must be an http or https URL", c.FeedBaseURL)
+	}
+	for name, p := range c.Playlists {
+		if p.Feed && c.FeedBaseURL == "" {
+			return fmt.Errorf("playlist %q: feed needs FEED_BASE_URL", name)
+		}
+	}
+	return nil
+}
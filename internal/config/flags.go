@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// SourceFlag is where a setting given on the command line came from
+const SourceFlag = "flag"
+
+// Flags are settings given on the command line. They win over the
+// environment, files and defaults.
+type Flags struct {
+	// Settings are keyed by environment variable name, e.g. MUSIC_PARENT_DIR
+	Settings map[string]string
+
+	// Playlists win over playlists with the same name from anywhere else
+	Playlists map[string]PlaylistConfig
+}
+
+// flags are applied by every LoadConfig, so reloads keep them
+var flags Flags
+
+// SetFlags sets the command line settings applied when loading the config
+func SetFlags(f Flags) {
+	flags = f
+}
+
+// SettingKeys lists the environment variable name of every setting, each of
+// which can be given as a flag
+func SettingKeys() []string {
+	return settingKeys()
+}
+
+// ParsePlaylistFlag parses a playlist given as name=URL
+func ParsePlaylistFlag(value string) (string, PlaylistConfig, error) {
+	// URLs have = in them, names don't
+	name, url, ok := strings.Cut(value, "=")
+	name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+	if !ok || name == "" || url == "" || strings.Contains(name, "://") {
+		return "", PlaylistConfig{}, fmt.Errorf("invalid playlist %q: use name=URL", value)
+	}
+	return name, PlaylistConfig{URL: url}, nil
+}
+
+// applyFlags makes the command line settings win over everything viper read
+func applyFlags() {
+	for key, value := range flags.Settings {
+		viper.Set(key, value)
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Post-download hooks, as named in a playlist's hooks
+const (
+	HookPlex      = "plex"
+	HookJellyfin  = "jellyfin"
+	HookNavidrome = "navidrome"
+	HookCommand   = "command"
+)
+
+// Hooks lists every post-download hook
+var Hooks = []string{HookPlex, HookJellyfin, HookNavidrome, HookCommand}
+
+// ConfiguredHooks lists the hooks that have their settings
+func (c *Config) ConfiguredHooks() []string {
+	var hooks []string
+	if c.PlexURL != "" {
+		hooks = append(hooks, HookPlex)
+	}
+	if c.JellyfinURL != "" {
+		hooks = append(hooks, HookJellyfin)
+	}
+	if c.NavidromeURL != "" {
+		hooks = append(hooks, HookNavidrome)
+	}
+	if c.PostDownloadCommand != "" {
+		hooks = append(hooks, HookCommand)
+	}
+	return hooks
+}
+
+// PlaylistUsesHook reports whether a playlist's new files are passed to a
+// hook: every hook when the playlist lists none, else only those listed
+func (c *Config) PlaylistUsesHook(p PlaylistConfig, hook string) bool {
+	return len(p.Hooks) == 0 || slices.Contains(p.Hooks, hook)
+}
+
+// validateHooks checks the servers' settings are complete and that
+// playlists only name hooks that are set up
+func (c *Config) validateHooks() error {
+	if c.PlexURL != "" && (c.PlexToken == "" || c.PlexSection <= 0) {
+		return fmt.Errorf("PLEX_URL needs PLEX_TOKEN and PLEX_SECTION, the library section to scan")
+	}
+	if c.JellyfinURL != "" && c.JellyfinAPIKey == "" {
+		return fmt.Errorf("JELLYFIN_URL needs JELLYFIN_API_KEY")
+	}
+	if c.NavidromeURL != "" && (c.NavidromeUser == "" || c.NavidromePassword == "") {
+		return fmt.Errorf("NAVIDROME_URL needs NAVIDROME_USER and NAVIDROME_PASSWORD, an admin's login")
+	}
+	for _, setting := range []struct{ key, value string }{
+		{"PLEX_URL", c.PlexURL}, {"JELLYFIN_URL", c.JellyfinURL}, {"NAVIDROME_URL", c.NavidromeURL},
+	} {
+		if setting.value != "" && !isHTTPURL(setting.value) {
+			return fmt.Errorf("invalid %s %q: must be an http or https URL", setting.key, setting.value)
+		}
+	}
+
+	configured := c.ConfiguredHooks()
+	for name, p := range c.Playlists {
+		if p.PlexPlaylist && c.PlexURL == "" {
+			return fmt.Errorf("playlist %q: plex_playlist needs PLEX_URL", name)
+		}
+		for _, hook := range p.Hooks {
+			if !slices.Contains(Hooks, hook) {
+				return fmt.Errorf("playlist %q: unknown hook %q: must be one of %v", name, hook, Hooks)
+			}
+			if !slices.Contains(configured, hook) {
+				return fmt.Errorf("playlist %q: hook %q isn't set up", name, hook)
+			}
+		}
+	}
+	return nil
+}
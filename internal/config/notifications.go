@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// Notification backends
+const (
+	NotifyWebhook = "webhook"
+	NotifyDiscord = "discord"
+	NotifyNtfy    = "ntfy"
+)
+
+// Notification is one place notifications are sent, from the notifications
+// list in the YAML file or playlists.json. Any number can be set, each
+// with its own events; NOTIFY_WEBHOOK_URL adds plain webhooks besides.
+type Notification struct {
+	Type     string   `json:"type"`     // webhook, discord or ntfy
+	URL      string   `json:"url"`      // The webhook's URL, or the ntfy server; defaults to ntfy.sh
+	Topic    string   `json:"topic"`    // ntfy topic
+	Token    string   `json:"token"`    // Sent as a bearer token by webhooks and ntfy
+	Priority string   `json:"priority"` // ntfy priority for every event; by event type when empty
+	Events   []string `json:"events"`   // Event types to send; all but status events when empty
+	Template string   `json:"template"` // Go template for each event's message
+}
+
+// validateNotifications checks each notification has what its type needs.
+// Event names and priorities are checked when the notifiers are created.
+func (c *Config) validateNotifications() error {
+	for i, n := range c.Notifications {
+		var err error
+		switch n.Type {
+		case NotifyWebhook, NotifyDiscord:
+			if n.URL == "" {
+				err = fmt.Errorf("%s needs a url", n.Type)
+			}
+		case NotifyNtfy:
+			if n.Topic == "" {
+				err = fmt.Errorf("ntfy needs a topic")
+			}
+		default:
+			err = fmt.Errorf("unknown type %q: must be %s, %s or %s", n.Type, NotifyWebhook, NotifyDiscord, NotifyNtfy)
+		}
+		if err == nil && n.Template != "" {
+			if _, terr := template.New("message").Parse(n.Template); terr != nil {
+				err = fmt.Errorf("invalid template: %w", terr)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("notifications[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// notificationsSummary lists the notification types, e.g. "discord, ntfy"
+func (c *Config) notificationsSummary() string {
+	types := make([]string, 0, len(c.Notifications)+1)
+	for _, n := range c.Notifications {
+		types = append(types, n.Type)
+	}
+	if c.MQTTBroker != "" {
+		types = append(types, "mqtt")
+	}
+	if c.DigestEnabled() {
+		types = append(types, "email digest")
+	}
+	if len(types) == 0 {
+		return "none"
+	}
+	return strings.Join(types, ", ")
+}
+
+// isHTTPURL reports whether raw is an absolute http or https URL
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// maskURL hides everything after the host, where services like Discord put
+// the secret
+func maskURL(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		return u.Scheme + "://" + u.Host + "/..."
+	}
+	return raw
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Where the published container mounts its volumes; vars so tests can
+// point them elsewhere
+var (
+	containerConfigDir = "/config"
+	containerMusicDir  = "/music"
+)
+
+// ConfigDir is where playlists.json and config.yaml are looked for by
+// default: /config in the container, otherwise
+// $XDG_CONFIG_HOME/pp-downloader (~/.config/pp-downloader), or the current
+// directory when there is no home directory
+func ConfigDir() string {
+	if isDir(containerConfigDir) {
+		return containerConfigDir
+	}
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir is where the database, log file and, outside the container, the
+// library go by default: /config in the container, otherwise
+// $XDG_DATA_HOME/pp-downloader (~/.local/share/pp-downloader), or the
+// current directory when there is no home directory
+func DataDir() string {
+	if isDir(containerConfigDir) {
+		return containerConfigDir
+	}
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// defaultMusicDir is /music in the container, otherwise a music folder in
+// DataDir
+func defaultMusicDir() string {
+	if isDir(containerMusicDir) {
+		return containerMusicDir
+	}
+	return filepath.Join(DataDir(), "music")
+}
+
+// defaultDBPath keeps the database in the library in the container, as it
+// always was, and in DataDir otherwise
+func defaultDBPath() string {
+	if isDir(containerMusicDir) {
+		return filepath.Join(containerMusicDir, "downloads.db")
+	}
+	return filepath.Join(DataDir(), "downloads.db")
+}
+
+// xdgDir returns our folder in the XDG base directory named by env, or in
+// fallback under the home directory when it's unset
+func xdgDir(env, fallback string) string {
+	if base := os.Getenv(env); filepath.IsAbs(base) {
+		return filepath.Join(base, "pp-downloader")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, fallback, "pp-downloader")
+	}
+	return "."
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
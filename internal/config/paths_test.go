@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useContainerDirs points the container volume paths at configDir and
+// musicDir for the rest of the test
+func useContainerDirs(t *testing.T, configDir, musicDir string) {
+	t.Helper()
+	oldConfig, oldMusic := containerConfigDir, containerMusicDir
+	containerConfigDir, containerMusicDir = configDir, musicDir
+	t.Cleanup(func() { containerConfigDir, containerMusicDir = oldConfig, oldMusic })
+}
+
+func TestDefaultPathsOutsideContainer(t *testing.T) {
+	dir := t.TempDir()
+	useContainerDirs(t, filepath.Join(dir, "no-config"), filepath.Join(dir, "no-music"))
+	home := filepath.Join(dir, "home")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+
+	assert.Equal(t, filepath.Join(home, ".config", "pp-downloader"), ConfigDir())
+	assert.Equal(t, filepath.Join(dir, "data", "pp-downloader"), DataDir())
+
+	// The playlists come from the environment, so nothing needs to exist
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	t.Setenv("PLAYLISTS", "a=PL_A")
+	cfg, err := LoadConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".config", "pp-downloader", "playlists.json"), cfg.JSONPath)
+	assert.Equal(t, filepath.Join(dir, "data", "pp-downloader", "music"), cfg.MusicParentDir)
+	assert.Equal(t, filepath.Join(dir, "data", "pp-downloader", "downloads.db"), cfg.DBPath)
+	assert.Equal(t, filepath.Join(dir, "data", "pp-downloader", "pp-downloader.log"), cfg.LogFile)
+}
+
+func TestDefaultPathsInContainer(t *testing.T) {
+	dir := t.TempDir()
+	configDir, musicDir := filepath.Join(dir, "config"), filepath.Join(dir, "music")
+	require.NoError(t, os.Mkdir(configDir, 0755))
+	require.NoError(t, os.Mkdir(musicDir, 0755))
+	useContainerDirs(t, configDir, musicDir)
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "playlists.json"), []byte(`{"playlists": {"a": "PL_A"}}`), 0644))
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	cfg, err := LoadConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(configDir, "playlists.json")}, cfg.Sources)
+	assert.Equal(t, musicDir, cfg.MusicParentDir)
+	assert.Equal(t, filepath.Join(musicDir, "downloads.db"), cfg.DBPath)
+	assert.Equal(t, filepath.Join(configDir, "pp-downloader.log"), cfg.LogFile)
+
+	cfg, err = loadTestConfig(t, `{"playlists": {"a": "PL_A"}}`, map[string]string{"LOG_FILE": "none", "DB_PATH": "./test.db"})
+	require.NoError(t, err)
+	assert.Equal(t, "none", cfg.LogFile)
+	assert.Equal(t, "./test.db", cfg.DBPath)
+}
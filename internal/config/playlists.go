@@ -0,0 +1,451 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// PlaylistConfig is a watched playlist. In playlists.json each entry is either
+// a plain URL string or an object with per-playlist settings:
+//
+//	"jazz": "https://www.youtube.com/playlist?list=...",
+//	"podcasts": {"url": "https://www.youtube.com/playlist?list=...", "quality": "64K"},
+//	"lectures": {"url": "https://www.youtube.com/playlist?list=...", "media_type": "video"}
+type PlaylistConfig struct {
+	URL string `json:"url"`
+
+	// Enabled set to false pauses the playlist: it isn't checked, but its
+	// settings, files and history are kept
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// TitleFilters limits which videos are downloaded by their titles
+	TitleFilters TitleFilters `json:"title_filters"`
+
+	// Quality is passed to yt-dlp's --audio-quality: 0 (best) to 9 (worst),
+	// or a bitrate such as "192K". Empty means the global AUDIO_QUALITY.
+	Quality string `json:"quality,omitempty"`
+
+	// MediaType is "audio" (extract mp3, the default) or "video" (keep the
+	// merged video file)
+	MediaType string `json:"media_type,omitempty"`
+
+	// AudioFormat is what audio playlists are extracted to: mp3 (the
+	// default), m4a, opus or flac
+	AudioFormat string `json:"audio_format,omitempty"`
+
+	// OutputSubdir is the playlist's folder inside MUSIC_PARENT_DIR;
+	// defaults to one named after the playlist
+	OutputSubdir string `json:"output_subdir,omitempty"`
+
+	// Cookies overrides COOKIES_PATH for this playlist, for accounts with
+	// different memberships
+	Cookies string `json:"cookies,omitempty"`
+
+	// FilenameTemplate overrides FILENAME_TEMPLATE for this playlist
+	FilenameTemplate string `json:"filename_template,omitempty"`
+
+	// SplitChapters splits videos with chapters into one track per chapter
+	SplitChapters bool `json:"split_chapters,omitempty"`
+
+	// SyncDeletions deletes local copies of videos removed from the playlist
+	// instead of keeping them as an archive
+	SyncDeletions bool `json:"sync_deletions,omitempty"`
+
+	// NormalizeLoudness overrides NORMALIZE_LOUDNESS for this playlist, e.g.
+	// to leave a lossless playlist untouched
+	NormalizeLoudness *bool `json:"normalize_loudness,omitempty"`
+
+	// Tags overrides how tags are derived from the playlist and video
+	Tags TagConfig `json:"tags"`
+
+	// MaxDuration and MinDuration override MAX_DURATION and MIN_DURATION,
+	// e.g. "2h" or "0" for no limit
+	MaxDuration string `json:"max_duration,omitempty"`
+	MinDuration string `json:"min_duration,omitempty"`
+
+	// BlockedVideoIDs are never downloaded into this playlist, on top of
+	// BLOCKED_VIDEO_IDS
+	BlockedVideoIDs []string `json:"blocked_video_ids,omitempty"`
+
+	// Interval checks the playlist at a fixed interval, e.g. "2m" or "24h",
+	// instead of adapting to how often it changes
+	Interval string `json:"interval,omitempty"`
+
+	// Hooks limits which post-download hooks are told about this
+	// playlist's new files, e.g. ["jellyfin"] for a video playlist; all
+	// when empty
+	Hooks []string `json:"hooks,omitempty"`
+
+	// PlexPlaylist mirrors the playlist as a Plex playlist of the same name
+	// and order, kept up to date after each pass; needs PLEX_URL
+	PlexPlaylist bool `json:"plex_playlist,omitempty"`
+
+	// Feed publishes the playlist's downloads as a podcast feed, rewritten
+	// after each pass; needs FEED_BASE_URL
+	Feed bool `json:"feed,omitempty"`
+}
+
+// TagConfig maps playlist and video details to file tags. Album, artist and
+// title are templates using {playlist}, {channel}, {title}, {index}, {artist}
+// and {song}; empty fields keep the defaults of playlist name, artist and song.
+type TagConfig struct {
+	Album  string `json:"album,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Title  string `json:"title,omitempty"`
+
+	// TrackNumber set to false leaves out the playlist position
+	TrackNumber *bool `json:"track_number,omitempty"`
+
+	// ParseTitles splits "Artist - Title" video titles into artist and song;
+	// without it they are the channel and the video title
+	ParseTitles bool `json:"parse_titles,omitempty"`
+}
+
+// TitleFilters are regular expressions matched against video titles. With
+// Include set only titles matching one of them are downloaded; titles
+// matching any of Exclude never are.
+type TitleFilters struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Compiled from the fields above by validatePlaylists
+	include, exclude []*regexp.Regexp
+}
+
+// compile compiles the filters, reporting the first invalid one
+func (f *TitleFilters) compile() error {
+	var err error
+	if f.include, err = compilePatterns(f.Include); err != nil {
+		return err
+	}
+	f.exclude, err = compilePatterns(f.Exclude)
+	return err
+}
+
+// compilePatterns compiles a list of regular expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title filter %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Patterns returns the compiled include and exclude filters
+func (f TitleFilters) Patterns() (include, exclude []*regexp.Regexp) {
+	return f.include, f.exclude
+}
+
+// Media types a playlist can be downloaded as
+const (
+	MediaTypeAudio = "audio"
+	MediaTypeVideo = "video"
+)
+
+// AudioFormats are the formats audio can be extracted to
+var AudioFormats = []string{"mp3", "m4a", "opus", "flac"}
+
+// UnmarshalJSON accepts both the legacy string form and the object form
+func (p *PlaylistConfig) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*p = PlaylistConfig{URL: url}
+		return nil
+	}
+
+	// Alias type so decoding doesn't recurse back into this method
+	type playlistConfig PlaylistConfig
+	var obj playlistConfig
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("playlist entry must be a URL string or an object: %w", err)
+	}
+	*p = PlaylistConfig(obj)
+	return nil
+}
+
+// playlistsFromEnv reads playlists set in the environment, either as
+// PLAYLISTS="Name=URL;Name=URL" or as numbered PLAYLIST_1_NAME and
+// PLAYLIST_1_URL pairs counting up from 1. Both can be used together; a
+// numbered pair wins over a PLAYLISTS entry with the same name.
+func playlistsFromEnv() (map[string]PlaylistConfig, error) {
+	playlists := make(map[string]PlaylistConfig)
+
+	// In a YAML config "playlists" is a map, which isn't for us
+	list, _ := viper.Get("PLAYLISTS").(string)
+	for _, entry := range strings.FieldsFunc(list, func(r rune) bool { return r == ';' || r == '\n' }) {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, playlist, err := ParsePlaylistFlag(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PLAYLISTS entry %q: use Name=URL, separated by ;", entry)
+		}
+		playlists[name] = playlist
+	}
+
+	for n := 1; ; n++ {
+		nameKey, urlKey := fmt.Sprintf("PLAYLIST_%d_NAME", n), fmt.Sprintf("PLAYLIST_%d_URL", n)
+		name, url := strings.TrimSpace(viper.GetString(nameKey)), strings.TrimSpace(viper.GetString(urlKey))
+		if name == "" && url == "" {
+			break
+		}
+		if name == "" || url == "" {
+			return nil, fmt.Errorf("%s and %s must be set together", nameKey, urlKey)
+		}
+		playlists[name] = PlaylistConfig{URL: url}
+	}
+	return playlists, nil
+}
+
+var audioQualityRe = regexp.MustCompile(`^([0-9]|[0-9]+[Kk])$`)
+
+// validateAudioQuality checks a value accepted by yt-dlp's --audio-quality
+func validateAudioQuality(quality string) error {
+	if !audioQualityRe.MatchString(quality) {
+		return fmt.Errorf("invalid audio quality %q: use 0-9 or a bitrate like 192K", quality)
+	}
+	return nil
+}
+
+// validatePlaylists checks every playlist entry
+func (c *Config) validatePlaylists() error {
+	for name, p := range c.Playlists {
+		if p.URL == "" {
+			return fmt.Errorf("playlist %q has no url", name)
+		}
+		if p.Quality != "" {
+			if err := validateAudioQuality(p.Quality); err != nil {
+				return fmt.Errorf("playlist %q: %w", name, err)
+			}
+		}
+		switch p.MediaType {
+		case "", MediaTypeAudio, MediaTypeVideo:
+		default:
+			return fmt.Errorf("playlist %q: invalid media_type %q: must be audio or video", name, p.MediaType)
+		}
+		if p.AudioFormat != "" && !slices.Contains(AudioFormats, p.AudioFormat) {
+			return fmt.Errorf("playlist %q: invalid audio_format %q: must be one of %s", name, p.AudioFormat, strings.Join(AudioFormats, ", "))
+		}
+		if p.OutputSubdir != "" {
+			if err := validateOutputSubdir(p.OutputSubdir); err != nil {
+				return fmt.Errorf("playlist %q: %w", name, err)
+			}
+		}
+		if p.Cookies != "" {
+			if err := checkCookiesFile(p.Cookies); err != nil {
+				return fmt.Errorf("playlist %q: %w", name, err)
+			}
+		}
+		if p.FilenameTemplate != "" {
+			if err := validateFilenameTemplate(p.FilenameTemplate); err != nil {
+				return fmt.Errorf("playlist %q: %w", name, err)
+			}
+		}
+		for _, d := range []string{p.MaxDuration, p.MinDuration} {
+			if d == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(d); err != nil {
+				return fmt.Errorf("playlist %q: invalid duration %q: use a value like 90s or 2h", name, d)
+			}
+		}
+		if err := p.TitleFilters.compile(); err != nil {
+			return fmt.Errorf("playlist %q: %w", name, err)
+		}
+		c.Playlists[name] = p
+		if err := validateVideoIDs(p.BlockedVideoIDs); err != nil {
+			return fmt.Errorf("playlist %q: %w", name, err)
+		}
+		if p.Interval != "" {
+			if d, err := time.ParseDuration(p.Interval); err != nil || d <= 0 {
+				return fmt.Errorf("playlist %q: invalid interval %q: use a value like 2m or 24h", name, p.Interval)
+			}
+		}
+		if err := validateDurationRange(c.PlaylistMinDuration(p), c.PlaylistMaxDuration(p)); err != nil {
+			return fmt.Errorf("playlist %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// IsEnabled reports whether a playlist is checked; playlists are unless
+// enabled is set to false
+func (p PlaylistConfig) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// PlaylistQuality returns the effective audio quality for a playlist
+func (c *Config) PlaylistQuality(p PlaylistConfig) string {
+	if p.Quality != "" {
+		return p.Quality
+	}
+	return c.AudioQuality
+}
+
+// PlaylistMediaType returns the effective media type for a playlist
+func (c *Config) PlaylistMediaType(p PlaylistConfig) string {
+	if p.MediaType != "" {
+		return p.MediaType
+	}
+	return MediaTypeAudio
+}
+
+// PlaylistAudioFormat returns the format a playlist's audio is extracted to
+func (c *Config) PlaylistAudioFormat(p PlaylistConfig) string {
+	if p.AudioFormat != "" {
+		return p.AudioFormat
+	}
+	return "mp3"
+}
+
+// validateOutputSubdir checks that a playlist folder stays inside the library
+func validateOutputSubdir(dir string) error {
+	if filepath.IsAbs(dir) {
+		return fmt.Errorf("invalid output_subdir %q: must be relative to MUSIC_PARENT_DIR", dir)
+	}
+	clean := filepath.Clean(dir)
+	if clean == "." || clean == ".." || strings.HasPrefix(filepath.ToSlash(clean), "../") {
+		return fmt.Errorf("invalid output_subdir %q: must be a folder inside MUSIC_PARENT_DIR", dir)
+	}
+	return nil
+}
+
+// PlaylistLoudnessTarget returns the loudness target in LUFS for a playlist,
+// or 0 when it isn't normalized
+func (c *Config) PlaylistLoudnessTarget(p PlaylistConfig) float64 {
+	normalize := c.NormalizeLoudness
+	if p.NormalizeLoudness != nil {
+		normalize = *p.NormalizeLoudness
+	}
+	if !normalize {
+		return 0
+	}
+	return c.LoudnessTarget
+}
+
+// PlaylistMaxDuration returns the longest video a playlist downloads, or 0
+// for no limit
+func (c *Config) PlaylistMaxDuration(p PlaylistConfig) time.Duration {
+	if d, err := time.ParseDuration(p.MaxDuration); err == nil {
+		return d
+	}
+	return c.MaxDuration
+}
+
+// PlaylistMinDuration returns the shortest video a playlist downloads, or 0
+// for no limit
+func (c *Config) PlaylistMinDuration(p PlaylistConfig) time.Duration {
+	if d, err := time.ParseDuration(p.MinDuration); err == nil {
+		return d
+	}
+	return c.MinDuration
+}
+
+// validateDurationRange checks that duration limits aren't negative or crossed
+func validateDurationRange(min, max time.Duration) error {
+	if min < 0 || max < 0 {
+		return fmt.Errorf("duration limits can't be negative")
+	}
+	if max > 0 && min > max {
+		return fmt.Errorf("minimum duration %s is longer than maximum %s", min, max)
+	}
+	return nil
+}
+
+// PlaylistInterval returns how often a playlist is checked: its fixed
+// interval, or adaptively by whether it changed within WatchActiveWindow
+func (c *Config) PlaylistInterval(p PlaylistConfig, lastChange time.Time) time.Duration {
+	if d, err := time.ParseDuration(p.Interval); err == nil {
+		return d
+	}
+	if time.Since(lastChange) < c.WatchActiveWindow {
+		return c.WatchActiveInterval
+	}
+	return c.WatchInterval
+}
+
+// videoIDRe matches a YouTube video ID
+var videoIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// validateVideoIDs checks a list of YouTube video IDs
+func validateVideoIDs(ids []string) error {
+	for _, id := range ids {
+		if !videoIDRe.MatchString(id) {
+			return fmt.Errorf("invalid video ID %q: use the 11 characters after watch?v=", id)
+		}
+	}
+	return nil
+}
+
+// PlaylistBlockedIDs returns the videos a playlist never downloads
+func (c *Config) PlaylistBlockedIDs(p PlaylistConfig) map[string]bool {
+	blocked := make(map[string]bool, len(c.BlockedVideoIDs)+len(p.BlockedVideoIDs))
+	for _, id := range append(slices.Clone(c.BlockedVideoIDs), p.BlockedVideoIDs...) {
+		blocked[id] = true
+	}
+	return blocked
+}
+
+// PlaylistCookies returns the cookies file to use for a playlist, if any
+func (c *Config) PlaylistCookies(p PlaylistConfig) string {
+	if p.Cookies != "" {
+		return p.Cookies
+	}
+	return c.CookiesPath
+}
+
+// checkCookiesFile makes sure a cookies file exists and is readable
+func checkCookiesFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("cookies file %s does not exist; export your browser cookies in Netscape format (see yt-dlp's --cookies option)", path)
+	} else if err != nil {
+		return fmt.Errorf("cannot read cookies file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cookies file %s is a directory", path)
+	}
+	return nil
+}
+
+// PlaylistFilenameTemplate returns the yt-dlp output template for a playlist
+func (c *Config) PlaylistFilenameTemplate(p PlaylistConfig) string {
+	if p.FilenameTemplate != "" {
+		return p.FilenameTemplate
+	}
+	return c.FilenameTemplate
+}
+
+// validateFilenameTemplate checks a yt-dlp output template, relative to the
+// playlist folder. Templates without the video ID are allowed but can make
+// two videos with the same title share one file, so they log a warning.
+func validateFilenameTemplate(tmpl string) error {
+	if !strings.HasSuffix(tmpl, ".%(ext)s") {
+		return fmt.Errorf("invalid filename template %q: must end with .%%(ext)s", tmpl)
+	}
+	if filepath.IsAbs(tmpl) {
+		return fmt.Errorf("invalid filename template %q: must be relative to the playlist folder", tmpl)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(tmpl), "/") {
+		if part == ".." {
+			return fmt.Errorf("invalid filename template %q: must stay inside the playlist folder", tmpl)
+		}
+	}
+	if !strings.Contains(tmpl, "%(id)s") {
+		slog.Warn("Filename template has no %(id)s; videos with the same name get an [id] suffix", "template", tmpl)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Schedule limits heavy work, downloads and deep validation, to time windows
+// of the day, e.g. off-peak hours or while a NAS is awake. With no windows
+// heavy work runs at any time.
+type Schedule struct {
+	// Windows are "HH:MM-HH:MM" ranges; one ending before it starts, like
+	// "23:00-07:00", crosses midnight
+	Windows []string `json:"windows"`
+
+	// Invert makes Windows the times heavy work is not allowed
+	Invert bool `json:"invert"`
+
+	// Timezone is the IANA zone the windows are in, e.g. "Europe/London";
+	// defaults to the local zone, which is UTC in the container
+	Timezone string `json:"timezone"`
+
+	// PauseListing also stops playlists being checked outside the windows;
+	// by default they are still listed and new videos wait for a window
+	PauseListing bool `json:"pause_listing"`
+
+	windows  []window
+	location *time.Location
+}
+
+// window is a range of minutes since midnight; end is before start when
+// it crosses midnight
+type window struct {
+	start, end int
+}
+
+var windowRe = regexp.MustCompile(`^([0-9]{1,2}):([0-9]{2})-([0-9]{1,2}):([0-9]{2})$`)
+
+// parse validates the windows and timezone
+func (s *Schedule) parse() error {
+	s.location = time.Local
+	if s.Timezone != "" {
+		loc, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+		s.location = loc
+	}
+
+	s.windows = nil
+	for _, w := range s.Windows {
+		m := windowRe.FindStringSubmatch(w)
+		if m == nil {
+			return fmt.Errorf("invalid window %q: use HH:MM-HH:MM, e.g. 01:00-07:00", w)
+		}
+		start, ok1 := minutes(m[1], m[2])
+		end, ok2 := minutes(m[3], m[4])
+		if !ok1 || !ok2 || start == end {
+			return fmt.Errorf("invalid window %q: use HH:MM-HH:MM, e.g. 01:00-07:00", w)
+		}
+		s.windows = append(s.windows, window{start: start, end: end})
+	}
+	return nil
+}
+
+// minutes converts hours and minutes to minutes since midnight; 24:00 is
+// allowed as the end of the day
+func minutes(hh, mm string) (int, bool) {
+	h, _ := strconv.Atoi(hh)
+	m, _ := strconv.Atoi(mm)
+	if m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, false
+	}
+	return h*60 + m, true
+}
+
+// contains reports whether the minute of the day falls in the window
+func (w window) contains(minute int) bool {
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// Allows reports whether heavy work may run at t
+func (s Schedule) Allows(t time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+	if s.location != nil {
+		t = t.In(s.location)
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range s.windows {
+		if w.contains(minute) {
+			return !s.Invert
+		}
+	}
+	return s.Invert
+}
+
+// Enabled reports whether any windows are configured
+func (s Schedule) Enabled() bool {
+	return len(s.windows) > 0
+}
+
+// String describes the schedule for logging
+func (s Schedule) String() string {
+	if !s.Enabled() {
+		return "any time"
+	}
+	zone := "local time"
+	if s.Timezone != "" {
+		zone = s.Timezone
+	}
+	if s.Invert {
+		return fmt.Sprintf("outside %v (%s)", s.Windows, zone)
+	}
+	return fmt.Sprintf("during %v (%s)", s.Windows, zone)
+}
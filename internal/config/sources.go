@@ -0,0 +1,284 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Where a setting can come from, besides a file
+const (
+	SourceEnvironment = "environment"
+	SourceDefault     = "default"
+)
+
+// findYAML returns the YAML config file to load: CONFIG_FILE, config.yaml
+// in dir, or config.yaml in ConfigDir, whichever is set or exists first. It returns
+// "" when there is none, so only .env and playlists.json are used.
+func findYAML(dir string) (string, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+		return path, nil
+	}
+	for _, path := range []string{filepath.Join(dir, "config.yaml"), filepath.Join(dir, "config.yml"), filepath.Join(ConfigDir(), "config.yaml")} {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// readYAML parses a YAML config file. Settings use the environment
+// variable names in lower case, e.g. music_parent_dir; playlists, schedule,
+// proxy and notifications take the same shape as in playlists.json.
+func readYAML(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]any)
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// jsonSections converts the parts of a YAML config shaped like
+// playlists.json into JSON, so they're decoded by the same rules
+func jsonSections(doc map[string]any) ([]byte, error) {
+	sections := make(map[string]any)
+	for _, key := range []string{"playlists", "schedule", "proxy", "notifications"} {
+		if v, ok := doc[key]; ok {
+			sections[key] = v
+		}
+	}
+	return json.Marshal(sections)
+}
+
+// dotenvKeys lists the settings in a .env file
+func dotenvKeys(path string) map[string]bool {
+	v := viper.New()
+	v.SetConfigFile(path)
+	keys := make(map[string]bool)
+	if err := v.ReadInConfig(); err != nil {
+		return keys
+	}
+	for _, key := range v.AllKeys() {
+		keys[strings.ToUpper(key)] = true
+	}
+	return keys
+}
+
+// settingKeys lists the environment variable name of every setting
+func settingKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("mapstructure"); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// recordOrigins notes where each setting came from. Flags win over the
+// environment, which wins over .env, which wins over the YAML file; playlists, schedule, proxy and
+// notifications come from the YAML file when it has them and playlists.json otherwise,
+// though PROXY in the environment still wins.
+func (c *Config) recordOrigins(dotenvPath string, dotenv map[string]bool, yamlPath string, doc map[string]any, jsonPath string) {
+	c.origins = make(map[string]string)
+	for _, key := range settingKeys() {
+		_, inEnv := os.LookupEnv(key)
+		_, inYAML := doc[strings.ToLower(key)]
+		_, inFlags := flags.Settings[key]
+		switch {
+		case inFlags:
+			c.origins[key] = SourceFlag
+		case inEnv:
+			c.origins[key] = SourceEnvironment
+		case dotenv[key]:
+			c.origins[key] = dotenvPath
+		case inYAML:
+			c.origins[key] = yamlPath
+		default:
+			c.origins[key] = SourceDefault
+		}
+	}
+	for _, section := range []string{"playlists", "schedule", "proxy", "notifications"} {
+		if section == "proxy" && c.origins["PROXY"] != SourceDefault {
+			continue
+		}
+		_, inYAML := doc[section]
+		switch {
+		case inYAML:
+			c.origins[strings.ToUpper(section)] = yamlPath
+		case jsonPath != "":
+			c.origins[strings.ToUpper(section)] = jsonPath
+		default:
+			c.origins[strings.ToUpper(section)] = SourceDefault
+		}
+	}
+}
+
+// PlaylistsFile returns the file the playlists are read from. With only
+// environment playlists it's the playlists.json that would be read, so
+// creating it can be noticed.
+func (c *Config) PlaylistsFile() string {
+	return c.playlistsFile
+}
+
+// PrintConfig writes the files the config was loaded from, then every
+// setting with its value and where that value came from. Secrets are
+// masked as in String.
+func (c *Config) PrintConfig(w io.Writer) error {
+	from := append(slices.Clone(c.Sources), SourceEnvironment)
+	if len(flags.Settings)+len(flags.Playlists) > 0 {
+		from = append(from, "flags")
+	}
+	fmt.Fprintf(w, "Loaded from: %s\n\n", strings.Join(from, ", "))
+
+	masked := c.masked()
+	values := make(map[string]string)
+	v := reflect.ValueOf(masked)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("mapstructure"); key != "" {
+			values[key] = fmt.Sprint(v.Field(i).Interface())
+		}
+	}
+	values["PLAYLISTS"] = fmt.Sprintf("%d playlists", len(c.Playlists))
+	values["SCHEDULE"] = c.Schedule.String()
+	values["NOTIFICATIONS"] = c.notificationsSummary()
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tFROM")
+	for _, key := range keys {
+		origin := c.origins[key]
+		if origin == "" {
+			origin = SourceDefault
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", key, values[key], origin)
+	}
+	return tw.Flush()
+}
+
+// AddPlaylist adds a playlist to the YAML or JSON file at path, keeping
+// what's already there. YAML comments survive; playlists.json is rewritten
+// indented, with its keys sorted.
+func AddPlaylist(path, name, url string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = addYAMLPlaylist(data, name, url)
+	default:
+		data, err = addJSONPlaylist(data, name, url)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// addYAMLPlaylist adds a playlist to the playlists mapping of a YAML
+// config, adding the mapping if there isn't one
+func addYAMLPlaylist(data []byte, name, url string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a mapping of settings")
+	}
+
+	var playlists *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "playlists" {
+			playlists = root.Content[i+1]
+		}
+	}
+	switch {
+	case playlists == nil:
+		playlists = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "playlists"}, playlists)
+	case playlists.Kind == yaml.ScalarNode && playlists.Tag == "!!null":
+		// An empty "playlists:"
+		*playlists = yaml.Node{Kind: yaml.MappingNode}
+	case playlists.Kind != yaml.MappingNode:
+		return nil, fmt.Errorf("playlists must be a mapping of names to URLs")
+	}
+	for i := 0; i < len(playlists.Content); i += 2 {
+		if playlists.Content[i].Value == name {
+			return nil, fmt.Errorf("playlist %q already exists", name)
+		}
+	}
+	playlists.Content = append(playlists.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: name},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: url})
+
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// addJSONPlaylist adds a playlist to a playlists.json
+func addJSONPlaylist(data []byte, name, url string) ([]byte, error) {
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	playlists := make(map[string]json.RawMessage)
+	if raw, ok := doc["playlists"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &playlists); err != nil {
+			return nil, fmt.Errorf("playlists must be an object of names to URLs: %w", err)
+		}
+	}
+	if _, ok := playlists[name]; ok {
+		return nil, fmt.Errorf("playlist %q already exists", name)
+	}
+	entry, err := json.Marshal(url)
+	if err != nil {
+		return nil, err
+	}
+	playlists[name] = entry
+
+	if doc["playlists"], err = json.Marshal(playlists); err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import "fmt"
+
+// UploadsEnabled reports whether downloads are copied to remote storage
+func (c *Config) UploadsEnabled() bool {
+	return c.RcloneRemote != "" || c.S3Bucket != ""
+}
+
+// validateUpload checks at most one remote is set up, and completely
+func (c *Config) validateUpload() error {
+	if c.RcloneRemote != "" && c.S3Bucket != "" {
+		return fmt.Errorf("set RCLONE_REMOTE or S3_BUCKET, not both")
+	}
+	if c.S3Bucket != "" {
+		if c.S3AccessKeyID == "" || c.S3SecretAccessKey == "" {
+			return fmt.Errorf("S3_BUCKET needs S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+		if !isHTTPURL(c.S3Endpoint) {
+			return fmt.Errorf("invalid S3_ENDPOINT %q: must be an http or https URL", c.S3Endpoint)
+		}
+	}
+	if c.UploadDeleteLocal && !c.UploadsEnabled() {
+		return fmt.Errorf("UPLOAD_DELETE_LOCAL needs RCLONE_REMOTE or S3_BUCKET")
+	}
+	return nil
+}
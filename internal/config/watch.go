@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long a file must stay unchanged before a change is
+// reported, so an editor saving in several writes triggers one reload
+const watchDebounce = time.Second
+
+// Watch calls onChange whenever the file at path is written, created or
+// replaced, until ctx is cancelled. The directory is watched rather than
+// the file, so editors that save by renaming a new file into place and
+// Kubernetes ConfigMaps that swap a symlink are noticed too.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		// Stopped until the first change
+		debounce := time.NewTimer(watchDebounce)
+		debounce.Stop()
+		defer debounce.Stop()
+
+		name := filepath.Base(path)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// ConfigMaps update a hidden ..data symlink instead of the file
+				if base := filepath.Base(event.Name); base != name && base != "..data" {
+					continue
+				}
+				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) {
+					debounce.Reset(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("Failed to watch config file", "path", path, "error", err)
+			case <-debounce.C:
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// archivePrefix is the extractor key yt-dlp writes in front of YouTube IDs
+const archivePrefix = "youtube"
+
+// ArchiveImportStats summarizes an ImportArchive run
+type ArchiveImportStats struct {
+	Imported   int // New videos marked as downloaded
+	Existing   int // Already in the database
+	Duplicates int // Repeated lines in the archive
+	Skipped    int // Blank, malformed or non-YouTube lines
+}
+
+// ImportArchive reads a yt-dlp download archive ("youtube <id>" per line) and
+// marks every listed video as downloaded under the given playlist, so
+// ProcessPlaylist skips them. Imported rows have no file path.
+func (d *Database) ImportArchive(r io.Reader, playlistYoutubeID string) (ArchiveImportStats, error) {
+	var stats ArchiveImportStats
+
+	playlist, err := d.GetOrCreatePlaylist(playlistYoutubeID, playlistYoutubeID)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get or create playlist: %w", err)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return stats, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO videos (youtube_id, playlist_id, playlist_title, title, channel, validation_status, downloaded_at)
+		VALUES (?, ?, ?, ?, '', 'archived', NULL)
+		ON CONFLICT DO NOTHING
+	`)
+	if err != nil {
+		return stats, fmt.Errorf("failed to prepare archive insert: %w", err)
+	}
+	defer stmt.Close()
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != archivePrefix {
+			stats.Skipped++
+			continue
+		}
+
+		id := fields[1]
+		if seen[id] {
+			stats.Duplicates++
+			continue
+		}
+		seen[id] = true
+
+		// The video ID doubles as the title until real metadata is fetched
+		result, err := stmt.Exec(id, playlist.ID, playlist.Title, id)
+		if err != nil {
+			return stats, fmt.Errorf("failed to import video %s: %w", id, err)
+		}
+		if err := addMembership(tx, playlist.ID, id, 0); err != nil {
+			return stats, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			stats.Existing++
+		} else {
+			stats.Imported++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	_, err = tx.Exec(
+		`UPDATE playlists
+		SET updated_at = CURRENT_TIMESTAMP,
+		    video_count = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = ?)
+		WHERE id = ?`,
+		playlist.ID,
+		playlist.ID,
+	)
+	if err != nil {
+		return stats, fmt.Errorf("failed to update playlist: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stats, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return stats, nil
+}
+
+// ExportArchive writes every known video as a yt-dlp download archive
+// Returns the number of lines written
+func (d *Database) ExportArchive(w io.Writer) (int, error) {
+	rows, err := d.db.Query("SELECT youtube_id FROM videos ORDER BY id")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query videos: %w", err)
+	}
+	defer rows.Close()
+
+	bw := bufio.NewWriter(w)
+	count := 0
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return count, fmt.Errorf("error scanning row: %w", err)
+		}
+		if _, err := fmt.Fprintf(bw, "%s %s\n", archivePrefix, id); err != nil {
+			return count, fmt.Errorf("failed to write archive: %w", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return count, bw.Flush()
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "archive.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.AddVideo("existing001", "PL_A", "A", VideoMetadata{Title: "track", Channel: "chan", UploadDate: time.Now()}))
+
+	archive := strings.Join([]string{
+		"youtube aaaaaaaaaaa",
+		"youtube bbbbbbbbbbb",
+		"youtube aaaaaaaaaaa", // Duplicate
+		"vimeo 123456",        // Other extractor
+		"",
+		"youtube existing001",
+	}, "\n")
+
+	stats, err := db.ImportArchive(strings.NewReader(archive), "PL_A")
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveImportStats{Imported: 2, Existing: 1, Duplicates: 1, Skipped: 2}, stats)
+
+	for _, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb"} {
+		exists, err := db.VideoExists(id)
+		require.NoError(t, err)
+		assert.True(t, exists, "Imported video %s should be skipped by downloads", id)
+	}
+
+	// Archived rows have no file, so validation ignores them
+	checked, err := db.ValidateFiles()
+	require.NoError(t, err)
+	assert.Equal(t, 0, checked)
+
+	var out bytes.Buffer
+	n, err := db.ExportArchive(&out)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "youtube existing001\nyoutube aaaaaaaaaaa\nyoutube bbbbbbbbbbb\n", out.String())
+
+	// Re-importing our own export changes nothing
+	stats, err = db.ImportArchive(&out, "PL_A")
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveImportStats{Existing: 3}, stats)
+}
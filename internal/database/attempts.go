@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DownloadAttempt is one failed attempt at downloading a video
+type DownloadAttempt struct {
+	YoutubeID    string    `json:"youtube_id"`
+	AttemptedAt  time.Time `json:"attempted_at"`
+	ErrorClass   string    `json:"error_class"`
+	ErrorMessage string    `json:"error_message"`
+	ExitCode     int       `json:"yt_dlp_exit_code,omitempty"` // 0 when yt-dlp didn't exit with an error
+}
+
+// FailedVideo is a video that keeps failing, with its latest attempt
+type FailedVideo struct {
+	DownloadFailure
+	ErrorClass string `json:"error_class"`
+	ExitCode   int    `json:"yt_dlp_exit_code,omitempty"`
+}
+
+// RecordDownloadAttempt logs a failed attempt and updates the retry summary
+// of the video, if an earlier download of it exists
+func (d *Database) RecordDownloadAttempt(attempt DownloadAttempt) error {
+	if attempt.AttemptedAt.IsZero() {
+		attempt.AttemptedAt = time.Now().UTC()
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO download_attempts (youtube_id, attempted_at, error_class, error_message, yt_dlp_exit_code)
+		VALUES (?, ?, ?, ?, NULLIF(?, 0))
+	`, attempt.YoutubeID, dbTime(attempt.AttemptedAt), attempt.ErrorClass, attempt.ErrorMessage, attempt.ExitCode)
+	if err != nil {
+		return fmt.Errorf("failed to record download attempt: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE videos
+		SET retry_count = COALESCE(retry_count, 0) + 1, last_error = ?, last_attempted_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE youtube_id = ?
+	`, attempt.ErrorMessage, dbTime(attempt.AttemptedAt), attempt.YoutubeID)
+	if err != nil {
+		return fmt.Errorf("failed to update retry count of %s: %w", attempt.YoutubeID, err)
+	}
+
+	return tx.Commit()
+}
+
+// GetDownloadAttempts returns the failed attempts for a video, oldest first
+func (d *Database) GetDownloadAttempts(youtubeID string) ([]DownloadAttempt, error) {
+	rows, err := d.db.Query(`
+		SELECT youtube_id, attempted_at, error_class, error_message, yt_dlp_exit_code
+		FROM download_attempts
+		WHERE youtube_id = ?
+		ORDER BY id
+	`, youtubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query download attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []DownloadAttempt
+	for rows.Next() {
+		var a DownloadAttempt
+		var errorClass, errorMessage sql.NullString
+		var exitCode sql.NullInt64
+		if err := rows.Scan(&a.YoutubeID, &a.AttemptedAt, &errorClass, &errorMessage, &exitCode); err != nil {
+			return nil, fmt.Errorf("failed to scan download attempt: %w", err)
+		}
+		a.ErrorClass = errorClass.String
+		a.ErrorMessage = errorMessage.String
+		a.ExitCode = int(exitCode.Int64)
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// GetFailedVideos returns videos that have failed on at least minAttempts
+// scheduler passes without succeeding since, most attempts first
+func (d *Database) GetFailedVideos(minAttempts int) ([]FailedVideo, error) {
+	rows, err := d.db.Query(`
+		SELECT f.youtube_id, f.playlist_youtube_id, f.attempts, f.last_error, f.permanent, f.availability, f.last_attempt_at,
+			a.error_class, a.yt_dlp_exit_code
+		FROM download_failures f
+		LEFT JOIN download_attempts a ON a.id = (
+			SELECT MAX(id) FROM download_attempts WHERE youtube_id = f.youtube_id
+		)
+		WHERE f.attempts >= ?
+		ORDER BY f.attempts DESC, f.youtube_id
+	`, minAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed videos: %w", err)
+	}
+	defer rows.Close()
+
+	var videos []FailedVideo
+	for rows.Next() {
+		var v FailedVideo
+		var playlistYoutubeID, lastError, availability, errorClass sql.NullString
+		var exitCode sql.NullInt64
+		if err := rows.Scan(&v.YoutubeID, &playlistYoutubeID, &v.Attempts, &lastError, &v.Permanent, &availability, &v.LastAttemptAt,
+			&errorClass, &exitCode); err != nil {
+			return nil, fmt.Errorf("failed to scan failed video: %w", err)
+		}
+		v.PlaylistYoutubeID = playlistYoutubeID.String
+		v.LastError = lastError.String
+		v.Availability = availability.String
+		v.ErrorClass = errorClass.String
+		v.ExitCode = int(exitCode.Int64)
+		videos = append(videos, v)
+	}
+	return videos, rows.Err()
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadAttemptsUpdateRetryCount(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "attempts.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.AddVideo("vid1", "PL_A", "A", VideoMetadata{Title: "song", UploadDate: time.Now()}))
+	retries := func() (int, string) {
+		var count int
+		var lastError *string
+		require.NoError(t, db.db.QueryRow("SELECT retry_count, last_error FROM videos WHERE youtube_id = 'vid1'").Scan(&count, &lastError))
+		if lastError == nil {
+			return count, ""
+		}
+		return count, *lastError
+	}
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.RecordDownloadFailure("vid1", "PL_A", "timed out", false))
+		require.NoError(t, db.RecordDownloadAttempt(DownloadAttempt{YoutubeID: "vid1", ErrorClass: "transient", ErrorMessage: "timed out"}))
+	}
+	count, lastError := retries()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, "timed out", lastError)
+
+	attempts, err := db.GetDownloadAttempts("vid1")
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Zero(t, attempts[0].ExitCode, "No exit code is stored as NULL")
+
+	// A success resets the summary but keeps the history
+	require.NoError(t, db.ClearDownloadFailure("vid1"))
+	count, lastError = retries()
+	assert.Zero(t, count)
+	assert.Empty(t, lastError)
+	attempts, err = db.GetDownloadAttempts("vid1")
+	require.NoError(t, err)
+	assert.Len(t, attempts, 2)
+
+	failed, err := db.GetFailedVideos(1)
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+}
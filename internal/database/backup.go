@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup writes a consistent copy of the database to destPath while it
+// stays in use. The copy is written to a temporary file next to destPath,
+// checked with PRAGMA integrity_check and only then renamed into place, so
+// destPath is never left half written. Postgres databases are backed up
+// with the server's own tools.
+func (d *Database) Backup(destPath string) error {
+	if d.dialect.postgres() {
+		return errors.New("Postgres databases can't be backed up by pp-downloader; use pg_dump")
+	}
+	dir := filepath.Dir(destPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(destPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	// VACUUM INTO needs SQLite 3.27; older libraries go through the backup API
+	if _, err := d.db.Exec("VACUUM INTO ?", tmpPath); err != nil {
+		d.logger.Warn("VACUUM INTO failed, using the backup API instead", "error", err)
+		if err := os.Truncate(tmpPath, 0); err != nil {
+			return fmt.Errorf("failed to reset backup file: %w", err)
+		}
+		if err := d.copyTo(tmpPath); err != nil {
+			return err
+		}
+	}
+
+	if err := verifyBackup(tmpPath); err != nil {
+		return err
+	}
+	if err := syncFile(tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	return nil
+}
+
+// copyTo copies the database to destPath with SQLite's online backup API
+func (d *Database) copyTo(destPath string) error {
+	ctx := context.Background()
+	src, err := d.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer src.Close()
+
+	destDB, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer destDB.Close()
+	dest, err := destDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer dest.Close()
+
+	return dest.Raw(func(destConn interface{}) error {
+		return src.Raw(func(srcConn interface{}) error {
+			backup, err := destConn.(*sqlite3.SQLiteConn).Backup("main", srcConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("failed to copy database: %w", err)
+			}
+			if err := backup.Finish(); err != nil {
+				return fmt.Errorf("failed to finish backup: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// verifyBackup opens a backup and runs PRAGMA integrity_check on it
+func verifyBackup(path string) error {
+	db, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("failed to check backup: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check backup: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("backup failed integrity check: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// syncFile flushes a file to disk before it is renamed into place
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync backup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup(t *testing.T) {
+	skipOnPostgres(t, "Postgres databases are backed up with pg_dump")
+	dir := t.TempDir()
+	db := newBatchTestDB(t)
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", []DownloadRecord{syntheticRecord(1), syntheticRecord(2)}))
+
+	dest := filepath.Join(dir, "backups", "copy.db")
+	require.NoError(t, db.Backup(dest))
+	// An existing backup is replaced, even while a write is in progress
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE videos SET title = 'Uncommitted'")
+	require.NoError(t, err)
+	require.NoError(t, db.Backup(dest))
+
+	entries, err := os.ReadDir(filepath.Dir(dest))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "No temporary files are left behind")
+
+	copied, err := openTestDB(t, dest)
+	require.NoError(t, err)
+	defer copied.Close()
+	known, err := copied.GetExistingVideoIDs([]string{"vid00001", "vid00002"})
+	require.NoError(t, err)
+	assert.Len(t, known, 2)
+	titles, err := copied.SearchVideos("Uncommitted", 0)
+	require.NoError(t, err)
+	assert.Empty(t, titles, "Only committed data is copied")
+}
+
+func TestBackupAPIFallback(t *testing.T) {
+	skipOnPostgres(t, "Postgres databases are backed up with pg_dump")
+	dir := t.TempDir()
+	db := newBatchTestDB(t)
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", []DownloadRecord{syntheticRecord(1)}))
+
+	dest := filepath.Join(dir, "copy.db")
+	require.NoError(t, db.copyTo(dest))
+	require.NoError(t, verifyBackup(dest))
+
+	require.NoError(t, os.WriteFile(dest, []byte("not a database"), 0644))
+	assert.Error(t, verifyBackup(dest))
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"fmt"
+)
+
+// DefaultBatchSize is the number of downloads written per transaction in bulk runs
+const DefaultBatchSize = 50
+
+// DownloadRecord is a completed download waiting to be written to the database
+type DownloadRecord struct {
+	YoutubeID    string
+	Metadata     VideoMetadata
+	FilePath     string
+	FileSize     int64
+	Checksum     string  // SHA-256 of the file; empty when hashing is off
+	Loudness     float64 // LUFS measured before normalization; 0 when not normalized
+	ParsedArtist string  // Artist and song split out of the video title, if parsed
+	ParsedTitle  string
+	Position     int // 1-based position in the playlist; 0 when unknown
+	ArtEmbedded  bool
+	ArtMissing   string // What yt-dlp lacked to embed cover art, e.g. "ffmpeg"
+	Media        MediaInfo
+	Tracks       []Track // Chapter tracks, when the video was split
+}
+
+// BatchWriter buffers completed downloads for one playlist and writes them in
+// chunks. If the process dies, at most the unflushed chunk is lost; those
+// videos aren't in the database, so the next run downloads them again.
+type BatchWriter struct {
+	db                *Database
+	playlistYoutubeID string
+	playlistTitle     string
+	size              int
+	pending           []DownloadRecord
+	onFlush           func(records []DownloadRecord)
+}
+
+// NewBatchWriter creates a BatchWriter for a playlist. onFlush, if set, is
+// called with each chunk after it has been committed.
+func (d *Database) NewBatchWriter(playlistYoutubeID, playlistTitle string, size int, onFlush func(records []DownloadRecord)) *BatchWriter {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	return &BatchWriter{
+		db:                d,
+		playlistYoutubeID: playlistYoutubeID,
+		playlistTitle:     playlistTitle,
+		size:              size,
+		onFlush:           onFlush,
+	}
+}
+
+// Add queues a record, flushing once a full chunk has accumulated
+func (b *BatchWriter) Add(record DownloadRecord) error {
+	b.pending = append(b.pending, record)
+	if len(b.pending) >= b.size {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Pending returns the number of records not yet written
+func (b *BatchWriter) Pending() int {
+	return len(b.pending)
+}
+
+// Flush writes all queued records in a single transaction
+func (b *BatchWriter) Flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+
+	records := b.pending
+	b.pending = nil
+	if err := b.db.RecordDownloads(b.playlistYoutubeID, b.playlistTitle, records); err != nil {
+		return err
+	}
+
+	if b.onFlush != nil {
+		b.onFlush(records)
+	}
+	return nil
+}
+
+// RecordDownload writes a completed download's metadata and file info
+// together, so a video is never recorded without its real file
+func (d *Database) RecordDownload(playlistYoutubeID, playlistTitle string, record DownloadRecord) error {
+	return d.RecordDownloads(playlistYoutubeID, playlistTitle, []DownloadRecord{record})
+}
+
+// RecordDownloads writes several completed downloads for one playlist in a
+// single transaction, updating the playlist counters once
+func (d *Database) RecordDownloads(playlistYoutubeID, playlistTitle string, records []DownloadRecord) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var playlistID int64
+	if err := tx.QueryRow("SELECT id FROM playlists WHERE youtube_id = ?", playlistYoutubeID).Scan(&playlistID); err != nil {
+		return fmt.Errorf("failed to find playlist %s: %w", playlistYoutubeID, err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO videos (
+			youtube_id, playlist_id, playlist_title, title, description,
+			channel, channel_id, duration, view_count,
+			thumbnail_url, upload_date, is_live,
+			live_start_time, live_end_time, metadata_json,
+			file_path, file_size, file_checksum, validation_status, last_validated, downloaded_at, art_embedded, art_missing,
+			media_type, container, codec, loudness_lufs, parsed_artist, parsed_title,
+			bitrate, sample_rate, channels
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, ''),
+			NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0))
+		ON CONFLICT(youtube_id) DO UPDATE SET
+			playlist_id = excluded.playlist_id,
+			playlist_title = excluded.playlist_title,
+			title = excluded.title,
+			description = excluded.description,
+			channel = excluded.channel,
+			channel_id = excluded.channel_id,
+			duration = excluded.duration,
+			view_count = excluded.view_count,
+			thumbnail_url = excluded.thumbnail_url,
+			upload_date = excluded.upload_date,
+			is_live = excluded.is_live,
+			live_start_time = excluded.live_start_time,
+			live_end_time = excluded.live_end_time,
+			metadata_json = excluded.metadata_json,
+			file_path = excluded.file_path,
+			file_size = excluded.file_size,
+			file_checksum = excluded.file_checksum,
+			validation_status = excluded.validation_status,
+			last_validated = excluded.last_validated,
+			downloaded_at = excluded.downloaded_at,
+			art_embedded = excluded.art_embedded,
+			art_missing = excluded.art_missing,
+			media_type = excluded.media_type,
+			container = excluded.container,
+			codec = excluded.codec,
+			loudness_lufs = excluded.loudness_lufs,
+			parsed_artist = excluded.parsed_artist,
+			parsed_title = excluded.parsed_title,
+			bitrate = excluded.bitrate,
+			sample_rate = excluded.sample_rate,
+			channels = excluded.channels,
+			storage_location = CASE WHEN videos.storage_location IS NULL THEN NULL ELSE 'local' END, -- A new file is uploaded again
+			validation_error = NULL,
+			last_verified = NULL, -- The new file hasn't been re-hashed yet
+			retry_count = 0,
+			last_error = NULL,
+			updated_at = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare video insert: %w", err)
+	}
+	defer stmt.Close()
+
+	clearFailure, err := tx.Prepare("DELETE FROM download_failures WHERE youtube_id = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare failure cleanup: %w", err)
+	}
+	defer clearFailure.Close()
+
+	now := dbNow()
+	for _, r := range records {
+		m := r.Metadata
+		_, err := stmt.Exec(
+			r.YoutubeID, playlistID, playlistTitle, m.Title, m.Description,
+			m.Channel, m.ChannelID, m.Duration, m.ViewCount,
+			m.ThumbnailURL, dbTime(m.UploadDate), m.IsLive,
+			dbTime(m.LiveStartTime), dbTime(m.LiveEndTime), m.MetadataJSON,
+			d.root.store(r.FilePath), r.FileSize, r.Checksum, "valid", now, now, r.ArtEmbedded, r.ArtMissing,
+			r.Media.mediaType(), r.Media.Container, r.Media.Codec, r.Loudness,
+			r.ParsedArtist, r.ParsedTitle,
+			r.Media.Bitrate, r.Media.SampleRate, r.Media.Channels,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert video %s: %w", r.YoutubeID, err)
+		}
+		if err := addMembership(tx, playlistID, r.YoutubeID, r.Position); err != nil {
+			return err
+		}
+		if _, err := clearFailure.Exec(r.YoutubeID); err != nil {
+			return fmt.Errorf("failed to clear failures for video %s: %w", r.YoutubeID, err)
+		}
+		if len(r.Tracks) > 0 {
+			if err := setVideoTracks(tx, d.root, r.YoutubeID, r.Tracks, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(
+		`UPDATE playlists
+		SET last_checked = ?,
+		    updated_at = CURRENT_TIMESTAMP,
+		    video_count = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = ?)
+		WHERE id = ?`,
+		now,
+		playlistID,
+		playlistID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update playlist: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func syntheticRecord(i int) DownloadRecord {
+	return DownloadRecord{
+		YoutubeID: fmt.Sprintf("vid%05d", i),
+		Metadata: VideoMetadata{
+			Title:      fmt.Sprintf("Track %d", i),
+			Channel:    "Synthetic Channel",
+			Duration:   180,
+			UploadDate: time.Now(),
+		},
+		FilePath: fmt.Sprintf("/music/bench/Track %d [vid%05d].mp3", i, i),
+		FileSize: 4 << 20,
+	}
+}
+
+func newBatchTestDB(t testing.TB) *Database {
+	t.Helper()
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "batch.db"))
+	require.NoError(t, err, "Failed to create database")
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.GetOrCreatePlaylist("PL_BATCH", "Batch")
+	require.NoError(t, err, "Failed to create playlist")
+	return db
+}
+
+func TestBatchWriterFlushesInChunks(t *testing.T) {
+	db := newBatchTestDB(t)
+
+	var flushed []int
+	batch := db.NewBatchWriter("PL_BATCH", "Batch", 50, func(records []DownloadRecord) {
+		flushed = append(flushed, len(records))
+	})
+
+	for i := 0; i < 120; i++ {
+		require.NoError(t, batch.Add(syntheticRecord(i)))
+	}
+	assert.Equal(t, []int{50, 50}, flushed, "Full chunks are written as they fill")
+	assert.Equal(t, 20, batch.Pending())
+
+	require.NoError(t, batch.Flush())
+	assert.Equal(t, []int{50, 50, 20}, flushed)
+
+	var count, videoCount int
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM videos WHERE validation_status = 'valid' AND file_size > 0").Scan(&count))
+	require.NoError(t, db.db.QueryRow("SELECT video_count FROM playlists WHERE youtube_id = 'PL_BATCH'").Scan(&videoCount))
+	assert.Equal(t, 120, count)
+	assert.Equal(t, 120, videoCount)
+}
+
+func TestBatchWriterCrashLosesOnlyUnflushedChunk(t *testing.T) {
+	db := newBatchTestDB(t)
+
+	batch := db.NewBatchWriter("PL_BATCH", "Batch", 50, nil)
+	for i := 0; i < 120; i++ {
+		require.NoError(t, batch.Add(syntheticRecord(i)))
+	}
+	// Simulate a crash: the final Flush never happens
+
+	for i := 0; i < 120; i++ {
+		exists, err := db.VideoExists(syntheticRecord(i).YoutubeID)
+		require.NoError(t, err)
+		// Unwritten videos are absent, so the next run downloads them again
+		assert.Equal(t, i < 100, exists, "Unexpected existence for video %d", i)
+	}
+}
+
+func TestRecordDownloadsIsAtomic(t *testing.T) {
+	db := newBatchTestDB(t)
+
+	// A bad row aborts the whole chunk rather than committing half of it
+	records := []DownloadRecord{syntheticRecord(1), syntheticRecord(2)}
+	err := db.RecordDownloads("PL_MISSING", "Missing", records)
+	require.Error(t, err, "Unknown playlist should fail the batch")
+
+	exists, err := db.VideoExists(records[0].YoutubeID)
+	require.NoError(t, err)
+	assert.False(t, exists, "No rows should be written from a failed batch")
+}
+
+const benchmarkRows = 5000
+
+func BenchmarkInsertPerVideo(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		db := newBatchTestDB(b)
+		b.StartTimer()
+
+		for i := 0; i < benchmarkRows; i++ {
+			r := syntheticRecord(i)
+			if err := db.AddVideo(r.YoutubeID, "PL_BATCH", "Batch", r.Metadata); err != nil {
+				b.Fatal(err)
+			}
+			if err := db.UpdateFileInfo(r.YoutubeID, r.FilePath, r.FileSize, r.Checksum); err != nil {
+				b.Fatal(err)
+			}
+			if err := db.SetArtEmbedded(r.YoutubeID, r.ArtEmbedded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkInsertBatched(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		db := newBatchTestDB(b)
+		b.StartTimer()
+
+		batch := db.NewBatchWriter("PL_BATCH", "Batch", DefaultBatchSize, nil)
+		for i := 0; i < benchmarkRows; i++ {
+			if err := batch.Add(syntheticRecord(i)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := batch.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRecordDownloadsStoresParsedTitle(t *testing.T) {
+	db := newBatchTestDB(t)
+
+	parsed := syntheticRecord(1)
+	parsed.ParsedArtist, parsed.ParsedTitle = "Avicii", "Levels"
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", []DownloadRecord{parsed, syntheticRecord(2)}))
+
+	artist, title, err := db.GetParsedTitle(parsed.YoutubeID)
+	require.NoError(t, err)
+	assert.Equal(t, "Avicii", artist)
+	assert.Equal(t, "Levels", title)
+
+	artist, title, err = db.GetParsedTitle(syntheticRecord(2).YoutubeID)
+	require.NoError(t, err)
+	assert.Empty(t, artist)
+	assert.Empty(t, title)
+}
+
+func TestGetExistingVideoIDs(t *testing.T) {
+	db := newBatchTestDB(t)
+
+	// Enough videos to span several IN (...) chunks
+	var records []DownloadRecord
+	var ids []string
+	for i := 0; i < existingIDsChunk*2+10; i++ {
+		if i%3 == 0 {
+			records = append(records, syntheticRecord(i))
+		}
+		ids = append(ids, syntheticRecord(i).YoutubeID)
+	}
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", records))
+
+	existing, err := db.GetExistingVideoIDs(ids)
+	require.NoError(t, err)
+	assert.Len(t, existing, len(records))
+	assert.True(t, existing[syntheticRecord(existingIDsChunk*2+8).YoutubeID], "The last chunk is checked")
+	assert.False(t, existing[syntheticRecord(1).YoutubeID])
+
+	existing, err = db.GetExistingVideoIDs(nil)
+	require.NoError(t, err)
+	assert.Empty(t, existing)
+}
+
+// seedExistingVideos records every other video of a benchmark playlist
+func seedExistingVideos(b *testing.B) (*Database, []string) {
+	db := newBatchTestDB(b)
+	var records []DownloadRecord
+	ids := make([]string, benchmarkRows)
+	for i := range ids {
+		if i%2 == 0 {
+			records = append(records, syntheticRecord(i))
+		}
+		ids[i] = syntheticRecord(i).YoutubeID
+	}
+	if err := db.RecordDownloads("PL_BATCH", "Batch", records); err != nil {
+		b.Fatal(err)
+	}
+	return db, ids
+}
+
+func BenchmarkVideoExistsPerVideo(b *testing.B) {
+	db, ids := seedExistingVideos(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, id := range ids {
+			if _, err := db.VideoExists(id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(len(ids)), "queries/op")
+}
+
+func BenchmarkGetExistingVideoIDs(b *testing.B) {
+	db, ids := seedExistingVideos(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := db.GetExistingVideoIDs(ids); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64((len(ids)+existingIDsChunk-1)/existingIDsChunk), "queries/op")
+}
+
+func TestRecordDownloadWritesFileInfo(t *testing.T) {
+	db := newBatchTestDB(t)
+	require.NoError(t, db.AddVideo("vid00001", "PL_BATCH", "Batch", VideoMetadata{Title: "Pending", UploadDate: time.Now()}))
+
+	path, err := db.GetFilePath("vid00001")
+	require.NoError(t, err)
+	assert.Empty(t, path, "AddVideo doesn't guess a path")
+
+	r := syntheticRecord(1)
+	require.NoError(t, db.RecordDownload("PL_BATCH", "Batch", r))
+	path, err = db.GetFilePath(r.YoutubeID)
+	require.NoError(t, err)
+	assert.Equal(t, r.FilePath, path)
+
+	var status string
+	require.NoError(t, db.db.QueryRow("SELECT validation_status FROM videos WHERE youtube_id = ?", r.YoutubeID).Scan(&status))
+	assert.Equal(t, "valid", status)
+}
+
+func TestRecordDownloadClearsValidation(t *testing.T) {
+	db := newBatchTestDB(t)
+	r := syntheticRecord(1)
+	require.NoError(t, db.RecordDownload("PL_BATCH", "Batch", r))
+	require.NoError(t, db.SetValidationStatus(r.YoutubeID, StatusCorrupt, "truncated"))
+	_, err := db.db.Exec("UPDATE videos SET last_verified = ? WHERE youtube_id = ?", dbNow(), r.YoutubeID)
+	require.NoError(t, err)
+
+	// Downloading the file again replaces everything known about the old one
+	require.NoError(t, db.RecordDownload("PL_BATCH", "Batch", r))
+	videos, err := db.GetVideosByStatus(StatusValid)
+	require.NoError(t, err)
+	require.Len(t, videos, 1)
+	assert.Empty(t, videos[0].ValidationError)
+	var verified sql.NullTime
+	require.NoError(t, db.db.QueryRow("SELECT last_verified FROM videos WHERE youtube_id = ?", r.YoutubeID).Scan(&verified))
+	assert.False(t, verified.Valid, "The new file is re-hashed by the next deep validation")
+}
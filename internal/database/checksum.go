@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileChecksum returns the hex SHA-256 of a file, streaming it rather than
+// reading it into memory
+func FileChecksum(path string) (string, error) {
+	return fileChecksum(context.Background(), path, nil)
+}
+
+// fileChecksum is FileChecksum with reads paced by limit, which may be nil
+func fileChecksum(ctx context.Context, path string, limit *throttle) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	var r io.Reader = f
+	if limit != nil {
+		r = &throttledReader{ctx: ctx, r: f, limit: limit}
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// throttle paces reads across many files, and the workers reading them, to
+// an average rate, so hashing a whole library doesn't saturate a NAS
+type throttle struct {
+	rate  int64 // Bytes per second
+	start time.Time
+
+	mu   sync.Mutex
+	read int64
+}
+
+// newThrottle returns a throttle for rate bytes per second, or nil for no limit
+func newThrottle(rate int64) *throttle {
+	if rate <= 0 {
+		return nil
+	}
+	return &throttle{rate: rate, start: time.Now()}
+}
+
+// wait records n bytes read and sleeps until the average rate is back
+// under the limit
+func (t *throttle) wait(ctx context.Context, n int) error {
+	t.mu.Lock()
+	t.read += int64(n)
+	due := t.start.Add(time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second)))
+	t.mu.Unlock()
+	delay := time.Until(due)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	limit *throttle
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.limit.wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0644))
+
+	sum, err := FileChecksum(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sum)
+
+	_, err = FileChecksum(path + ".missing")
+	assert.Error(t, err)
+}
+
+func TestValidateFilesWithChecksums(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "checksums.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	path := filepath.Join(dir, "track.mp3")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0644))
+	sum, err := FileChecksum(path)
+	require.NoError(t, err)
+
+	require.NoError(t, db.AddVideo("vid1", "PL_A", "A", VideoMetadata{Title: "track", UploadDate: time.Now()}))
+	require.NoError(t, db.UpdateFileInfo("vid1", path, 5, sum))
+
+	status := func() string {
+		var s string
+		require.NoError(t, db.db.QueryRow("SELECT validation_status FROM videos WHERE youtube_id = 'vid1'").Scan(&s))
+		return s
+	}
+
+	_, err = db.ValidateFilesWithChecksums()
+	require.NoError(t, err)
+	assert.Equal(t, "valid", status())
+
+	// Bit rot keeps the file in place, so only re-hashing notices
+	require.NoError(t, os.WriteFile(path, []byte("jello"), 0644))
+	_, err = db.ValidateFiles()
+	require.NoError(t, err)
+	assert.Equal(t, "valid", status())
+
+	_, err = db.ValidateFilesWithChecksums()
+	require.NoError(t, err)
+	assert.Equal(t, "corrupt", status())
+}
+
+func TestFileChecksumThrottled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	require.NoError(t, os.WriteFile(path, make([]byte, 64<<10), 0644))
+
+	start := time.Now()
+	_, err := fileChecksum(context.Background(), path, newThrottle(256<<10))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "64 KiB at 256 KiB/s takes a quarter second")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fileChecksum(ctx, path, newThrottle(1<<10))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, newThrottle(0))
+}
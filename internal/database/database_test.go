@@ -1,8 +1,12 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,7 +19,7 @@ func TestDatabaseOperations(t *testing.T) {
 	dbPath := "test.db"
 	defer os.Remove(dbPath)
 
-	db, err := NewDatabase(dbPath)
+	db, err := openTestDB(t, dbPath)
 	require.NoError(t, err, "Failed to create database")
 	defer db.Close()
 
@@ -23,9 +27,9 @@ func TestDatabaseOperations(t *testing.T) {
 	tx, err := db.Begin()
 	require.NoError(t, err, "Failed to begin transaction")
 
-	playlistID, err := db.getOrCreatePlaylist(tx, "test_playlist_id", "Test Playlist")
+	playlist, err := getOrCreatePlaylist(tx, "test_playlist_id", "Test Playlist")
 	require.NoError(t, err, "Failed to create playlist")
-	assert.NotZero(t, playlistID, "Playlist ID should not be zero")
+	assert.NotZero(t, playlist.ID, "Playlist ID should not be zero")
 
 	err = tx.Commit()
 	require.NoError(t, err, "Failed to commit transaction")
@@ -41,7 +45,7 @@ func TestDatabaseOperations(t *testing.T) {
 		UploadDate:  time.Now(),
 	}
 
-	err = db.AddVideo("test_video_id", fmt.Sprintf("%d", playlistID), "Test Playlist", metadata)
+	err = db.AddVideo("test_video_id", fmt.Sprintf("%d", playlist.ID), "Test Playlist", metadata)
 	require.NoError(t, err, "Failed to add video")
 
 	// Manually set file_path to make it eligible for validation
@@ -67,3 +71,184 @@ func TestDatabaseOperations(t *testing.T) {
 	_, err = db.ValidateFiles()
 	require.NoError(t, err, "ValidateFiles should not fail")
 }
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "migrate.db")
+
+	db, err := openTestDB(t, dbPath)
+	require.NoError(t, err, "Failed to create database")
+	require.NoError(t, db.Close())
+
+	// Reopening must not re-apply migrations
+	db, err = openTestDB(t, dbPath)
+	require.NoError(t, err, "Failed to reopen database")
+	defer db.Close()
+
+	var version int
+	require.NoError(t, db.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version))
+	assert.Equal(t, migrations[len(migrations)-1].version, version)
+}
+
+func TestPing(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	assert.NoError(t, db.Ping(context.Background()))
+
+	require.NoError(t, db.Close())
+	assert.ErrorContains(t, db.Ping(context.Background()), "unreachable")
+}
+
+func TestAddVideoConcurrently(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "concurrent.db"))
+	require.NoError(t, err, "Failed to create database")
+	defer db.Close()
+
+	const workers, perWorker = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				// Half the workers share a playlist, the rest create their own
+				playlistID := fmt.Sprintf("PL_%d", w%(workers/2))
+				id := fmt.Sprintf("vid%d_%d", w, i)
+				errs <- db.AddVideo(id, playlistID, "Concurrent", VideoMetadata{Title: id, UploadDate: time.Now()})
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	var videos, playlists int
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM videos").Scan(&videos))
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM playlists").Scan(&playlists))
+	assert.Equal(t, workers*perWorker, videos)
+	assert.Equal(t, workers/2, playlists)
+}
+
+func TestAddVideoRollsBackNewPlaylist(t *testing.T) {
+	skipOnPostgres(t, "the test rejects inserts with a SQLite trigger")
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "rollback.db"))
+	require.NoError(t, err, "Failed to create database")
+	defer db.Close()
+
+	// A failed video insert must not leave its new playlist behind
+	_, err = db.db.Exec(`CREATE TRIGGER reject_video BEFORE INSERT ON videos BEGIN SELECT RAISE(ABORT, 'rejected'); END`)
+	require.NoError(t, err)
+	require.Error(t, db.AddVideo("vid1", "PL_NEW", "New", VideoMetadata{Title: "song", UploadDate: time.Now()}))
+
+	var playlists int
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM playlists WHERE youtube_id = 'PL_NEW'").Scan(&playlists))
+	assert.Zero(t, playlists)
+}
+
+// testDriver is the driver the suite runs against; the postgres build tag
+// switches it, see postgres_test.go
+var testDriver = DriverSQLite
+
+// openTestDB opens the test database at path, which with Postgres names a
+// fresh database instead of a file. Opening a path again reopens it.
+var openTestDB = func(t testing.TB, path string) (*Database, error) {
+	return NewDatabase(path)
+}
+
+// skipOnPostgres skips tests of behaviour only SQLite has
+func skipOnPostgres(t testing.TB, why string) {
+	t.Helper()
+	if testDriver == DriverPostgres {
+		t.Skip(why)
+	}
+}
+
+// forgetMigrations makes db look like it predates version: tables and
+// columns added since are dropped and the migrations are applied again on
+// the next open
+func forgetMigrations(t *testing.T, db *Database, version int) {
+	t.Helper()
+	addColumn := regexp.MustCompile(`^ALTER TABLE (\w+) ADD COLUMN (\w+)`)
+	createTable := regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\w+)`)
+	for i := len(migrations) - 1; i >= 0 && migrations[i].version >= version; i-- {
+		for _, stmt := range migrations[i].stmts {
+			if m := addColumn.FindStringSubmatch(stmt); m != nil {
+				_, err := db.db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", m[1], m[2]))
+				require.NoError(t, err)
+			} else if m := createTable.FindStringSubmatch(stmt); m != nil {
+				_, err := db.db.Exec("DROP TABLE " + m[1])
+				require.NoError(t, err)
+			}
+		}
+	}
+	_, err := db.db.Exec("DELETE FROM schema_migrations WHERE version >= ?", version)
+	require.NoError(t, err)
+}
+
+func TestMigrationClearsPlaceholderPaths(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "placeholder.db")
+	db, err := openTestDB(t, dbPath)
+	require.NoError(t, err, "Failed to create database")
+	require.NoError(t, db.AddVideo("vid1", "PL_A", "A", VideoMetadata{Title: "Song", UploadDate: time.Now()}))
+	require.NoError(t, db.AddVideo("vid2", "PL_A", "A", VideoMetadata{Title: "Other", UploadDate: time.Now()}))
+	require.NoError(t, db.UpdateFileInfo("vid1", ".music/Song [vid1].mp3", 0, ""))
+	require.NoError(t, db.UpdateFileInfo("vid2", "/music/A/Other [vid2].mp3", 10, ""))
+
+	// Pretend the database predates the fix
+	forgetMigrations(t, db, 13)
+	require.NoError(t, db.Close())
+
+	db, err = openTestDB(t, dbPath)
+	require.NoError(t, err, "Failed to reopen database")
+	defer db.Close()
+
+	path, err := db.GetFilePath("vid1")
+	require.NoError(t, err)
+	assert.Empty(t, path, "Placeholder path is cleared")
+	path, err = db.GetFilePath("vid2")
+	require.NoError(t, err)
+	assert.Equal(t, "/music/A/Other [vid2].mp3", path)
+}
+
+func TestConcurrentWritesDontLock(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "stress.db"))
+	require.NoError(t, err, "Failed to create database")
+	defer db.Close()
+
+	if testDriver == DriverSQLite {
+		var mode string
+		require.NoError(t, db.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+		assert.Equal(t, "wal", mode)
+	}
+
+	// Each goroutine stands in for a playlist being processed
+	const playlists, perPlaylist = 6, 40
+	var wg sync.WaitGroup
+	errs := make(chan error, playlists*perPlaylist*2)
+	for p := 0; p < playlists; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			playlistID := fmt.Sprintf("PL_%d", p)
+			for i := 0; i < perPlaylist; i++ {
+				id := fmt.Sprintf("vid%d_%d", p, i)
+				errs <- db.AddVideo(id, playlistID, playlistID, VideoMetadata{Title: id, UploadDate: time.Now()})
+				errs <- db.UpdateFileInfo(id, filepath.Join("/music", playlistID, id+".mp3"), 1024, "")
+				if _, err := db.VideoExists(id); err != nil {
+					errs <- err
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	var valid int
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM videos WHERE validation_status = 'valid'").Scan(&valid))
+	assert.Equal(t, playlists*perPlaylist, valid)
+}
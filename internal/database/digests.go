@@ -0,0 +1,27 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LastDigest returns when the last activity digest was emailed; zero if
+// none ever was
+func (d *Database) LastDigest() (time.Time, error) {
+	var sentAt time.Time
+	err := d.db.QueryRow("SELECT sent_at FROM digests ORDER BY sent_at DESC LIMIT 1").Scan(&sentAt)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, fmt.Errorf("failed to get last digest: %w", err)
+	}
+	return sentAt, nil
+}
+
+// RecordDigest records that a digest covering everything up to sentAt was
+// emailed, so the next one starts from there
+func (d *Database) RecordDigest(sentAt time.Time) error {
+	if _, err := d.db.Exec("INSERT INTO digests (sent_at) VALUES (?)", dbTime(sentAt)); err != nil {
+		return fmt.Errorf("failed to record digest: %w", err)
+	}
+	return nil
+}
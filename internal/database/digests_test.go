@@ -0,0 +1,27 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigests(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	last, err := db.LastDigest()
+	require.NoError(t, err)
+	assert.True(t, last.IsZero(), "No digest sent yet")
+
+	sent := time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)
+	require.NoError(t, db.RecordDigest(sent.Add(-24*time.Hour)))
+	require.NoError(t, db.RecordDigest(sent))
+	last, err = db.LastDigest()
+	require.NoError(t, err)
+	assert.True(t, sent.Equal(last), "got %v", last)
+}
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats for ExportVideos
+const (
+	ExportJSON = "json"
+	ExportCSV  = "csv"
+)
+
+// ExportedPlaylist is the playlist holding an exported video's canonical file
+type ExportedPlaylist struct {
+	YoutubeID  string `json:"youtube_id"`
+	Title      string `json:"title"`
+	SourceType string `json:"source_type"`
+}
+
+// ExportedVideo is a video as written by ExportVideos. Optional fields are
+// null when unset, and timestamps are RFC3339 in UTC.
+type ExportedVideo struct {
+	YoutubeID        string           `json:"youtube_id"`
+	Title            string           `json:"title"`
+	Description      *string          `json:"description"`
+	Channel          string           `json:"channel"`
+	ChannelID        *string          `json:"channel_id"`
+	Duration         int              `json:"duration"` // Seconds
+	ViewCount        int64            `json:"view_count"`
+	ThumbnailURL     *string          `json:"thumbnail_url"`
+	UploadDate       *string          `json:"upload_date"`
+	ParsedArtist     *string          `json:"parsed_artist"`
+	ParsedTitle      *string          `json:"parsed_title"`
+	MediaType        *string          `json:"media_type"`
+	Container        *string          `json:"container"`
+	Codec            *string          `json:"codec"`
+	LoudnessLUFS     *float64         `json:"loudness_lufs"`
+	FilePath         *string          `json:"file_path"`
+	FileSize         int64            `json:"file_size"`
+	FileChecksum     *string          `json:"file_checksum"`
+	ValidationStatus *string          `json:"validation_status"`
+	Availability     string           `json:"availability"`
+	LastValidated    *string          `json:"last_validated"`
+	DownloadedAt     *string          `json:"downloaded_at"`
+	CreatedAt        *string          `json:"created_at"`
+	UpdatedAt        *string          `json:"updated_at"`
+	Playlist         ExportedPlaylist `json:"playlist"`
+	Playlists        []string         `json:"playlists"` // YouTube IDs of every playlist the video is in
+}
+
+// exportColumns are the CSV header, in the order csvRecord writes them
+var exportColumns = []string{
+	"youtube_id", "title", "description", "channel", "channel_id", "duration", "view_count",
+	"thumbnail_url", "upload_date", "parsed_artist", "parsed_title", "media_type", "container", "codec",
+	"loudness_lufs", "file_path", "file_size", "file_checksum", "validation_status", "availability",
+	"last_validated", "downloaded_at", "created_at", "updated_at",
+	"playlist_youtube_id", "playlist_title", "playlist_source_type", "playlists",
+}
+
+// csvRecord flattens a video into one CSV row; null fields are empty
+func (v ExportedVideo) csvRecord() []string {
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	loudness := ""
+	if v.LoudnessLUFS != nil {
+		loudness = strconv.FormatFloat(*v.LoudnessLUFS, 'f', -1, 64)
+	}
+	return []string{
+		v.YoutubeID, v.Title, str(v.Description), v.Channel, str(v.ChannelID),
+		strconv.Itoa(v.Duration), strconv.FormatInt(v.ViewCount, 10),
+		str(v.ThumbnailURL), str(v.UploadDate), str(v.ParsedArtist), str(v.ParsedTitle),
+		str(v.MediaType), str(v.Container), str(v.Codec),
+		loudness, str(v.FilePath), strconv.FormatInt(v.FileSize, 10), str(v.FileChecksum),
+		str(v.ValidationStatus), v.Availability,
+		str(v.LastValidated), str(v.DownloadedAt), str(v.CreatedAt), str(v.UpdatedAt),
+		v.Playlist.YoutubeID, v.Playlist.Title, v.Playlist.SourceType, strings.Join(v.Playlists, ";"),
+	}
+}
+
+// ExportVideos writes every video matching opts as a JSON array or as CSV
+// with one row per video. Ordering and paging in opts are ignored; videos
+// are written in the order they were first recorded.
+func (d *Database) ExportVideos(w io.Writer, format string, opts ListOptions) error {
+	if format != ExportJSON && format != ExportCSV {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	videos, err := d.ExportedVideos(opts)
+	if err != nil {
+		return err
+	}
+
+	if format == ExportJSON {
+		if videos == nil {
+			videos = []ExportedVideo{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(videos); err != nil {
+			return fmt.Errorf("failed to write JSON: %w", err)
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportColumns); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	for _, v := range videos {
+		if err := cw.Write(v.csvRecord()); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+// ExportedVideos loads the videos matching opts with their full metadata and
+// memberships
+func (d *Database) ExportedVideos(opts ListOptions) ([]ExportedVideo, error) {
+	where, args := opts.filter()
+	rows, err := d.db.Query(`
+		SELECT v.id, v.youtube_id, v.title, v.description, v.channel, v.channel_id, v.duration,
+			COALESCE(v.view_count, 0), v.thumbnail_url, v.upload_date, v.parsed_artist, v.parsed_title,
+			v.media_type, v.container, v.codec, v.loudness_lufs,
+			v.file_path, COALESCE(v.file_size, 0), v.file_checksum, v.validation_status,
+			COALESCE(v.availability, 'available'),
+			v.last_validated, v.downloaded_at, v.created_at, v.updated_at,
+			p.youtube_id, p.title, COALESCE(p.source_type, 'playlist')
+		FROM videos v
+		JOIN playlists p ON p.id = v.playlist_id`+where+`
+		ORDER BY v.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query videos: %w", err)
+	}
+	defer rows.Close()
+
+	var videos []ExportedVideo
+	var ids []int64
+	for rows.Next() {
+		var v ExportedVideo
+		var id int64
+		var description, channelID, thumbnail, artist, title, mediaType, container, codec sql.NullString
+		var filePath, checksum, status sql.NullString
+		var loudness sql.NullFloat64
+		var uploadDate, lastValidated, downloadedAt, createdAt, updatedAt sql.NullTime
+		if err := rows.Scan(&id, &v.YoutubeID, &v.Title, &description, &v.Channel, &channelID, &v.Duration,
+			&v.ViewCount, &thumbnail, &uploadDate, &artist, &title,
+			&mediaType, &container, &codec, &loudness,
+			&filePath, &v.FileSize, &checksum, &status,
+			&v.Availability,
+			&lastValidated, &downloadedAt, &createdAt, &updatedAt,
+			&v.Playlist.YoutubeID, &v.Playlist.Title, &v.Playlist.SourceType); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		v.Description = nullString(description)
+		v.ChannelID = nullString(channelID)
+		v.ThumbnailURL = nullString(thumbnail)
+		v.ParsedArtist = nullString(artist)
+		v.ParsedTitle = nullString(title)
+		v.MediaType = nullString(mediaType)
+		v.Container = nullString(container)
+		v.Codec = nullString(codec)
+		if filePath.Valid {
+			filePath.String = d.root.resolve(filePath.String)
+		}
+		v.FilePath = nullString(filePath)
+		v.FileChecksum = nullString(checksum)
+		v.ValidationStatus = nullString(status)
+		if loudness.Valid {
+			v.LoudnessLUFS = &loudness.Float64
+		}
+		v.UploadDate = nullTime(uploadDate)
+		v.LastValidated = nullTime(lastValidated)
+		v.DownloadedAt = nullTime(downloadedAt)
+		v.CreatedAt = nullTime(createdAt)
+		v.UpdatedAt = nullTime(updatedAt)
+
+		videos = append(videos, v)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	members, err := d.memberships()
+	if err != nil {
+		return nil, err
+	}
+	for i := range videos {
+		videos[i].Playlists = members[ids[i]]
+		if videos[i].Playlists == nil {
+			videos[i].Playlists = []string{}
+		}
+	}
+	return videos, nil
+}
+
+// memberships maps every video ID to the YouTube IDs of its playlists
+func (d *Database) memberships() (map[int64][]string, error) {
+	rows, err := d.db.Query(`
+		SELECT pv.video_id, p.youtube_id
+		FROM playlist_videos pv
+		JOIN playlists p ON p.id = pv.playlist_id
+		ORDER BY pv.added_at, p.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query playlist memberships: %w", err)
+	}
+	defer rows.Close()
+
+	members := make(map[int64][]string)
+	for rows.Next() {
+		var videoID int64
+		var playlist string
+		if err := rows.Scan(&videoID, &playlist); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		members[videoID] = append(members[videoID], playlist)
+	}
+	return members, rows.Err()
+}
+
+// nullString returns nil for NULL and empty strings
+func nullString(s sql.NullString) *string {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	return &s.String
+}
+
+// nullTime formats a timestamp as RFC3339 in UTC, or nil for NULL
+func nullTime(t sql.NullTime) *string {
+	if !t.Valid || t.Time.IsZero() {
+		return nil
+	}
+	s := t.Time.UTC().Format(time.RFC3339)
+	return &s
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedExport records two downloads in PL_BATCH, one with every optional
+// field set, and a video in PL_OTHER downloaded long ago
+func seedExport(t *testing.T) *Database {
+	t.Helper()
+	db := newBatchTestDB(t)
+
+	full := syntheticRecord(1)
+	full.Metadata.Description = "Line one\nline, \"two\""
+	full.Metadata.ChannelID = "UCsynthetic"
+	full.Checksum = "abc123"
+	full.Loudness = -14.5
+	full.ParsedArtist, full.ParsedTitle = "Artist", "Song"
+	full.Media = MediaInfo{MediaType: "audio", Container: "mp3", Codec: "mp3"}
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", []DownloadRecord{full, syntheticRecord(2)}))
+
+	_, err := db.GetOrCreatePlaylist("PL_OTHER", "Other")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_OTHER", "Other", syntheticRecord(3)))
+	_, err = db.db.Exec("UPDATE videos SET downloaded_at = ? WHERE youtube_id = 'vid00003'", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	return db
+}
+
+func TestExportVideosJSON(t *testing.T) {
+	db := seedExport(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, db.ExportVideos(&buf, ExportJSON, ListOptions{}))
+	assert.NotContains(t, buf.String(), `"Valid"`, "Nullable fields are plain values")
+
+	var videos []ExportedVideo
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &videos))
+	require.Len(t, videos, 3)
+
+	full := videos[0]
+	assert.Equal(t, "vid00001", full.YoutubeID)
+	assert.Equal(t, "Line one\nline, \"two\"", *full.Description)
+	assert.Equal(t, "UCsynthetic", *full.ChannelID)
+	assert.Equal(t, -14.5, *full.LoudnessLUFS)
+	assert.Equal(t, "Artist", *full.ParsedArtist)
+	assert.Equal(t, "abc123", *full.FileChecksum)
+	assert.Equal(t, ExportedPlaylist{YoutubeID: "PL_BATCH", Title: "Batch", SourceType: "playlist"}, full.Playlist)
+	assert.Equal(t, []string{"PL_BATCH"}, full.Playlists)
+	for _, ts := range []*string{full.UploadDate, full.DownloadedAt, full.CreatedAt, full.UpdatedAt} {
+		require.NotNil(t, ts)
+		parsed, err := time.Parse(time.RFC3339, *ts)
+		require.NoError(t, err)
+		assert.Equal(t, time.UTC, parsed.Location())
+	}
+
+	plain := videos[1]
+	assert.Nil(t, plain.Description)
+	assert.Nil(t, plain.LoudnessLUFS)
+	assert.Nil(t, plain.FileChecksum)
+	assert.Contains(t, buf.String(), `"description": null`)
+
+	// Filters
+	buf.Reset()
+	require.NoError(t, db.ExportVideos(&buf, ExportJSON, ListOptions{PlaylistYoutubeID: "PL_OTHER"}))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &videos))
+	require.Len(t, videos, 1)
+	assert.Equal(t, "vid00003", videos[0].YoutubeID)
+	assert.Equal(t, "2020-01-01T00:00:00Z", *videos[0].DownloadedAt)
+
+	buf.Reset()
+	require.NoError(t, db.ExportVideos(&buf, ExportJSON, ListOptions{DownloadedAfter: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &videos))
+	assert.Len(t, videos, 2)
+
+	buf.Reset()
+	require.NoError(t, db.ExportVideos(&buf, ExportJSON, ListOptions{PlaylistYoutubeID: "PL_NONE"}))
+	assert.Equal(t, "[]\n", buf.String())
+
+	assert.Error(t, db.ExportVideos(&buf, "xml", ListOptions{}))
+}
+
+func TestExportVideosCSV(t *testing.T) {
+	db := seedExport(t)
+
+	var jsonBuf, csvBuf bytes.Buffer
+	require.NoError(t, db.ExportVideos(&jsonBuf, ExportJSON, ListOptions{}))
+	require.NoError(t, db.ExportVideos(&csvBuf, ExportCSV, ListOptions{}))
+
+	var videos []ExportedVideo
+	require.NoError(t, json.Unmarshal(jsonBuf.Bytes(), &videos))
+	records, err := csv.NewReader(&csvBuf).ReadAll()
+	require.NoError(t, err)
+
+	require.Len(t, records, len(videos)+1)
+	assert.Equal(t, exportColumns, records[0])
+	for i, v := range videos {
+		assert.Equal(t, v.csvRecord(), records[i+1], "CSV row %d matches the JSON export", i)
+	}
+	assert.Equal(t, "Line one\nline, \"two\"", records[1][2], "Quoted fields survive the round trip")
+	assert.Equal(t, "-14.5", records[1][14])
+	assert.Empty(t, records[2][2], "Null fields are empty")
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Availability of a video on YouTube
+const (
+	AvailabilityAvailable = "available"
+	AvailabilityPrivate   = "private"
+	AvailabilityDeleted   = "deleted"
+	AvailabilityBlocked   = "blocked" // Geo-blocked or taken down for copyright
+)
+
+// DownloadFailure summarizes the failed download attempts for a video
+type DownloadFailure struct {
+	YoutubeID         string    `json:"youtube_id"`
+	PlaylistYoutubeID string    `json:"playlist_youtube_id"`
+	Attempts          int       `json:"attempts"`
+	LastError         string    `json:"last_error"`
+	Permanent         bool      `json:"permanent"`
+	Availability      string    `json:"availability,omitempty"` // Set when the video is unavailable
+	LastAttemptAt     time.Time `json:"last_attempt_at"`
+}
+
+// RecordDownloadFailure increments the failure count for a video and stores
+// the latest error. Permanent failures are never retried.
+func (d *Database) RecordDownloadFailure(youtubeID, playlistYoutubeID, lastError string, permanent bool) error {
+	_, err := d.db.Exec(`
+		INSERT INTO download_failures (youtube_id, playlist_youtube_id, attempts, last_error, permanent, last_attempt_at)
+		VALUES (?, ?, 1, ?, ?, ?)
+		ON CONFLICT(youtube_id) DO UPDATE SET
+			playlist_youtube_id = excluded.playlist_youtube_id,
+			attempts = download_failures.attempts + 1,
+			last_error = excluded.last_error,
+			permanent = excluded.permanent,
+			availability = NULL,
+			last_attempt_at = excluded.last_attempt_at
+	`, youtubeID, playlistYoutubeID, lastError, permanent, dbNow())
+	if err != nil {
+		return fmt.Errorf("failed to record download failure: %w", err)
+	}
+	return nil
+}
+
+// RecordUnavailable records that a video is private, deleted or blocked. It
+// counts as a permanent failure, and a downloaded copy is kept but marked.
+func (d *Database) RecordUnavailable(youtubeID, playlistYoutubeID, availability, lastError string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO download_failures (youtube_id, playlist_youtube_id, attempts, last_error, permanent, availability, last_attempt_at)
+		VALUES (?, ?, 1, ?, TRUE, ?, ?)
+		ON CONFLICT(youtube_id) DO UPDATE SET
+			playlist_youtube_id = excluded.playlist_youtube_id,
+			attempts = download_failures.attempts + 1,
+			last_error = excluded.last_error,
+			permanent = TRUE,
+			availability = excluded.availability,
+			last_attempt_at = excluded.last_attempt_at
+	`, youtubeID, playlistYoutubeID, lastError, availability, dbNow())
+	if err != nil {
+		return fmt.Errorf("failed to record unavailable video: %w", err)
+	}
+
+	if err := setAvailability(tx, youtubeID, availability); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetAvailability updates the availability of a downloaded video
+func (d *Database) SetAvailability(youtubeID, availability string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setAvailability(tx, youtubeID, availability); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setAvailability only writes when the availability changed
+func setAvailability(tx *sql.Tx, youtubeID, availability string) error {
+	_, err := tx.Exec(
+		"UPDATE videos SET availability = ?, updated_at = CURRENT_TIMESTAMP WHERE youtube_id = ? AND availability IS NOT ?",
+		availability, youtubeID, availability,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set availability of %s: %w", youtubeID, err)
+	}
+	return nil
+}
+
+// GetAvailability returns the recorded availability of a downloaded video
+func (d *Database) GetAvailability(youtubeID string) (string, error) {
+	var availability sql.NullString
+	if err := d.db.QueryRow("SELECT availability FROM videos WHERE youtube_id = ?", youtubeID).Scan(&availability); err != nil {
+		return "", fmt.Errorf("failed to get availability of %s: %w", youtubeID, err)
+	}
+	if !availability.Valid {
+		return AvailabilityAvailable, nil
+	}
+	return availability.String, nil
+}
+
+// GetDownloadFailure returns the failure record for a video, or nil if it has never failed
+func (d *Database) GetDownloadFailure(youtubeID string) (*DownloadFailure, error) {
+	var f DownloadFailure
+	var playlistYoutubeID, lastError, availability sql.NullString
+	err := d.db.QueryRow(`
+		SELECT youtube_id, playlist_youtube_id, attempts, last_error, permanent, availability, last_attempt_at
+		FROM download_failures
+		WHERE youtube_id = ?
+	`, youtubeID).Scan(&f.YoutubeID, &playlistYoutubeID, &f.Attempts, &lastError, &f.Permanent, &availability, &f.LastAttemptAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get download failure: %w", err)
+	}
+
+	f.PlaylistYoutubeID = playlistYoutubeID.String
+	f.LastError = lastError.String
+	f.Availability = availability.String
+	return &f, nil
+}
+
+// ClearDownloadFailure forgets past failures once a video downloads
+// successfully. The attempt log is kept.
+func (d *Database) ClearDownloadFailure(youtubeID string) error {
+	if _, err := d.db.Exec("DELETE FROM download_failures WHERE youtube_id = ?", youtubeID); err != nil {
+		return err
+	}
+	_, err := d.db.Exec("UPDATE videos SET retry_count = 0, last_error = NULL WHERE youtube_id = ? AND retry_count > 0", youtubeID)
+	return err
+}
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// HousekeepingOptions selects what Housekeeping cleans up. Every destructive
+// step is off unless set.
+type HousekeepingOptions struct {
+	PurgePlaylists bool          // Delete playlists missing from KeepPlaylists
+	KeepPlaylists  []string      // YouTube IDs of the configured playlists
+	PendingMaxAge  time.Duration // Delete videos still pending without a file after this long; 0 keeps them
+	Vacuum         bool
+	DryRun         bool // Report what would be deleted without changing anything
+}
+
+// HousekeepingReport is what Housekeeping did, or would do in a dry run
+type HousekeepingReport struct {
+	PurgedPlaylists []string // YouTube IDs
+	SharedPlaylists []string // Kept because configured playlists list their videos
+	PurgedVideos    int      // Videos owned by purged playlists
+	PurgedPending   int
+	Optimized       bool
+	Vacuumed        bool
+	FreedBytes      int64 // Space VACUUM gave back to the filesystem
+}
+
+// Housekeeping removes rows nothing refers to any more, then optimizes and
+// optionally vacuums the database. Only rows are deleted; files on disk are
+// left alone. A playlist owning videos that a kept playlist also lists is
+// never purged, since its videos would go with it.
+func (d *Database) Housekeeping(opts HousekeepingOptions) (HousekeepingReport, error) {
+	var report HousekeepingReport
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return report, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if opts.PurgePlaylists {
+		if err := purgePlaylists(tx, opts.KeepPlaylists, &report); err != nil {
+			return report, err
+		}
+	}
+
+	if opts.PendingMaxAge > 0 {
+		n, err := deleteVideos(tx, `
+			SELECT id FROM videos
+			WHERE COALESCE(validation_status, 'pending') = 'pending'
+			  AND COALESCE(file_path, '') = ''
+			  AND created_at < ?`, dbTime(time.Now().Add(-opts.PendingMaxAge)))
+		if err != nil {
+			return report, fmt.Errorf("failed to delete stale pending videos: %w", err)
+		}
+		report.PurgedPending = n
+	}
+
+	if report.PurgedVideos+report.PurgedPending > 0 {
+		if _, err := tx.Exec("UPDATE playlists SET video_count = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = playlists.id)"); err != nil {
+			return report, fmt.Errorf("failed to update video counts: %w", err)
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	optimize := "PRAGMA optimize"
+	if d.dialect.postgres() {
+		optimize = "ANALYZE"
+	}
+	if _, err := d.db.Exec(optimize); err != nil {
+		return report, fmt.Errorf("failed to optimize database: %w", err)
+	}
+	report.Optimized = true
+
+	if opts.Vacuum {
+		before, err := d.size()
+		if err != nil {
+			return report, err
+		}
+		// VACUUM can't run inside a transaction
+		if _, err := d.db.Exec("VACUUM"); err != nil {
+			return report, fmt.Errorf("failed to vacuum database: %w", err)
+		}
+		after, err := d.size()
+		if err != nil {
+			return report, err
+		}
+		report.Vacuumed = true
+		report.FreedBytes = before - after
+	}
+	return report, nil
+}
+
+// purgePlaylists deletes every playlist not in keep, with the videos it owns
+func purgePlaylists(tx *sql.Tx, keep []string, report *HousekeepingReport) error {
+	kept := make(map[string]bool)
+	for _, id := range keep {
+		kept[id] = true
+	}
+
+	rows, err := tx.Query("SELECT id, youtube_id FROM playlists ORDER BY youtube_id")
+	if err != nil {
+		return fmt.Errorf("failed to query playlists: %w", err)
+	}
+	type playlist struct {
+		id        int64
+		youtubeID string
+	}
+	var orphans []playlist
+	orphanIDs := make(map[int64]bool)
+	for rows.Next() {
+		var p playlist
+		if err := rows.Scan(&p.id, &p.youtubeID); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		if !kept[p.youtubeID] {
+			orphans = append(orphans, p)
+			orphanIDs[p.id] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	for _, p := range orphans {
+		// Playlists whose videos are listed elsewhere
+		rows, err := tx.Query(`
+			SELECT DISTINCT pv.playlist_id
+			FROM playlist_videos pv
+			JOIN videos v ON v.id = pv.video_id
+			WHERE v.playlist_id = ? AND pv.playlist_id != ?`, p.id, p.id)
+		if err != nil {
+			return fmt.Errorf("failed to check playlist %s: %w", p.youtubeID, err)
+		}
+		shared := false
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning row: %w", err)
+			}
+			if !orphanIDs[id] {
+				shared = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating rows: %w", err)
+		}
+		if shared {
+			report.SharedPlaylists = append(report.SharedPlaylists, p.youtubeID)
+			continue
+		}
+
+		n, err := deleteVideos(tx, "SELECT id FROM videos WHERE playlist_id = ?", p.id)
+		if err != nil {
+			return fmt.Errorf("failed to delete videos of playlist %s: %w", p.youtubeID, err)
+		}
+		for _, stmt := range []string{
+			"DELETE FROM video_links WHERE playlist_id = ?",
+			"DELETE FROM playlist_videos WHERE playlist_id = ?",
+			"DELETE FROM playlists WHERE id = ?",
+		} {
+			if _, err := tx.Exec(stmt, p.id); err != nil {
+				return fmt.Errorf("failed to delete playlist %s: %w", p.youtubeID, err)
+			}
+		}
+		report.PurgedPlaylists = append(report.PurgedPlaylists, p.youtubeID)
+		report.PurgedVideos += n
+	}
+	return nil
+}
+
+// deleteVideos deletes the videos whose IDs query selects, along with their
+// tracks, links and memberships, and returns how many there were
+func deleteVideos(tx *sql.Tx, query string, args ...interface{}) (int, error) {
+	for _, stmt := range []string{
+		"DELETE FROM video_tracks WHERE video_id IN (" + query + ")",
+		"DELETE FROM video_links WHERE video_id IN (" + query + ")",
+		"DELETE FROM playlist_videos WHERE video_id IN (" + query + ")",
+	} {
+		if _, err := tx.Exec(stmt, args...); err != nil {
+			return 0, err
+		}
+	}
+	result, err := tx.Exec("DELETE FROM videos WHERE id IN ("+query+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// size is the space the database takes up, excluding the WAL
+func (d *Database) size() (int64, error) {
+	if d.dialect.postgres() {
+		var size int64
+		if err := d.db.QueryRow("SELECT pg_database_size(current_database())").Scan(&size); err != nil {
+			return 0, fmt.Errorf("failed to read database size: %w", err)
+		}
+		return size, nil
+	}
+	var pages, pageSize int64
+	if err := d.db.QueryRow("PRAGMA page_count").Scan(&pages); err != nil {
+		return 0, fmt.Errorf("failed to read page count: %w", err)
+	}
+	if err := d.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to read page size: %w", err)
+	}
+	return pages * pageSize, nil
+}
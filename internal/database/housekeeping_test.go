@@ -0,0 +1,76 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHousekeeping(t *testing.T) {
+	db := newBatchTestDB(t)
+
+	// PL_BATCH is configured; PL_GONE isn't and PL_SHARED isn't but owns a
+	// video PL_BATCH also lists
+	require.NoError(t, db.RecordDownload("PL_BATCH", "Batch", syntheticRecord(1)))
+	require.NoError(t, db.AddVideo("stale", "PL_BATCH", "Batch", VideoMetadata{Title: "stale"}))
+	require.NoError(t, db.AddVideo("fresh", "PL_BATCH", "Batch", VideoMetadata{Title: "fresh"}))
+	_, err := db.db.Exec("UPDATE videos SET created_at = ? WHERE youtube_id = 'stale'", dbTime(time.Now().AddDate(0, 0, -40)))
+	require.NoError(t, err)
+	for _, id := range []string{"PL_GONE", "PL_SHARED"} {
+		_, err := db.GetOrCreatePlaylist(id, id)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.RecordDownload("PL_GONE", "Gone", syntheticRecord(2)))
+	require.NoError(t, db.RecordDownload("PL_SHARED", "Shared", syntheticRecord(3)))
+	require.NoError(t, db.AddVideo("vid00003", "PL_BATCH", "Batch", VideoMetadata{Title: "Track 3"}))
+
+	opts := HousekeepingOptions{
+		PurgePlaylists: true,
+		KeepPlaylists:  []string{"PL_BATCH"},
+		PendingMaxAge:  30 * 24 * time.Hour,
+		Vacuum:         true,
+		DryRun:         true,
+	}
+	want := HousekeepingReport{
+		PurgedPlaylists: []string{"PL_GONE"},
+		SharedPlaylists: []string{"PL_SHARED"},
+		PurgedVideos:    1,
+		PurgedPending:   1,
+	}
+
+	report, err := db.Housekeeping(opts)
+	require.NoError(t, err)
+	assert.Equal(t, want, report)
+	exists, err := db.VideoExists("vid00002")
+	require.NoError(t, err)
+	assert.True(t, exists, "Dry run deletes nothing")
+
+	opts.DryRun = false
+	report, err = db.Housekeeping(opts)
+	require.NoError(t, err)
+	assert.True(t, report.Optimized)
+	assert.True(t, report.Vacuumed)
+	report.Optimized, report.Vacuumed, report.FreedBytes = false, false, 0
+	assert.Equal(t, want, report)
+
+	for id, kept := range map[string]bool{"vid00001": true, "fresh": true, "vid00003": true, "stale": false, "vid00002": false} {
+		exists, err := db.VideoExists(id)
+		require.NoError(t, err)
+		assert.Equal(t, kept, exists, id)
+	}
+	var playlists, members int
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM playlists WHERE youtube_id = 'PL_GONE'").Scan(&playlists))
+	assert.Zero(t, playlists)
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM playlist_videos pv JOIN videos v ON v.id = pv.video_id WHERE v.youtube_id IN ('stale', 'vid00002')").Scan(&members))
+	assert.Zero(t, members)
+	batch, err := db.GetOrCreatePlaylist("PL_BATCH", "Batch")
+	require.NoError(t, err)
+	assert.Equal(t, 3, batch.VideoCount)
+
+	// Nothing selected: only the optimize runs
+	report, err = db.Housekeeping(HousekeepingOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, HousekeepingReport{Optimized: true}, report)
+}
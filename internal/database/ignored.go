@@ -0,0 +1,53 @@
+package database
+
+import (
+	"fmt"
+)
+
+// IgnoreBlocked is the reason recorded for videos blocked with the block
+// command, which are reported as blocked rather than ignored
+const IgnoreBlocked = "blocked"
+
+// IgnoreVideo marks a video so no playlist downloads it again
+func (d *Database) IgnoreVideo(youtubeID, reason string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO ignored_videos (youtube_id, reason, ignored_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(youtube_id) DO UPDATE SET
+			reason = excluded.reason,
+			ignored_at = excluded.ignored_at
+	`, youtubeID, reason, dbNow())
+	if err != nil {
+		return fmt.Errorf("failed to ignore video: %w", err)
+	}
+	return nil
+}
+
+// IsIgnored reports whether a video must not be downloaded
+func (d *Database) IsIgnored(youtubeID string) (bool, error) {
+	var ignored bool
+	err := d.db.QueryRow("SELECT EXISTS(SELECT 1 FROM ignored_videos WHERE youtube_id = ?)", youtubeID).Scan(&ignored)
+	if err != nil {
+		return false, fmt.Errorf("failed to check ignored video: %w", err)
+	}
+	return ignored, nil
+}
+
+// BlockedVideoIDs returns the videos blocked with the block command
+func (d *Database) BlockedVideoIDs() (map[string]bool, error) {
+	rows, err := d.db.Query("SELECT youtube_id FROM ignored_videos WHERE reason = ?", IgnoreBlocked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocked videos: %w", err)
+	}
+	defer rows.Close()
+
+	blocked := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to list blocked videos: %w", err)
+		}
+		blocked[id] = true
+	}
+	return blocked, rows.Err()
+}
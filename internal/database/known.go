@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// KnownVideo is a video an import listed in a playlist, such as one from a
+// Google Takeout export, which may not be downloaded yet
+type KnownVideo struct {
+	YoutubeID  string
+	AddedAt    time.Time // When it was added to the playlist; zero if unknown
+	Downloaded bool      // Recorded in videos
+}
+
+// KnownImportStats summarizes an ImportKnownVideos run
+type KnownImportStats struct {
+	Imported   int // Newly known in the playlist
+	Existing   int // Known from an earlier import
+	Downloaded int // Of either, those already recorded
+}
+
+// ImportKnownVideos records the videos listed in a playlist, in order,
+// without downloading them; when the playlist is watched they download as
+// usual. Importing the same videos again changes nothing.
+func (d *Database) ImportKnownVideos(playlistYoutubeID, title string, videos []KnownVideo) (KnownImportStats, error) {
+	var stats KnownImportStats
+	playlist, err := d.GetOrCreatePlaylist(playlistYoutubeID, title)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get or create playlist: %w", err)
+	}
+
+	ids := make([]string, len(videos))
+	for i, v := range videos {
+		ids[i] = v.YoutubeID
+	}
+	downloaded, err := d.GetExistingVideoIDs(ids)
+	if err != nil {
+		return stats, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return stats, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO known_videos (playlist_id, youtube_id, position, added_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`)
+	if err != nil {
+		return stats, fmt.Errorf("failed to prepare known video insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, v := range videos {
+		result, err := stmt.Exec(playlist.ID, v.YoutubeID, i+1, dbTime(v.AddedAt))
+		if err != nil {
+			return stats, fmt.Errorf("failed to import video %s: %w", v.YoutubeID, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			stats.Existing++
+		} else {
+			stats.Imported++
+		}
+		if downloaded[v.YoutubeID] {
+			stats.Downloaded++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stats, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return stats, nil
+}
+
+// GetKnownVideos returns the videos imports listed in a playlist, in the
+// order they were listed
+func (d *Database) GetKnownVideos(playlistYoutubeID string) ([]KnownVideo, error) {
+	rows, err := d.db.Query(`
+		SELECT k.youtube_id, k.added_at, EXISTS (SELECT 1 FROM videos v WHERE v.youtube_id = k.youtube_id)
+		FROM known_videos k
+		JOIN playlists p ON p.id = k.playlist_id
+		WHERE p.youtube_id = ?
+		ORDER BY k.position, k.youtube_id
+	`, playlistYoutubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query known videos: %w", err)
+	}
+	defer rows.Close()
+
+	var videos []KnownVideo
+	for rows.Next() {
+		var v KnownVideo
+		var addedAt sql.NullTime
+		if err := rows.Scan(&v.YoutubeID, &addedAt, &v.Downloaded); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		v.AddedAt = addedAt.Time
+		videos = append(videos, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return videos, nil
+}
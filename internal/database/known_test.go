@@ -0,0 +1,51 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportKnownVideos(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.GetOrCreatePlaylist("PL_OTHER", "Other")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_OTHER", "Other", DownloadRecord{
+		YoutubeID: "bbbbbbbbbbb",
+		Metadata:  VideoMetadata{Title: "Already here"},
+		FilePath:  "/music/bbbbbbbbbbb.m4a",
+	}))
+
+	added := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	videos := []KnownVideo{{YoutubeID: "aaaaaaaaaaa", AddedAt: added}, {YoutubeID: "bbbbbbbbbbb"}}
+	stats, err := db.ImportKnownVideos("PL_JAZZ", "Late Jazz", videos)
+	require.NoError(t, err)
+	assert.Equal(t, KnownImportStats{Imported: 2, Downloaded: 1}, stats)
+
+	stats, err = db.ImportKnownVideos("PL_JAZZ", "Late Jazz", append(videos, KnownVideo{YoutubeID: "ccccccccccc"}))
+	require.NoError(t, err)
+	assert.Equal(t, KnownImportStats{Imported: 1, Existing: 2, Downloaded: 1}, stats, "Importing again only adds what's new")
+
+	known, err := db.GetKnownVideos("PL_JAZZ")
+	require.NoError(t, err)
+	require.Len(t, known, 3)
+	assert.Equal(t, "aaaaaaaaaaa", known[0].YoutubeID)
+	assert.True(t, added.Equal(known[0].AddedAt))
+	assert.False(t, known[0].Downloaded)
+	assert.True(t, known[1].Downloaded)
+	assert.True(t, known[2].AddedAt.IsZero())
+
+	// Known videos aren't recorded, so watching the playlist downloads them
+	existing, err := db.GetExistingVideoIDs([]string{"aaaaaaaaaaa", "ccccccccccc"})
+	require.NoError(t, err)
+	assert.Empty(t, existing)
+	pl, err := db.GetOrCreatePlaylist("PL_JAZZ", "ignored")
+	require.NoError(t, err)
+	assert.Equal(t, "Late Jazz", pl.Title)
+}
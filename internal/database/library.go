@@ -0,0 +1,205 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultLibraryIDPattern finds the video ID in yt-dlp's default
+// "Title [id].ext" filenames
+const DefaultLibraryIDPattern = `\[([A-Za-z0-9_-]{11})\]`
+
+// libraryExtensions are the media files ScanLibrary considers; covers,
+// playlists and other sidecar files are ignored
+var libraryExtensions = map[string]string{
+	".mp3": "audio", ".m4a": "audio", ".opus": "audio", ".ogg": "audio", ".flac": "audio",
+	".wav": "audio", ".aac": "audio", ".webm": "audio",
+	".mp4": "video", ".mkv": "video",
+}
+
+// LibraryFile is a media file whose name contains a video ID
+type LibraryFile struct {
+	YoutubeID string
+	Title     string // Filename without the ID and extension
+	Path      string
+	Size      int64
+	MediaType string // "audio" or "video"
+	Container string // File extension, e.g. mp3
+}
+
+// LibraryScan is what ScanLibrary found in a directory
+type LibraryScan struct {
+	Files        []LibraryFile
+	Unrecognized []string // Media files without a video ID in their name
+	Duplicates   []string // Further files with an ID already seen
+}
+
+// ScanLibrary walks dir for media files and extracts each one's video ID
+// with idPattern, using its first group if it has one
+func ScanLibrary(dir, idPattern string) (LibraryScan, error) {
+	var scan LibraryScan
+
+	re, err := regexp.Compile(idPattern)
+	if err != nil {
+		return scan, fmt.Errorf("invalid ID pattern: %w", err)
+	}
+	if re.NumSubexp() > 1 {
+		return scan, fmt.Errorf("ID pattern %q must have at most one group", idPattern)
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return scan, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		f, ok := ParseLibraryFile(path, info.Size(), re)
+		switch {
+		case !ok:
+			return nil
+		case f.YoutubeID == "":
+			scan.Unrecognized = append(scan.Unrecognized, path)
+		case seen[f.YoutubeID]:
+			scan.Duplicates = append(scan.Duplicates, path)
+		default:
+			seen[f.YoutubeID] = true
+			scan.Files = append(scan.Files, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return scan, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+
+	sort.Strings(scan.Unrecognized)
+	return scan, nil
+}
+
+// ParseLibraryFile describes the media file at path, taking its video ID
+// from the first group of idRe, or the whole match if it has none. ok is
+// false for files that aren't media; names without an ID leave YoutubeID empty.
+func ParseLibraryFile(path string, size int64, idRe *regexp.Regexp) (f LibraryFile, ok bool) {
+	name := filepath.Base(path)
+	ext := strings.ToLower(filepath.Ext(name))
+	mediaType, ok := libraryExtensions[ext]
+	if !ok {
+		return f, false
+	}
+	f = LibraryFile{Path: path, Size: size, MediaType: mediaType, Container: strings.TrimPrefix(ext, ".")}
+
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	match := idRe.FindStringSubmatchIndex(base)
+	if match == nil {
+		f.Title = base
+		return f, true
+	}
+	start, end := match[0], match[1]
+	if len(match) > 2 {
+		start, end = match[2], match[3]
+	}
+	f.YoutubeID = base[start:end]
+	f.Title = strings.TrimSpace(base[:match[0]] + base[match[1]:])
+	if f.Title == "" {
+		f.Title = f.YoutubeID
+	}
+	return f, true
+}
+
+// LibraryImportStats summarizes an ImportLibrary run
+type LibraryImportStats struct {
+	Imported int // New videos recorded with their file
+	Updated  int // Known videos that had no file yet, e.g. from an archive import
+	Existing int // Already recorded with a file
+}
+
+// ImportLibrary records files found by ScanLibrary as valid downloads in a
+// playlist, so ProcessPlaylist doesn't download them again. Videos already
+// recorded with a file keep it; ones known without a file, e.g. from an
+// archive import, or whose file is gone take the imported file and playlist.
+func (d *Database) ImportLibrary(playlistYoutubeID string, files []LibraryFile) (LibraryImportStats, error) {
+	var stats LibraryImportStats
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return stats, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	playlist, err := getOrCreatePlaylist(tx, playlistYoutubeID, playlistYoutubeID)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get or create playlist: %w", err)
+	}
+
+	now := dbNow()
+	for _, f := range files {
+		var recorded string
+		err := tx.QueryRow("SELECT COALESCE(file_path, '') FROM videos WHERE youtube_id = ?", f.YoutubeID).Scan(&recorded)
+		if err != nil && err != sql.ErrNoRows {
+			return stats, fmt.Errorf("failed to check video %s: %w", f.YoutubeID, err)
+		}
+		// A recorded file that's gone is replaced by the imported one
+		hasFile := recorded != ""
+		if hasFile {
+			if _, statErr := os.Stat(d.root.resolve(recorded)); os.IsNotExist(statErr) {
+				hasFile = false
+			}
+		}
+		switch {
+		case err == nil && hasFile:
+			stats.Existing++
+			continue
+		case err == nil:
+			_, err = tx.Exec(`
+				UPDATE videos
+				SET playlist_id = ?, playlist_title = ?,
+				    file_path = ?, file_size = ?, validation_status = 'valid', last_validated = ?,
+				    media_type = ?, container = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE youtube_id = ?`,
+				playlist.ID, playlist.Title,
+				d.root.store(f.Path), f.Size, now, f.MediaType, f.Container, f.YoutubeID,
+			)
+			stats.Updated++
+		default:
+			_, err = tx.Exec(`
+				INSERT INTO videos (
+					youtube_id, playlist_id, playlist_title, title, channel,
+					file_path, file_size, validation_status, last_validated, media_type, container, downloaded_at
+				) VALUES (?, ?, ?, ?, '', ?, ?, 'valid', ?, ?, ?, NULL)`,
+				f.YoutubeID, playlist.ID, playlist.Title, f.Title,
+				d.root.store(f.Path), f.Size, now, f.MediaType, f.Container,
+			)
+			stats.Imported++
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to import %s: %w", f.Path, err)
+		}
+		if err := addMembership(tx, playlist.ID, f.YoutubeID, 0); err != nil {
+			return stats, err
+		}
+	}
+
+	if err := updateVideoCount(tx, playlist.ID); err != nil {
+		return stats, err
+	}
+	if err := tx.Commit(); err != nil {
+		return stats, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return stats, nil
+}
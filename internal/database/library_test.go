@@ -0,0 +1,97 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeLibrary creates files under dir, keyed by relative path
+func writeLibrary(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestScanLibrary(t *testing.T) {
+	dir := t.TempDir()
+	writeLibrary(t, dir, map[string]string{
+		"Song One [aaaaaaaaaaa].mp3":      "audio",
+		"sub/Song Two [bbbbbbbbbbb].m4a":  "audio!",
+		"sub/Song Two [bbbbbbbbbbb].opus": "again",
+		"Lecture [ccccccccccc].mkv":       "video",
+		"No ID here.mp3":                  "audio",
+		"cover.jpg":                       "image",
+	})
+
+	scan, err := ScanLibrary(dir, DefaultLibraryIDPattern)
+	require.NoError(t, err)
+	require.Len(t, scan.Files, 3)
+	byID := map[string]LibraryFile{}
+	for _, f := range scan.Files {
+		byID[f.YoutubeID] = f
+	}
+	assert.Equal(t, "Song One", byID["aaaaaaaaaaa"].Title)
+	assert.Equal(t, int64(6), byID["bbbbbbbbbbb"].Size)
+	assert.Equal(t, "video", byID["ccccccccccc"].MediaType)
+	assert.Equal(t, "mkv", byID["ccccccccccc"].Container)
+	assert.True(t, filepath.IsAbs(byID["aaaaaaaaaaa"].Path))
+	assert.Equal(t, []string{filepath.Join(dir, "No ID here.mp3")}, scan.Unrecognized, "Sidecar files aren't reported")
+	assert.Len(t, scan.Duplicates, 1)
+
+	// A custom pattern, e.g. for "id - Title" names
+	writeLibrary(t, dir, map[string]string{"ddddddddddd - Other.mp3": "audio"})
+	scan, err = ScanLibrary(dir, `^([A-Za-z0-9_-]{11}) - `)
+	require.NoError(t, err)
+	require.Len(t, scan.Files, 1)
+	assert.Equal(t, "ddddddddddd", scan.Files[0].YoutubeID)
+	assert.Equal(t, "Other", scan.Files[0].Title)
+
+	_, err = ScanLibrary(dir, `(a)(b)`)
+	assert.Error(t, err)
+	_, err = ScanLibrary(dir, `[`)
+	assert.Error(t, err)
+}
+
+func TestImportLibrary(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "library.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	writeLibrary(t, dir, map[string]string{
+		"music/Song One [aaaaaaaaaaa].mp3": "audio",
+		"music/Song Two [bbbbbbbbbbb].mp3": "audio",
+	})
+	_, err = db.ImportArchive(strings.NewReader("youtube bbbbbbbbbbb\n"), "PL_OLD")
+	require.NoError(t, err)
+
+	scan, err := ScanLibrary(filepath.Join(dir, "music"), DefaultLibraryIDPattern)
+	require.NoError(t, err)
+	stats, err := db.ImportLibrary("PL_LIB", scan.Files)
+	require.NoError(t, err)
+	assert.Equal(t, LibraryImportStats{Imported: 1, Updated: 1}, stats)
+
+	path, err := db.GetFilePath("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "music", "Song One [aaaaaaaaaaa].mp3"), path)
+	path, err = db.GetFilePath("bbbbbbbbbbb")
+	require.NoError(t, err)
+	assert.NotEmpty(t, path, "Archive-imported videos get their file")
+
+	videos, err := db.ListVideos(ListOptions{PlaylistYoutubeID: "PL_LIB", ValidationStatus: "valid"})
+	require.NoError(t, err)
+	assert.Len(t, videos, 2)
+
+	// Importing again changes nothing
+	stats, err = db.ImportLibrary("PL_LIB", scan.Files)
+	require.NoError(t, err)
+	assert.Equal(t, LibraryImportStats{Existing: 2}, stats)
+}
@@ -0,0 +1,324 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sampiiiii/pp-downloader/internal/sidecar"
+)
+
+// VideoLink is an extra location of a downloaded file in another playlist's folder
+type VideoLink struct {
+	PlaylistYoutubeID string `json:"playlist_youtube_id"`
+	Path              string `json:"path"`
+	Type              string `json:"type"`
+}
+
+// GetFilePath returns the canonical file path of a downloaded video, or an
+// empty string if the video has no file yet
+func (d *Database) GetFilePath(youtubeID string) (string, error) {
+	var filePath sql.NullString
+	err := d.db.QueryRow("SELECT file_path FROM videos WHERE youtube_id = ?", youtubeID).Scan(&filePath)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get file path: %w", err)
+	}
+	return d.root.resolve(filePath.String), nil
+}
+
+// FileOwner returns the YouTube ID of the video whose file, playlist link or
+// chapter track is at path, or an empty string if none is recorded there
+func (d *Database) FileOwner(path string) (string, error) {
+	stored := d.root.store(path)
+	var youtubeID string
+	err := d.db.QueryRow(`
+		SELECT youtube_id FROM videos WHERE file_path = ?
+		UNION SELECT v.youtube_id FROM video_links l JOIN videos v ON v.id = l.video_id WHERE l.link_path = ?
+		UNION SELECT v.youtube_id FROM video_tracks t JOIN videos v ON v.id = t.video_id WHERE t.file_path = ?
+		LIMIT 1`,
+		stored, stored, stored,
+	).Scan(&youtubeID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to find owner of %s: %w", path, err)
+	}
+	return youtubeID, nil
+}
+
+// HasPlaylistCopy reports whether a video already has a file in the given
+// playlist's folder, either as its canonical file or as a link
+func (d *Database) HasPlaylistCopy(youtubeID, playlistYoutubeID string) (bool, error) {
+	var exists bool
+	err := d.db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM videos v
+			JOIN playlists p ON p.id = v.playlist_id
+			WHERE v.youtube_id = ? AND p.youtube_id = ?
+		) OR EXISTS(
+			SELECT 1 FROM video_links l
+			JOIN videos v ON v.id = l.video_id
+			JOIN playlists p ON p.id = l.playlist_id
+			WHERE v.youtube_id = ? AND p.youtube_id = ?
+		)`,
+		youtubeID, playlistYoutubeID, youtubeID, playlistYoutubeID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check playlist copy: %w", err)
+	}
+	return exists, nil
+}
+
+// AddVideoLink records that a video's file was linked into another playlist's
+// folder, making the video a member of that playlist
+func (d *Database) AddVideoLink(youtubeID, playlistYoutubeID, linkPath, linkType string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var playlistID int64
+	if err := tx.QueryRow("SELECT id FROM playlists WHERE youtube_id = ?", playlistYoutubeID).Scan(&playlistID); err != nil {
+		return fmt.Errorf("failed to find playlist %s: %w", playlistYoutubeID, err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO video_links (video_id, playlist_id, link_path, link_type, last_validated)
+		SELECT id, ?, ?, ?, CURRENT_TIMESTAMP
+		FROM videos WHERE youtube_id = ?
+	`, playlistID, d.root.store(linkPath), linkType, youtubeID)
+	if err != nil {
+		return fmt.Errorf("failed to add video link: %w", err)
+	}
+	if err := addMembership(tx, playlistID, youtubeID, 0); err != nil {
+		return err
+	}
+	if err := updateVideoCount(tx, playlistID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetVideoLinks returns every extra location of a video's file
+func (d *Database) GetVideoLinks(youtubeID string) ([]VideoLink, error) {
+	rows, err := d.db.Query(`
+		SELECT p.youtube_id, l.link_path, l.link_type
+		FROM video_links l
+		JOIN videos v ON v.id = l.video_id
+		JOIN playlists p ON p.id = l.playlist_id
+		WHERE v.youtube_id = ?
+		ORDER BY l.id
+	`, youtubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query video links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []VideoLink
+	for rows.Next() {
+		var link VideoLink
+		if err := rows.Scan(&link.PlaylistYoutubeID, &link.Path, &link.Type); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		link.Path = d.root.resolve(link.Path)
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return links, nil
+}
+
+// RemovePlaylistMembership removes a video from one playlist. Only that
+// playlist's copy of the file is deleted; the video row and its file are
+// removed once no playlist references them any more. Files are only touched
+// once the rows are committed, so a failed commit never leaves a row
+// pointing at a deleted file; a file that then can't be removed is logged.
+func (d *Database) RemovePlaylistMembership(youtubeID, playlistYoutubeID string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var videoID, canonicalPlaylistID, playlistID int64
+	var filePath sql.NullString
+	err = tx.QueryRow("SELECT id, playlist_id, file_path FROM videos WHERE youtube_id = ?", youtubeID).Scan(&videoID, &canonicalPlaylistID, &filePath)
+	if err != nil {
+		return fmt.Errorf("failed to find video %s: %w", youtubeID, err)
+	}
+	err = tx.QueryRow("SELECT id FROM playlists WHERE youtube_id = ?", playlistYoutubeID).Scan(&playlistID)
+	if err != nil {
+		return fmt.Errorf("failed to find playlist %s: %w", playlistYoutubeID, err)
+	}
+
+	result, err := tx.Exec("DELETE FROM playlist_videos WHERE playlist_id = ? AND video_id = ?", playlistID, videoID)
+	if err != nil {
+		return fmt.Errorf("failed to delete playlist membership: %w", err)
+	}
+	member, _ := result.RowsAffected()
+	if err := updateVideoCount(tx, playlistID); err != nil {
+		return err
+	}
+
+	// The playlist holds a link: drop just that location
+	var linkID int64
+	var linkPath string
+	err = tx.QueryRow("SELECT id, link_path FROM video_links WHERE video_id = ? AND playlist_id = ?", videoID, playlistID).Scan(&linkID, &linkPath)
+	if err == nil {
+		if _, err := tx.Exec("DELETE FROM video_links WHERE id = ?", linkID); err != nil {
+			return fmt.Errorf("failed to delete video link: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		d.removeUnreferenced(d.root.resolve(linkPath))
+		return nil
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query video link: %w", err)
+	}
+
+	if canonicalPlaylistID != playlistID {
+		if member == 0 {
+			return fmt.Errorf("video %s is not in playlist %s", youtubeID, playlistYoutubeID)
+		}
+		// A member without a copy in this playlist's folder has no file to delete
+		return tx.Commit()
+	}
+
+	links, err := loadLinks(tx, videoID)
+	if err != nil {
+		return err
+	}
+
+	// Last reference: the canonical file and row go too
+	if len(links) == 0 {
+		if _, err := tx.Exec("DELETE FROM playlist_videos WHERE video_id = ?", videoID); err != nil {
+			return fmt.Errorf("failed to delete playlist memberships: %w", err)
+		}
+		if _, err := tx.Exec("UPDATE playlists SET video_count = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = playlists.id)"); err != nil {
+			return fmt.Errorf("failed to update video counts: %w", err)
+		}
+		if _, err := tx.Exec("DELETE FROM videos WHERE id = ?", videoID); err != nil {
+			return fmt.Errorf("failed to delete video: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		if filePath.String != "" {
+			d.removeUnreferenced(d.root.resolve(filePath.String))
+		}
+		return nil
+	}
+
+	// Otherwise promote the oldest link to be the canonical file
+	promoted := links[0]
+	if _, err := tx.Exec(`
+		UPDATE videos
+		SET file_path = ?,
+		    playlist_id = ?,
+		    playlist_title = (SELECT title FROM playlists WHERE id = ?),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		promoted.path, promoted.playlistID, promoted.playlistID, videoID,
+	); err != nil {
+		return fmt.Errorf("failed to promote video link: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM video_links WHERE id = ?", promoted.id); err != nil {
+		return fmt.Errorf("failed to delete promoted link: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	canonical, promotedPath := d.root.resolve(filePath.String), d.root.resolve(promoted.path)
+	if promoted.linkType != "symlink" {
+		d.removeUnreferenced(canonical)
+		return nil
+	}
+
+	// A symlink would dangle once the canonical file is gone, so move the
+	// data into its place. Until that works every symlink still reaches the
+	// old file, so there's nothing to repoint.
+	if err := os.Rename(canonical, promotedPath); err != nil {
+		d.logger.Warn("Failed to move file to its new canonical location", "from", canonical, "to", promotedPath, "error", err)
+		return nil
+	}
+	if err := sidecar.Remove(canonical); err != nil {
+		d.logger.Warn("Failed to remove sidecars", "path", canonical, "error", err)
+	}
+
+	// Remaining symlinks must follow the new canonical location
+	target, err := filepath.Abs(promotedPath)
+	if err != nil {
+		d.logger.Warn("Failed to resolve new canonical location", "path", promotedPath, "error", err)
+		return nil
+	}
+	for _, link := range links[1:] {
+		if link.linkType != "symlink" {
+			continue
+		}
+		linkPath := d.root.resolve(link.path)
+		if err := removeFile(linkPath); err == nil {
+			err = os.Symlink(target, linkPath)
+		}
+		if err != nil {
+			d.logger.Warn("Failed to repoint symlink", "path", linkPath, "error", err)
+		}
+	}
+	return nil
+}
+
+// removeUnreferenced deletes a file and its sidecars once no row refers to
+// them. The database is already consistent, so a failure is only logged.
+func (d *Database) removeUnreferenced(path string) {
+	if err := removeFile(path); err != nil {
+		d.logger.Warn("Failed to remove file", "path", path, "error", err)
+	}
+}
+
+// linkRow is a video_links row as needed by RemovePlaylistMembership
+type linkRow struct {
+	id         int64
+	playlistID int64
+	path       string
+	linkType   string
+}
+
+// loadLinks returns a video's links, oldest first
+func loadLinks(tx *sql.Tx, videoID int64) ([]linkRow, error) {
+	rows, err := tx.Query("SELECT id, playlist_id, link_path, link_type FROM video_links WHERE video_id = ? ORDER BY id", videoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query video links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []linkRow
+	for rows.Next() {
+		var link linkRow
+		if err := rows.Scan(&link.id, &link.playlistID, &link.path, &link.linkType); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// removeFile deletes path and any metadata sidecars beside it, treating an
+// already-missing file as success
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	if err := sidecar.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove sidecars of %s: %w", path, err)
+	}
+	return nil
+}
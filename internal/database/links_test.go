@@ -0,0 +1,138 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedLinkedVideo creates a video downloaded for playlist A and hardlinked into playlist B
+func seedLinkedVideo(t *testing.T, db *Database, dir string) (canonical, linked string) {
+	t.Helper()
+
+	canonical = filepath.Join(dir, "A", "track [vid1].mp3")
+	linked = filepath.Join(dir, "B", "track [vid1].mp3")
+	require.NoError(t, os.MkdirAll(filepath.Dir(canonical), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Dir(linked), 0755))
+	require.NoError(t, os.WriteFile(canonical, []byte("audio"), 0644))
+	require.NoError(t, os.Link(canonical, linked))
+
+	require.NoError(t, db.AddVideo("vid1", "PL_A", "A", VideoMetadata{Title: "track", Channel: "chan", UploadDate: time.Now()}))
+	require.NoError(t, db.UpdateFileInfo("vid1", canonical, 5, ""))
+	_, err := db.GetOrCreatePlaylist("PL_B", "B")
+	require.NoError(t, err)
+	require.NoError(t, db.AddVideoLink("vid1", "PL_B", linked, "hardlink"))
+	return canonical, linked
+}
+
+func TestVideoLinks(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "links.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, linked := seedLinkedVideo(t, db, dir)
+
+	for _, playlist := range []string{"PL_A", "PL_B"} {
+		present, err := db.HasPlaylistCopy("vid1", playlist)
+		require.NoError(t, err)
+		assert.True(t, present, "Video should be present in %s", playlist)
+	}
+	present, err := db.HasPlaylistCopy("vid1", "PL_C")
+	require.NoError(t, err)
+	assert.False(t, present)
+
+	links, err := db.GetVideoLinks("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, []VideoLink{{PlaylistYoutubeID: "PL_B", Path: linked, Type: "hardlink"}}, links)
+
+	// Validation counts the link location as well
+	checked, err := db.ValidateFiles()
+	require.NoError(t, err)
+	assert.Equal(t, 2, checked)
+}
+
+func TestFileOwner(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "links.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.SetLibraryRoot(dir))
+
+	canonical, linked := seedLinkedVideo(t, db, dir)
+	for _, path := range []string{canonical, linked} {
+		owner, err := db.FileOwner(path)
+		require.NoError(t, err)
+		assert.Equal(t, "vid1", owner, path)
+	}
+	owner, err := db.FileOwner(filepath.Join(dir, "A", "other.mp3"))
+	require.NoError(t, err)
+	assert.Empty(t, owner)
+}
+
+func TestRemovePlaylistMembershipRemovesOnlyLink(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "links.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	canonical, linked := seedLinkedVideo(t, db, dir)
+
+	require.NoError(t, db.RemovePlaylistMembership("vid1", "PL_B"))
+	assert.NoFileExists(t, linked)
+	assert.FileExists(t, canonical)
+
+	path, err := db.GetFilePath("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, canonical, path)
+}
+
+func TestRemovePlaylistMembershipLogsStuckFile(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "links.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, linked := seedLinkedVideo(t, db, dir)
+
+	// A non-empty directory in the link's place can't be removed
+	require.NoError(t, os.Remove(linked))
+	require.NoError(t, os.MkdirAll(filepath.Join(linked, "stuck"), 0755))
+
+	require.NoError(t, db.RemovePlaylistMembership("vid1", "PL_B"), "A file that can't be removed after the commit is only logged")
+	links, err := db.GetVideoLinks("vid1")
+	require.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+func TestRemovePlaylistMembershipPromotesLink(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "links.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	canonical, linked := seedLinkedVideo(t, db, dir)
+
+	// Removing the canonical playlist keeps the file alive through the link
+	require.NoError(t, db.RemovePlaylistMembership("vid1", "PL_A"))
+	assert.NoFileExists(t, canonical)
+	assert.FileExists(t, linked)
+
+	path, err := db.GetFilePath("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, linked, path)
+	links, err := db.GetVideoLinks("vid1")
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	// The last reference takes the row and file with it
+	require.NoError(t, db.RemovePlaylistMembership("vid1", "PL_B"))
+	assert.NoFileExists(t, linked)
+	exists, err := db.VideoExists("vid1")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// addMembership records that a video is in a playlist, clearing any earlier
+// removal. Membership is additive: a video listed by several playlists keeps
+// one row per playlist while its file is only downloaded once. A zero
+// position keeps any known one.
+func addMembership(tx *sql.Tx, playlistID int64, youtubeID string, position int) error {
+	_, err := tx.Exec(`
+		INSERT INTO playlist_videos (playlist_id, video_id, position)
+		SELECT ?, id, NULLIF(?, 0) FROM videos WHERE youtube_id = ?
+		ON CONFLICT(playlist_id, video_id) DO UPDATE SET
+			position = COALESCE(excluded.position, playlist_videos.position),
+			removed_from_playlist_at = NULL
+	`, playlistID, position, youtubeID)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to playlist: %w", youtubeID, err)
+	}
+	return nil
+}
+
+// GetVideoPlaylists returns the YouTube IDs of every playlist a video is
+// in, in the order it was added to them
+func (d *Database) GetVideoPlaylists(youtubeID string) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT p.youtube_id
+		FROM playlist_videos pv
+		JOIN playlists p ON p.id = pv.playlist_id
+		JOIN videos v ON v.id = pv.video_id
+		WHERE v.youtube_id = ?
+		ORDER BY pv.added_at, p.id
+	`, youtubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query video playlists: %w", err)
+	}
+	defer rows.Close()
+
+	var playlists []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		playlists = append(playlists, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return playlists, nil
+}
+
+// updateVideoCount recounts the members of a playlist
+func updateVideoCount(tx *sql.Tx, playlistID int64) error {
+	_, err := tx.Exec(
+		"UPDATE playlists SET video_count = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = ?) WHERE id = ?",
+		playlistID, playlistID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update video count: %w", err)
+	}
+	return nil
+}
+
+// RemovedVideo is a member of a playlist that the playlist no longer lists
+type RemovedVideo struct {
+	YoutubeID string    `json:"youtube_id"`
+	Title     string    `json:"title"`
+	FilePath  string    `json:"file_path"`
+	RemovedAt time.Time `json:"removed_at"`
+}
+
+// GetPlaylistMembers returns the YouTube IDs of the videos a playlist still
+// lists, leaving out ones marked as removed
+func (d *Database) GetPlaylistMembers(playlistYoutubeID string) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT v.youtube_id
+		FROM playlist_videos pv
+		JOIN playlists p ON p.id = pv.playlist_id
+		JOIN videos v ON v.id = pv.video_id
+		WHERE p.youtube_id = ? AND pv.removed_from_playlist_at IS NULL
+		ORDER BY v.youtube_id
+	`, playlistYoutubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query playlist members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		members = append(members, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return members, nil
+}
+
+// MarkRemovedFromPlaylist records that a playlist stopped listing the given
+// videos. Videos already marked keep their original removal time.
+func (d *Database) MarkRemovedFromPlaylist(playlistYoutubeID string, youtubeIDs []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		UPDATE playlist_videos
+		SET removed_from_playlist_at = ?
+		WHERE removed_from_playlist_at IS NULL
+		  AND playlist_id = (SELECT id FROM playlists WHERE youtube_id = ?)
+		  AND video_id = (SELECT id FROM videos WHERE youtube_id = ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare removal update: %w", err)
+	}
+	defer stmt.Close()
+
+	now := dbNow()
+	for _, id := range youtubeIDs {
+		if _, err := stmt.Exec(now, playlistYoutubeID, id); err != nil {
+			return fmt.Errorf("failed to mark %s as removed: %w", id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRemovedVideos returns the videos a playlist no longer lists, most
+// recently removed first
+func (d *Database) GetRemovedVideos(playlistYoutubeID string) ([]RemovedVideo, error) {
+	rows, err := d.db.Query(`
+		SELECT v.youtube_id, v.title, COALESCE(l.link_path, v.file_path), pv.removed_from_playlist_at
+		FROM playlist_videos pv
+		JOIN playlists p ON p.id = pv.playlist_id
+		JOIN videos v ON v.id = pv.video_id
+		LEFT JOIN video_links l ON l.video_id = pv.video_id AND l.playlist_id = pv.playlist_id
+		WHERE p.youtube_id = ? AND pv.removed_from_playlist_at IS NOT NULL
+		ORDER BY pv.removed_from_playlist_at DESC, v.youtube_id
+	`, playlistYoutubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query removed videos: %w", err)
+	}
+	defer rows.Close()
+
+	var videos []RemovedVideo
+	for rows.Next() {
+		var video RemovedVideo
+		var title, filePath sql.NullString
+		if err := rows.Scan(&video.YoutubeID, &title, &filePath, &video.RemovedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		video.Title = title.String
+		video.FilePath = d.root.resolve(filePath.String)
+		videos = append(videos, video)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return videos, nil
+}
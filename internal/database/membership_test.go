@@ -0,0 +1,85 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaylistMembershipIsAdditive(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "membership.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	canonical := filepath.Join(dir, "A", "song [vid1].mp3")
+	require.NoError(t, db.AddVideo("vid1", "PL_A", "A", VideoMetadata{Title: "song", UploadDate: time.Now()}))
+	require.NoError(t, db.UpdateFileInfo("vid1", canonical, 5, ""))
+
+	// Seen again in another playlist: it joins that one without moving
+	require.NoError(t, db.AddVideo("vid1", "PL_B", "B", VideoMetadata{Title: "song", UploadDate: time.Now()}))
+
+	playlists, err := db.GetVideoPlaylists("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PL_A", "PL_B"}, playlists)
+
+	path, err := db.GetFilePath("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, canonical, path, "File stays with the playlist that downloaded it")
+
+	for _, id := range []string{"PL_A", "PL_B"} {
+		playlist, err := db.GetOrCreatePlaylist(id, id)
+		require.NoError(t, err)
+		assert.Equal(t, 1, playlist.VideoCount, "Video counts in %s", id)
+	}
+
+	videos, err := db.GetPlaylistVideosOrdered("PL_B")
+	require.NoError(t, err)
+	require.Len(t, videos, 1)
+	assert.Equal(t, canonical, videos[0].FilePath)
+
+	// Leaving B doesn't touch A's file
+	require.NoError(t, db.RemovePlaylistMembership("vid1", "PL_B"))
+	playlists, err = db.GetVideoPlaylists("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PL_A"}, playlists)
+	path, err = db.GetFilePath("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, canonical, path)
+	assert.Error(t, db.RemovePlaylistMembership("vid1", "PL_B"), "No longer a member")
+}
+
+func TestMigrationBackfillsPlaylistMembership(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "backfill.db")
+	db, err := openTestDB(t, dbPath)
+	require.NoError(t, err)
+	seedLinkedVideo(t, db, dir)
+	require.NoError(t, db.SetPlaylistPositions("PL_B", map[string]int{"vid1": 4}))
+
+	// Pretend the database predates the join table, with positions in the old columns
+	forgetMigrations(t, db, 14)
+	_, err = db.db.Exec("UPDATE video_links SET playlist_position = 4")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = openTestDB(t, dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	playlists, err := db.GetVideoPlaylists("vid1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"PL_A", "PL_B"}, playlists)
+
+	videos, err := db.GetPlaylistVideosOrdered("PL_B")
+	require.NoError(t, err)
+	require.Len(t, videos, 1)
+	assert.Equal(t, 4, videos[0].Position)
+
+	playlist, err := db.GetOrCreatePlaylist("PL_B", "B")
+	require.NoError(t, err)
+	assert.Equal(t, 1, playlist.VideoCount)
+}
@@ -0,0 +1,370 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration is a versioned schema change applied once, in order, on top of
+// the base schema created by createSchema
+type migration struct {
+	version     int
+	description string
+	stmts       []string
+	sqliteOnly  bool // Fixes data only older SQLite databases can hold
+}
+
+// migrations must only ever be appended to; applied versions are recorded
+// in schema_migrations
+var migrations = []migration{
+	{
+		version:     1,
+		description: "track whether cover art was embedded",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN art_embedded BOOLEAN`,
+		},
+	},
+	{
+		version:     2,
+		description: "record extra playlist folder locations of a video",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS video_links (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				video_id INTEGER NOT NULL,
+				playlist_id INTEGER NOT NULL,
+				link_path TEXT NOT NULL UNIQUE,
+				link_type TEXT NOT NULL,  -- 'hardlink', 'reflink', 'symlink', 'copy'
+				validation_status TEXT DEFAULT 'valid',
+				last_validated TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (video_id, playlist_id),
+				FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE,
+				FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_video_links_video_id ON video_links(video_id);`,
+		},
+	},
+	{
+		version:     3,
+		description: "remember failed download attempts between runs",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS download_failures (
+				youtube_id TEXT PRIMARY KEY,
+				playlist_youtube_id TEXT,
+				attempts INTEGER NOT NULL DEFAULT 0,  -- Scheduler passes that failed
+				last_error TEXT,
+				permanent BOOLEAN NOT NULL DEFAULT FALSE,  -- Error that retrying won't fix
+				first_failed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				last_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+	},
+	{
+		version:     4,
+		description: "record media type, container and codec of downloads",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN media_type TEXT DEFAULT 'audio'`, // 'audio' or 'video'
+			`ALTER TABLE videos ADD COLUMN container TEXT`,                  // File extension, e.g. mp3, mp4, mkv
+			`ALTER TABLE videos ADD COLUMN codec TEXT`,                      // e.g. mp3, or avc1+mp4a for video
+		},
+	},
+	{
+		version:     5,
+		description: "store chapter tracks split out of a video",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS video_tracks (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				video_id INTEGER NOT NULL,
+				track_number INTEGER NOT NULL,  -- 1-based chapter index
+				title TEXT NOT NULL,  -- Chapter name
+				file_path TEXT NOT NULL UNIQUE,
+				file_size INTEGER DEFAULT 0,
+				validation_status TEXT DEFAULT 'valid',
+				last_validated TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (video_id, track_number),
+				FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_video_tracks_video_id ON video_tracks(video_id);`,
+		},
+	},
+	{
+		version:     6,
+		description: "distinguish channel uploads from curated playlists",
+		stmts: []string{
+			`ALTER TABLE playlists ADD COLUMN source_type TEXT DEFAULT 'playlist'`, // 'playlist', 'channel' or 'video'
+		},
+	},
+	{
+		version:     7,
+		description: "record loudness measured before normalization",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN loudness_lufs REAL`, // NULL when the file wasn't normalized
+		},
+	},
+	{
+		version:     8,
+		description: "store artist and song parsed from video titles",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN parsed_artist TEXT`, // NULL when the title wasn't parsed
+			`ALTER TABLE videos ADD COLUMN parsed_title TEXT`,
+		},
+	},
+	{
+		version:     9,
+		description: "store each video's position in its playlists",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN playlist_position INTEGER`,      // 1-based; NULL when no longer listed
+			`ALTER TABLE video_links ADD COLUMN playlist_position INTEGER`, // Position in the linked playlist
+		},
+	},
+	{
+		version:     10,
+		description: "track videos that became private, deleted or blocked",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN availability TEXT DEFAULT 'available'`, // 'available', 'private', 'deleted' or 'blocked'
+			`ALTER TABLE download_failures ADD COLUMN availability TEXT`,          // Set when the failure is because the video is unavailable
+		},
+	},
+	{
+		version:     11,
+		description: "remember videos skipped by playlist filters",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS skipped_videos (
+				youtube_id TEXT PRIMARY KEY,
+				playlist_youtube_id TEXT,
+				skipped_reason TEXT NOT NULL,  -- e.g. 'too_long', 'too_short'
+				duration INTEGER,  -- Seconds, so changed limits can be applied without refetching
+				skipped_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+	},
+	{
+		version:     12,
+		description: "log every failed download attempt",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS download_attempts (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				youtube_id TEXT NOT NULL,
+				attempted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				error_class TEXT,  -- e.g. 'transient', 'permanent', 'blocked'
+				error_message TEXT,
+				yt_dlp_exit_code INTEGER  -- NULL when yt-dlp didn't exit with an error
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_download_attempts_youtube_id ON download_attempts(youtube_id);`,
+			`ALTER TABLE videos ADD COLUMN retry_count INTEGER DEFAULT 0`, // Failed attempts since the last success
+			`ALTER TABLE videos ADD COLUMN last_error TEXT`,
+		},
+	},
+	{
+		version:     13,
+		description: "forget placeholder .music/ paths that were never the real file",
+		stmts: []string{
+			`UPDATE videos SET file_path = NULL, file_size = 0, validation_status = 'pending'
+				WHERE file_path LIKE '.music/%'`,
+		},
+	},
+	{
+		version:     14,
+		description: "track playlist membership separately from file ownership",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS playlist_videos (
+				playlist_id INTEGER NOT NULL,
+				video_id INTEGER NOT NULL,
+				position INTEGER,  -- 1-based; NULL when no longer listed
+				added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (playlist_id, video_id),
+				FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+				FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_playlist_videos_video_id ON playlist_videos(video_id);`,
+			// videos.playlist_id stays as the playlist whose folder holds the canonical file
+			`INSERT INTO playlist_videos (playlist_id, video_id, position, added_at)
+				SELECT playlist_id, id, playlist_position, COALESCE(created_at, CURRENT_TIMESTAMP)
+				FROM videos WHERE playlist_id IS NOT NULL
+				ON CONFLICT DO NOTHING`,
+			// SQLite needs the WHERE to tell ON CONFLICT from a join's ON
+			`INSERT INTO playlist_videos (playlist_id, video_id, position, added_at)
+				SELECT playlist_id, video_id, playlist_position, COALESCE(created_at, CURRENT_TIMESTAMP)
+				FROM video_links WHERE TRUE
+				ON CONFLICT DO NOTHING`,
+			`UPDATE playlists SET video_count = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = playlists.id)`,
+		},
+	},
+	{
+		version:     15,
+		description: "remember when a video was removed from a playlist",
+		stmts: []string{
+			`ALTER TABLE playlist_videos ADD COLUMN removed_from_playlist_at TIMESTAMP`, // NULL while the playlist still lists it
+		},
+	},
+	{
+		version:     16,
+		description: "remember videos that must never be downloaded again",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS ignored_videos (
+				youtube_id TEXT PRIMARY KEY,
+				reason TEXT,  -- Free text, e.g. 'wrong track'
+				ignored_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+	},
+	{
+		version:     17,
+		description: "store every timestamp as UTC in SQLite's format",
+		sqliteOnly:  true,
+		stmts: []string{
+			normalizeTimestamps("playlists", "last_checked", "created_at", "updated_at"),
+			normalizeTimestamps("videos", "upload_date", "live_start_time", "live_end_time",
+				"last_validated", "downloaded_at", "created_at", "updated_at"),
+			normalizeTimestamps("video_links", "last_validated", "created_at"),
+			normalizeTimestamps("video_tracks", "last_validated", "created_at"),
+			normalizeTimestamps("download_failures", "first_failed_at", "last_attempt_at"),
+			normalizeTimestamps("skipped_videos", "skipped_at"),
+			normalizeTimestamps("download_attempts", "attempted_at"),
+			normalizeTimestamps("playlist_videos", "added_at", "removed_from_playlist_at"),
+			normalizeTimestamps("ignored_videos", "ignored_at"),
+		},
+	},
+	{
+		version:     18,
+		description: "only set downloaded_at once a download succeeds",
+		stmts: []string{
+			// Inserts used to default it to the time the row was created
+			`UPDATE videos SET downloaded_at = NULL
+				WHERE validation_status IN ('pending', 'archived') AND COALESCE(file_path, '') = ''`,
+		},
+	},
+	{
+		version:     19,
+		description: "remember when a download was last attempted",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN last_attempted_at TIMESTAMP`, // Last failed attempt, next to retry_count and last_error
+		},
+	},
+	{
+		version:     20,
+		description: "record the audio format of each file as probed by ffprobe",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN bitrate INTEGER`, // Audio bits per second
+			`ALTER TABLE videos ADD COLUMN sample_rate INTEGER`,
+			`ALTER TABLE videos ADD COLUMN channels INTEGER`,
+		},
+	},
+	{
+		version:     21,
+		description: "remember when each file's checksum was last verified",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN last_verified TIMESTAMP`, // Set by deep validation, unlike last_validated
+		},
+	},
+	{
+		version:     22,
+		description: "record why a file failed validation",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN validation_error TEXT`, // NULL while the file is valid
+		},
+	},
+	{
+		version:     23,
+		description: "remember when each playlist last got new videos",
+		stmts: []string{
+			`ALTER TABLE playlists ADD COLUMN last_changed TIMESTAMP`, // Set by the watcher; drives adaptive polling
+		},
+	},
+	{
+		version:     24,
+		description: "remember each playlist's listing to skip unchanged ones",
+		stmts: []string{
+			`ALTER TABLE playlists ADD COLUMN listing_fingerprint TEXT`, // Hash of the video IDs and selection options
+			`ALTER TABLE playlists ADD COLUMN listing_scanned_at TIMESTAMP`,
+		},
+	},
+	{
+		version:     25,
+		description: "track where each file is stored once uploads are on",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN storage_location TEXT`, // NULL when never queued for upload; see StorageLocal
+		},
+	},
+	{
+		version:     26,
+		description: "remember when activity digests were emailed",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS digests (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				sent_at TIMESTAMP NOT NULL
+			)`,
+		},
+	},
+	{
+		version:     27,
+		description: "remember the videos imports list in playlists before they're downloaded",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS known_videos (
+				playlist_id INTEGER NOT NULL,
+				youtube_id TEXT NOT NULL,
+				position INTEGER,   -- 1-based, in the imported listing
+				added_at TIMESTAMP, -- When it was added to the playlist, if the import says
+				imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (playlist_id, youtube_id),
+				FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		version:     28,
+		description: "remember what yt-dlp lacked to embed cover art",
+		stmts: []string{
+			`ALTER TABLE videos ADD COLUMN art_missing TEXT`, // e.g. "ffmpeg"; NULL when nothing installable would help
+		},
+	},
+}
+
+// migrate applies any migrations newer than the database's current version
+func migrate(db *sql.DB, dl dialect) error {
+	if _, err := db.Exec(dl.ddl(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`)); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current || (m.sqliteOnly && dl.postgres()) {
+			continue
+		}
+		if err := applyMigration(db, dl, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs a single migration in its own transaction
+func applyMigration(db *sql.DB, dl dialect, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.stmts {
+		if _, err := tx.Exec(dl.ddl(stmt)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, description) VALUES (?, ?)", m.version, m.description); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// libraryRoot is the directory file paths are stored relative to, so the
+// library can move without the database pointing at the old location.
+// Files outside it keep their full path. The zero value stores paths as
+// given.
+type libraryRoot string
+
+// store returns the form of path written to the database
+func (r libraryRoot) store(path string) string {
+	if r == "" || path == "" {
+		return path
+	}
+	rel, err := filepath.Rel(string(r), path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// resolve returns the path on disk of a path read from the database
+func (r libraryRoot) resolve(path string) string {
+	if r == "" || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(string(r), path)
+}
+
+// pathColumns are every column holding a file path
+var pathColumns = []struct{ table, column string }{
+	{"videos", "file_path"},
+	{"video_links", "link_path"},
+	{"video_tracks", "file_path"},
+}
+
+// SetLibraryRoot stores new file paths relative to root and resolves stored
+// ones against it. Paths recorded under root before paths were stored
+// relative are converted.
+func (d *Database) SetLibraryRoot(root string) error {
+	d.root = libraryRoot(filepath.Clean(root))
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := rewritePathPrefix(tx, string(d.root), "")
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if n > 0 {
+		d.logger.Info("Stored file paths relative to the library", "paths", n, "root", string(d.root))
+	}
+	return nil
+}
+
+// ResolvePath returns where a file path read from the database is on disk
+func (d *Database) ResolvePath(path string) string {
+	return d.root.resolve(path)
+}
+
+// RelocatePaths rewrites file paths under oldRoot to the same place under
+// newRoot, for a library that was moved. Paths that end up under the
+// library root are stored relative to it. It returns how many paths were
+// rewritten.
+func (d *Database) RelocatePaths(oldRoot, newRoot string) (int, error) {
+	oldRoot, newRoot = filepath.Clean(oldRoot), filepath.Clean(newRoot)
+	if oldRoot == newRoot {
+		return 0, fmt.Errorf("old and new locations are both %s", oldRoot)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	to := newRoot + string(filepath.Separator)
+	if d.root != "" && newRoot == string(d.root) {
+		to = ""
+	}
+	n, err := rewritePathPrefix(tx, oldRoot, to)
+	if err != nil {
+		return 0, err
+	}
+	if d.root != "" {
+		if _, err := rewritePathPrefix(tx, string(d.root), ""); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return n, nil
+}
+
+// rewritePathPrefix replaces the directory from at the start of every
+// stored path with to, which is empty or ends in a separator
+func rewritePathPrefix(tx *sql.Tx, from, to string) (int, error) {
+	prefix := from + string(filepath.Separator)
+	if from == string(filepath.Separator) {
+		prefix = from
+	}
+
+	var total int
+	for _, c := range pathColumns {
+		result, err := tx.Exec(fmt.Sprintf(
+			"UPDATE %[1]s SET %[2]s = ? || substr(%[2]s, length(?) + 1) WHERE substr(%[2]s, 1, length(?)) = ?", c.table, c.column),
+			to, prefix, prefix, prefix,
+		)
+		if err != nil {
+			return total, fmt.Errorf("failed to rewrite paths in %s: %w", c.table, err)
+		}
+		n, _ := result.RowsAffected()
+		total += int(n)
+	}
+	return total, nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storedPath reads a video's file_path as written to the database
+func storedPath(t *testing.T, db *Database, youtubeID string) string {
+	t.Helper()
+	var path string
+	require.NoError(t, db.db.QueryRow("SELECT file_path FROM videos WHERE youtube_id = ?", youtubeID).Scan(&path))
+	return path
+}
+
+func TestLibraryRoot(t *testing.T) {
+	root := libraryRoot("/music")
+	for path, want := range map[string]string{
+		"/music/Jazz/a.mp3": "Jazz/a.mp3",
+		"/elsewhere/a.mp3":  "/elsewhere/a.mp3",
+		"/musicals/a.mp3":   "/musicals/a.mp3",
+		"/music":            "/music",
+		"":                  "",
+	} {
+		assert.Equal(t, want, root.store(path), path)
+		assert.Equal(t, path, root.resolve(root.store(path)), path)
+	}
+	assert.Equal(t, "Jazz/a.mp3", libraryRoot("").store("Jazz/a.mp3"), "No root stores paths as given")
+}
+
+func TestLibraryCanBeMoved(t *testing.T) {
+	dir := t.TempDir()
+	oldRoot := filepath.Join(dir, "music")
+	dbPath := filepath.Join(dir, "library.db")
+
+	db, err := openTestDB(t, dbPath)
+	require.NoError(t, err)
+	require.NoError(t, db.SetLibraryRoot(oldRoot))
+	_, err = db.GetOrCreatePlaylist("PL_A", "A")
+	require.NoError(t, err)
+	_, err = db.GetOrCreatePlaylist("PL_B", "B")
+	require.NoError(t, err)
+
+	song := filepath.Join(oldRoot, "A", "song [aaaaaaaaaaa].mp3")
+	link := filepath.Join(oldRoot, "B", "song [aaaaaaaaaaa].mp3")
+	require.NoError(t, os.MkdirAll(filepath.Dir(song), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Dir(link), 0755))
+	require.NoError(t, os.WriteFile(song, []byte("audio"), 0644))
+	require.NoError(t, os.Link(song, link))
+	require.NoError(t, db.RecordDownload("PL_A", "A", DownloadRecord{YoutubeID: "aaaaaaaaaaa", FilePath: song, FileSize: 5}))
+	require.NoError(t, db.AddVideoLink("aaaaaaaaaaa", "PL_B", link, "hardlink"))
+
+	assert.Equal(t, filepath.Join("A", "song [aaaaaaaaaaa].mp3"), storedPath(t, db, "aaaaaaaaaaa"))
+	path, err := db.GetFilePath("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, song, path)
+	require.NoError(t, db.Close())
+
+	// Move the library and point the database at the new location
+	newRoot := filepath.Join(dir, "tank", "music")
+	require.NoError(t, os.MkdirAll(filepath.Dir(newRoot), 0755))
+	require.NoError(t, os.Rename(oldRoot, newRoot))
+	db, err = openTestDB(t, dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.SetLibraryRoot(newRoot))
+
+	_, err = db.ValidateFiles()
+	require.NoError(t, err)
+	videos, err := db.GetVideosByStatus(StatusMissing)
+	require.NoError(t, err)
+	assert.Empty(t, videos)
+	links, err := db.GetVideoLinks("aaaaaaaaaaa")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, filepath.Join(newRoot, "B", "song [aaaaaaaaaaa].mp3"), links[0].Path)
+
+	known, err := db.GetKnownFilePaths()
+	require.NoError(t, err)
+	assert.True(t, known[filepath.Join(newRoot, "A", "song [aaaaaaaaaaa].mp3")])
+}
+
+func TestSetLibraryRootConvertsOldPaths(t *testing.T) {
+	db := newBatchTestDB(t)
+	records := []DownloadRecord{syntheticRecord(1), syntheticRecord(2)}
+	records[1].FilePath = "/elsewhere/Track 2.mp3"
+	records[0].Tracks = []Track{{Number: 1, Title: "Intro", FilePath: "/music/bench/Track 1/01 Intro.mp3"}}
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", records))
+
+	require.NoError(t, db.SetLibraryRoot("/music/"))
+	assert.Equal(t, "bench/Track 1 [vid00001].mp3", storedPath(t, db, "vid00001"))
+	assert.Equal(t, "/elsewhere/Track 2.mp3", storedPath(t, db, "vid00002"), "Files outside the library keep their path")
+	var track string
+	require.NoError(t, db.db.QueryRow("SELECT file_path FROM video_tracks").Scan(&track))
+	assert.Equal(t, "bench/Track 1/01 Intro.mp3", track)
+
+	videos, err := db.ListVideos(ListOptions{})
+	require.NoError(t, err)
+	paths := []string{videos[0].FilePath, videos[1].FilePath}
+	assert.ElementsMatch(t, []string{"/music/bench/Track 1 [vid00001].mp3", "/elsewhere/Track 2.mp3"}, paths)
+}
+
+func TestRelocatePaths(t *testing.T) {
+	db := newBatchTestDB(t)
+	records := []DownloadRecord{syntheticRecord(1), syntheticRecord(2)}
+	records[1].FilePath = "/music-old/other/Track 2.mp3"
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", records))
+	require.NoError(t, db.SetLibraryRoot("/mnt/tank/music"))
+
+	n, err := db.RelocatePaths("/music", "/mnt/tank/music")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "bench/Track 1 [vid00001].mp3", storedPath(t, db, "vid00001"))
+	assert.Equal(t, "/music-old/other/Track 2.mp3", storedPath(t, db, "vid00002"), "Only paths inside the old directory move")
+	path, err := db.GetFilePath("vid00001")
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/tank/music/bench/Track 1 [vid00001].mp3", path)
+
+	// Somewhere outside the library root stays absolute
+	n, err = db.RelocatePaths("/music-old", "/archive")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "/archive/other/Track 2.mp3", storedPath(t, db, "vid00002"))
+
+	_, err = db.RelocatePaths("/archive", "/archive/")
+	assert.Error(t, err)
+}
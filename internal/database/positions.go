@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// PlaylistVideo is one downloaded entry of a playlist, with the path of its
+// copy in that playlist's folder
+type PlaylistVideo struct {
+	YoutubeID string `json:"youtube_id"`
+	Title     string `json:"title"`
+	FilePath  string `json:"file_path"`
+	Position  int    `json:"position"` // 1-based; 0 when unknown
+}
+
+// SetPlaylistPositions records the position of every listed video in a
+// playlist, adding known videos to it as members. Videos of the playlist
+// missing from positions lose their position, so reordering on YouTube is
+// reflected on the next pass.
+func (d *Database) SetPlaylistPositions(playlistYoutubeID string, positions map[string]int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var playlistID int64
+	if err := tx.QueryRow("SELECT id FROM playlists WHERE youtube_id = ?", playlistYoutubeID).Scan(&playlistID); err != nil {
+		return fmt.Errorf("failed to find playlist %s: %w", playlistYoutubeID, err)
+	}
+
+	if _, err := tx.Exec("UPDATE playlist_videos SET position = NULL WHERE playlist_id = ?", playlistID); err != nil {
+		return fmt.Errorf("failed to clear positions: %w", err)
+	}
+
+	for youtubeID, position := range positions {
+		if err := addMembership(tx, playlistID, youtubeID, position); err != nil {
+			return err
+		}
+	}
+	if err := updateVideoCount(tx, playlistID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetPlaylistPosition records the position of one video in a playlist
+func (d *Database) SetPlaylistPosition(youtubeID, playlistYoutubeID string, position int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var playlistID int64
+	if err := tx.QueryRow("SELECT id FROM playlists WHERE youtube_id = ?", playlistYoutubeID).Scan(&playlistID); err != nil {
+		return fmt.Errorf("failed to find playlist %s: %w", playlistYoutubeID, err)
+	}
+	if _, err := tx.Exec(
+		"UPDATE playlist_videos SET position = ? WHERE playlist_id = ? AND video_id = (SELECT id FROM videos WHERE youtube_id = ?)",
+		position, playlistID, youtubeID,
+	); err != nil {
+		return fmt.Errorf("failed to set position of %s: %w", youtubeID, err)
+	}
+
+	return tx.Commit()
+}
+
+// GetPlaylistVideosOrdered returns the downloaded videos of a playlist in
+// playlist order. Videos without a known position come last. Members without
+// a copy in the playlist's folder point at their canonical file.
+func (d *Database) GetPlaylistVideosOrdered(playlistYoutubeID string) ([]PlaylistVideo, error) {
+	rows, err := d.db.Query(`
+		SELECT v.youtube_id, v.title, COALESCE(l.link_path, v.file_path), pv.position
+		FROM playlist_videos pv
+		JOIN playlists p ON p.id = pv.playlist_id
+		JOIN videos v ON v.id = pv.video_id
+		LEFT JOIN video_links l ON l.video_id = pv.video_id AND l.playlist_id = pv.playlist_id
+		WHERE p.youtube_id = ? AND COALESCE(l.link_path, v.file_path) IS NOT NULL
+		ORDER BY pv.position IS NULL, pv.position, v.youtube_id
+	`, playlistYoutubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query playlist videos: %w", err)
+	}
+	defer rows.Close()
+
+	var videos []PlaylistVideo
+	for rows.Next() {
+		var video PlaylistVideo
+		var title sql.NullString
+		var position sql.NullInt64
+		if err := rows.Scan(&video.YoutubeID, &title, &video.FilePath, &position); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		video.Title = title.String
+		video.FilePath = d.root.resolve(video.FilePath)
+		video.Position = int(position.Int64)
+		videos = append(videos, video)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return videos, nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaylistPositions(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "positions.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, linked := seedLinkedVideo(t, db, dir)
+	for _, id := range []string{"vid2", "vid3"} {
+		require.NoError(t, db.AddVideo(id, "PL_B", "B", VideoMetadata{Title: "song " + id, UploadDate: time.Now()}))
+		require.NoError(t, db.UpdateFileInfo(id, filepath.Join(dir, "B", id+".mp3"), 5, ""))
+	}
+
+	ids := func(videos []PlaylistVideo) []string {
+		var out []string
+		for _, v := range videos {
+			out = append(out, v.YoutubeID)
+		}
+		return out
+	}
+
+	require.NoError(t, db.SetPlaylistPositions("PL_B", map[string]int{"vid3": 1, "vid1": 2, "vid2": 3}))
+	videos, err := db.GetPlaylistVideosOrdered("PL_B")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vid3", "vid1", "vid2"}, ids(videos))
+	assert.Equal(t, linked, videos[1].FilePath, "Linked videos use the link path")
+	assert.Equal(t, 2, videos[1].Position)
+
+	// The owner reordered and removed vid3
+	require.NoError(t, db.SetPlaylistPositions("PL_B", map[string]int{"vid2": 1, "vid1": 2}))
+	videos, err = db.GetPlaylistVideosOrdered("PL_B")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vid2", "vid1", "vid3"}, ids(videos))
+	assert.Equal(t, 0, videos[2].Position, "Unlisted videos lose their position")
+
+	// Positions are per playlist
+	require.NoError(t, db.SetPlaylistPosition("vid1", "PL_A", 7))
+	videos, err = db.GetPlaylistVideosOrdered("PL_A")
+	require.NoError(t, err)
+	require.Len(t, videos, 1)
+	assert.Equal(t, 7, videos[0].Position)
+}
@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Database drivers
+const (
+	DriverSQLite   = "sqlite"   // A file next to the library; the default
+	DriverPostgres = "postgres" // A server shared by several machines
+)
+
+// dialect is the SQL flavour of a driver. Queries are written for SQLite
+// with ? placeholders, which the Postgres connection rewrites; dialect
+// covers the few statements the two spell differently.
+type dialect string
+
+// postgres reports whether queries run against Postgres
+func (dl dialect) postgres() bool {
+	return dl == DriverPostgres
+}
+
+// Postgres types for SQLite's, whose INTEGER is always 64-bit and REAL
+// double precision
+var postgresTypes = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+	"INTEGER", "BIGINT",
+	"REAL", "DOUBLE PRECISION",
+)
+
+// ddl returns a CREATE or ALTER TABLE statement in the dialect's types
+func (dl dialect) ddl(stmt string) string {
+	if dl.postgres() {
+		return postgresTypes.Replace(stmt)
+	}
+	return stmt
+}
+
+// postgresNow is SQLite's CURRENT_TIMESTAMP in Postgres: the UTC time in
+// whole seconds, like timeFormat. Fractions would sort a row written at
+// CURRENT_TIMESTAMP after one written with dbNow in the same second.
+const postgresNow = "DATE_TRUNC('second', LOCALTIMESTAMP)"
+
+// ago returns an expression for the current time plus the duration bound
+// to its placeholder, given in SQLite's modifier form, e.g. "-7 days"
+func (dl dialect) ago() string {
+	if dl.postgres() {
+		return "(" + postgresNow + " + CAST(? AS INTERVAL))"
+	}
+	return "datetime('now', ?)"
+}
+
+// daysSince returns an expression for the days, with fractions, between
+// the timestamp expression t and now
+func (dl dialect) daysSince(t string) string {
+	if dl.postgres() {
+		return "(EXTRACT(EPOCH FROM LOCALTIMESTAMP - " + t + ") / 86400)"
+	}
+	return "(julianday('now') - julianday(" + t + "))"
+}
+
+// noLimit returns the LIMIT argument that returns every row, for queries
+// with an OFFSET or a LIMIT the caller may leave out. Postgres rejects
+// SQLite's -1.
+func (dl dialect) noLimit() int64 {
+	if dl.postgres() {
+		return math.MaxInt32
+	}
+	return -1
+}
+
+// random returns an expression for a random integer from 0 to n-1
+func (dl dialect) random(n int) string {
+	if dl.postgres() {
+		return fmt.Sprintf("FLOOR(RANDOM() * %d)", n)
+	}
+	return fmt.Sprintf("ABS(RANDOM() %% %d)", n)
+}
+
+// openPostgres connects to the Postgres server at dsn. Every session runs
+// in UTC, so CURRENT_TIMESTAMP defaults match the stored timestamps.
+//
+// Arguments are sent as literals in the query text, leaving Postgres to
+// type them from where they're used as SQLite does; with server-side
+// parameters it can't tell the type of e.g. "? IS NULL".
+func openPostgres(dsn string) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Postgres DSN: %w", err)
+	}
+	config.RuntimeParams["timezone"] = "UTC"
+	config.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	return sql.OpenDB(rebindConnector{stdlib.GetConnector(*config)}), nil
+}
+
+// schemaLock is the Postgres advisory lock held while setting up the schema
+const schemaLock = 0x70705f646c // "pp_dl"
+
+// lockSchema takes schemaLock on a connection of its own, returning the
+// function that releases it
+func lockSchema(db *sql.DB) (func(), error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock the schema: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SELECT pg_advisory_lock(%d)", schemaLock)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to lock the schema: %w", err)
+	}
+	return func() {
+		conn.ExecContext(ctx, fmt.Sprintf("SELECT pg_advisory_unlock(%d)", schemaLock))
+		conn.Close()
+	}, nil
+}
+
+// rebindConnector opens pgx connections that accept ? placeholders
+type rebindConnector struct {
+	driver.Connector
+}
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pc, ok := conn.(pgxConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected Postgres connection type %T", conn)
+	}
+	return rebindConn{pc}, nil
+}
+
+// pgxConn is what database/sql uses of a pgx connection
+type pgxConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.NamedValueChecker
+	driver.SessionResetter
+}
+
+// rebindConn rewrites ? placeholders to Postgres' $1, $2, ... before a
+// query reaches the server
+type rebindConn struct {
+	pgxConn
+}
+
+// Prepare doesn't prepare on the server, whose parameters are typed; see
+// openPostgres
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return rebindStmt{c, rebind(query)}, nil
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Prepare(query)
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.pgxConn.ExecContext(ctx, rebind(query), args)
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.pgxConn.QueryContext(ctx, rebind(query), args)
+}
+
+// rebindStmt is a statement run as a plain query each time
+type rebindStmt struct {
+	conn  rebindConn
+	query string // Already rebound
+}
+
+func (s rebindStmt) Close() error  { return nil }
+func (s rebindStmt) NumInput() int { return -1 }
+
+func (s rebindStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s rebindStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s rebindStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.pgxConn.ExecContext(ctx, s.query, args)
+}
+
+func (s rebindStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.pgxConn.QueryContext(ctx, s.query, args)
+}
+
+// CheckNamedValue lets pgx convert arguments, as it does for queries
+func (s rebindStmt) CheckNamedValue(v *driver.NamedValue) error {
+	return s.conn.CheckNamedValue(v)
+}
+
+// namedValues numbers positional arguments
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// sqlToken matches what rebind must skip: string literals, quoted
+// identifiers and comments, or what it rewrites: a placeholder or
+// CURRENT_TIMESTAMP
+var sqlToken = regexp.MustCompile(`'(?:[^']|'')*'|"(?:[^"]|"")*"|--[^\n]*|/\*(?s:.*?)\*/|\?|\bCURRENT_TIMESTAMP\b`)
+
+// rebind numbers the ? placeholders of query and replaces CURRENT_TIMESTAMP
+// with postgresNow, outside literals and comments
+func rebind(query string) string {
+	n := 0
+	return sqlToken.ReplaceAllStringFunc(query, func(token string) string {
+		switch token {
+		case "?":
+			n++
+			return fmt.Sprintf("$%d", n)
+		case "CURRENT_TIMESTAMP":
+			return postgresNow
+		}
+		return token
+	})
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PlaylistSchedule is when a playlist was last checked and last got new
+// videos, so the watcher's polling picks up where it left off after a restart
+type PlaylistSchedule struct {
+	LastChecked time.Time
+	LastChanged time.Time // Zero if nothing was ever downloaded
+}
+
+// MarkPlaylistChecked records that the watcher just checked a playlist, and
+// whether that downloaded anything
+func (d *Database) MarkPlaylistChecked(playlistYoutubeID string, changed bool) error {
+	now := dbNow()
+	_, err := d.db.Exec(`
+		UPDATE playlists
+		SET last_checked = ?,
+		    last_changed = CASE WHEN ? THEN ? ELSE last_changed END
+		WHERE youtube_id = ?
+	`, now, changed, now, playlistYoutubeID)
+	if err != nil {
+		return fmt.Errorf("failed to mark playlist checked: %w", err)
+	}
+	return nil
+}
+
+// GetListingFingerprint returns the fingerprint of a playlist's listing as
+// of its last pass that left nothing to do, and when that was; empty if
+// there was none
+func (d *Database) GetListingFingerprint(playlistYoutubeID string) (string, time.Time, error) {
+	var fingerprint sql.NullString
+	var scannedAt sql.NullTime
+	err := d.db.QueryRow("SELECT listing_fingerprint, listing_scanned_at FROM playlists WHERE youtube_id = ?", playlistYoutubeID).Scan(&fingerprint, &scannedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return "", time.Time{}, fmt.Errorf("failed to get listing fingerprint: %w", err)
+	}
+	return fingerprint.String, scannedAt.Time, nil
+}
+
+// SetListingFingerprint records a playlist's listing fingerprint after a
+// pass that left nothing to do
+func (d *Database) SetListingFingerprint(playlistYoutubeID, fingerprint string) error {
+	_, err := d.db.Exec("UPDATE playlists SET listing_fingerprint = ?, listing_scanned_at = ? WHERE youtube_id = ?",
+		fingerprint, dbNow(), playlistYoutubeID)
+	if err != nil {
+		return fmt.Errorf("failed to set listing fingerprint: %w", err)
+	}
+	return nil
+}
+
+// GetPlaylistSchedules returns every playlist's schedule by its YouTube ID
+func (d *Database) GetPlaylistSchedules() (map[string]PlaylistSchedule, error) {
+	rows, err := d.db.Query("SELECT youtube_id, last_checked, last_changed FROM playlists")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list playlist schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := make(map[string]PlaylistSchedule)
+	for rows.Next() {
+		var id string
+		var checked, changed sql.NullTime
+		if err := rows.Scan(&id, &checked, &changed); err != nil {
+			return nil, fmt.Errorf("failed to list playlist schedules: %w", err)
+		}
+		schedules[id] = PlaylistSchedule{LastChecked: checked.Time, LastChanged: changed.Time}
+	}
+	return schedules, rows.Err()
+}
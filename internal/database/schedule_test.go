@@ -0,0 +1,41 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaylistSchedules(t *testing.T) {
+	db := newBatchTestDB(t)
+	_, err := db.db.Exec("UPDATE playlists SET last_checked = ? WHERE youtube_id = 'PL_BATCH'", dbTime(time.Now().Add(-time.Hour)))
+	require.NoError(t, err)
+
+	schedules, err := db.GetPlaylistSchedules()
+	require.NoError(t, err)
+	require.Contains(t, schedules, "PL_BATCH")
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), schedules["PL_BATCH"].LastChecked, time.Minute)
+	assert.True(t, schedules["PL_BATCH"].LastChanged.IsZero(), "Nothing downloaded yet")
+
+	// A quiet check moves last_checked only
+	require.NoError(t, db.MarkPlaylistChecked("PL_BATCH", false))
+	schedules, err = db.GetPlaylistSchedules()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), schedules["PL_BATCH"].LastChecked, time.Minute)
+	assert.True(t, schedules["PL_BATCH"].LastChanged.IsZero())
+
+	require.NoError(t, db.MarkPlaylistChecked("PL_BATCH", true))
+	schedules, err = db.GetPlaylistSchedules()
+	require.NoError(t, err)
+	changed := schedules["PL_BATCH"].LastChanged
+	assert.WithinDuration(t, time.Now(), changed, time.Minute)
+	assert.Equal(t, time.UTC, changed.Location())
+
+	// Unknown playlists are left alone
+	assert.NoError(t, db.MarkPlaylistChecked("PL_UNKNOWN", true))
+	schedules, err = db.GetPlaylistSchedules()
+	require.NoError(t, err)
+	assert.NotContains(t, schedules, "PL_UNKNOWN")
+}
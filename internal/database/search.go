@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// searchTriggers keep videos_fts in step with every write to videos, since
+// videos are written from many places
+var searchTriggers = map[string]string{
+	"videos_fts_insert": `CREATE TRIGGER IF NOT EXISTS videos_fts_insert AFTER INSERT ON videos BEGIN
+		INSERT INTO videos_fts (rowid, title, channel, description)
+		VALUES (new.id, new.title, new.channel, new.description);
+	END;`,
+	"videos_fts_delete": `CREATE TRIGGER IF NOT EXISTS videos_fts_delete AFTER DELETE ON videos BEGIN
+		INSERT INTO videos_fts (videos_fts, rowid, title, channel, description)
+		VALUES ('delete', old.id, old.title, old.channel, old.description);
+	END;`,
+	"videos_fts_update": `CREATE TRIGGER IF NOT EXISTS videos_fts_update AFTER UPDATE OF title, channel, description ON videos BEGIN
+		INSERT INTO videos_fts (videos_fts, rowid, title, channel, description)
+		VALUES ('delete', old.id, old.title, old.channel, old.description);
+		INSERT INTO videos_fts (rowid, title, channel, description)
+		VALUES (new.id, new.title, new.channel, new.description);
+	END;`,
+}
+
+// setupSearch creates the full-text index over video titles, channels and
+// descriptions. It reports false when SQLite was built without FTS5, in
+// which case SearchVideos falls back to LIKE queries.
+func setupSearch(db *sql.DB) (bool, error) {
+	_, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(
+		title, channel, description,
+		content = 'videos', content_rowid = 'id'
+	);`)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no such module") {
+			return false, fmt.Errorf("failed to create search index: %w", err)
+		}
+		slog.Warn("SQLite was built without FTS5; search falls back to slower LIKE queries")
+		// Triggers left by a build with FTS5 would break every write to videos
+		for name := range searchTriggers {
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return false, fmt.Errorf("failed to drop trigger %s: %w", name, err)
+			}
+		}
+		return false, nil
+	}
+
+	var triggers int
+	err = db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ('videos_fts_insert', 'videos_fts_delete', 'videos_fts_update')",
+	).Scan(&triggers)
+	if err != nil {
+		return false, fmt.Errorf("failed to check search triggers: %w", err)
+	}
+	if triggers == len(searchTriggers) {
+		return true, nil
+	}
+
+	// New index, or one that missed writes while the triggers were gone
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for name, stmt := range searchTriggers {
+		if _, err := tx.Exec(stmt); err != nil {
+			return false, fmt.Errorf("failed to create trigger %s: %w", name, err)
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO videos_fts (videos_fts) VALUES ('rebuild')"); err != nil {
+		return false, fmt.Errorf("failed to build search index: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// SearchVideos finds videos whose title, channel or description contain
+// every word of query, best matches first. limit caps the number of
+// results; 0 means no limit.
+func (d *Database) SearchVideos(query string, limit int) ([]Video, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var limitArg interface{} = limit
+	if limit <= 0 {
+		limitArg = d.dialect.noLimit()
+	}
+
+	var rows *sql.Rows
+	var err error
+	if d.fts {
+		// Quote every word so punctuation like "AC/DC" isn't read as FTS syntax
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		}
+		rows, err = d.db.Query(`
+			SELECT `+videoColumns+`
+			FROM videos_fts f
+			JOIN videos v ON v.id = f.rowid
+			JOIN playlists p ON p.id = v.playlist_id
+			WHERE videos_fts MATCH ?
+			ORDER BY bm25(videos_fts), v.id
+			LIMIT ?`,
+			strings.Join(quoted, " "), limitArg,
+		)
+	} else {
+		escape := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+		var where []string
+		var args []interface{}
+		// LOWER because only SQLite's LIKE ignores case
+		for _, term := range terms {
+			where = append(where, `(LOWER(v.title) LIKE LOWER(?) ESCAPE '\' OR LOWER(v.channel) LIKE LOWER(?) ESCAPE '\' OR LOWER(v.description) LIKE LOWER(?) ESCAPE '\')`)
+			pattern := "%" + escape.Replace(term) + "%"
+			args = append(args, pattern, pattern, pattern)
+		}
+		// Without a ranking function, titles matching the first word come first
+		args = append(args, args[0], limitArg)
+		rows, err = d.db.Query(`
+			SELECT `+videoColumns+`
+			FROM videos v
+			JOIN playlists p ON p.id = v.playlist_id
+			WHERE `+strings.Join(where, " AND ")+`
+			ORDER BY LOWER(v.title) LIKE LOWER(?) ESCAPE '\' DESC, LOWER(v.title), v.id
+			LIMIT ?`,
+			args...,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search videos: %w", err)
+	}
+	defer rows.Close()
+	return d.scanVideos(rows)
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchVideos(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "search.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	videos := map[string]VideoMetadata{
+		"vid1": {Title: "Daft Punk - Around the World", Channel: "Daft Punk"},
+		"vid2": {Title: "One More Time", Channel: "DaftPunkVEVO", Description: "Daft Punk live at Alive 2007"},
+		"vid3": {Title: "AC/DC - Thunderstruck", Channel: "AC/DC"},
+		"vid4": {Title: "100% Pure Love", Channel: "Crystal Waters"},
+	}
+	for id, m := range videos {
+		m.UploadDate = time.Now()
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", m))
+	}
+
+	ids := func(query string) []string {
+		results, err := db.SearchVideos(query, 0)
+		require.NoError(t, err)
+		var out []string
+		for _, v := range results {
+			out = append(out, v.YoutubeID)
+		}
+		return out
+	}
+
+	assert.ElementsMatch(t, []string{"vid1", "vid2"}, ids("daft punk"), "Matches title, channel and description")
+	assert.Equal(t, []string{"vid3"}, ids("AC/DC"), "Punctuation is matched literally")
+	assert.Equal(t, []string{"vid4"}, ids("100%"))
+	assert.Empty(t, ids("daft thunderstruck"), "Every word must match")
+	assert.Empty(t, ids("   "))
+
+	results, err := db.SearchVideos("daft punk", 1)
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "A", results[0].PlaylistTitle)
+
+	// The index follows updates and deletes
+	require.NoError(t, db.AddVideo("vid3", "PL_A", "A", VideoMetadata{Title: "Highway to Hell", Channel: "AC/DC", UploadDate: time.Now()}))
+	assert.Empty(t, ids("thunderstruck"))
+	assert.Equal(t, []string{"vid3"}, ids("highway"))
+	require.NoError(t, db.DeleteVideo("vid3", false))
+	assert.Empty(t, ids("highway"))
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Reasons a video is skipped without downloading it
+const (
+	SkipTooLong  = "too_long"
+	SkipTooShort = "too_short"
+	SkipLive     = "live"     // Streaming now, or the VOD is still processing
+	SkipUpcoming = "upcoming" // Scheduled stream or premiere
+	SkipTitle    = "title"    // Left out by the playlist's title filters
+)
+
+// SkippedVideo is a playlist entry left out on purpose
+type SkippedVideo struct {
+	YoutubeID         string    `json:"youtube_id"`
+	PlaylistYoutubeID string    `json:"playlist_youtube_id"`
+	Reason            string    `json:"skipped_reason"`
+	Duration          int       `json:"duration"` // Seconds
+	SkippedAt         time.Time `json:"skipped_at"`
+}
+
+// RecordSkipped remembers why a video wasn't downloaded, so later passes can
+// skip it without fetching its metadata again
+func (d *Database) RecordSkipped(youtubeID, playlistYoutubeID, reason string, duration int) error {
+	_, err := d.db.Exec(`
+		INSERT INTO skipped_videos (youtube_id, playlist_youtube_id, skipped_reason, duration, skipped_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(youtube_id) DO UPDATE SET
+			playlist_youtube_id = excluded.playlist_youtube_id,
+			skipped_reason = excluded.skipped_reason,
+			duration = excluded.duration,
+			skipped_at = excluded.skipped_at
+	`, youtubeID, playlistYoutubeID, reason, duration, dbNow())
+	if err != nil {
+		return fmt.Errorf("failed to record skipped video: %w", err)
+	}
+	return nil
+}
+
+// GetSkipped returns the skip record for a video, or nil if it wasn't skipped
+func (d *Database) GetSkipped(youtubeID string) (*SkippedVideo, error) {
+	var s SkippedVideo
+	var playlistYoutubeID sql.NullString
+	var duration sql.NullInt64
+	err := d.db.QueryRow(`
+		SELECT youtube_id, playlist_youtube_id, skipped_reason, duration, skipped_at
+		FROM skipped_videos
+		WHERE youtube_id = ?
+	`, youtubeID).Scan(&s.YoutubeID, &playlistYoutubeID, &s.Reason, &duration, &s.SkippedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get skipped video: %w", err)
+	}
+
+	s.PlaylistYoutubeID = playlistYoutubeID.String
+	s.Duration = int(duration.Int64)
+	return &s, nil
+}
+
+// ClearSkipped forgets a skip once the video is let through
+func (d *Database) ClearSkipped(youtubeID string) error {
+	_, err := d.db.Exec("DELETE FROM skipped_videos WHERE youtube_id = ?", youtubeID)
+	return err
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PlaylistStats summarizes a playlist's videos and files
+type PlaylistStats struct {
+	YoutubeID   string    `json:"youtube_id,omitempty"`
+	Title       string    `json:"title"`
+	Videos      int       `json:"videos"`     // Videos whose file belongs to this playlist
+	Linked      int       `json:"linked"`     // Videos linked in from another playlist
+	Downloaded  int       `json:"downloaded"` // Videos with a file that wasn't found missing
+	Missing     int       `json:"missing"`
+	Failed      int       `json:"failed"`      // Videos that failed and haven't downloaded since
+	LowBitrate  int       `json:"low_bitrate"` // Files whose audio bitrate is below the threshold
+	SizeBytes   int64     `json:"size_bytes"`  // Linked files aren't counted again
+	Duration    int64     `json:"duration"`    // Seconds
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// LibraryStats is the per-playlist breakdown of the library and its totals
+type LibraryStats struct {
+	Playlists []PlaylistStats `json:"playlists"`
+	Total     PlaylistStats   `json:"total"`
+}
+
+// GetPlaylistStats summarizes every playlist with a few grouped queries.
+// Files with a probed audio bitrate below lowBitrate bits per second count
+// as LowBitrate.
+func (d *Database) GetPlaylistStats(lowBitrate int) (*LibraryStats, error) {
+	rows, err := d.db.Query(`
+		SELECT p.id, p.youtube_id, p.title, p.last_checked,
+			COUNT(v.id),
+			COALESCE(SUM(CASE WHEN v.file_path IS NOT NULL AND v.validation_status != 'missing' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN v.validation_status = 'missing' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN v.bitrate > 0 AND v.bitrate < ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(v.file_size), 0),
+			COALESCE(SUM(v.duration), 0)
+		FROM playlists p
+		LEFT JOIN videos v ON v.playlist_id = p.id
+		GROUP BY p.id
+		ORDER BY LOWER(p.title), p.id
+	`, lowBitrate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query playlist stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := &LibraryStats{Total: PlaylistStats{Title: "Total"}}
+	byID := make(map[int64]int)
+	byYoutubeID := make(map[string]int)
+	for rows.Next() {
+		var id int64
+		var s PlaylistStats
+		var lastChecked sql.NullTime
+		if err := rows.Scan(&id, &s.YoutubeID, &s.Title, &lastChecked, &s.Videos, &s.Downloaded, &s.Missing, &s.LowBitrate, &s.SizeBytes, &s.Duration); err != nil {
+			return nil, fmt.Errorf("failed to scan playlist stats: %w", err)
+		}
+		s.LastChecked = lastChecked.Time
+		byID[id] = len(stats.Playlists)
+		byYoutubeID[s.YoutubeID] = len(stats.Playlists)
+		stats.Playlists = append(stats.Playlists, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query playlist stats: %w", err)
+	}
+
+	links, err := d.db.Query("SELECT playlist_id, COUNT(*) FROM video_links GROUP BY playlist_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count linked videos: %w", err)
+	}
+	defer links.Close()
+	for links.Next() {
+		var id int64
+		var n int
+		if err := links.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan linked videos: %w", err)
+		}
+		if i, ok := byID[id]; ok {
+			stats.Playlists[i].Linked = n
+		}
+	}
+	if err := links.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count linked videos: %w", err)
+	}
+
+	failures, err := d.db.Query("SELECT playlist_youtube_id, COUNT(*) FROM download_failures WHERE playlist_youtube_id IS NOT NULL GROUP BY playlist_youtube_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count failed videos: %w", err)
+	}
+	defer failures.Close()
+	for failures.Next() {
+		var youtubeID string
+		var n int
+		if err := failures.Scan(&youtubeID, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan failed videos: %w", err)
+		}
+		if i, ok := byYoutubeID[youtubeID]; ok {
+			stats.Playlists[i].Failed = n
+		}
+	}
+	if err := failures.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count failed videos: %w", err)
+	}
+
+	t := &stats.Total
+	for _, s := range stats.Playlists {
+		t.Videos += s.Videos
+		t.Linked += s.Linked
+		t.Downloaded += s.Downloaded
+		t.Missing += s.Missing
+		t.Failed += s.Failed
+		t.LowBitrate += s.LowBitrate
+		t.SizeBytes += s.SizeBytes
+		t.Duration += s.Duration
+		if s.LastChecked.After(t.LastChecked) {
+			t.LastChecked = s.LastChecked
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPlaylistStats(t *testing.T) {
+	db := newBatchTestDB(t)
+	_, err := db.GetOrCreatePlaylist("PL_EMPTY", "Empty")
+	require.NoError(t, err)
+
+	records := []DownloadRecord{syntheticRecord(1), syntheticRecord(2), syntheticRecord(3)}
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", records))
+	_, err = db.db.Exec("UPDATE videos SET validation_status = 'missing' WHERE youtube_id = 'vid00002'")
+	require.NoError(t, err)
+	require.NoError(t, db.AddVideoLink("vid00001", "PL_EMPTY", "/music/empty/Track 1.mp3", "hardlink"))
+	require.NoError(t, db.RecordDownloadFailure("failing0001", "PL_BATCH", "timed out", false))
+
+	stats, err := db.GetPlaylistStats(0)
+	require.NoError(t, err)
+	require.Len(t, stats.Playlists, 2)
+
+	batch := stats.Playlists[0]
+	assert.Equal(t, "Batch", batch.Title)
+	assert.Equal(t, 3, batch.Videos)
+	assert.Equal(t, 2, batch.Downloaded)
+	assert.Equal(t, 1, batch.Missing)
+	assert.Equal(t, 1, batch.Failed)
+	assert.Equal(t, int64(3*(4<<20)), batch.SizeBytes)
+	assert.Equal(t, int64(3*180), batch.Duration)
+
+	empty := stats.Playlists[1]
+	assert.Equal(t, 0, empty.Videos)
+	assert.Equal(t, 1, empty.Linked)
+	assert.Zero(t, empty.SizeBytes, "Linked files aren't counted twice")
+
+	assert.Equal(t, 3, stats.Total.Videos)
+	assert.Equal(t, 1, stats.Total.Linked)
+	assert.Equal(t, batch.SizeBytes, stats.Total.SizeBytes)
+	assert.False(t, stats.Total.LastChecked.IsZero())
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// Statuses for GetVideosByStatus. All but StatusFailed are validation
+// statuses of recorded videos.
+const (
+	StatusPending = "pending" // Recorded, but no file yet
+	StatusValid   = "valid"
+	StatusMissing = "missing"
+	StatusCorrupt = "corrupt"
+	StatusError   = "error"    // The file couldn't be checked
+	StatusFailed  = "failed"   // Failed to download and not downloaded since
+	StatusArchive = "archived" // Imported from a yt-dlp archive
+)
+
+// videoStatuses are the statuses GetVideosByStatus accepts
+var videoStatuses = map[string]bool{
+	StatusPending: true, StatusValid: true, StatusMissing: true, StatusCorrupt: true,
+	StatusError: true, StatusFailed: true, StatusArchive: true,
+}
+
+// GetVideosByStatus lists videos with the given status. Failed videos are
+// the ones in download_failures; those never downloaded have no row in
+// videos, so only their ID, playlist and failure details are set.
+func (d *Database) GetVideosByStatus(status string) ([]Video, error) {
+	if !videoStatuses[status] {
+		return nil, fmt.Errorf("unknown video status %q", status)
+	}
+	if status == StatusFailed {
+		return d.getFailedVideoRows()
+	}
+
+	rows, err := d.db.Query(`
+		SELECT `+videoColumns+`
+		FROM videos v
+		JOIN playlists p ON p.id = v.playlist_id
+		WHERE COALESCE(v.validation_status, 'pending') = ?
+		ORDER BY v.youtube_id`, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s videos: %w", status, err)
+	}
+	defer rows.Close()
+	return d.scanVideos(rows)
+}
+
+// SetValidationStatus records the outcome of a check made outside
+// ValidateFiles, such as the validator's duration probe, with the reason
+// the file failed it, if it did
+func (d *Database) SetValidationStatus(youtubeID, status, reason string) error {
+	if !videoStatuses[status] || status == StatusFailed {
+		return fmt.Errorf("unknown validation status %q", status)
+	}
+	now := dbNow()
+	_, err := d.db.Exec(
+		"UPDATE videos SET validation_status = ?, validation_error = NULLIF(?, ''), last_validated = ?, updated_at = ? WHERE youtube_id = ?",
+		status, reason, now, now, youtubeID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set validation status of %s: %w", youtubeID, err)
+	}
+	return nil
+}
+
+// GetStatusCounts counts recorded videos by validation status
+func (d *Database) GetStatusCounts() (map[string]int, error) {
+	rows, err := d.db.Query("SELECT COALESCE(validation_status, 'pending'), COUNT(*) FROM videos GROUP BY 1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count videos by status: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// getFailedVideoRows lists every video in download_failures
+func (d *Database) getFailedVideoRows() ([]Video, error) {
+	rows, err := d.db.Query(`
+		SELECT ` + videoColumns + `
+		FROM videos v
+		JOIN playlists p ON p.id = v.playlist_id
+		WHERE v.youtube_id IN (SELECT youtube_id FROM download_failures)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed videos: %w", err)
+	}
+	defer rows.Close()
+	videos, err := d.scanVideos(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = d.db.Query(`
+		SELECT f.youtube_id, COALESCE(f.playlist_youtube_id, ''), f.attempts, COALESCE(f.last_error, ''), f.last_attempt_at
+		FROM download_failures f
+		WHERE f.youtube_id NOT IN (SELECT youtube_id FROM videos)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed videos: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		v := Video{ValidationStatus: StatusFailed}
+		var lastAttempt sql.NullTime
+		if err := rows.Scan(&v.YoutubeID, &v.PlaylistYoutubeID, &v.RetryCount, &v.LastError, &lastAttempt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		v.LastAttemptedAt = lastAttempt.Time
+		videos = append(videos, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	sort.Slice(videos, func(i, j int) bool { return videos[i].YoutubeID < videos[j].YoutubeID })
+	return videos, nil
+}
+
+// PlaylistStatusCounts is how many of a playlist's videos have each status
+type PlaylistStatusCounts struct {
+	YoutubeID string         `json:"youtube_id"`
+	Title     string         `json:"title"`
+	Counts    map[string]int `json:"counts"`
+}
+
+// GetPlaylistStatusCounts counts the videos of every playlist by status,
+// including videos linked in from another playlist
+func (d *Database) GetPlaylistStatusCounts() ([]PlaylistStatusCounts, error) {
+	rows, err := d.db.Query(`
+		SELECT p.youtube_id, p.title, COALESCE(v.validation_status, 'pending'), COUNT(v.id)
+		FROM playlists p
+		LEFT JOIN playlist_videos pv ON pv.playlist_id = p.id
+		LEFT JOIN videos v ON v.id = pv.video_id
+		GROUP BY p.id, COALESCE(v.validation_status, 'pending')
+		ORDER BY LOWER(p.title), p.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count videos by status: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []PlaylistStatusCounts
+	byYoutubeID := make(map[string]int)
+	for rows.Next() {
+		var youtubeID, title, status string
+		var n int
+		if err := rows.Scan(&youtubeID, &title, &status, &n); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		i, ok := byYoutubeID[youtubeID]
+		if !ok {
+			i = len(counts)
+			byYoutubeID[youtubeID] = i
+			counts = append(counts, PlaylistStatusCounts{YoutubeID: youtubeID, Title: title, Counts: make(map[string]int)})
+		}
+		if n > 0 {
+			counts[i].Counts[status] = n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	failures, err := d.db.Query("SELECT playlist_youtube_id, COUNT(*) FROM download_failures WHERE playlist_youtube_id IS NOT NULL GROUP BY playlist_youtube_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count failed videos: %w", err)
+	}
+	defer failures.Close()
+	for failures.Next() {
+		var youtubeID string
+		var n int
+		if err := failures.Scan(&youtubeID, &n); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if i, ok := byYoutubeID[youtubeID]; ok {
+			counts[i].Counts[StatusFailed] = n
+		}
+	}
+	return counts, failures.Err()
+}
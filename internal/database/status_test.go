@@ -0,0 +1,56 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetVideosByStatus(t *testing.T) {
+	db := newBatchTestDB(t)
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", []DownloadRecord{syntheticRecord(1), syntheticRecord(2)}))
+	_, err := db.db.Exec("UPDATE videos SET validation_status = 'missing' WHERE youtube_id = 'vid00002'")
+	require.NoError(t, err)
+	require.NoError(t, db.AddVideo("pending1", "PL_BATCH", "Batch", VideoMetadata{Title: "Pending"}))
+
+	// A failure of a recorded video and of one never downloaded
+	attempted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"pending1", "neverhad"} {
+		require.NoError(t, db.RecordDownloadFailure(id, "PL_BATCH", "HTTP Error 403", false))
+		require.NoError(t, db.RecordDownloadAttempt(DownloadAttempt{YoutubeID: id, AttemptedAt: attempted, ErrorMessage: "HTTP Error 403"}))
+	}
+
+	ids := func(status string) []string {
+		videos, err := db.GetVideosByStatus(status)
+		require.NoError(t, err)
+		var ids []string
+		for _, v := range videos {
+			ids = append(ids, v.YoutubeID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"vid00001"}, ids(StatusValid))
+	assert.Equal(t, []string{"vid00002"}, ids(StatusMissing))
+	assert.Equal(t, []string{"pending1"}, ids(StatusPending))
+	assert.Empty(t, ids(StatusCorrupt))
+	assert.Equal(t, []string{"neverhad", "pending1"}, ids(StatusFailed))
+
+	failed, err := db.GetVideosByStatus(StatusFailed)
+	require.NoError(t, err)
+	assert.Equal(t, "PL_BATCH", failed[0].PlaylistYoutubeID)
+	assert.Equal(t, 1, failed[0].RetryCount)
+	assert.Equal(t, "HTTP Error 403", failed[0].LastError)
+	assert.Equal(t, 1, failed[1].RetryCount)
+	assert.Equal(t, "HTTP Error 403", failed[1].LastError)
+	assert.True(t, attempted.Equal(failed[1].LastAttemptedAt), "got %v", failed[1].LastAttemptedAt)
+
+	_, err = db.GetVideosByStatus("broken")
+	assert.Error(t, err)
+
+	counts, err := db.GetPlaylistStatusCounts()
+	require.NoError(t, err)
+	require.Len(t, counts, 1)
+	assert.Equal(t, map[string]int{StatusValid: 1, StatusMissing: 1, StatusPending: 1, StatusFailed: 2}, counts[0].Counts)
+}
@@ -0,0 +1,57 @@
+package database
+
+import "fmt"
+
+// PlaylistStorage is the disk space a playlist's videos take up
+type PlaylistStorage struct {
+	YoutubeID string `json:"youtube_id"`
+	Title     string `json:"title"`
+	Videos    int    `json:"videos"` // Videos with a file
+	Bytes     int64  `json:"bytes"`
+}
+
+// StorageStats is the disk space used by the library
+type StorageStats struct {
+	Videos    int               `json:"videos"`
+	Bytes     int64             `json:"bytes"` // Each file counted once
+	Playlists []PlaylistStorage `json:"playlists"`
+}
+
+// GetStorageStats adds up file sizes per playlist, largest first. A video
+// in several playlists counts towards each of them but only once in the
+// totals.
+func (d *Database) GetStorageStats() (*StorageStats, error) {
+	stats := &StorageStats{}
+	err := d.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(file_size), 0)
+		FROM videos
+		WHERE COALESCE(file_path, '') != ''
+	`).Scan(&stats.Videos, &stats.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query storage totals: %w", err)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT p.youtube_id, p.title, COUNT(v.id), COALESCE(SUM(v.file_size), 0)
+		FROM playlists p
+		LEFT JOIN playlist_videos pv ON pv.playlist_id = p.id
+		LEFT JOIN videos v ON v.id = pv.video_id AND COALESCE(v.file_path, '') != ''
+		GROUP BY p.id
+		ORDER BY 4 DESC, LOWER(p.title)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query playlist storage: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s PlaylistStorage
+		if err := rows.Scan(&s.YoutubeID, &s.Title, &s.Videos, &s.Bytes); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		stats.Playlists = append(stats.Playlists, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return stats, nil
+}
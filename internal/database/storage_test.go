@@ -0,0 +1,32 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStorageStats(t *testing.T) {
+	db := newBatchTestDB(t)
+	_, err := db.GetOrCreatePlaylist("PL_SMALL", "Small")
+	require.NoError(t, err)
+	_, err = db.GetOrCreatePlaylist("PL_EMPTY", "Empty")
+	require.NoError(t, err)
+
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", []DownloadRecord{syntheticRecord(1), syntheticRecord(2)}))
+	require.NoError(t, db.RecordDownload("PL_SMALL", "Small", syntheticRecord(3)))
+	// Shared with PL_BATCH, and a video without a file
+	require.NoError(t, db.AddVideo("vid00001", "PL_SMALL", "Small", VideoMetadata{Title: "Track 1"}))
+	require.NoError(t, db.AddVideo("pending", "PL_SMALL", "Small", VideoMetadata{Title: "Pending"}))
+
+	stats, err := db.GetStorageStats()
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Videos)
+	assert.Equal(t, int64(3*(4<<20)), stats.Bytes, "Shared files are counted once")
+	assert.Equal(t, []PlaylistStorage{
+		{YoutubeID: "PL_BATCH", Title: "Batch", Videos: 2, Bytes: 2 * (4 << 20)},
+		{YoutubeID: "PL_SMALL", Title: "Small", Videos: 2, Bytes: 2 * (4 << 20)},
+		{YoutubeID: "PL_EMPTY", Title: "Empty"},
+	}, stats.Playlists)
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeFormat is how every timestamp is stored: UTC, in the same form as
+// SQLite's CURRENT_TIMESTAMP and datetime(), so stored values compare
+// correctly against both as plain strings
+const timeFormat = "2006-01-02 15:04:05"
+
+// dbTime formats t for storage; the zero time is stored as NULL
+func dbTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(timeFormat)
+}
+
+// dbNow returns the current time formatted for storage
+func dbNow() string {
+	return time.Now().UTC().Format(timeFormat)
+}
+
+// normalizeTimestamps rewrites a table's timestamp columns, as written by
+// older versions in RFC3339 or Go's own format with any time zone, into
+// timeFormat. Zero times become NULL and values SQLite can't parse are
+// left alone.
+func normalizeTimestamps(table string, columns ...string) string {
+	sets := make([]string, len(columns))
+	for i, c := range columns {
+		sets[i] = fmt.Sprintf(`%[1]s = CASE
+				WHEN typeof(%[1]s) != 'text' THEN %[1]s
+				WHEN %[1]s LIKE '0001-01-01%%' THEN NULL
+				ELSE COALESCE(strftime('%%Y-%%m-%%d %%H:%%M:%%S', %[1]s), %[1]s)
+			END`, c)
+	}
+	return "UPDATE " + table + " SET " + strings.Join(sets, ",\n\t\t\t")
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBTime(t *testing.T) {
+	local := time.Date(2024, 3, 1, 2, 30, 0, 500, time.FixedZone("UTC+5", 5*60*60))
+	assert.Equal(t, "2024-02-29 21:30:00", dbTime(local))
+	assert.Nil(t, dbTime(time.Time{}))
+}
+
+func TestTimestampsCompareAcrossWritePaths(t *testing.T) {
+	dir := t.TempDir()
+	db := newBatchTestDB(t)
+
+	// Each write path: a bound Go time, CURRENT_TIMESTAMP, and ValidateFiles
+	for i := 1; i <= 3; i++ {
+		path := filepath.Join(dir, syntheticRecord(i).YoutubeID+".mp3")
+		require.NoError(t, os.WriteFile(path, []byte("audio"), 0644))
+		record := syntheticRecord(i)
+		record.FilePath = path
+		require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", []DownloadRecord{record}))
+	}
+	require.NoError(t, db.UpdateFileInfo("vid00002", filepath.Join(dir, "vid00002.mp3"), 5, ""))
+	_, err := db.ValidateFiles()
+	require.NoError(t, err)
+
+	due, err := db.GetVideosNeedingValidation(time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, due, "Just validated")
+
+	_, err = db.db.Exec("UPDATE videos SET last_validated = ? WHERE youtube_id = 'vid00001'", dbTime(time.Now().Add(-2*time.Hour)))
+	require.NoError(t, err)
+	due, err = db.GetVideosNeedingValidation(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vid00001"}, due)
+
+	lastChecked, err := db.GetLastChecked("PL_BATCH")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, lastChecked.Location())
+	assert.WithinDuration(t, time.Now(), lastChecked, time.Minute)
+}
+
+func TestMigrationNormalizesTimestamps(t *testing.T) {
+	skipOnPostgres(t, "Postgres databases never held timestamps in the old formats")
+	dbPath := filepath.Join(t.TempDir(), "timestamps.db")
+	db, err := openTestDB(t, dbPath)
+	require.NoError(t, err)
+	_, err = db.GetOrCreatePlaylist("PL_BATCH", "Batch")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", []DownloadRecord{syntheticRecord(1), syntheticRecord(2), syntheticRecord(3)}))
+
+	// Formats older versions wrote, which compare wrongly as strings
+	plus5 := time.FixedZone("UTC+5", 5*60*60)
+	recentRFC3339 := time.Now().Add(-30 * time.Minute).UTC().Format(time.RFC3339)                            // "T" sorts after " "
+	staleOffset := time.Now().Add(-90 * time.Minute).In(plus5).Format("2006-01-02 15:04:05.999999999-07:00") // Hours ahead of UTC
+	checked := time.Date(2024, 3, 1, 12, 0, 0, 0, plus5)
+	for id, value := range map[string]string{"vid00001": recentRFC3339, "vid00002": staleOffset} {
+		_, err = db.db.Exec("UPDATE videos SET last_validated = ?, upload_date = '0001-01-01 00:00:00+00:00' WHERE youtube_id = ?", value, id)
+		require.NoError(t, err)
+	}
+	_, err = db.db.Exec("UPDATE videos SET last_validated = NULL WHERE youtube_id = 'vid00003'")
+	require.NoError(t, err)
+	_, err = db.db.Exec("UPDATE playlists SET last_checked = ? WHERE youtube_id = 'PL_BATCH'", checked.Format(time.RFC3339))
+	require.NoError(t, err)
+	forgetMigrations(t, db, 17)
+	require.NoError(t, db.Close())
+
+	db, err = openTestDB(t, dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	due, err := db.GetVideosNeedingValidation(time.Hour)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"vid00002", "vid00003"}, due)
+
+	lastChecked, err := db.GetLastChecked("PL_BATCH")
+	require.NoError(t, err)
+	assert.True(t, checked.Equal(lastChecked), "got %v", lastChecked)
+	assert.Equal(t, time.UTC, lastChecked.Location())
+
+	var stored string
+	require.NoError(t, db.db.QueryRow("SELECT CAST(last_checked AS TEXT) FROM playlists WHERE youtube_id = 'PL_BATCH'").Scan(&stored))
+	assert.Equal(t, "2024-03-01 07:00:00", stored)
+
+	var nullDates int
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM videos WHERE upload_date IS NULL").Scan(&nullDates))
+	assert.Equal(t, 2, nullDates, "Zero times become NULL")
+}
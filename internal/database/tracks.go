@@ -0,0 +1,77 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Track is one chapter of a video that was split into separate files
+type Track struct {
+	Number   int    `json:"number"`
+	Title    string `json:"title"`
+	FilePath string `json:"file_path"`
+	FileSize int64  `json:"file_size"`
+}
+
+// SetVideoTracks replaces the chapter tracks recorded for a video
+func (d *Database) SetVideoTracks(youtubeID string, tracks []Track) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setVideoTracks(tx, d.root, youtubeID, tracks, dbNow()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setVideoTracks replaces a video's tracks within an existing transaction
+func setVideoTracks(tx *sql.Tx, root libraryRoot, youtubeID string, tracks []Track, now string) error {
+	var videoID int64
+	if err := tx.QueryRow("SELECT id FROM videos WHERE youtube_id = ?", youtubeID).Scan(&videoID); err != nil {
+		return fmt.Errorf("failed to find video %s: %w", youtubeID, err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM video_tracks WHERE video_id = ?", videoID); err != nil {
+		return fmt.Errorf("failed to clear tracks: %w", err)
+	}
+
+	for _, t := range tracks {
+		_, err := tx.Exec(`
+			INSERT INTO video_tracks (video_id, track_number, title, file_path, file_size, validation_status, last_validated)
+			VALUES (?, ?, ?, ?, ?, 'valid', ?)
+		`, videoID, t.Number, t.Title, root.store(t.FilePath), t.FileSize, now)
+		if err != nil {
+			return fmt.Errorf("failed to insert track %d of %s: %w", t.Number, youtubeID, err)
+		}
+	}
+	return nil
+}
+
+// GetVideoTracks returns a video's chapter tracks in order, or nil if it wasn't split
+func (d *Database) GetVideoTracks(youtubeID string) ([]Track, error) {
+	rows, err := d.db.Query(`
+		SELECT t.track_number, t.title, t.file_path, t.file_size
+		FROM video_tracks t
+		JOIN videos v ON v.id = t.video_id
+		WHERE v.youtube_id = ?
+		ORDER BY t.track_number
+	`, youtubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tracks: %w", err)
+	}
+	defer rows.Close()
+
+	var tracks []Track
+	for rows.Next() {
+		var t Track
+		if err := rows.Scan(&t.Number, &t.Title, &t.FilePath, &t.FileSize); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		t.FilePath = d.root.resolve(t.FilePath)
+		tracks = append(tracks, t)
+	}
+	return tracks, rows.Err()
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVideoTracks(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "tracks.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.AddVideo("vid1", "PL_A", "A", VideoMetadata{Title: "mix", Channel: "chan", UploadDate: time.Now()}))
+
+	intro := filepath.Join(dir, "mix", "01 - Intro.mp3")
+	require.NoError(t, os.MkdirAll(filepath.Dir(intro), 0755))
+	require.NoError(t, os.WriteFile(intro, []byte("audio"), 0644))
+	tracks := []Track{
+		{Number: 1, Title: "Intro", FilePath: intro, FileSize: 5},
+		{Number: 2, Title: "Outro", FilePath: filepath.Join(dir, "mix", "02 - Outro.mp3"), FileSize: 5},
+	}
+	require.NoError(t, db.SetVideoTracks("vid1", tracks))
+
+	got, err := db.GetVideoTracks("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, tracks, got)
+
+	// Setting tracks again replaces the old ones
+	require.NoError(t, db.SetVideoTracks("vid1", tracks[:1]))
+	got, err = db.GetVideoTracks("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, tracks[:1], got)
+
+	checked, err := db.ValidateFiles()
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
+
+	assert.Error(t, db.SetVideoTracks("unknown", tracks), "Tracks need a recorded video")
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Where a video's files are kept once uploads are on. Videos never queued
+// for upload have no storage location and are only local.
+const (
+	StorageLocal  = "local"  // Waiting to be uploaded
+	StorageRemote = "remote" // Uploaded, and the local copy deleted
+	StorageBoth   = "both"   // Uploaded, and kept locally too
+)
+
+// QueueUpload marks a downloaded video as waiting to be uploaded, so the
+// upload survives a restart
+func (d *Database) QueueUpload(youtubeID string) error {
+	return d.SetStorageLocation(youtubeID, StorageLocal)
+}
+
+// SetStorageLocation records where a video's files are kept
+func (d *Database) SetStorageLocation(youtubeID, location string) error {
+	_, err := d.db.Exec("UPDATE videos SET storage_location = ?, updated_at = CURRENT_TIMESTAMP WHERE youtube_id = ?", location, youtubeID)
+	if err != nil {
+		return fmt.Errorf("failed to set storage location: %w", err)
+	}
+	return nil
+}
+
+// GetStorageLocation returns where a video's files are kept, or an empty
+// string if it was never queued for upload or isn't recorded
+func (d *Database) GetStorageLocation(youtubeID string) (string, error) {
+	var location string
+	err := d.db.QueryRow("SELECT COALESCE(storage_location, '') FROM videos WHERE youtube_id = ?", youtubeID).Scan(&location)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get storage location: %w", err)
+	}
+	return location, nil
+}
+
+// PendingUploads returns the videos waiting to be uploaded, oldest download
+// first
+func (d *Database) PendingUploads() ([]string, error) {
+	rows, err := d.db.Query("SELECT youtube_id FROM videos WHERE storage_location = ? ORDER BY downloaded_at, id", StorageLocal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,410 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultValidateWorkers = 4
+	validateBatchSize      = 500 // Status updates per transaction
+
+	// readCheckSize is how much of each file is read to prove it's readable
+	readCheckSize = 4 << 10
+
+	// Files smaller than their recorded size divided by this are corrupt
+	undersizedRatio = 2
+)
+
+// ReasonChecksumMismatch is the validation error of files that no longer
+// match their stored checksum
+const ReasonChecksumMismatch = "checksum mismatch"
+
+// ValidateFiles checks the existence of all downloaded files and updates their status
+// Returns the number of files checked and any error encountered
+func (d *Database) ValidateFiles() (int, error) {
+	return d.ValidateFilesWithOptions(context.Background(), ValidateOptions{})
+}
+
+// ValidateFilesWithChecksums is ValidateFiles, but also re-hashes every file
+// with a stored checksum and marks mismatches as corrupt. This reads every
+// file in full, so it is much slower.
+func (d *Database) ValidateFilesWithChecksums() (int, error) {
+	return d.ValidateFilesWithOptions(context.Background(), ValidateOptions{VerifyChecksums: true})
+}
+
+// ValidateOptions tunes a validation pass
+type ValidateOptions struct {
+	// VerifyChecksums re-hashes files with a stored checksum and marks
+	// mismatches as corrupt. Files re-hashed within VerifyMaxAge are only
+	// checked to exist, so an interrupted pass picks up where it stopped.
+	VerifyChecksums bool
+	VerifyMaxAge    time.Duration
+
+	MaxBytesPerSecond int64 // Caps hashing throughput across workers; 0 means unthrottled
+	ProgressEvery     int   // Log progress after this many files; 0 means never
+	Workers           int   // Files checked at once; 0 means 4
+
+	// YoutubeIDs limits the pass to these videos and their links and
+	// tracks; nil means every video
+	YoutubeIDs []string
+
+	// StatRemote returns the size of the uploaded copy of a file, or an
+	// error wrapping fs.ErrNotExist when there is none. Files only kept
+	// remotely aren't looked for locally; with VerifyChecksums their
+	// uploaded copy is checked with StatRemote, when set.
+	StatRemote func(ctx context.Context, path string) (int64, error)
+}
+
+// fileCheck is one file a validation pass looks at: a video's file, a
+// playlist link or a chapter track
+type fileCheck struct {
+	table     string // Table holding the row
+	id        int64
+	youtubeID string
+	stored    string // file_path or link_path as stored
+	path      string // Resolved path
+	size      int64  // Recorded size; 0 for links
+	remote    bool   // Only kept remotely
+
+	checksum     string // Only set for videos
+	lastVerified sql.NullTime
+
+	status   string // Empty when the check was interrupted
+	reason   string // Why the file isn't valid
+	verified bool   // Re-hashed by this pass
+	hashed   int64
+}
+
+// ValidateFilesWithOptions checks every downloaded file, playlist link and
+// chapter track, or those of opts.YoutubeIDs, and updates their status.
+// Files are checked by a pool of workers outside any transaction, and the
+// results are saved in short transactions, so a slow pass over network
+// storage doesn't block downloads from being recorded. A cancelled pass
+// still saves the statuses of the files it got to.
+func (d *Database) ValidateFilesWithOptions(ctx context.Context, opts ValidateOptions) (int, error) {
+	var only map[string]bool
+	if opts.YoutubeIDs != nil {
+		only = make(map[string]bool, len(opts.YoutubeIDs))
+		for _, id := range opts.YoutubeIDs {
+			only[id] = true
+		}
+	}
+	checks, err := d.loadFileChecks(only)
+	if err != nil {
+		return 0, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultValidateWorkers
+	}
+	limit := newThrottle(opts.MaxBytesPerSecond)
+	jobs := make(chan int)
+	done := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() == nil {
+					checks[i].check(ctx, opts, limit)
+				}
+				done <- i
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range checks {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var checked, missing, corrupt int
+	var hashed int64
+	start := time.Now()
+	for i := range done {
+		c := &checks[i]
+		if c.status == "" {
+			continue
+		}
+		checked++
+		hashed += c.hashed
+		switch c.status {
+		case StatusMissing:
+			missing++
+		case StatusCorrupt:
+			corrupt++
+		}
+		if c.reason != "" {
+			d.logger.Warn("Validation failed", "video_id", c.youtubeID, "path", c.path, "status", c.status, "reason", c.reason)
+		}
+		if opts.ProgressEvery > 0 && checked%opts.ProgressEvery == 0 {
+			d.logger.Info("Validating files", "checked", checked, "total", len(checks), "missing", missing, "corrupt", corrupt,
+				"bytes_hashed", hashed, "elapsed", time.Since(start).Round(time.Second))
+		}
+	}
+
+	now := dbNow()
+	for start := 0; start < len(checks); start += validateBatchSize {
+		end := min(start+validateBatchSize, len(checks))
+		if err := d.saveFileChecks(checks[start:end], now); err != nil {
+			return checked, err
+		}
+	}
+
+	d.logger.Info("Validated files", "checked", checked, "missing", missing, "corrupt", corrupt)
+	return checked, ctx.Err()
+}
+
+// loadFileChecks lists the files to validate, limited to the videos in only
+// when it isn't nil
+func (d *Database) loadFileChecks(only map[string]bool) ([]fileCheck, error) {
+	rows, err := d.db.Query(`
+		SELECT 'videos', id, youtube_id, file_path, COALESCE(file_size, 0), COALESCE(file_checksum, ''), last_verified,
+			COALESCE(storage_location, '') = ?
+		FROM videos
+		WHERE COALESCE(file_path, '') != ''
+		UNION ALL
+		SELECT 'video_links', l.id, v.youtube_id, l.link_path, 0, '', CAST(NULL AS TIMESTAMP), FALSE
+		FROM video_links l
+		JOIN videos v ON v.id = l.video_id
+		UNION ALL
+		SELECT 'video_tracks', t.id, v.youtube_id, t.file_path, COALESCE(t.file_size, 0), '', CAST(NULL AS TIMESTAMP),
+			COALESCE(v.storage_location, '') = ?
+		FROM video_tracks t
+		JOIN videos v ON v.id = t.video_id
+	`, StorageRemote, StorageRemote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files to validate: %w", err)
+	}
+	defer rows.Close()
+
+	var checks []fileCheck
+	for rows.Next() {
+		var c fileCheck
+		if err := rows.Scan(&c.table, &c.id, &c.youtubeID, &c.stored, &c.size, &c.checksum, &c.lastVerified, &c.remote); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if only != nil && !only[c.youtubeID] {
+			continue
+		}
+		c.path = d.root.resolve(c.stored)
+		checks = append(checks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return checks, nil
+}
+
+// check stats the file and reads its start, or re-hashes it when opts asks
+// for it and it hasn't been verified recently. Empty, undersized and
+// unreadable files are corrupt, so they're downloaded again.
+func (c *fileCheck) check(ctx context.Context, opts ValidateOptions, limit *throttle) {
+	if c.remote {
+		c.checkRemote(ctx, opts)
+		return
+	}
+
+	// Stat follows symlinks, so a dangling symlink counts as missing
+	info, err := os.Stat(c.path)
+	switch {
+	case os.IsNotExist(err):
+		c.status = StatusMissing
+		return
+	case err != nil:
+		c.fail(StatusError, err.Error())
+		return
+	case info.Size() == 0:
+		c.fail(StatusCorrupt, "empty file")
+		return
+	case c.size > 0 && info.Size() < c.size/undersizedRatio:
+		c.fail(StatusCorrupt, fmt.Sprintf("file is %d bytes, expected %d", info.Size(), c.size))
+		return
+	}
+
+	if !opts.VerifyChecksums || c.checksum == "" ||
+		(c.lastVerified.Valid && time.Since(c.lastVerified.Time) < opts.VerifyMaxAge) {
+		if err := readStart(c.path); err != nil {
+			c.fail(StatusCorrupt, "unreadable: "+err.Error())
+			return
+		}
+		c.status = StatusValid
+		return
+	}
+
+	actual, err := fileChecksum(ctx, c.path, limit)
+	switch {
+	case ctx.Err() != nil:
+		// Interrupted mid-file; leave it for the next pass
+		return
+	case errors.Is(err, fs.ErrPermission):
+		c.fail(StatusCorrupt, "unreadable: "+err.Error())
+	case err != nil:
+		c.fail(StatusError, err.Error())
+	case actual != c.checksum:
+		c.fail(StatusCorrupt, ReasonChecksumMismatch)
+		c.verified = true
+	default:
+		c.status = StatusValid
+		c.verified = true
+	}
+	c.hashed = info.Size()
+}
+
+// checkRemote checks a file only kept remotely. Its uploaded copy can't be
+// hashed, so deep passes only make sure it's still there and whole.
+func (c *fileCheck) checkRemote(ctx context.Context, opts ValidateOptions) {
+	if !opts.VerifyChecksums || opts.StatRemote == nil {
+		c.status = StatusValid
+		return
+	}
+	size, err := opts.StatRemote(ctx, c.path)
+	switch {
+	case ctx.Err() != nil:
+		return
+	case errors.Is(err, fs.ErrNotExist):
+		c.status = StatusMissing
+	case err != nil:
+		c.fail(StatusError, err.Error())
+	case size == 0:
+		c.fail(StatusCorrupt, "empty remote copy")
+	case c.size > 0 && size < c.size/undersizedRatio:
+		c.fail(StatusCorrupt, fmt.Sprintf("remote copy is %d bytes, expected %d", size, c.size))
+	default:
+		c.status = StatusValid
+	}
+}
+
+// fail records why the file isn't valid; it's logged once the check is
+// collected
+func (c *fileCheck) fail(status, reason string) {
+	c.status = status
+	c.reason = reason
+}
+
+// readStart reads the first few KB of a file, catching files that exist but
+// can't be read, e.g. after their owner changed
+func readStart(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.ReadFull(f, make([]byte, readCheckSize)); err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return nil
+}
+
+// saveFileChecks records the results of one batch of checks. Rows whose
+// path changed while they were checked, e.g. by a re-download, keep their
+// new status.
+func (d *Database) saveFileChecks(checks []fileCheck, now string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, c := range checks {
+		if c.status == "" {
+			continue
+		}
+		var err error
+		switch c.table {
+		case "videos":
+			_, err = tx.Exec(`
+				UPDATE videos
+				SET validation_status = ?,
+				    validation_error = NULLIF(?, ''),
+				    last_validated = ?,
+				    last_verified = CASE WHEN ? THEN ? ELSE last_verified END,
+				    updated_at = ?
+				WHERE id = ? AND file_path = ?`,
+				c.status, c.reason, now, c.verified, now, now, c.id, c.stored,
+			)
+		case "video_links":
+			_, err = tx.Exec("UPDATE video_links SET validation_status = ?, last_validated = ? WHERE id = ? AND link_path = ?",
+				c.status, now, c.id, c.stored)
+		case "video_tracks":
+			_, err = tx.Exec("UPDATE video_tracks SET validation_status = ?, last_validated = ? WHERE id = ? AND file_path = ?",
+				c.status, now, c.id, c.stored)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update validation status of %s: %w", c.path, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// VerifiedSince reports whether any file was re-hashed at or after t
+func (d *Database) VerifiedSince(t time.Time) (bool, error) {
+	var verified bool
+	err := d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM videos WHERE last_verified >= ?)", dbTime(t)).Scan(&verified)
+	if err != nil {
+		return false, fmt.Errorf("failed to check when files were last verified: %w", err)
+	}
+	return verified, nil
+}
+
+// CountVerifiable returns how many downloaded videos have a stored checksum
+func (d *Database) CountVerifiable() (int, error) {
+	var n int
+	err := d.db.QueryRow(`
+		SELECT COUNT(*) FROM videos
+		WHERE COALESCE(file_path, '') != '' AND COALESCE(file_checksum, '') != ''
+	`).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count files with checksums: %w", err)
+	}
+	return n, nil
+}
+
+// SampleForVerification picks up to n videos with a stored checksum at
+// random. Each is weighted by how long ago it was last re-hashed, so files
+// never verified or verified longest ago are the likeliest picks.
+func (d *Database) SampleForVerification(n int) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT youtube_id FROM videos
+		WHERE COALESCE(file_path, '') != '' AND COALESCE(file_checksum, '') != ''
+		ORDER BY `+d.dialect.daysSince("COALESCE(last_verified, '2000-01-01')")+` * (1 + `+d.dialect.random(1000)+`) DESC
+		LIMIT ?
+	`, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample files to verify: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFilesConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "validate.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// More files than one batch of updates, every third one gone
+	n := validateBatchSize + 100
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("vid%d", i)
+		path := filepath.Join(dir, id+".mp3")
+		require.NoError(t, os.WriteFile(path, []byte(id), 0644))
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", VideoMetadata{Title: id}))
+		require.NoError(t, db.UpdateFileInfo(id, path, int64(len(id)), ""))
+		if i%3 == 0 {
+			require.NoError(t, os.Remove(path))
+		}
+	}
+	_, err = db.GetOrCreatePlaylist("PL_B", "B")
+	require.NoError(t, err)
+	link := filepath.Join(dir, "B", "vid1.mp3")
+	require.NoError(t, db.AddVideoLink("vid1", "PL_B", link, "symlink"))
+
+	// A cancelled pass checks nothing and leaves the statuses alone
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = db.ValidateFilesWithOptions(ctx, ValidateOptions{Workers: 8})
+	assert.ErrorIs(t, err, context.Canceled)
+	missing, err := db.GetVideosByStatus(StatusMissing)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+
+	checked, err := db.ValidateFilesWithOptions(context.Background(), ValidateOptions{Workers: 8})
+	require.NoError(t, err)
+	assert.Equal(t, n+1, checked)
+	missing, err = db.GetVideosByStatus(StatusMissing)
+	require.NoError(t, err)
+	assert.Len(t, missing, (n+2)/3)
+	var linkStatus string
+	require.NoError(t, db.db.QueryRow("SELECT validation_status FROM video_links").Scan(&linkStatus))
+	assert.Equal(t, StatusMissing, linkStatus)
+}
+
+func TestValidateFilesDetectsDamage(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "validate.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	add := func(id string, data []byte, recordedSize int64) string {
+		path := filepath.Join(dir, id+".mp3")
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", VideoMetadata{Title: id}))
+		require.NoError(t, db.UpdateFileInfo(id, path, recordedSize, ""))
+		return path
+	}
+	add("fine", make([]byte, 8<<10), 8<<10)
+	add("empty", nil, 8<<10)
+	add("cut", make([]byte, 1<<10), 8<<10)
+	locked := add("locked", make([]byte, 8<<10), 8<<10)
+	require.NoError(t, os.Chmod(locked, 0))
+
+	_, err = db.ValidateFiles()
+	require.NoError(t, err)
+
+	videos, err := db.ListVideos(ListOptions{})
+	require.NoError(t, err)
+	got := make(map[string]Video)
+	for _, v := range videos {
+		got[v.YoutubeID] = v
+	}
+	assert.Equal(t, StatusValid, got["fine"].ValidationStatus)
+	assert.Empty(t, got["fine"].ValidationError)
+	assert.Equal(t, StatusCorrupt, got["empty"].ValidationStatus)
+	assert.Equal(t, "empty file", got["empty"].ValidationError)
+	assert.Equal(t, StatusCorrupt, got["cut"].ValidationStatus)
+	assert.Equal(t, "file is 1024 bytes, expected 8192", got["cut"].ValidationError)
+	// Root reads files whatever their permissions
+	if os.Geteuid() != 0 {
+		assert.Equal(t, StatusCorrupt, got["locked"].ValidationStatus)
+		assert.Contains(t, got["locked"].ValidationError, "unreadable")
+	}
+
+	// A replaced file clears the reason
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "empty.mp3"), make([]byte, 8<<10), 0644))
+	_, err = db.ValidateFiles()
+	require.NoError(t, err)
+	videos, err = db.ListVideos(ListOptions{})
+	require.NoError(t, err)
+	for _, v := range videos {
+		if v.YoutubeID == "empty" {
+			assert.Equal(t, StatusValid, v.ValidationStatus)
+			assert.Empty(t, v.ValidationError)
+		}
+	}
+}
+
+func TestValidateFilesRemoteOnly(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "validate.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Uploaded and deleted locally
+	for _, id := range []string{"gone", "kept", "empty"} {
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", VideoMetadata{Title: id}))
+		require.NoError(t, db.UpdateFileInfo(id, filepath.Join(dir, id+".mp3"), 1000, "abc"))
+		require.NoError(t, db.SetStorageLocation(id, StorageRemote))
+	}
+	status := func(id string) string {
+		var s string
+		require.NoError(t, db.db.QueryRow("SELECT validation_status FROM videos WHERE youtube_id = ?", id).Scan(&s))
+		return s
+	}
+
+	// Quick passes don't look for them
+	checked, err := db.ValidateFiles()
+	require.NoError(t, err)
+	assert.Equal(t, 3, checked)
+	for _, id := range []string{"gone", "kept", "empty"} {
+		assert.Equal(t, StatusValid, status(id))
+	}
+
+	// Deep passes check the uploaded copy
+	stat := func(ctx context.Context, path string) (int64, error) {
+		switch filepath.Base(path) {
+		case "kept.mp3":
+			return 1000, nil
+		case "empty.mp3":
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	}
+	_, err = db.ValidateFilesWithOptions(context.Background(), ValidateOptions{VerifyChecksums: true, StatRemote: stat})
+	require.NoError(t, err)
+	assert.Equal(t, StatusMissing, status("gone"))
+	assert.Equal(t, StatusValid, status("kept"))
+	assert.Equal(t, StatusCorrupt, status("empty"))
+}
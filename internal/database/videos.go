@@ -0,0 +1,300 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Video is a recorded video as stored in the library
+type Video struct {
+	ID                int64     `json:"id"`
+	YoutubeID         string    `json:"youtube_id"`
+	PlaylistYoutubeID string    `json:"playlist_youtube_id"` // Playlist that owns the canonical file
+	PlaylistTitle     string    `json:"playlist_title"`
+	Title             string    `json:"title"`
+	Channel           string    `json:"channel"`
+	Duration          int       `json:"duration"` // Seconds
+	FilePath          string    `json:"file_path"`
+	FileSize          int64     `json:"file_size"`
+	ValidationStatus  string    `json:"validation_status"`
+	Availability      string    `json:"availability"`
+	LastValidated     time.Time `json:"last_validated"`
+	DownloadedAt      time.Time `json:"downloaded_at"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	RetryCount        int       `json:"retry_count"` // Failed attempts since the last successful download
+	LastError         string    `json:"last_error,omitempty"`
+	LastAttemptedAt   time.Time `json:"last_attempted_at"` // Last failed attempt
+	Codec             string    `json:"codec,omitempty"`
+	Bitrate           int       `json:"bitrate,omitempty"` // Audio bits per second
+	SampleRate        int       `json:"sample_rate,omitempty"`
+	Channels          int       `json:"channels,omitempty"`
+	ValidationError   string    `json:"validation_error,omitempty"` // Why the file isn't valid
+	StorageLocation   string    `json:"storage_location,omitempty"` // Set once queued for upload; see StorageLocal
+	ArtMissing        string    `json:"art_missing,omitempty"`      // What yt-dlp lacked to embed cover art
+}
+
+// Orders for ListVideos
+const (
+	ListOrderNewest = "newest" // Most recently downloaded first
+	ListOrderOldest = "oldest"
+	ListOrderTitle  = "title"
+)
+
+// listOrders maps each order to its ORDER BY clause. The id tiebreak keeps
+// pages stable when many rows share a timestamp or title.
+var listOrders = map[string]string{
+	ListOrderNewest: "v.downloaded_at DESC, v.id DESC",
+	ListOrderOldest: "v.downloaded_at ASC, v.id ASC",
+	ListOrderTitle:  "LOWER(v.title) ASC, v.id ASC",
+}
+
+// ListOptions filters and pages ListVideos. Zero values mean no filter.
+type ListOptions struct {
+	// PlaylistYoutubeID limits results to videos in a playlist, including
+	// ones linked into its folder from another playlist
+	PlaylistYoutubeID string
+
+	// DownloadedAfter limits results to videos downloaded after this time
+	DownloadedAfter time.Time
+
+	// ValidationStatus limits results to e.g. "valid" or "missing"
+	ValidationStatus string
+
+	// OrderBy is ListOrderNewest (the default), ListOrderOldest or ListOrderTitle
+	OrderBy string
+
+	// Limit caps the number of results; 0 means no limit
+	Limit  int
+	Offset int
+}
+
+// filter returns the WHERE clause, if any, and arguments selecting the
+// videos v (joined with their playlists p) that opts matches
+func (opts ListOptions) filter() (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if opts.PlaylistYoutubeID != "" {
+		where = append(where, `(p.youtube_id = ? OR EXISTS (
+			SELECT 1 FROM video_links l JOIN playlists lp ON lp.id = l.playlist_id
+			WHERE l.video_id = v.id AND lp.youtube_id = ?
+		))`)
+		args = append(args, opts.PlaylistYoutubeID, opts.PlaylistYoutubeID)
+	}
+	if !opts.DownloadedAfter.IsZero() {
+		where = append(where, "v.downloaded_at > ?")
+		args = append(args, dbTime(opts.DownloadedAfter))
+	}
+	if opts.ValidationStatus != "" {
+		where = append(where, "v.validation_status = ?")
+		args = append(args, opts.ValidationStatus)
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return "\n\t\tWHERE " + strings.Join(where, " AND "), args
+}
+
+// GetDownloadsSince returns videos downloaded at or after t, oldest first
+func (d *Database) GetDownloadsSince(t time.Time) ([]Video, error) {
+	rows, err := d.db.Query(`
+		SELECT `+videoColumns+`
+		FROM videos v
+		JOIN playlists p ON p.id = v.playlist_id
+		WHERE v.downloaded_at >= ?
+		ORDER BY v.downloaded_at, v.id`, dbTime(t))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query downloads: %w", err)
+	}
+	defer rows.Close()
+	return d.scanVideos(rows)
+}
+
+// ListVideos returns recorded videos matching opts
+func (d *Database) ListVideos(opts ListOptions) ([]Video, error) {
+	if opts.OrderBy == "" {
+		opts.OrderBy = ListOrderNewest
+	}
+	order, ok := listOrders[opts.OrderBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown video order %q", opts.OrderBy)
+	}
+
+	where, args := opts.filter()
+	query := `
+		SELECT ` + videoColumns + `
+		FROM videos v
+		JOIN playlists p ON p.id = v.playlist_id` + where
+	query += "\n\t\tORDER BY " + order
+	if opts.Limit > 0 || opts.Offset > 0 {
+		var limit interface{} = opts.Limit
+		if opts.Limit <= 0 {
+			limit = d.dialect.noLimit() // OFFSET needs a LIMIT
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, opts.Offset)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+	defer rows.Close()
+	return d.scanVideos(rows)
+}
+
+// videoColumns are the columns scanVideos reads, from videos v joined with
+// the owning playlists p
+const videoColumns = `v.id, v.youtube_id, p.youtube_id, v.playlist_title, v.title, v.channel, v.duration,
+			v.file_path, v.file_size, v.validation_status, COALESCE(v.availability, 'available'),
+			v.last_validated, v.downloaded_at, v.created_at, v.updated_at,
+			COALESCE(v.retry_count, 0), COALESCE(v.last_error, ''), v.last_attempted_at,
+			COALESCE(v.codec, ''), COALESCE(v.bitrate, 0), COALESCE(v.sample_rate, 0), COALESCE(v.channels, 0),
+			COALESCE(v.validation_error, ''), COALESCE(v.storage_location, ''), COALESCE(v.art_missing, '')`
+
+// scanVideos reads rows selected with videoColumns
+func (d *Database) scanVideos(rows *sql.Rows) ([]Video, error) {
+	var videos []Video
+	for rows.Next() {
+		var v Video
+		var filePath, validationStatus sql.NullString
+		var fileSize sql.NullInt64
+		var lastValidated, downloadedAt, createdAt, updatedAt, lastAttempted sql.NullTime
+		if err := rows.Scan(&v.ID, &v.YoutubeID, &v.PlaylistYoutubeID, &v.PlaylistTitle, &v.Title, &v.Channel, &v.Duration,
+			&filePath, &fileSize, &validationStatus, &v.Availability,
+			&lastValidated, &downloadedAt, &createdAt, &updatedAt,
+			&v.RetryCount, &v.LastError, &lastAttempted,
+			&v.Codec, &v.Bitrate, &v.SampleRate, &v.Channels,
+			&v.ValidationError, &v.StorageLocation, &v.ArtMissing); err != nil {
+			return nil, fmt.Errorf("failed to scan video: %w", err)
+		}
+		v.FilePath = d.root.resolve(filePath.String)
+		v.FileSize = fileSize.Int64
+		v.ValidationStatus = validationStatus.String
+		v.LastValidated = lastValidated.Time
+		v.DownloadedAt = downloadedAt.Time
+		v.CreatedAt = createdAt.Time
+		v.UpdatedAt = updatedAt.Time
+		v.LastAttemptedAt = lastAttempted.Time
+		videos = append(videos, v)
+	}
+	return videos, rows.Err()
+}
+
+// DeleteVideo removes a video and everything recorded about it, so the next
+// pass downloads it again unless it is also ignored. With deleteFile its
+// file, chapter tracks and playlist links are deleted from disk first; if one
+// can't be removed the video is kept, minus the copies already gone, and the
+// error is returned.
+func (d *Database) DeleteVideo(youtubeID string, deleteFile bool) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var videoID int64
+	var filePath sql.NullString
+	err = tx.QueryRow("SELECT id, file_path FROM videos WHERE youtube_id = ?", youtubeID).Scan(&videoID, &filePath)
+	if err != nil {
+		return fmt.Errorf("failed to find video %s: %w", youtubeID, err)
+	}
+
+	if deleteFile {
+		if err := removeVideoFiles(tx, d.root, videoID, filePath.String); err != nil {
+			if cerr := tx.Commit(); cerr != nil {
+				return fmt.Errorf("%w (and failed to record removed files: %v)", err, cerr)
+			}
+			return err
+		}
+	}
+
+	for _, stmt := range []string{
+		"DELETE FROM video_tracks WHERE video_id = ?",
+		"DELETE FROM video_links WHERE video_id = ?",
+		"DELETE FROM playlist_videos WHERE video_id = ?",
+		"DELETE FROM videos WHERE id = ?",
+	} {
+		if _, err := tx.Exec(stmt, videoID); err != nil {
+			return fmt.Errorf("failed to delete video %s: %w", youtubeID, err)
+		}
+	}
+	for _, stmt := range []string{
+		"DELETE FROM download_failures WHERE youtube_id = ?",
+		"DELETE FROM skipped_videos WHERE youtube_id = ?",
+	} {
+		if _, err := tx.Exec(stmt, youtubeID); err != nil {
+			return fmt.Errorf("failed to delete video %s: %w", youtubeID, err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE playlists SET video_count = (SELECT COUNT(*) FROM playlist_videos WHERE playlist_id = playlists.id)"); err != nil {
+		return fmt.Errorf("failed to update video counts: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// removeVideoFiles deletes a video's tracks, links and file from disk,
+// forgetting each one as it goes so a failure part way leaves the rows
+// matching what is left on disk
+func removeVideoFiles(tx *sql.Tx, root libraryRoot, videoID int64, filePath string) error {
+	type file struct {
+		id   int64
+		path string
+	}
+	query := func(q string) ([]file, error) {
+		rows, err := tx.Query(q, videoID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query files: %w", err)
+		}
+		defer rows.Close()
+		var files []file
+		for rows.Next() {
+			var f file
+			if err := rows.Scan(&f.id, &f.path); err != nil {
+				return nil, fmt.Errorf("error scanning row: %w", err)
+			}
+			files = append(files, f)
+		}
+		return files, rows.Err()
+	}
+
+	tracks, err := query("SELECT id, file_path FROM video_tracks WHERE video_id = ?")
+	if err != nil {
+		return err
+	}
+	for _, t := range tracks {
+		if err := removeFile(root.resolve(t.path)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM video_tracks WHERE id = ?", t.id); err != nil {
+			return fmt.Errorf("failed to delete track: %w", err)
+		}
+	}
+
+	links, err := query("SELECT id, link_path FROM video_links WHERE video_id = ?")
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		if err := removeFile(root.resolve(l.path)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM video_links WHERE id = ?", l.id); err != nil {
+			return fmt.Errorf("failed to delete video link: %w", err)
+		}
+	}
+
+	if filePath == "" {
+		return nil
+	}
+	if err := removeFile(root.resolve(filePath)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE videos SET file_path = NULL, file_size = 0, validation_status = 'missing' WHERE id = ?", videoID); err != nil {
+		return fmt.Errorf("failed to clear file path: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/sidecar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListVideos(t *testing.T) {
+	db := newBatchTestDB(t)
+	var records []DownloadRecord
+	for i := 0; i < 25; i++ {
+		records = append(records, syntheticRecord(i))
+	}
+	require.NoError(t, db.RecordDownloads("PL_BATCH", "Batch", records))
+	_, err := db.db.Exec("UPDATE videos SET validation_status = 'missing' WHERE youtube_id IN ('vid00003', 'vid00007')")
+	require.NoError(t, err)
+
+	// Every row shares a download timestamp, so pages rely on the id tiebreak
+	seen := make(map[string]bool)
+	for offset := 0; offset < 30; offset += 10 {
+		page, err := db.ListVideos(ListOptions{Limit: 10, Offset: offset})
+		require.NoError(t, err)
+		for _, v := range page {
+			assert.False(t, seen[v.YoutubeID], "%s appears on two pages", v.YoutubeID)
+			seen[v.YoutubeID] = true
+		}
+	}
+	assert.Len(t, seen, 25)
+
+	newest, err := db.ListVideos(ListOptions{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, newest, 1)
+	assert.Equal(t, "vid00024", newest[0].YoutubeID)
+	assert.Equal(t, "PL_BATCH", newest[0].PlaylistYoutubeID)
+	assert.Equal(t, records[24].FilePath, newest[0].FilePath)
+	assert.False(t, newest[0].DownloadedAt.IsZero())
+
+	missing, err := db.ListVideos(ListOptions{ValidationStatus: "missing", OrderBy: ListOrderOldest})
+	require.NoError(t, err)
+	require.Len(t, missing, 2)
+	assert.Equal(t, "vid00003", missing[0].YoutubeID)
+
+	// Linked videos count as part of the playlist they're linked into
+	_, err = db.GetOrCreatePlaylist("PL_OTHER", "Other")
+	require.NoError(t, err)
+	require.NoError(t, db.AddVideoLink("vid00005", "PL_OTHER", "/music/other/Track 5.mp3", "hardlink"))
+	linked, err := db.ListVideos(ListOptions{PlaylistYoutubeID: "PL_OTHER"})
+	require.NoError(t, err)
+	require.Len(t, linked, 1)
+	assert.Equal(t, "vid00005", linked[0].YoutubeID)
+
+	later, err := db.ListVideos(ListOptions{DownloadedAfter: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, later)
+
+	byTitle, err := db.ListVideos(ListOptions{OrderBy: ListOrderTitle, Offset: 24})
+	require.NoError(t, err)
+	require.Len(t, byTitle, 1)
+	assert.Equal(t, "Track 9", byTitle[0].Title, "Titles sort as text")
+
+	_, err = db.ListVideos(ListOptions{OrderBy: "random"})
+	assert.Error(t, err)
+}
+
+func TestDeleteVideo(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "delete.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	canonical, linked := seedLinkedVideo(t, db, dir)
+	require.NoError(t, db.RecordDownloadFailure("vid1", "PL_A", "timed out", false))
+	nfo := sidecar.Path(canonical, sidecar.FormatNFO)
+	require.NoError(t, os.WriteFile(nfo, []byte("<song/>"), 0644))
+
+	require.NoError(t, db.DeleteVideo("vid1", true))
+	assert.NoFileExists(t, canonical)
+	assert.NoFileExists(t, linked)
+	assert.NoFileExists(t, nfo, "Sidecars go with the file")
+	exists, err := db.IsVideoDownloaded("vid1")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	failure, err := db.GetDownloadFailure("vid1")
+	require.NoError(t, err)
+	assert.Nil(t, failure)
+	playlist, err := db.GetOrCreatePlaylist("PL_B", "B")
+	require.NoError(t, err)
+	assert.Zero(t, playlist.VideoCount)
+
+	assert.Error(t, db.DeleteVideo("vid1", true), "Already gone")
+}
+
+func TestDeleteVideoKeepsRowWhenFileRemovalFails(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openTestDB(t, filepath.Join(dir, "delete.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	canonical, linked := seedLinkedVideo(t, db, dir)
+
+	// A non-empty directory where the file should be can't be removed
+	require.NoError(t, os.Remove(canonical))
+	require.NoError(t, os.MkdirAll(filepath.Join(canonical, "stuck"), 0755))
+
+	require.Error(t, db.DeleteVideo("vid1", true))
+	assert.NoFileExists(t, linked)
+	path, err := db.GetFilePath("vid1")
+	require.NoError(t, err)
+	assert.Equal(t, canonical, path, "The row still points at what is left")
+	links, err := db.GetVideoLinks("vid1")
+	require.NoError(t, err)
+	assert.Empty(t, links, "The removed link is forgotten")
+
+	// Keeping the file only drops the row
+	require.NoError(t, db.DeleteVideo("vid1", false))
+	assert.DirExists(t, canonical)
+}
+
+func TestIgnoreVideo(t *testing.T) {
+	db, err := openTestDB(t, filepath.Join(t.TempDir(), "ignore.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	ignored, err := db.IsIgnored("vid1")
+	require.NoError(t, err)
+	assert.False(t, ignored)
+
+	require.NoError(t, db.IgnoreVideo("vid1", "wrong track"))
+	require.NoError(t, db.IgnoreVideo("vid1", "still wrong"))
+	ignored, err = db.IsIgnored("vid1")
+	require.NoError(t, err)
+	assert.True(t, ignored)
+
+	blocked, err := db.BlockedVideoIDs()
+	require.NoError(t, err)
+	assert.Empty(t, blocked, "Only blocked videos are listed")
+	require.NoError(t, db.IgnoreVideo("vid2", IgnoreBlocked))
+	blocked, err = db.BlockedVideoIDs()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"vid2": true}, blocked)
+}
+
+func TestDownloadedAtSetOnSuccess(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "downloaded.db")
+	db, err := openTestDB(t, dbPath)
+	require.NoError(t, err)
+	start := time.Now().Add(-time.Minute)
+
+	ids := func() []string {
+		videos, err := db.GetDownloadsSince(start)
+		require.NoError(t, err)
+		var ids []string
+		for _, v := range videos {
+			ids = append(ids, v.YoutubeID)
+		}
+		return ids
+	}
+
+	// Recording a video isn't downloading it
+	require.NoError(t, db.AddVideo("added", "PL_A", "A", VideoMetadata{Title: "Added"}))
+	_, err = db.ImportArchive(strings.NewReader("youtube archived\n"), "PL_A")
+	require.NoError(t, err)
+	assert.Empty(t, ids())
+
+	require.NoError(t, db.UpdateFileInfo("added", "/music/A/added.mp3", 10, ""))
+	require.NoError(t, db.RecordDownloads("PL_A", "A", []DownloadRecord{syntheticRecord(1)}))
+	assert.Equal(t, []string{"added", "vid00001"}, ids())
+
+	// A download from before start drops out until it is downloaded again
+	_, err = db.db.Exec("UPDATE videos SET downloaded_at = ? WHERE youtube_id = 'vid00001'", dbTime(start.Add(-time.Hour)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"added"}, ids())
+	require.NoError(t, db.RecordDownloads("PL_A", "A", []DownloadRecord{syntheticRecord(1)}))
+	assert.Equal(t, []string{"added", "vid00001"}, ids())
+
+	// Older databases set it on every insert
+	_, err = db.db.Exec("UPDATE videos SET downloaded_at = CURRENT_TIMESTAMP")
+	require.NoError(t, err)
+	forgetMigrations(t, db, 18)
+	require.NoError(t, db.Close())
+
+	db, err = openTestDB(t, dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, []string{"added", "vid00001"}, ids())
+}
@@ -0,0 +1,291 @@
+// Package digest summarises the library's activity since the last digest,
+// per playlist, as an email with plain text and HTML bodies
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// Digest is what happened to the library between Since and Until
+type Digest struct {
+	Since, Until time.Time
+	Playlists    []Playlist // By title
+
+	Downloads int // New tracks across every playlist
+	Failures  int // Videos failing to download
+	Problems  int // Missing or corrupt files
+	Videos    int // Each file counted once
+	Bytes     int64
+}
+
+// Playlist is one playlist's share of a digest
+type Playlist struct {
+	Title     string
+	Downloads []Track
+	Failures  []Failure
+	Problems  []Problem
+	Videos    int   // With a file
+	Bytes     int64 // Used by its files
+}
+
+// Track is a video downloaded during the period
+type Track struct {
+	YoutubeID string
+	Title     string
+	Channel   string
+	Duration  int // Seconds
+}
+
+// Failure is a video that failed to download during the period
+type Failure struct {
+	YoutubeID string
+	Title     string // Empty for videos never downloaded
+	Reason    string
+	Attempts  int
+	Permanent bool // Won't be retried
+}
+
+// Problem is a downloaded file that's missing or failed validation
+type Problem struct {
+	YoutubeID string
+	Title     string
+	Status    string // database.StatusMissing or StatusCorrupt
+	Reason    string
+}
+
+// Gather collects the digest of downloads and failures since since, along
+// with the files that currently need attention and each playlist's storage
+func Gather(db *database.Database, since, until time.Time) (*Digest, error) {
+	d := &Digest{Since: since, Until: until}
+	storage, err := db.GetStorageStats()
+	if err != nil {
+		return nil, err
+	}
+	d.Videos, d.Bytes = storage.Videos, storage.Bytes
+
+	playlists := make(map[string]*Playlist, len(storage.Playlists))
+	playlist := func(youtubeID, title string) *Playlist {
+		p, ok := playlists[youtubeID]
+		if !ok {
+			if title == "" {
+				title = youtubeID
+			}
+			p = &Playlist{Title: title}
+			playlists[youtubeID] = p
+		}
+		return p
+	}
+	for _, s := range storage.Playlists {
+		p := playlist(s.YoutubeID, s.Title)
+		p.Videos, p.Bytes = s.Videos, s.Bytes
+	}
+
+	downloads, err := db.GetDownloadsSince(since)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range downloads {
+		if !v.DownloadedAt.Before(until) {
+			continue
+		}
+		p := playlist(v.PlaylistYoutubeID, v.PlaylistTitle)
+		p.Downloads = append(p.Downloads, Track{YoutubeID: v.YoutubeID, Title: v.Title, Channel: v.Channel, Duration: v.Duration})
+		d.Downloads++
+	}
+
+	// Failures only know the video's title once it was downloaded before
+	failed, err := db.GetFailedVideos(1)
+	if err != nil {
+		return nil, err
+	}
+	known, err := db.GetVideosByStatus(database.StatusFailed)
+	if err != nil {
+		return nil, err
+	}
+	titles := make(map[string]string, len(known))
+	for _, v := range known {
+		titles[v.YoutubeID] = v.Title
+	}
+	for _, f := range failed {
+		if f.LastAttemptAt.Before(since) || !f.LastAttemptAt.Before(until) {
+			continue
+		}
+		p := playlist(f.PlaylistYoutubeID, "")
+		p.Failures = append(p.Failures, Failure{
+			YoutubeID: f.YoutubeID,
+			Title:     titles[f.YoutubeID],
+			Reason:    firstLine(f.LastError),
+			Attempts:  f.Attempts,
+			Permanent: f.Permanent,
+		})
+		d.Failures++
+	}
+
+	for _, status := range []string{database.StatusMissing, database.StatusCorrupt} {
+		videos, err := db.GetVideosByStatus(status)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			p := playlist(v.PlaylistYoutubeID, v.PlaylistTitle)
+			p.Problems = append(p.Problems, Problem{YoutubeID: v.YoutubeID, Title: v.Title, Status: status, Reason: v.ValidationError})
+			d.Problems++
+		}
+	}
+
+	for _, p := range playlists {
+		d.Playlists = append(d.Playlists, *p)
+	}
+	sort.Slice(d.Playlists, func(i, j int) bool {
+		return strings.ToLower(d.Playlists[i].Title) < strings.ToLower(d.Playlists[j].Title)
+	})
+	return d, nil
+}
+
+// firstLine keeps error output from yt-dlp to its first line
+func firstLine(s string) string {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "\n")
+	return s
+}
+
+// Subject is the digest email's subject line
+func (d *Digest) Subject() string {
+	subject := fmt.Sprintf("Playlist digest: %s", plural(d.Downloads, "new track"))
+	if d.Failures > 0 {
+		subject += ", " + plural(d.Failures, "failure")
+	}
+	if d.Problems > 0 {
+		subject += ", " + plural(d.Problems, "file problem")
+	}
+	return subject
+}
+
+// Text renders the digest as plain text
+func (d *Digest) Text() (string, error) {
+	var b bytes.Buffer
+	err := textTemplate.Execute(&b, d)
+	return b.String(), err
+}
+
+// HTML renders the digest as an HTML document
+func (d *Digest) HTML() (string, error) {
+	var b bytes.Buffer
+	err := htmlTemplate.Execute(&b, d)
+	return b.String(), err
+}
+
+// plural formats a count of something, e.g. 1 failure or 2 failures
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatBytes formats a size with a binary unit, e.g. 1.5 GiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDuration formats seconds as m:ss, or h:mm:ss for an hour or more
+func formatDuration(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+var funcs = map[string]any{
+	"bytes":    formatBytes,
+	"duration": formatDuration,
+	"plural":   plural,
+	"date":     func(t time.Time) string { return t.Local().Format("Mon 2 Jan 2006 15:04") },
+}
+
+var textTemplate = template.Must(template.New("text").Funcs(funcs).Parse(`Playlist digest for {{date .Since}} to {{date .Until}}
+
+{{plural .Downloads "new track"}}, {{plural .Failures "failure"}} and {{plural .Problems "file problem"}}.
+The library has {{plural .Videos "file"}} using {{bytes .Bytes}}.
+{{range .Playlists}}
+{{.Title}} ({{plural .Videos "file"}}, {{bytes .Bytes}})
+{{- if .Downloads}}
+  New:
+{{- range .Downloads}}
+  - {{.Title}}{{if .Channel}} by {{.Channel}}{{end}}{{if .Duration}} ({{duration .Duration}}){{end}}
+{{- end}}
+{{- end}}
+{{- if .Failures}}
+  Failed:
+{{- range .Failures}}
+  - {{if .Title}}{{.Title}} ({{.YoutubeID}}){{else}}{{.YoutubeID}}{{end}}: {{.Reason}} after {{plural .Attempts "attempt"}}{{if .Permanent}}, not retried{{end}}
+{{- end}}
+{{- end}}
+{{- if .Problems}}
+  Problems:
+{{- range .Problems}}
+  - {{.Title}}: {{.Status}}{{if .Reason}}, {{.Reason}}{{end}}
+{{- end}}
+{{- end}}
+{{- if not (or .Downloads .Failures .Problems)}}
+  Nothing new.
+{{- end}}
+{{end}}`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<h2>Playlist digest</h2>
+<p style="color: #666;">{{date .Since}} to {{date .Until}}</p>
+<p><strong>{{plural .Downloads "new track"}}</strong>, {{plural .Failures "failure"}} and {{plural .Problems "file problem"}}.
+The library has {{plural .Videos "file"}} using {{bytes .Bytes}}.</p>
+{{range .Playlists}}
+<h3 style="margin-bottom: 0;">{{.Title}}</h3>
+<p style="color: #666; margin-top: 0;">{{plural .Videos "file"}}, {{bytes .Bytes}}</p>
+{{- if .Downloads}}
+<p>New:</p>
+<ul>
+{{- range .Downloads}}
+<li><a href="https://www.youtube.com/watch?v={{.YoutubeID}}">{{.Title}}</a>{{if .Channel}} by {{.Channel}}{{end}}{{if .Duration}} ({{duration .Duration}}){{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Failures}}
+<p style="color: #b00;">Failed:</p>
+<ul>
+{{- range .Failures}}
+<li><a href="https://www.youtube.com/watch?v={{.YoutubeID}}">{{if .Title}}{{.Title}}{{else}}{{.YoutubeID}}{{end}}</a>: {{.Reason}} after {{plural .Attempts "attempt"}}{{if .Permanent}}, not retried{{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Problems}}
+<p style="color: #b60;">Problems:</p>
+<ul>
+{{- range .Problems}}
+<li>{{.Title}}: {{.Status}}{{if .Reason}}, {{.Reason}}{{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if not (or .Downloads .Failures .Problems)}}
+<p>Nothing new.</p>
+{{- end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,71 @@
+package digest
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGather(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for id, title := range map[string]string{"PL_JAZZ": "Jazz", "PL_TALKS": "Talks", "PL_QUIET": "Quiet"} {
+		_, err := db.GetOrCreatePlaylist(id, title)
+		require.NoError(t, err)
+	}
+	for _, v := range []struct{ playlist, title, id string }{
+		{"PL_JAZZ", "Jazz", "aaaaaaaaaaa"},
+		{"PL_JAZZ", "Jazz", "bbbbbbbbbbb"},
+		{"PL_TALKS", "Talks", "ccccccccccc"},
+	} {
+		require.NoError(t, db.RecordDownload(v.playlist, v.title, database.DownloadRecord{
+			YoutubeID: v.id,
+			Metadata:  database.VideoMetadata{Title: "Track <" + v.id + ">", Channel: "Channel", Duration: 185},
+			FilePath:  "/music/" + v.id + ".m4a",
+			FileSize:  2048,
+		}))
+	}
+	require.NoError(t, db.SetValidationStatus("ccccccccccc", database.StatusCorrupt, "truncated"))
+	require.NoError(t, db.RecordDownloadFailure("ddddddddddd", "PL_JAZZ", "ERROR: Video unavailable\nmore output", true))
+
+	now := time.Now()
+	d, err := Gather(db, now.Add(-time.Hour), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, d.Downloads)
+	assert.Equal(t, 1, d.Failures)
+	assert.Equal(t, 1, d.Problems)
+	require.Len(t, d.Playlists, 3, "Playlists with nothing new still show their storage")
+	jazz := d.Playlists[0]
+	assert.Equal(t, "Jazz", jazz.Title)
+	assert.Len(t, jazz.Downloads, 2)
+	assert.Equal(t, int64(4096), jazz.Bytes)
+	assert.Equal(t, []Failure{{YoutubeID: "ddddddddddd", Reason: "ERROR: Video unavailable", Attempts: 1, Permanent: true}}, jazz.Failures)
+	assert.Equal(t, "Quiet", d.Playlists[1].Title)
+	assert.Equal(t, []Problem{{YoutubeID: "ccccccccccc", Title: "Track <ccccccccccc>", Status: database.StatusCorrupt, Reason: "truncated"}}, d.Playlists[2].Problems)
+	assert.Equal(t, "Playlist digest: 3 new tracks, 1 failure, 1 file problem", d.Subject())
+
+	text, err := d.Text()
+	require.NoError(t, err)
+	assert.Contains(t, text, "Jazz (2 files, 4.0 KiB)\n  New:\n  - Track <aaaaaaaaaaa> by Channel (3:05)\n")
+	assert.Contains(t, text, "  Failed:\n  - ddddddddddd: ERROR: Video unavailable after 1 attempt, not retried\n")
+	assert.Contains(t, text, "Quiet (0 files, 0 B)\n  Nothing new.\n")
+	assert.Contains(t, text, "  - Track <ccccccccccc>: corrupt, truncated\n")
+
+	html, err := d.HTML()
+	require.NoError(t, err)
+	assert.Contains(t, html, `<a href="https://www.youtube.com/watch?v=aaaaaaaaaaa">Track &lt;aaaaaaaaaaa&gt;</a> by Channel (3:05)`)
+	assert.NotContains(t, html, "<ccccccccccc>", "Titles are escaped")
+
+	// Nothing happened in an earlier period
+	d, err = Gather(db, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, d.Downloads)
+	assert.Zero(t, d.Failures)
+	assert.Equal(t, 1, d.Problems, "Files needing attention are listed until fixed")
+}
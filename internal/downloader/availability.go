@@ -0,0 +1,62 @@
+package downloader
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// unavailableRecheck is how long a private, deleted or blocked video is
+// skipped before trying it again in case it came back
+const unavailableRecheck = 7 * 24 * time.Hour
+
+// unavailableErrors map yt-dlp messages to why a video can't be downloaded.
+// They're checked in order, as "Video unavailable" prefixes several of them.
+var unavailableErrors = []struct {
+	pattern      string
+	availability string
+}{
+	{"Private video", database.AvailabilityPrivate},
+	{"This video is private", database.AvailabilityPrivate},
+	{"not made this video available in your country", database.AvailabilityBlocked},
+	{"blocked it in your country", database.AvailabilityBlocked},
+	{"copyright claim", database.AvailabilityBlocked},
+	{"This video has been removed", database.AvailabilityDeleted},
+	{"account associated with this video has been terminated", database.AvailabilityDeleted},
+	{"This video is no longer available", database.AvailabilityDeleted},
+	{"Video unavailable", database.AvailabilityDeleted},
+}
+
+// classifyUnavailable returns the availability a download error implies, or
+// an empty string if the error isn't about the video being unavailable
+func classifyUnavailable(err error) string {
+	if err == nil {
+		return ""
+	}
+	msg := err.Error()
+	for _, e := range unavailableErrors {
+		if strings.Contains(msg, e.pattern) {
+			return e.availability
+		}
+	}
+	return ""
+}
+
+// listingAvailability reads the placeholder titles the flat playlist listing
+// gives entries that are gone
+func listingAvailability(video VideoInfo) string {
+	switch video.Title {
+	case "[Private video]":
+		return database.AvailabilityPrivate
+	case "[Deleted video]":
+		return database.AvailabilityDeleted
+	}
+	return database.AvailabilityAvailable
+}
+
+// skipUnavailable reports whether a video known to be unavailable should be
+// skipped this pass
+func skipUnavailable(failure *database.DownloadFailure, now time.Time) bool {
+	return failure != nil && failure.Availability != "" && now.Sub(failure.LastAttemptAt) < unavailableRecheck
+}
@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// chapterFileRe matches the names produced by chapterTemplate
+var chapterFileRe = regexp.MustCompile(`^(\d+) - (.*)$`)
+
+// chapterTemplate turns an output template such as
+// "/music/Mix/%(title)s [%(id)s].%(ext)s" into the template for split
+// chapters: "/music/Mix/%(title)s [%(id)s]/01 - %(section_title)s.%(ext)s"
+func chapterTemplate(tmpl string) string {
+	dir := strings.TrimSuffix(tmpl, ".%(ext)s")
+	return filepath.Join(dir, "%(section_number)02d - %(section_title)s.%(ext)s")
+}
+
+// findChapterTracks lists the tracks split out of the file at path, which
+// chapterTemplate puts in a folder named like the file without its extension.
+// Returns nil when the video had no chapters.
+func findChapterTracks(path string) ([]database.Track, error) {
+	dir := strings.TrimSuffix(path, filepath.Ext(path))
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var tracks []database.Track
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		track := database.Track{Title: name, FilePath: filepath.Join(dir, entry.Name()), FileSize: info.Size()}
+		if m := chapterFileRe.FindStringSubmatch(name); m != nil {
+			track.Number, _ = strconv.Atoi(m[1])
+			track.Title = m[2]
+		}
+		tracks = append(tracks, track)
+	}
+
+	sort.SliceStable(tracks, func(i, j int) bool { return tracks[i].Number < tracks[j].Number })
+	for i := range tracks {
+		if tracks[i].Number == 0 {
+			tracks[i].Number = i + 1
+		}
+	}
+	return tracks, nil
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/notify"
+)
+
+// diskSpaceRetry is how often paused downloads check for space again
+var diskSpaceRetry = time.Minute
+
+// freeSpace is swapped out in tests
+var freeSpace = FreeSpace
+
+// waitForSpace blocks while the library's filesystem has less than
+// minFreeSpace bytes free, so a full disk pauses downloads instead of
+// leaving half-written files and a database that can't be written. It
+// returns early only when ctx is cancelled.
+func (d *Downloader) waitForSpace(ctx context.Context) error {
+	if d.minFreeSpace <= 0 {
+		return nil
+	}
+
+	paused := false
+	for {
+		free, err := freeSpace(d.outputDir)
+		if err != nil {
+			// Better to carry on than to stop downloading for good
+			d.logger.Warn("Failed to check free space", "dir", d.outputDir, "error", err)
+			return nil
+		}
+		if free >= d.minFreeSpace {
+			if paused {
+				d.logger.Info("Space freed, resuming downloads", "dir", d.outputDir, "free_bytes", free)
+				d.lowSpace.Store(false)
+			}
+			return nil
+		}
+		if !paused {
+			d.logger.Warn("Downloads are paused until space is freed: free space is below MIN_FREE_SPACE",
+				"dir", d.outputDir, "free_bytes", free, "min_free_bytes", d.minFreeSpace)
+			paused = true
+
+			// Playlists pause separately, but one notification will do
+			if !d.lowSpace.Swap(true) {
+				d.notifier.Notify(notify.Event{
+					Type:    notify.EventLowDiskSpace,
+					Message: fmt.Sprintf("Only %d MiB free in %s; downloads are paused until space is freed", free>>20, d.outputDir),
+					Details: map[string]any{"free_bytes": free, "min_free_bytes": d.minFreeSpace, "dir": d.outputDir},
+				})
+			}
+		}
+		if err := sleepContext(ctx, diskSpaceRetry); err != nil {
+			return err
+		}
+	}
+}
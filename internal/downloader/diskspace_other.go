@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package downloader
+
+import "errors"
+
+// FreeSpace is only implemented on Linux and macOS
+func FreeSpace(dir string) (int64, error) {
+	return 0, errors.New("checking free space is not supported on this platform")
+}
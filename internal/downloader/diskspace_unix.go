@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package downloader
+
+import "golang.org/x/sys/unix"
+
+// FreeSpace returns the bytes available to unprivileged users on the
+// filesystem holding dir
+func FreeSpace(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -3,289 +3,1484 @@ package downloader
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	youtube "github.com/kkdai/youtube/v2"
+	"github.com/sampiiiii/pp-downloader/internal/artwork"
 	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/filename"
+	"github.com/sampiiiii/pp-downloader/internal/notify"
+	"github.com/sampiiiii/pp-downloader/internal/ytdlp"
 )
 
 // VideoInfo represents information about a YouTube video
 type VideoInfo struct {
-	ID            string    `json:"id"`
-	Title         string    `json:"title"`
-	Description   string    `json:"description"`
-	Duration      float64   `json:"duration"`
-	Channel       string    `json:"channel"`
-	ChannelID     string    `json:"channel_id"`
-	PlaylistID    string    `json:"playlist_id,omitempty"`
-	ViewCount     int64     `json:"view_count"`
-	Thumbnail     string    `json:"thumbnail"`
-	UploadDate    string    `json:"upload_date"`
-	LiveStartTime time.Time `json:"live_start_time,omitempty"`
-	LiveEndTime   time.Time `json:"live_end_time,omitempty"`
-	MetadataJSON  string    `json:"metadata_json,omitempty"`
+	ID            string  `json:"id"`
+	Title         string  `json:"title"`
+	Description   string  `json:"description"`
+	Duration      float64 `json:"duration"`
+	Channel       string  `json:"channel"`
+	ChannelID     string  `json:"channel_id"`
+	PlaylistID    string  `json:"playlist_id,omitempty"`
+	PlaylistIndex int     `json:"-"` // 1-based position in the playlist listing
+	Uploader      string  `json:"uploader"`
+	ViewCount     int64   `json:"view_count"`
+	Thumbnail     string  `json:"thumbnail"`
+	UploadDate    string  `json:"upload_date"`
+	MetadataJSON  string  `json:"metadata_json,omitempty"`
+
+	// Livestreams and premieres
+	IsLive           bool   `json:"is_live"`
+	LiveStatus       string `json:"live_status"`       // not_live, is_live, is_upcoming, was_live or post_live
+	ReleaseTimestamp int64  `json:"release_timestamp"` // Unix time the stream or premiere starts
+}
+
+// Options holds optional Downloader settings
+type Options struct {
+	// Artwork fetches high-resolution thumbnails for embedding; when nil,
+	// yt-dlp embeds whatever thumbnail it picks itself
+	Artwork *artwork.Fetcher
+
+	// Capabilities is the probed yt-dlp feature set; when nil every option
+	// is assumed to be supported
+	Capabilities *ytdlp.Capabilities
+
+	// LinkMode controls how a video already downloaded for one playlist is
+	// placed into another playlist's folder (hardlink, reflink, or symlink)
+	LinkMode string
+
+	// BatchSize is how many new videos a run must have before database
+	// writes are batched, and how many rows go in each transaction
+	BatchSize int
+
+	// MaxConcurrentDownloads is the number of videos downloaded in parallel
+	// per playlist; values below 1 mean one at a time
+	MaxConcurrentDownloads int
+
+	// Retry controls retries of failed downloads within and across runs
+	Retry RetryPolicy
+
+	// RateLimit is passed to yt-dlp's --limit-rate, e.g. "2M"; empty means unlimited
+	RateLimit string
+
+	// SleepBetweenDownloads is how long to wait before starting each video
+	// after the first in a playlist run
+	SleepBetweenDownloads time.Duration
+
+	// Proxy is passed to every yt-dlp call as --proxy; empty means direct
+	Proxy string
+
+	// YTDLPPath is the yt-dlp binary to run; defaults to "yt-dlp" on PATH
+	YTDLPPath string
+
+	// Backend is BackendAuto (the default), BackendYTDLP or BackendNative
+	Backend string
+
+	// HTTPClient is used by the native YouTube client; nil means
+	// http.DefaultClient
+	HTTPClient *http.Client
+
+	// SkipChecksums turns off hashing downloaded files, for slow storage
+	SkipChecksums bool
+
+	// PlaylistFetchTimeout bounds listing a playlist or channel; defaults
+	// to DefaultPlaylistFetchTimeout
+	PlaylistFetchTimeout time.Duration
+
+	// TempDir is where yt-dlp writes before finished files are moved into
+	// the library; defaults to ".tmp" inside the output directory
+	TempDir string
+
+	// OnProgress, if set, receives progress updates while videos download
+	OnProgress ProgressFunc
+
+	// FFprobePath is the ffprobe binary used to record each file's audio
+	// format; defaults to "ffprobe" on PATH
+	FFprobePath string
+
+	// MinFreeSpace pauses downloads while the output directory's
+	// filesystem has fewer bytes free; 0 turns the check off
+	MinFreeSpace int64
+
+	// SidecarFormat writes a metadata file next to each download:
+	// sidecar.FormatNFO or sidecar.FormatJSON; empty writes none
+	SidecarFormat string
+
+	// FullScanInterval is how long a playlist whose listing hasn't changed
+	// since a pass that left nothing to do is skipped without looking at
+	// its videos; 0 looks at every video on every pass
+	FullScanInterval time.Duration
+
+	// Uploader, when set, is given each download once it's recorded, to
+	// copy it to remote storage
+	Uploader Uploader
+
+	// Notifier is told when downloads pause for lack of space
+	Notifier notify.Notifier
+
+	// Logger receives download events; defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// Uploader copies recorded downloads to remote storage in the background
+type Uploader interface {
+	Enqueue(youtubeID string)
+}
+
+// VideoResult reports what happened to a single playlist entry
+type VideoResult struct {
+	VideoID    string
+	Downloaded bool
+	Skipped    SkipReason // Why the entry wasn't downloaded this pass, if skipped
+	Tracks     int        // Files produced: 1, or the chapter count when split
+	Removed    bool       // No longer listed by the playlist
+	Deleted    bool       // Removed and, with SyncDeletions, deleted locally
+	Err        error      // Set when the download failed
+
+	// What was downloaded, when Downloaded is set
+	Path      string // The file, or the first track when split
+	Title     string
+	Channel   string
+	Duration  int // Seconds
+	Thumbnail string
+}
+
+// downloadedResult is the result of a video recorded as downloaded
+func downloadedResult(record database.DownloadRecord) VideoResult {
+	result := VideoResult{
+		VideoID:    record.YoutubeID,
+		Downloaded: true,
+		Tracks:     trackCount(record),
+		Path:       record.FilePath,
+		Title:      record.Metadata.Title,
+		Channel:    record.Metadata.Channel,
+		Duration:   record.Metadata.Duration,
+		Thumbnail:  record.Metadata.ThumbnailURL,
+	}
+	if result.Path == "" && len(record.Tracks) > 0 {
+		result.Path = record.Tracks[0].FilePath
+	}
+	return result
+}
+
+// SkipReason explains why ProcessPlaylist didn't download an entry
+type SkipReason string
+
+// Reasons an entry is skipped
+const (
+	SkipDownloaded  SkipReason = "downloaded"  // Already in the library
+	SkipUnavailable SkipReason = "unavailable" // Private, deleted or blocked
+	SkipFailed      SkipReason = "failed"      // Failed permanently or too often
+	SkipDuration    SkipReason = "duration"    // Outside the playlist's duration limits
+	SkipLive        SkipReason = "live"        // Live or upcoming; retried on later passes
+	SkipIgnored     SkipReason = "ignored"     // Removed by the user and never downloaded again
+	SkipQueued      SkipReason = "queued"      // Waiting for a pass that may download
+	SkipTitle       SkipReason = "title"       // Left out by the playlist's title filters
+	SkipBlocked     SkipReason = "blocked"     // Blocked in the config or with the block command
+)
+
+// Callback is invoked once per playlist entry processed by ProcessPlaylist
+type Callback func(result VideoResult)
+
+// PlaylistOptions are per-playlist download settings
+type PlaylistOptions struct {
+	// Quality is yt-dlp's --audio-quality: 0 (best) to 9, or a bitrate like "192K"
+	Quality string
+
+	// MediaType is "audio" to extract mp3s or "video" to keep the video
+	MediaType string
+
+	// AudioFormat is what audio is extracted to: mp3 (the default), m4a,
+	// opus or flac. Our own artwork is only embedded in mp3s; the other
+	// formats get yt-dlp's thumbnail.
+	AudioFormat string
+
+	// OutputSubdir is the playlist's folder inside the library; defaults to
+	// one named after the playlist
+	OutputSubdir string
+
+	// VideoContainer is the merge format for video downloads: mp4 or mkv
+	VideoContainer string
+
+	// MaxDuration and MinDuration skip videos outside these lengths; zero
+	// means no limit
+	MaxDuration time.Duration
+	MinDuration time.Duration
+
+	// TitleInclude, when set, only downloads videos whose title matches one
+	// of them; TitleExclude skips videos whose title matches any
+	TitleInclude []*regexp.Regexp
+	TitleExclude []*regexp.Regexp
+
+	// BlockedIDs are videos never downloaded or linked into the playlist,
+	// on top of those blocked in the database
+	BlockedIDs map[string]bool
+
+	// LoudnessTarget normalizes downloads to this integrated loudness in
+	// LUFS, e.g. -14; 0 leaves them untouched
+	LoudnessTarget float64
+
+	// Tags maps playlist and video details to the tags written to each file
+	Tags TagMapping
+
+	// SplitChapters splits videos with chapter markers into one file per
+	// chapter, in a folder named after the video
+	SplitChapters bool
+
+	// FilenameTemplate is the yt-dlp output template inside the playlist
+	// folder; defaults to "%(title)s [%(id)s].%(ext)s"
+	FilenameTemplate string
+
+	// CookiesPath is a Netscape cookies file passed to yt-dlp for private,
+	// members-only and age-restricted videos; empty means no cookies
+	CookiesPath string
+
+	// SyncDeletions deletes the local copy of videos the playlist no longer
+	// lists; otherwise they are kept and only marked as removed
+	SyncDeletions bool
+
+	// ListOnly checks the playlist for changes without touching the
+	// library: new videos are reported as queued and left for a later pass
+	ListOnly bool
+}
+
+// keepVideo reports whether the playlist keeps video instead of extracting audio
+func (o PlaylistOptions) keepVideo() bool {
+	return o.MediaType == "video"
+}
+
+// audioFormat returns the configured audio format, defaulting to mp3
+func (o PlaylistOptions) audioFormat() string {
+	if o.AudioFormat == "" {
+		return "mp3"
+	}
+	return o.AudioFormat
+}
+
+// audioMedia describes the files audio is extracted to
+func (o PlaylistOptions) audioMedia() database.MediaInfo {
+	codec := map[string]string{"m4a": "aac"}[o.audioFormat()]
+	if codec == "" {
+		codec = o.audioFormat()
+	}
+	return database.MediaInfo{MediaType: "audio", Container: o.audioFormat(), Codec: codec}
+}
+
+// filenameTemplate returns the configured output template or the default
+func (o PlaylistOptions) filenameTemplate() string {
+	if o.FilenameTemplate == "" {
+		return "%(title)s [%(id)s].%(ext)s"
+	}
+	return o.FilenameTemplate
+}
+
+// videoContainer returns the configured merge format, defaulting to mp4
+func (o PlaylistOptions) videoContainer() string {
+	if o.VideoContainer == "" {
+		return "mp4"
+	}
+	return o.VideoContainer
+}
+
+// audioQuality returns the configured quality, defaulting to best
+func (o PlaylistOptions) audioQuality() string {
+	if o.Quality == "" {
+		return "0"
+	}
+	return o.Quality
 }
 
+// DefaultPlaylistFetchTimeout bounds listing a playlist when no timeout is set
+const DefaultPlaylistFetchTimeout = 5 * time.Minute
+
 type Downloader struct {
 	client     *youtube.Client
+	backend    string
+	ytdlpPath  string
 	ffmpegPath string
 	outputDir  string
+	tempDir    string
+	checksums  bool
 	db         *database.Database
+	artwork    *artwork.Fetcher
+	caps       *ytdlp.Capabilities
+	linkMode   string
+	batchSize  int
+	workers    int
+	retry      RetryPolicy
+	rateLimit  string
+	sleep      time.Duration
+	proxy      string
+	onProgress ProgressFunc
+
+	listTimeout      time.Duration
+	minFreeSpace     int64
+	fullScanInterval time.Duration
+	ffprobePath      string
+	sidecarFormat    string
+	uploader         Uploader
+	notifier         notify.Notifier
+	logger           *slog.Logger
+	lowSpace         atomic.Bool // Set while downloads are paused for space
 }
 
-func NewDownloader(ffmpegPath, outputDir string, db *database.Database) *Downloader {
+func NewDownloader(ffmpegPath, outputDir string, db *database.Database, opts Options) *Downloader {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = database.DefaultBatchSize
+	}
+	if opts.MaxConcurrentDownloads <= 0 {
+		opts.MaxConcurrentDownloads = 1
+	}
+	if opts.YTDLPPath == "" {
+		opts.YTDLPPath = "yt-dlp"
+	}
+	if opts.TempDir == "" {
+		opts.TempDir = filepath.Join(outputDir, ".tmp")
+	}
+	if opts.Backend == "" {
+		opts.Backend = BackendAuto
+	}
+	if opts.PlaylistFetchTimeout <= 0 {
+		opts.PlaylistFetchTimeout = DefaultPlaylistFetchTimeout
+	}
+	if opts.FFprobePath == "" {
+		opts.FFprobePath = "ffprobe"
+	}
+	if opts.Notifier == nil {
+		opts.Notifier = notify.Discard
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
 	return &Downloader{
-		client:     &youtube.Client{},
+		client:     &youtube.Client{HTTPClient: opts.HTTPClient},
+		backend:    opts.Backend,
+		ytdlpPath:  opts.YTDLPPath,
 		ffmpegPath: ffmpegPath,
 		outputDir:  outputDir,
+		tempDir:    opts.TempDir,
+		checksums:  !opts.SkipChecksums,
 		db:         db,
+		artwork:    opts.Artwork,
+		caps:       opts.Capabilities,
+		linkMode:   opts.LinkMode,
+		batchSize:  opts.BatchSize,
+		workers:    opts.MaxConcurrentDownloads,
+		retry:      opts.Retry.withDefaults(),
+		rateLimit:  opts.RateLimit,
+		sleep:      opts.SleepBetweenDownloads,
+		proxy:      opts.Proxy,
+		onProgress: opts.OnProgress,
+
+		listTimeout:      opts.PlaylistFetchTimeout,
+		minFreeSpace:     opts.MinFreeSpace,
+		fullScanInterval: opts.FullScanInterval,
+		ffprobePath:      opts.FFprobePath,
+		sidecarFormat:    opts.SidecarFormat,
+		uploader:         opts.Uploader,
+		notifier:         opts.Notifier,
+		logger:           opts.Logger,
 	}
 }
 
-// ProcessPlaylist downloads all videos from a playlist that haven't been downloaded before
-func (d *Downloader) ProcessPlaylist(playlistURL string, playlistName string, callback func(videoID string, downloaded bool)) error {
-	// Extract playlist ID from URL
-	playlistID := extractPlaylistID(playlistURL)
-	if playlistID == "" {
-		return fmt.Errorf("invalid playlist URL: %s", playlistURL)
+// ProcessPlaylist downloads all videos from a playlist that haven't been downloaded before.
+// Downloads run on a worker pool, but database writes and callbacks happen on
+// the calling goroutine only. Cancelling ctx stops in-flight downloads.
+func (d *Downloader) ProcessPlaylist(ctx context.Context, playlistURL string, playlistName string, opts PlaylistOptions, callback Callback) error {
+	src, err := parseSource(playlistURL)
+	if err != nil {
+		return fmt.Errorf("invalid playlist URL: %w", err)
 	}
+	playlistID := src.ID
 
 	playlist, err := d.db.GetOrCreatePlaylist(playlistID, playlistName)
 	if err != nil {
 		return fmt.Errorf("failed to get or create playlist: %w", err)
 	}
 
-	log.Printf("Processing playlist '%s' (%s)", playlistName, playlistID)
+	logger := d.logger.With("playlist", playlistName)
+	logger.Info("Processing playlist", "playlist_id", playlistID)
 
 	// Get all videos in the playlist
-	videos, err := d.getPlaylistVideos(playlistURL)
+	listing, err := d.getPlaylistVideos(ctx, src, opts)
 	if err != nil {
 		return fmt.Errorf("failed to get playlist videos: %w", err)
 	}
+	videos := listing.Entries
+
+	// Keep the title and channel current in case they're renamed on YouTube
+	if src.Type != database.SourceVideo {
+		if err := d.db.UpdatePlaylistMetadata(playlist.YoutubeID, listing.metadata()); err != nil {
+			logger.Warn("Failed to update playlist details", "error", err)
+		}
+	}
+	if src.Type != database.SourcePlaylist {
+		if err := d.db.SetPlaylistSource(playlist.YoutubeID, src.Type, listing.channelTitle(), listing.ChannelID); err != nil {
+			logger.Warn("Failed to record playlist source", "error", err)
+		}
+	}
 
 	if len(videos) == 0 {
-		log.Printf("No videos found in playlist %s", playlistID)
+		logger.Info("No videos found in playlist")
 		return nil
 	}
 
-	log.Printf("Found %d videos in playlist %s", len(videos), playlistID)
+	logger.Info("Found videos in playlist", "count", len(videos))
 
-	// Process each video
+	// Split the playlist into videos we already have and ones to download
+	ids := make([]string, len(videos))
+	for i, video := range videos {
+		ids[i] = video.ID
+	}
+
+	// A listing unchanged since a pass that left nothing to do needs no
+	// work, until the next full scan catches what the listing can't show
+	fingerprint := listingFingerprint(ids, opts)
+	if d.fullScanInterval > 0 {
+		last, scannedAt, err := d.db.GetListingFingerprint(playlist.YoutubeID)
+		if err != nil {
+			logger.Warn("Failed to load playlist fingerprint", "error", err)
+		} else if last == fingerprint && time.Since(scannedAt) < d.fullScanInterval {
+			logger.Info("Playlist is unchanged; skipping its videos", "next_full_scan", scannedAt.Add(d.fullScanInterval))
+			return nil
+		}
+	}
+
+	existing, err := d.db.GetExistingVideoIDs(ids)
+	if err != nil {
+		return fmt.Errorf("failed to check existing videos: %w", err)
+	}
+
+	blocked, err := d.db.BlockedVideoIDs()
+	if err != nil {
+		return fmt.Errorf("failed to load blocked videos: %w", err)
+	}
+
+	// Only a pass where every new video landed or was skipped for good can
+	// be skipped next time; live streams need checking again
+	settled := true
+	var newVideos []VideoInfo
+	backfilled, unavailable := 0, 0
+	now := time.Now()
 	for _, video := range videos {
-		// Check if video already exists in the database
-		exists, err := d.db.VideoExists(video.ID)
+		// Blocked videos are left alone even when they were downloaded before
+		if blocked[video.ID] || opts.BlockedIDs[video.ID] {
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Skipped: SkipBlocked})
+			}
+			continue
+		}
+
+		if existing[video.ID] {
+			logger.Debug("Skipping video already in the database", "video_id", video.ID)
+			// Keep the file, but note when it's gone from YouTube
+			if err := d.db.SetAvailability(video.ID, listingAvailability(video)); err != nil {
+				logger.Warn("Failed to update video availability", "video_id", video.ID, "error", err)
+			}
+			if !opts.ListOnly {
+				if backfilled < maxMetadataBackfill && d.backfillMetadata(ctx, video, opts) {
+					backfilled++
+				}
+				if err := d.ensurePlaylistCopy(video.ID, playlist.YoutubeID, playlistName, opts); err != nil {
+					logger.Warn("Failed to link video into playlist", "video_id", video.ID, "error", err)
+				}
+			}
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Skipped: SkipDownloaded})
+			}
+			continue
+		}
+
+		if ignored, err := d.db.IsIgnored(video.ID); err != nil {
+			logger.Error("Failed to check whether video is ignored", "video_id", video.ID, "error", err)
+		} else if ignored {
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Skipped: SkipIgnored})
+			}
+			continue
+		}
+
+		failure, err := d.db.GetDownloadFailure(video.ID)
 		if err != nil {
-			log.Printf("Error checking if video %s exists: %v", video.ID, err)
+			logger.Error("Failed to check past failures of video", "video_id", video.ID, "error", err)
+		}
+
+		// Unavailable videos are recorded once and rechecked weekly; the
+		// listing already tells us about private and deleted entries
+		if availability := listingAvailability(video); availability != database.AvailabilityAvailable {
+			if failure == nil || failure.Availability != availability {
+				logger.Info("Skipping unavailable video", "video_id", video.ID, "availability", availability)
+				if err := d.db.RecordUnavailable(video.ID, playlist.YoutubeID, availability, "listed as "+video.Title); err != nil {
+					logger.Warn("Failed to record video as unavailable", "video_id", video.ID, "error", err)
+				}
+			}
+			unavailable++
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Skipped: SkipUnavailable})
+			}
+			continue
+		}
+		if skipUnavailable(failure, now) {
+			unavailable++
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Skipped: SkipUnavailable})
+			}
 			continue
 		}
 
-		if exists {
-			log.Printf("Skipping video %s as it already exists in the database", video.ID)
+		// Don't keep hammering videos that failed permanently or too often
+		if failure != nil && failure.Availability == "" && (failure.Permanent || failure.Attempts >= d.retry.MaxPasses) {
+			logger.Debug("Skipping video that keeps failing", "video_id", video.ID, "attempts", failure.Attempts, "last_error", failure.LastError)
 			if callback != nil {
-				callback(video.ID, false)
+				callback(VideoResult{VideoID: video.ID, Skipped: SkipFailed})
 			}
 			continue
 		}
 
-		// Download the video
-		filePath, fileSize, err := d.downloadVideo(video.ID, playlistName) // Pass the friendly name
+		// Videos skipped for their length or title stay skipped unless the
+		// limits or filters changed; live streams are checked again every pass
+		skipped, err := d.db.GetSkipped(video.ID)
 		if err != nil {
-			log.Printf("Failed to download video %s: %v", video.ID, err)
+			logger.Error("Failed to check whether video was skipped", "video_id", video.ID, "error", err)
+		} else if skipped != nil {
+			if opts.stillSkipped(skipped, video) {
+				if callback != nil {
+					callback(VideoResult{VideoID: video.ID, Skipped: skipReason(skipped.Reason)})
+				}
+				continue
+			}
+			if err := d.db.ClearSkipped(video.ID); err != nil {
+				logger.Warn("Failed to clear skipped video", "video_id", video.ID, "error", err)
+			}
+		}
+
+		// Flat listings usually have the duration and live status;
+		// otherwise they're checked once the full metadata is fetched
+		if reason := opts.filter(video); reason != "" {
+			if isLiveSkip(reason) {
+				settled = false
+			}
+			d.recordSkipped(video, playlist.YoutubeID, reason)
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Skipped: skipReason(reason)})
+			}
 			continue
 		}
 
-		// Parse upload date
-		var uploadDate time.Time
-		if video.UploadDate != "" {
-			uploadDate, _ = time.Parse("20060102", video.UploadDate)
+		newVideos = append(newVideos, video)
+	}
+	if unavailable > 0 {
+		logger.Info("Skipped unavailable videos", "count", unavailable)
+	}
+
+	// Positions shift when the owner reorders the playlist, so refresh them
+	// for videos we already have; new ones get theirs when recorded
+	positions := make(map[string]int, len(videos))
+	for _, video := range videos {
+		positions[video.ID] = video.PlaylistIndex
+	}
+	if err := d.db.SetPlaylistPositions(playlist.YoutubeID, positions); err != nil {
+		logger.Warn("Failed to record playlist positions", "error", err)
+	}
+	// Deleting removed videos waits for a pass that may touch the library
+	if !opts.ListOnly || !opts.SyncDeletions {
+		d.handleRemoved(playlist.YoutubeID, playlistName, ids, opts, callback)
+	}
+
+	if opts.ListOnly {
+		if len(newVideos) > 0 {
+			logger.Info("Queued new videos until downloads are allowed", "count", len(newVideos))
+		}
+		if callback != nil {
+			for _, video := range newVideos {
+				callback(VideoResult{VideoID: video.ID, Skipped: SkipQueued})
+			}
 		}
+		return ctx.Err()
+	}
+
+	// Bulk imports write in chunks; steady-state runs record each video as it lands
+	var batch *database.BatchWriter
+	if len(newVideos) >= d.batchSize {
+		logger.Info("Writing new videos in batches", "count", len(newVideos), "batch_size", d.batchSize)
+		batch = d.db.NewBatchWriter(playlist.YoutubeID, playlist.Title, d.batchSize, func(records []database.DownloadRecord) {
+			for _, r := range records {
+				d.upload(r.YoutubeID)
+				if callback != nil {
+					callback(downloadedResult(r))
+				}
+			}
+		})
+	}
 
-		// Prepare video metadata
-		metadata := database.VideoMetadata{
-			Title:         video.Title,
-			Description:   video.Description,
-			Channel:       video.Channel,
-			ChannelID:     video.ChannelID,
-			Duration:      int(video.Duration),
-			ViewCount:     video.ViewCount,
-			ThumbnailURL:  video.Thumbnail,
-			UploadDate:    uploadDate,
-			LiveStartTime: video.LiveStartTime,
-			LiveEndTime:   video.LiveEndTime,
-			MetadataJSON:  video.MetadataJSON,
+	for job := range d.downloadAll(ctx, playlistName, opts, newVideos) {
+		video, result := job.video, job.result
+		var skipped *skippedError
+		if errors.As(job.err, &skipped) {
+			if isLiveSkip(skipped.reason) {
+				settled = false
+			}
+			d.recordSkipped(video, playlist.YoutubeID, skipped.reason)
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Skipped: skipReason(skipped.reason)})
+			}
+			continue
+		}
+		if job.err != nil {
+			settled = false
+			logger.Error("Failed to download video", "video_id", video.ID, "title", video.Title, "error", job.err)
+			// Interrupted downloads aren't the video's fault
+			if ctx.Err() == nil {
+				d.recordFailure(video.ID, playlist.YoutubeID, job.err)
+			}
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Err: job.err})
+			}
+			continue
 		}
 
-		// Add video to database
-		if err := d.db.AddVideo(video.ID, playlist.YoutubeID, playlist.Title, metadata); err != nil {
-			log.Printf("Failed to add video %s to database: %v", video.ID, err)
+		record := downloadRecord(video, result, opts)
+		d.writeSidecars(video, record, playlistName, opts)
+		if batch != nil {
+			if err := batch.Add(record); err != nil {
+				settled = false
+				logger.Error("Failed to write batch", "error", err)
+			}
 			continue
 		}
 
-		// Update file information
-		if err := d.db.UpdateFileInfo(video.ID, filePath, fileSize); err != nil {
-			log.Printf("Failed to update file info for video %s: %v", video.ID, err)
+		if err := d.recordDownload(playlist, record); err != nil {
+			settled = false
+			logger.Error("Failed to record video", "video_id", video.ID, "error", err)
+			if callback != nil {
+				callback(VideoResult{VideoID: video.ID, Err: err})
+			}
+			continue
 		}
 
+		d.upload(record.YoutubeID)
 		if callback != nil {
-			callback(video.ID, true)
+			callback(downloadedResult(record))
+		}
+	}
+
+	// Completed downloads are recorded even when shutting down
+	if batch != nil {
+		if err := batch.Flush(); err != nil {
+			return fmt.Errorf("failed to write final batch: %w", err)
+		}
+	}
+
+	if settled && ctx.Err() == nil && d.fullScanInterval > 0 {
+		if err := d.db.SetListingFingerprint(playlist.YoutubeID, fingerprint); err != nil {
+			logger.Warn("Failed to save playlist fingerprint", "error", err)
+		}
+	}
+	return ctx.Err()
+}
+
+// recordFailure records a failed download, noting when the error shows the
+// video is no longer available
+func (d *Downloader) recordFailure(videoID, playlistYoutubeID string, err error) {
+	if availability := classifyUnavailable(err); availability != "" {
+		d.logger.Info("Video is unavailable", "video_id", videoID, "availability", availability, "recheck_in", unavailableRecheck)
+		if err := d.db.RecordUnavailable(videoID, playlistYoutubeID, availability, truncateError(err)); err != nil {
+			d.logger.Warn("Failed to record video as unavailable", "video_id", videoID, "error", err)
 		}
+	} else if err := d.db.RecordDownloadFailure(videoID, playlistYoutubeID, truncateError(err), isPermanentError(err)); err != nil {
+		d.logger.Warn("Failed to record download failure", "video_id", videoID, "error", err)
+	}
+	attempt := database.DownloadAttempt{
+		YoutubeID:    videoID,
+		ErrorClass:   errorClass(err),
+		ErrorMessage: truncateError(err),
+		ExitCode:     exitCode(err),
 	}
+	if err := d.db.RecordDownloadAttempt(attempt); err != nil {
+		d.logger.Warn("Failed to record download attempt", "video_id", videoID, "error", err)
+	}
+}
 
+// downloadRecord describes a completed download for the database
+func downloadRecord(video VideoInfo, result *downloadResult, opts PlaylistOptions) database.DownloadRecord {
+	record := database.DownloadRecord{
+		YoutubeID:   video.ID,
+		Metadata:    videoMetadata(video),
+		FilePath:    result.FilePath,
+		FileSize:    result.FileSize,
+		Checksum:    result.Checksum,
+		Loudness:    result.Loudness,
+		ArtEmbedded: result.ArtEmbedded,
+		ArtMissing:  result.ArtMissing,
+		Media:       result.Media,
+		Tracks:      result.Tracks,
+		Position:    video.PlaylistIndex,
+	}
+	record.ParsedArtist, record.ParsedTitle, _ = opts.Tags.parsedTitle(video)
+	if result.Duration > 0 {
+		record.Metadata.Duration = result.Duration // The listing's duration is only approximate
+	}
+	return record
+}
+
+// recordSkipped remembers a video filtered out by its title, duration or
+// live status
+func (d *Downloader) recordSkipped(video VideoInfo, playlistYoutubeID, reason string) {
+	if isLiveSkip(reason) {
+		d.logger.Info("Deferring video", "video_id", video.ID, "reason", reason)
+	} else if reason == database.SkipTitle {
+		d.logger.Info("Skipping video: title is filtered out", "video_id", video.ID, "title", video.Title)
+	} else {
+		d.logger.Info("Skipping video", "video_id", video.ID, "reason", reason, "duration", time.Duration(video.Duration)*time.Second)
+	}
+	if err := d.db.RecordSkipped(video.ID, playlistYoutubeID, reason, int(video.Duration)); err != nil {
+		d.logger.Warn("Failed to record skipped video", "video_id", video.ID, "error", err)
+	}
+}
+
+// trackCount returns how many files a download produced
+func trackCount(record database.DownloadRecord) int {
+	if len(record.Tracks) > 0 {
+		return len(record.Tracks)
+	}
+	return 1
+}
+
+// downloadJob is the outcome of downloading one playlist entry
+type downloadJob struct {
+	video  VideoInfo
+	result *downloadResult
+	err    error
+}
+
+// downloadAll downloads videos on up to d.workers goroutines. Results are
+// delivered on the returned channel, which is closed once every worker has
+// finished, so the caller can write them to the database from one goroutine.
+func (d *Downloader) downloadAll(ctx context.Context, playlistName string, opts PlaylistOptions, videos []VideoInfo) <-chan downloadJob {
+	jobs := make(chan VideoInfo)
+	results := make(chan downloadJob)
+
+	workers := d.workers
+	if workers > len(videos) {
+		workers = len(videos)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for video := range jobs {
+				// The flat listing leaves most metadata empty
+				video = d.withFullInfo(ctx, video, opts)
+				if reason := opts.filter(video); reason != "" {
+					results <- downloadJob{video: video, err: &skippedError{reason: reason, duration: int(video.Duration)}}
+					continue
+				}
+				result, err := d.downloadWithRetry(ctx, video, playlistName, opts)
+				results <- downloadJob{video: video, result: result, err: err}
+			}
+		}()
+	}
+
+	// Stop handing out work once shutdown starts
+	go func() {
+		defer close(jobs)
+		for i, video := range videos {
+			// Space out downloads so a big playlist doesn't trigger throttling
+			if i > 0 && d.sleep > 0 && sleepContext(ctx, d.sleep) != nil {
+				return
+			}
+			if d.waitForSpace(ctx) != nil {
+				return
+			}
+			select {
+			case jobs <- video:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// recordDownload writes a single completed download to the database
+func (d *Downloader) recordDownload(playlist *database.Playlist, record database.DownloadRecord) error {
+	if err := d.db.RecordDownload(playlist.YoutubeID, playlist.Title, record); err != nil {
+		return fmt.Errorf("failed to add video to database: %w", err)
+	}
 	return nil
 }
 
-// PlaylistResponse represents the JSON structure returned by yt-dlp for a playlist
-// getPlaylistVideos uses yt-dlp to fetch all videos in a playlist
-func (d *Downloader) getPlaylistVideos(playlistURL string) ([]VideoInfo, error) {
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+// downloadWithRetry downloads a video, retrying transient failures with
+// exponential backoff. Permanent errors are returned immediately.
+func (d *Downloader) downloadWithRetry(ctx context.Context, video VideoInfo, playlistName string, opts PlaylistOptions) (*downloadResult, error) {
+	var err error
+	start := time.Now()
+	for attempt := 1; attempt <= d.retry.Attempts; attempt++ {
+		var result *downloadResult
+		result, err = d.downloadVideo(ctx, video, playlistName, opts) // Pass the friendly name
+		if err == nil {
+			d.logger.Info("Downloaded video", "playlist", playlistName, "video_id", video.ID, "title", video.Title,
+				"bytes", result.FileSize, "duration", time.Duration(result.Duration)*time.Second,
+				"elapsed", time.Since(start).Round(time.Millisecond), "attempts", attempt)
+			return result, nil
+		}
+		if ctx.Err() != nil || isPermanentError(err) || attempt == d.retry.Attempts {
+			break
+		}
+
+		delay := d.retry.backoff(attempt)
+		d.logger.Warn("Download failed, retrying", "playlist", playlistName, "video_id", video.ID,
+			"attempt", attempt, "max_attempts", d.retry.Attempts, "retry_in", delay.Round(time.Millisecond), "error", err)
+		if sleepContext(ctx, delay) != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// truncateError keeps stored error text to a reasonable size; yt-dlp errors
+// include the full command output
+func truncateError(err error) string {
+	const maxLen = 2000
+	msg := err.Error()
+	if len(msg) > maxLen {
+		msg = msg[:maxLen] + "..."
+	}
+	return msg
+}
+
+// videoMetadata converts a playlist entry into database metadata
+func videoMetadata(video VideoInfo) database.VideoMetadata {
+	// Parse upload date
+	var uploadDate time.Time
+	if video.UploadDate != "" {
+		uploadDate, _ = time.Parse("20060102", video.UploadDate)
+	}
+
+	metadata := database.VideoMetadata{
+		Title:        video.Title,
+		Description:  video.Description,
+		Channel:      video.Channel,
+		ChannelID:    video.ChannelID,
+		Duration:     int(video.Duration),
+		ViewCount:    video.ViewCount,
+		ThumbnailURL: video.Thumbnail,
+		UploadDate:   uploadDate,
+		MetadataJSON: video.MetadataJSON,
+	}
+
+	// Recorded streams keep when they aired; the end is only known once the
+	// VOD has its full duration
+	switch video.LiveStatus {
+	case "is_live", "was_live", "post_live":
+		metadata.IsLive = true
+	}
+	metadata.IsLive = metadata.IsLive || video.IsLive
+	if metadata.IsLive && video.ReleaseTimestamp > 0 {
+		metadata.LiveStartTime = time.Unix(video.ReleaseTimestamp, 0).UTC()
+		if video.LiveStatus == "was_live" && video.Duration > 0 {
+			metadata.LiveEndTime = metadata.LiveStartTime.Add(time.Duration(video.Duration * float64(time.Second)))
+		}
+	}
+	return metadata
+}
+
+// playlistListing is yt-dlp's flat listing of a playlist or channel
+type playlistListing struct {
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Thumbnail   string      `json:"thumbnail"`
+	Thumbnails  []thumbnail `json:"thumbnails"` // Worst to best, as yt-dlp sorts them
+	Channel     string      `json:"channel"`
+	ChannelID   string      `json:"channel_id"`
+	Uploader    string      `json:"uploader"`
+	Entries     []VideoInfo `json:"entries"`
+}
+
+// thumbnail is one of the thumbnails yt-dlp lists for a playlist
+type thumbnail struct {
+	URL string `json:"url"`
+}
+
+// metadata returns the playlist's details for the database
+func (l *playlistListing) metadata() database.PlaylistMetadata {
+	thumb := l.Thumbnail
+	if thumb == "" && len(l.Thumbnails) > 0 {
+		thumb = l.Thumbnails[len(l.Thumbnails)-1].URL
+	}
+	return database.PlaylistMetadata{
+		Title:       l.Title,
+		Description: l.Description,
+		Thumbnail:   thumb,
+		Channel:     l.channelTitle(),
+		ChannelID:   l.ChannelID,
+	}
+}
+
+// channelTitle returns the name of the channel the listing belongs to
+func (l *playlistListing) channelTitle() string {
+	if l.Channel != "" {
+		return l.Channel
+	}
+	return l.Uploader
+}
+
+// getPlaylistVideos uses yt-dlp to fetch all videos in a playlist, or all
+// uploads of a channel. A single video is its own listing.
+func (d *Downloader) getPlaylistVideos(ctx context.Context, src source, opts PlaylistOptions) (*playlistListing, error) {
+	if src.Type == database.SourceVideo {
+		// Full metadata is fetched before downloading anyway
+		return &playlistListing{Entries: []VideoInfo{{ID: src.ID, PlaylistID: src.ID, PlaylistIndex: 1}}}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.listTimeout)
 	defer cancel()
 
+	if d.backend == BackendNative {
+		return d.listNative(ctx, src)
+	}
+
 	// Run yt-dlp to get playlist info as JSON
-	cmd := exec.CommandContext(ctx, "yt-dlp",
-		"--flat-playlist",
-		"--dump-single-json",
-		"--no-warnings",
-		"--skip-download",
-		playlistURL,
-	)
+	args := ytdlp.NewArgs(d.caps)
+	if err := errors.Join(
+		args.AddRequired("--flat-playlist"),
+		args.AddRequired("--dump-single-json"),
+		args.AddRequired("--skip-download"),
+		d.addNetworkArgs(args, opts),
+	); err != nil {
+		return nil, err
+	}
+	args.Add("--no-warnings")
+	args.AddPositional(src.ListURL)
+	cmd := exec.CommandContext(ctx, d.ytdlpPath, args.List()...)
 
-	output, err := cmd.CombinedOutput()
+	// Only stdout is JSON; yt-dlp still prints some warnings to stderr.
+	// Large playlists are decoded as they stream in rather than buffered.
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("yt-dlp failed: %w\nOutput: %s", err, string(output))
+		return nil, fmt.Errorf("failed to open yt-dlp output: %w", err)
 	}
 
-	// Parse the JSON output
-	var result struct {
-		Entries []VideoInfo `json:"entries"`
+	var listing *playlistListing
+	var parsed int
+	var parseErr error
+	if err = cmd.Start(); err == nil {
+		listing, parsed, parseErr = decodeListing(stdout, src.ID)
+		if parseErr != nil {
+			// Unblock yt-dlp if it is still writing
+			io.Copy(io.Discard, stdout)
+		}
+		err = cmd.Wait()
 	}
-
-	if err := json.Unmarshal(output, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse yt-dlp output: %w", err)
+	if err != nil {
+		err = fmt.Errorf("yt-dlp failed after %d entries: %w\nOutput: %s", parsed, err, stderr.String())
+		if d.fallBack(err) && src.Type == database.SourcePlaylist {
+			d.logger.Warn("Listing with the native client", "playlist_id", src.ID, "error", err)
+			return d.listNative(ctx, src)
+		}
+		return nil, err
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp output after %d entries: %w", parsed, parseErr)
 	}
 
-	// Extract playlist ID from URL
-	playlistID := extractPlaylistID(playlistURL)
+	return listing, nil
+}
 
-	// Process each video in the playlist
-	var videos []VideoInfo
-	for _, entry := range result.Entries {
-		if entry.ID == "" {
-			continue
+// addNetworkArgs adds the options every yt-dlp call that talks to YouTube
+// needs. Traffic must not bypass the proxy, so an unsupported one is an error.
+func (d *Downloader) addNetworkArgs(args *ytdlp.Args, opts PlaylistOptions) error {
+	if d.proxy != "" {
+		// Proxy URLs can carry a username and password
+		if err := args.AddSecret("--proxy", d.proxy); err != nil {
+			return err
 		}
-
-		// Ensure we have the playlist ID set
-		entry.PlaylistID = playlistID
-		videos = append(videos, entry)
 	}
+	if opts.CookiesPath != "" {
+		return args.AddSecret("--cookies", opts.CookiesPath)
+	}
+	return nil
+}
 
-	return videos, nil
+// downloadResult describes a file produced by downloadVideo
+type downloadResult struct {
+	FilePath    string
+	FileSize    int64
+	Checksum    string
+	Loudness    float64 // LUFS measured before normalization
+	ArtEmbedded bool
+	ArtMissing  string // What yt-dlp lacked to embed cover art
+	Media       database.MediaInfo
+	Duration    int              // Seconds as probed from the file; 0 when unknown
+	Tracks      []database.Track // Set when the video was split by chapter
 }
 
-// downloadVideo downloads a single video and converts it to mp3
-// Returns the output file path, file size in bytes, and any error
-func (d *Downloader) downloadVideo(videoID string, playlistName string) (string, int64, error) {
-	log.Printf("Downloading video: %s for playlist: %s", videoID, playlistName)
+// downloadVideo downloads a single video and extracts its audio, or keeps
+// the merged video when the playlist is in video mode
+// Returns the downloaded file details and any error
+func (d *Downloader) downloadVideo(ctx context.Context, video VideoInfo, playlistName string, opts PlaylistOptions) (*downloadResult, error) {
+	videoID := video.ID
+	logger := d.logger.With("playlist", playlistName, "video_id", videoID)
+	logger.Info("Downloading video", "title", video.Title)
 
 	// Create playlist-specific directory using the playlist name
-	playlistDir := filepath.Join(d.outputDir, playlistName)
+	playlistDir := d.playlistDir(playlistName, video.PlaylistID, opts)
 	if err := os.MkdirAll(playlistDir, 0755); err != nil {
-		return "", 0, fmt.Errorf("failed to create playlist directory: %w", err)
+		return nil, fmt.Errorf("failed to create playlist directory: %w", err)
+	}
+
+	// Prefer our own high-resolution artwork over yt-dlp's thumbnail choice.
+	// Embedding it is mp3-specific, so other downloads use yt-dlp's.
+	artPath := ""
+	if !opts.keepVideo() && opts.audioFormat() == "mp3" {
+		artPath = d.prepareArtwork(ctx, videoID, video.Thumbnail)
+	}
+
+	// yt-dlp writes into a staging directory so the library never sees
+	// partial downloads or intermediate formats
+	stagingDir, err := d.newStagingDir(videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	fetched, err := d.fetch(ctx, video, stagingDir, artPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	filePath, media, artEmbedded := fetched.FilePath, fetched.Media, fetched.ArtEmbedded
+
+	var tracks []database.Track
+	if opts.SplitChapters {
+		tracks, err = findChapterTracks(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find chapter tracks: %w", err)
+		}
+	}
+
+	if artPath != "" {
+		if err := d.embedArtwork(ctx, filePath, artPath); err != nil {
+			logger.Warn("Failed to embed artwork", "error", err)
+		} else {
+			artEmbedded = true
+		}
+		for _, track := range tracks {
+			if err := d.embedArtwork(ctx, track.FilePath, artPath); err != nil {
+				logger.Warn("Failed to embed artwork in track", "track", track.Number, "error", err)
+			}
+		}
+		if err := writeCoverFile(playlistDir, artPath); err != nil {
+			logger.Warn("Failed to write cover file", "error", err)
+		}
+	}
+
+	// Normalize while the files are still staged so the library only ever
+	// sees the final version
+	var loudness float64
+	if opts.LoudnessTarget != 0 {
+		for _, track := range tracks {
+			if _, err := d.normalizeLoudness(ctx, track.FilePath, opts.LoudnessTarget, opts.audioQuality()); err != nil {
+				logger.Warn("Failed to normalize track", "track", track.Number, "error", err)
+			}
+		}
+		if len(tracks) == 0 {
+			if loudness, err = d.normalizeLoudness(ctx, filePath, opts.LoudnessTarget, opts.audioQuality()); err != nil {
+				logger.Warn("Failed to normalize loudness", "error", err)
+			} else {
+				logger.Info("Normalized loudness", "from_lufs", loudness, "to_lufs", opts.LoudnessTarget)
+			}
+		}
+	}
+
+	// Probe the unsplit file, after any re-encoding, for what actually ended up on disk
+	var duration int
+	if probe, err := d.probeAudio(ctx, filePath); err != nil {
+		logger.Warn("Failed to probe file", "error", err)
+	} else {
+		if !opts.keepVideo() && probe.Codec != "" {
+			media.Codec = probe.Codec
+		}
+		media.Bitrate, media.SampleRate, media.Channels = probe.Bitrate, probe.SampleRate, probe.Channels
+		duration = probe.Duration
+	}
+
+	// Tag last so nothing after it rewrites the metadata
+	if len(tracks) > 0 {
+		for _, track := range tracks {
+			if err := d.writeTags(ctx, track.FilePath, chapterTags(video, track.Number, track.Title, len(tracks))); err != nil {
+				logger.Warn("Failed to tag track", "track", track.Number, "error", err)
+			}
+		}
+	} else if err := d.writeTags(ctx, filePath, opts.Tags.tags(video, playlistName)); err != nil {
+		logger.Warn("Failed to tag file", "error", err)
+	}
+
+	// Videos without chapters keep the normal single file
+	if len(tracks) > 0 {
+		logger.Info("Split video into chapter tracks", "tracks", len(tracks))
+
+		// yt-dlp keeps the unsplit file; the tracks replace it, and the
+		// staging directory is removed with it
+		var total int64
+		for i := range tracks {
+			path, err := d.promoteFile(stagingDir, playlistDir, tracks[i].FilePath, videoID)
+			if err != nil {
+				return nil, err
+			}
+			tracks[i].FilePath = path
+			total += tracks[i].FileSize
+		}
+		return &downloadResult{
+			FileSize:    total,
+			ArtEmbedded: artEmbedded,
+			ArtMissing:  fetched.ArtMissing,
+			Media:       media,
+			Duration:    duration,
+			Tracks:      tracks,
+		}, nil
+	}
+
+	// Get file size
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file size for '%s': %w", filePath, err)
+	}
+
+	// Record a checksum so validation can detect corruption later
+	checksum := ""
+	if d.checksums {
+		if checksum, err = database.FileChecksum(filePath); err != nil {
+			logger.Warn("Failed to checksum file", "error", err)
+		}
+	}
+
+	finalPath, err := d.promoteFile(stagingDir, playlistDir, filePath, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &downloadResult{
+		FilePath:    finalPath,
+		FileSize:    fileInfo.Size(),
+		Checksum:    checksum,
+		Loudness:    loudness,
+		ArtEmbedded: artEmbedded,
+		ArtMissing:  fetched.ArtMissing,
+		Media:       media,
+		Duration:    duration,
+	}, nil
+}
+
+// fetchResult is a file downloaded into the staging directory, before any
+// post-processing
+type fetchResult struct {
+	FilePath    string
+	Media       database.MediaInfo
+	ArtEmbedded bool   // The downloader embedded a thumbnail itself
+	ArtMissing  string // What the downloader lacked to embed one, if installing it would help
+}
+
+// fetch downloads a video into the staging directory with the configured
+// backend. In auto mode the native client takes over when yt-dlp is missing
+// or can't extract the video.
+func (d *Downloader) fetch(ctx context.Context, video VideoInfo, stagingDir, artPath string, opts PlaylistOptions) (*fetchResult, error) {
+	if d.backend == BackendNative {
+		return d.fetchNative(ctx, video, stagingDir, opts)
 	}
 
+	fetched, err := d.fetchYTDLP(ctx, video, stagingDir, artPath, opts)
+	if err != nil && d.fallBack(err) && !opts.keepVideo() {
+		d.logger.Warn("yt-dlp failed, falling back to the native client", "video_id", video.ID, "error", err)
+		return d.fetchNative(ctx, video, stagingDir, opts)
+	}
+	return fetched, err
+}
+
+// fetchYTDLP downloads a video with yt-dlp, extracting the audio or merging
+// the video as the playlist requires
+func (d *Downloader) fetchYTDLP(ctx context.Context, video VideoInfo, stagingDir, artPath string, opts PlaylistOptions) (*fetchResult, error) {
+	videoID := video.ID
+
 	// Create a template for the output filename
-	tmpl := filepath.Join(playlistDir, "%(title)s [%(id)s].%(ext)s")
-	log.Printf("Using output template: %s", tmpl)
-	
-	// Use yt-dlp to download the best audio quality and convert to mp3
-	cmd := exec.Command("yt-dlp",
-		"--extract-audio",
-		"--audio-format", "mp3",
-		"--audio-quality", "0", // Best quality
-		"--embed-thumbnail",
-		"--add-metadata",
-		"--output", tmpl,
-		"--no-warnings",
-		"--no-playlist", // Ensure we only download the video, not the whole playlist
-		"https://youtube.com/watch?v="+videoID,
-	)
+	tmpl := filepath.Join(stagingDir, opts.filenameTemplate())
+	d.logger.Debug("Using output template", "video_id", videoID, "template", tmpl)
+
+	// Without these the file would land in the wrong place or format, so
+	// unlike the options further down they can't be dropped
+	args := ytdlp.NewArgs(d.caps)
+	media := opts.audioMedia()
+	var err error
+	if opts.keepVideo() {
+		media = database.MediaInfo{MediaType: "video", Container: opts.videoContainer()}
+		err = errors.Join(
+			args.AddRequired("--format", "bestvideo*+bestaudio/best"),
+			args.AddRequired("--merge-output-format", media.Container),
+		)
+	} else {
+		err = errors.Join(
+			args.AddRequired("--extract-audio"),
+			args.AddRequired("--audio-format", media.Container),
+		)
+		args.Add("--audio-quality", opts.audioQuality())
+	}
+	if err = errors.Join(err,
+		d.addNetworkArgs(args, opts),
+		args.AddRequired("--output", tmpl),
+		args.AddRequired("--no-playlist"), // Ensure we only download the video, not the whole playlist
+	); err != nil {
+		return nil, err
+	}
+
+	// yt-dlp only embeds art when our own artwork isn't available
+	artEmbedded, artMissing := false, ""
+	if artPath == "" {
+		if d.caps.CanEmbedThumbnail(media.Container) {
+			artEmbedded = args.Add("--embed-thumbnail")
+		} else {
+			artMissing = d.caps.MissingForThumbnail(media.Container)
+			d.logger.Warn("Skipping thumbnail embedding: yt-dlp is missing the required post-processor", "video_id", videoID, "missing", artMissing)
+		}
+	}
 
-	// Add more detailed logging for the command
-	log.Printf("Executing yt-dlp command: %v", cmd.Args)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	args.Add("--add-metadata")
+	args.Add("--ffmpeg-location", d.ffmpegPath)
+	if d.rateLimit != "" {
+		args.Add("--limit-rate", d.rateLimit)
+	}
+	if opts.SplitChapters {
+		// Chapters go in a folder named like the unsplit file would be
+		args.Add("--split-chapters")
+		args.Add("--output", "chapter:"+chapterTemplate(tmpl))
+	}
+	args.Add("--no-warnings")
 
-	// Create a buffer to capture command output
-	var output bytes.Buffer
-	cmd.Stdout = &output
-	cmd.Stderr = &output
+	// One progress line per update, shown even though --print implies --quiet
+	args.Add("--newline")
+	args.Add("--progress")
+
+	// Video codecs depend on the formats yt-dlp picked, so have it report them
+	// on the line before the path
+	printsCodec := false
+	if opts.keepVideo() {
+		printsCodec = args.Add("--print", "after_move:%(vcodec)s+%(acodec)s")
+	}
+
+	// Have yt-dlp print the final path once post-processing has moved the file.
+	// --print implies --simulate, so downloading has to be re-enabled explicitly.
+	printsPath := args.Add("--print", "after_move:filepath")
+	if printsPath && !args.Add("--no-simulate") {
+		return nil, fmt.Errorf("installed yt-dlp supports --print but not --no-simulate")
+	}
+	args.AddPositional("https://youtube.com/watch?v=" + videoID)
+
+	// Use yt-dlp to download the best quality and convert or merge it
+	cmd := exec.CommandContext(ctx, d.ytdlpPath, args.List()...)
+
+	// Add more detailed logging for the command; cookies and proxy
+	// credentials are masked
+	d.logger.Debug("Executing yt-dlp command", "video_id", videoID, "command", strings.Join(append([]string{d.ytdlpPath}, args.Redacted()...), " "))
+
+	// Keep stdout separate so the printed path isn't mixed with log noise.
+	// Output is streamed so progress can be reported while yt-dlp runs.
+	stdout := newProgressWriter(videoID, d.onProgress)
+	stderr := newProgressWriter(videoID, d.onProgress)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	if err := cmd.Run(); err != nil {
-		return "", 0, fmt.Errorf("yt-dlp download failed: %w\nOutput: %s", err, output.String())
+		return nil, fmt.Errorf("yt-dlp download failed: %w\nOutput: %s%s", err, stdout.String(), stderr.String())
 	}
 
 	// Log the output for debugging
-	log.Printf("Download output for %s in %s: %s", videoID, playlistName, output.String())
+	d.logger.Debug("yt-dlp output", "video_id", videoID, "output", stdout.String()+stderr.String())
 
-	// Parse the output to find the actual file path
-	outputStr := output.String()
-	filePath := ""
-	for _, line := range strings.Split(outputStr, "\n") {
-		if strings.Contains(line, "[ExtractAudio] Destination:") {
-			filePath = strings.TrimSpace(strings.Split(line, ":")[1])
-		} else if strings.Contains(line, "[download] Destination:") {
-			// Fallback for non-audio conversion downloads
-			filePath = strings.TrimSpace(strings.Split(line, ":")[1])
-		}
+	var filePath string
+	if printsPath {
+		filePath = parsePrintedPath(stdout.String())
+	} else {
+		// Older yt-dlp builds: fall back to the progress output
+		filePath = parseDestination(stdout.String() + "\n" + stderr.String())
 	}
 
 	if filePath == "" {
-		return "", 0, fmt.Errorf("could not find file path in yt-dlp output")
+		return nil, fmt.Errorf("could not find file path in yt-dlp output")
+	}
+	if printsCodec && printsPath {
+		media.Codec = parsePrintedCodec(stdout.String())
+	}
+	if ext := strings.TrimPrefix(filepath.Ext(filePath), "."); ext != "" {
+		// yt-dlp falls back to another container when the streams can't be merged
+		media.Container = strings.ToLower(ext)
 	}
 
-	// Get file size
-	fileInfo, err := os.Stat(filePath)
+	return &fetchResult{FilePath: filePath, Media: media, ArtEmbedded: artEmbedded, ArtMissing: artMissing}, nil
+
+}
+
+// upload hands a recorded download to the uploader, when uploads are on
+func (d *Downloader) upload(videoID string) {
+	if d.uploader != nil {
+		d.uploader.Enqueue(videoID)
+	}
+}
+
+// ensurePlaylistCopy links an already-downloaded video into a playlist's
+// folder instead of downloading it again
+func (d *Downloader) ensurePlaylistCopy(videoID, playlistYoutubeID, playlistName string, opts PlaylistOptions) error {
+	present, err := d.db.HasPlaylistCopy(videoID, playlistYoutubeID)
+	if err != nil || present {
+		return err
+	}
+	if location, err := d.db.GetStorageLocation(videoID); err != nil || location == database.StorageRemote {
+		return err // Nothing left locally to link; the video stays in its first playlist
+	}
+
+	src, err := d.db.GetFilePath(videoID)
+	if err != nil || src == "" {
+		return err
+	}
+
+	dst := filepath.Join(d.playlistDir(playlistName, playlistYoutubeID, opts), filepath.Base(src))
+	linkType, err := linkFile(src, dst, d.linkMode)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to get file size for '%s': %w", filePath, err)
+		return err
 	}
 
-	return filePath, fileInfo.Size(), nil
+	d.logger.Info("Linked video into playlist", "playlist", playlistName, "video_id", videoID, "link_type", linkType)
+	return d.db.AddVideoLink(videoID, playlistYoutubeID, dst, linkType)
 }
 
-// extractPlaylistID extracts the playlist ID from a YouTube URL
-func extractPlaylistID(url string) string {
-	// Handle direct ID
-	if !strings.Contains(url, "youtube.com") && !strings.Contains(url, "youtu.be") {
-		return url
+// parsePrintedPath returns the path printed by --print after_move:filepath,
+// which is the last non-empty line of stdout
+func parsePrintedPath(stdout string) string {
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
 	}
+	return ""
+}
 
-	// Extract from URL parameters
-	if strings.Contains(url, "list=") {
-		parts := strings.Split(url, "list=")
-		if len(parts) > 1 {
-			id := strings.Split(parts[1], "&")[0]
-			if id != "" {
-				return id
-			}
+// parsePrintedCodec returns the codec line printed just before the path
+func parsePrintedCodec(stdout string) string {
+	var lines []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 {
+		return ""
+	}
+	return lines[len(lines)-2]
+}
+
+// parseDestination finds the output file in yt-dlp's progress output,
+// preferring the post-conversion audio file or merged video over the raw download
+func parseDestination(output string) string {
+	filePath := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "[Merger] Merging formats into") {
+			return strings.Trim(strings.TrimSpace(strings.SplitN(line, "Merging formats into", 2)[1]), `"`)
+		}
+		if !strings.Contains(line, "[ExtractAudio] Destination:") && !strings.Contains(line, "[download] Destination:") {
+			continue
+		}
+		// Split on the marker rather than ":" so paths containing colons survive
+		filePath = strings.TrimSpace(strings.SplitN(line, "Destination:", 2)[1])
+		if strings.Contains(line, "[ExtractAudio]") {
+			break
 		}
 	}
-	return url
+	return filePath
+}
+
+// prepareArtwork fetches the best available thumbnail for a video
+// Returns an empty path when artwork is disabled or nothing usable was found
+func (d *Downloader) prepareArtwork(ctx context.Context, videoID, thumbnailURL string) string {
+	if d.artwork == nil {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	artPath, err := d.artwork.Fetch(ctx, videoID, thumbnailURL)
+	if err != nil {
+		d.logger.Warn("Falling back to yt-dlp thumbnail", "video_id", videoID, "error", err)
+		return ""
+	}
+	return artPath
 }
 
-func sanitizeFilename(filename string) string {
-	// Remove invalid characters
-	replacer := strings.NewReplacer(
-		"<", "", ">", "", ":", "",
-		"\"", "", "/", "", "\\", "",
-		"|", "", "?", "", "*", "",
-		" ", "_",
+// embedArtwork replaces the cover image embedded in an mp3 using ffmpeg
+func (d *Downloader) embedArtwork(ctx context.Context, filePath, artPath string) error {
+	tmpPath := filepath.Join(filepath.Dir(filePath), ".artwork-"+filepath.Base(filePath))
+	defer os.Remove(tmpPath)
+
+	cmd := exec.CommandContext(ctx, d.ffmpegPath,
+		"-y",
+		"-loglevel", "error",
+		"-i", filePath,
+		"-i", artPath,
+		"-map", "0:a",
+		"-map", "1:0",
+		"-c", "copy",
+		"-id3v2_version", "3",
+		"-metadata:s:v", "title=Album cover",
+		"-metadata:s:v", "comment=Cover (front)",
+		"-disposition:v:0", "attached_pic",
+		tmpPath,
 	)
-	return replacer.Replace(filename)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
+	}
+
+	return os.Rename(tmpPath, filePath)
+}
+
+// writeCoverFile copies artwork to cover.jpg in dir unless one already exists
+func writeCoverFile(dir, artPath string) error {
+	coverPath := filepath.Join(dir, "cover.jpg")
+	if _, err := os.Stat(coverPath); err == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(artPath)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(coverPath, data, 0644)
+}
+
+// playlistDir returns the library folder of a playlist: its OutputSubdir,
+// or one named after it
+func (d *Downloader) playlistDir(playlistName, playlistID string, opts PlaylistOptions) string {
+	if opts.OutputSubdir != "" {
+		return filepath.Join(d.outputDir, opts.OutputSubdir)
+	}
+	return filepath.Join(d.outputDir, filename.Sanitize(playlistName, playlistID))
 }
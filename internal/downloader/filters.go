@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// skippedError is returned for a video filtered out once its full metadata
+// was known
+type skippedError struct {
+	reason   string
+	duration int
+}
+
+func (e *skippedError) Error() string {
+	return fmt.Sprintf("skipped: %s (%s)", e.reason, time.Duration(e.duration)*time.Second)
+}
+
+// filter returns why a video is skipped this pass, or an empty string if
+// it's downloaded
+func (o PlaylistOptions) filter(video VideoInfo) string {
+	if reason := o.titleFilter(video.Title); reason != "" {
+		return reason
+	}
+	if reason := liveFilter(video); reason != "" {
+		return reason
+	}
+	return o.durationFilter(video.Duration)
+}
+
+// liveFilter defers streams that are live or haven't started, which yt-dlp
+// would either fail on or record indefinitely. Streams that just ended are
+// deferred too, until YouTube has processed the VOD.
+func liveFilter(video VideoInfo) string {
+	switch video.LiveStatus {
+	case "is_live", "post_live":
+		return database.SkipLive
+	case "is_upcoming":
+		return database.SkipUpcoming
+	}
+	if video.IsLive {
+		return database.SkipLive
+	}
+	return ""
+}
+
+// isLiveSkip reports whether a skip is only until the stream is over
+func isLiveSkip(reason string) bool {
+	return reason == database.SkipLive || reason == database.SkipUpcoming
+}
+
+// skipReason maps a recorded skip to what the callback reports
+func skipReason(reason string) SkipReason {
+	if isLiveSkip(reason) {
+		return SkipLive
+	}
+	if reason == database.SkipTitle {
+		return SkipTitle
+	}
+	return SkipDuration
+}
+
+// stillSkipped reports whether a video skipped on an earlier pass is still
+// left out by the current settings, so changed limits or filters let it
+// through. Live streams are checked again every pass.
+func (o PlaylistOptions) stillSkipped(skipped *database.SkippedVideo, video VideoInfo) bool {
+	switch {
+	case isLiveSkip(skipped.Reason):
+		return false
+	case skipped.Reason == database.SkipTitle:
+		return o.titleFilter(video.Title) != ""
+	default:
+		return o.durationFilter(float64(skipped.Duration)) != ""
+	}
+}
+
+// titleFilter returns why a video with the given title is skipped, or an
+// empty string if it's downloaded. Unknown titles pass.
+func (o PlaylistOptions) titleFilter(title string) string {
+	if title == "" || len(o.TitleInclude)+len(o.TitleExclude) == 0 {
+		return ""
+	}
+	for _, re := range o.TitleExclude {
+		if re.MatchString(title) {
+			return database.SkipTitle
+		}
+	}
+	if len(o.TitleInclude) == 0 {
+		return ""
+	}
+	for _, re := range o.TitleInclude {
+		if re.MatchString(title) {
+			return ""
+		}
+	}
+	return database.SkipTitle
+}
+
+// durationFilter returns why a video of the given length in seconds is
+// skipped, or an empty string if it's downloaded. Unknown durations pass.
+func (o PlaylistOptions) durationFilter(seconds float64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	d := time.Duration(seconds * float64(time.Second))
+	if o.MaxDuration > 0 && d > o.MaxDuration {
+		return database.SkipTooLong
+	}
+	if o.MinDuration > 0 && d < o.MinDuration {
+		return database.SkipTooShort
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// listingFingerprint identifies a playlist's listing together with the
+// options that decide what is done with it. An unchanged fingerprint means
+// a pass would find nothing new, so its videos can be skipped.
+func listingFingerprint(ids []string, opts PlaylistOptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n", len(ids), strings.Join(ids, "\n"))
+
+	// Anything that changes which videos are wanted, or where they go
+	blocked := make([]string, 0, len(opts.BlockedIDs))
+	for id := range opts.BlockedIDs {
+		blocked = append(blocked, id)
+	}
+	sort.Strings(blocked)
+	fmt.Fprintf(h, "%s|%s|%s|%s|%s|%s|%t\n", opts.MediaType, opts.AudioFormat, opts.OutputSubdir,
+		opts.MinDuration, opts.MaxDuration, strings.Join(blocked, ","), opts.SyncDeletions)
+	for _, re := range opts.TitleInclude {
+		fmt.Fprintf(h, "+%s\n", re)
+	}
+	for _, re := range opts.TitleExclude {
+		fmt.Fprintf(h, "-%s\n", re)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Link modes for placing an already-downloaded file into another playlist folder
+const (
+	LinkModeHardlink = "hardlink"
+	LinkModeReflink  = "reflink"
+	LinkModeSymlink  = "symlink"
+
+	// linkTypeCopy is recorded when linking wasn't possible and the file was copied
+	linkTypeCopy = "copy"
+)
+
+// linkFile places src at dst using mode, falling back to a full copy when the
+// link can't be created (e.g. across filesystems). Returns the link type used.
+func linkFile(src, dst, mode string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to create link directory: %w", err)
+	}
+
+	var err error
+	switch mode {
+	case LinkModeSymlink:
+		abs, absErr := filepath.Abs(src)
+		if absErr != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", src, absErr)
+		}
+		if err = os.Symlink(abs, dst); err == nil {
+			return LinkModeSymlink, nil
+		}
+	case LinkModeReflink:
+		if err = reflink(src, dst); err == nil {
+			return LinkModeReflink, nil
+		}
+	default:
+		if err = os.Link(src, dst); err == nil {
+			return LinkModeHardlink, nil
+		}
+	}
+
+	if errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("link destination %s already exists", dst)
+	}
+	if errors.Is(err, syscall.EXDEV) {
+		slog.Warn("Files are on different filesystems; copying instead of linking", "src", src, "dst", dst)
+	} else {
+		slog.Warn("Failed to link file, copying instead", "mode", mode, "src", src, "error", err)
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return "", err
+	}
+	return linkTypeCopy, nil
+}
+
+// copyFile copies src to dst through a temporary file so dst is never partial
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".copy-*"+filepath.Ext(dst))
+	if err != nil {
+		return fmt.Errorf("failed to create copy of %s: %w", src, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
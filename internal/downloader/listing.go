@@ -0,0 +1,98 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// decodeListing reads yt-dlp's --dump-single-json output for a playlist one
+// entry at a time, so the raw JSON of a huge playlist is never held in
+// memory. Returns how many entries were read, including on error.
+func decodeListing(r io.Reader, playlistID string) (*playlistListing, int, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, 0, err
+	}
+
+	listing := &playlistListing{}
+	parsed := 0
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, parsed, err
+		}
+
+		switch key {
+		case "title":
+			err = dec.Decode(&listing.Title)
+		case "description":
+			err = dec.Decode(&listing.Description)
+		case "thumbnail":
+			err = dec.Decode(&listing.Thumbnail)
+		case "thumbnails":
+			err = dec.Decode(&listing.Thumbnails)
+		case "channel":
+			err = dec.Decode(&listing.Channel)
+		case "channel_id":
+			err = dec.Decode(&listing.ChannelID)
+		case "uploader":
+			err = dec.Decode(&listing.Uploader)
+		case "entries":
+			err = decodeEntries(dec, playlistID, listing, &parsed)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return nil, parsed, fmt.Errorf("failed to decode %v: %w", key, err)
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, parsed, err
+	}
+	return listing, parsed, nil
+}
+
+// decodeEntries reads the entries array, numbering entries by their
+// position in the playlist
+func decodeEntries(dec *json.Decoder, playlistID string, listing *playlistListing, parsed *int) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil { // "entries": null
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("expected an array, got %v", tok)
+	}
+
+	for i := 1; dec.More(); i++ {
+		var entry VideoInfo
+		if err := dec.Decode(&entry); err != nil {
+			return err
+		}
+		*parsed++
+		if entry.ID == "" {
+			continue
+		}
+		entry.PlaylistID = playlistID
+		entry.PlaylistIndex = i
+		listing.Entries = append(listing.Entries, entry)
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token and checks it is the given delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeListing(t *testing.T) {
+	listing, parsed, err := decodeListing(strings.NewReader(`{
+		"title": "Big", "description": null, "thumbnails": [{"url": "small"}, {"url": "large"}], "channel": "Chan", "channel_id": "UC1", "uploader": null,
+		"entries": [{"id": "aaaaaaaaaaa", "title": "One"}, {"id": "", "title": "[Deleted]"}, {"id": "ccccccccccc", "duration": 61.5}],
+		"epoch": 1
+	}`), "PL_BIG")
+	require.NoError(t, err)
+	assert.Equal(t, 3, parsed)
+	assert.Equal(t, "Chan", listing.channelTitle())
+	assert.Equal(t, "UC1", listing.ChannelID)
+	assert.Equal(t, database.PlaylistMetadata{Title: "Big", Thumbnail: "large", Channel: "Chan", ChannelID: "UC1"}, listing.metadata())
+	require.Len(t, listing.Entries, 2)
+	assert.Equal(t, "ccccccccccc", listing.Entries[1].ID)
+	assert.Equal(t, 3, listing.Entries[1].PlaylistIndex, "Positions count skipped entries")
+	assert.Equal(t, "PL_BIG", listing.Entries[1].PlaylistID)
+
+	listing, _, err = decodeListing(strings.NewReader(`{"entries": null}`), "PL_EMPTY")
+	require.NoError(t, err)
+	assert.Empty(t, listing.Entries)
+}
+
+func TestDecodeListingReportsProgressOnError(t *testing.T) {
+	var entries []string
+	for i := 0; i < 1000; i++ {
+		entries = append(entries, fmt.Sprintf(`{"id": "vid%08d"}`, i))
+	}
+	// Cut off partway through an entry, as when yt-dlp is killed
+	truncated := `{"entries": [` + strings.Join(entries[:500], ",") + `, {"id": "vi`
+
+	_, parsed, err := decodeListing(strings.NewReader(truncated), "PL_CUT")
+	assert.Error(t, err)
+	assert.Equal(t, 500, parsed)
+}
@@ -0,0 +1,119 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Loudness range and true peak used alongside the integrated target
+const (
+	loudnormLRA         = 11
+	loudnormTruePeak    = -1.5
+	loudnormAACBitrate  = "192k"
+	loudnormOpusBitrate = "160k"
+)
+
+// loudnormStats is the measurement printed by ffmpeg's loudnorm filter with
+// print_format=json; ffmpeg reports the numbers as strings
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// parseLoudnormOutput extracts the JSON block loudnorm prints at the end of
+// ffmpeg's output
+func parseLoudnormOutput(output string) (loudnormStats, error) {
+	var stats loudnormStats
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return stats, fmt.Errorf("no loudnorm measurement in ffmpeg output")
+	}
+	if err := json.Unmarshal([]byte(output[start:end+1]), &stats); err != nil {
+		return stats, fmt.Errorf("failed to parse loudnorm measurement: %w", err)
+	}
+	return stats, nil
+}
+
+// normalizeLoudness runs two-pass EBU R128 normalization on a file in place:
+// the first pass measures it, the second applies a linear gain to reach
+// target LUFS. Returns the integrated loudness measured before normalizing.
+func (d *Downloader) normalizeLoudness(ctx context.Context, filePath string, target float64, quality string) (float64, error) {
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%d", target, loudnormTruePeak, loudnormLRA)
+
+	measure := exec.CommandContext(ctx, d.ffmpegPath,
+		"-hide_banner",
+		"-nostats",
+		"-i", filePath,
+		"-af", filter+":print_format=json",
+		"-f", "null",
+		"-",
+	)
+	output, err := measure.CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("ffmpeg loudness measurement failed: %w\nOutput: %s", err, string(output))
+	}
+	stats, err := parseLoudnormOutput(string(output))
+	if err != nil {
+		return 0, err
+	}
+	measured, err := strconv.ParseFloat(stats.InputI, 64)
+	if err != nil {
+		// Silence measures as -inf
+		return 0, fmt.Errorf("unusable loudness measurement %q", stats.InputI)
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(filePath), ".loudnorm-"+filepath.Base(filePath))
+	defer os.Remove(tmpPath)
+
+	args := []string{
+		"-y",
+		"-loglevel", "error",
+		"-i", filePath,
+		"-map", "0",
+		"-map_metadata", "0",
+		"-c", "copy", // Cover art and video streams are kept as they are
+		"-af", fmt.Sprintf("%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+			filter, stats.InputI, stats.InputTP, stats.InputLRA, stats.InputThresh, stats.TargetOffset),
+	}
+	args = append(args, loudnormCodecArgs(filePath, quality)...)
+	args = append(args, tmpPath)
+
+	apply := exec.CommandContext(ctx, d.ffmpegPath, args...)
+	if output, err := apply.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("ffmpeg loudness normalization failed: %w\nOutput: %s", err, string(output))
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return 0, err
+	}
+	return measured, nil
+}
+
+// loudnormCodecArgs re-encodes the audio stream in the file's own format.
+// loudnorm resamples to 192kHz internally, so the output rate is set back.
+func loudnormCodecArgs(filePath, quality string) []string {
+	if strings.EqualFold(filepath.Ext(filePath), ".mp3") {
+		args := []string{"-c:a", "libmp3lame", "-ar", "44100", "-id3v2_version", "3"}
+		if strings.HasSuffix(strings.ToUpper(quality), "K") {
+			return append(args, "-b:a", strings.ToLower(quality))
+		}
+		return append(args, "-q:a", quality)
+	}
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".opus":
+		return []string{"-c:a", "libopus", "-b:a", loudnormOpusBitrate, "-ar", "48000"}
+	case ".flac":
+		return []string{"-c:a", "flac", "-ar", "48000"}
+	}
+	return []string{"-c:a", "aac", "-b:a", loudnormAACBitrate, "-ar", "48000"}
+}
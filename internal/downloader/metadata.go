@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/ytdlp"
+)
+
+// maxMetadataBackfill caps how many existing videos get their metadata
+// refetched per playlist pass, so a large imported archive is filled in
+// gradually instead of stalling one run
+const maxMetadataBackfill = 20
+
+// fetchVideoInfo asks yt-dlp, or the native client depending on the backend,
+// for a single video's full metadata. Flat playlist entries leave duration,
+// views, description and upload date empty.
+func (d *Downloader) fetchVideoInfo(ctx context.Context, videoID string, opts PlaylistOptions) (VideoInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	if d.backend == BackendNative {
+		return d.fetchVideoInfoNative(ctx, videoID)
+	}
+
+	args := ytdlp.NewArgs(d.caps)
+	if err := errors.Join(
+		args.AddRequired("--dump-json"),
+		args.AddRequired("--skip-download"),
+		args.AddRequired("--no-playlist"),
+		d.addNetworkArgs(args, opts),
+	); err != nil {
+		return VideoInfo{}, err
+	}
+	args.Add("--no-warnings")
+	args.AddPositional("https://youtube.com/watch?v=" + videoID)
+	cmd := exec.CommandContext(ctx, d.ytdlpPath, args.List()...)
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		if d.fallBack(err) {
+			return d.fetchVideoInfoNative(ctx, videoID)
+		}
+		return VideoInfo{}, fmt.Errorf("yt-dlp failed: %w", err)
+	}
+
+	var info VideoInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return VideoInfo{}, fmt.Errorf("failed to parse yt-dlp output: %w", err)
+	}
+	if info.ID != videoID {
+		return VideoInfo{}, fmt.Errorf("yt-dlp returned metadata for %q", info.ID)
+	}
+	return info, nil
+}
+
+// withFullInfo returns the playlist entry with its full metadata, or the
+// entry unchanged if it couldn't be fetched
+func (d *Downloader) withFullInfo(ctx context.Context, video VideoInfo, opts PlaylistOptions) VideoInfo {
+	info, err := d.fetchVideoInfo(ctx, video.ID, opts)
+	if err != nil {
+		d.logger.Warn("Failed to fetch metadata, using the playlist entry", "video_id", video.ID, "error", err)
+		return video
+	}
+	info.PlaylistID = video.PlaylistID
+	info.PlaylistIndex = video.PlaylistIndex
+	return info
+}
+
+// backfillMetadata fills in full metadata for a video recorded from a flat
+// listing. Returns whether a fetch was attempted.
+func (d *Downloader) backfillMetadata(ctx context.Context, video VideoInfo, opts PlaylistOptions) bool {
+	needs, err := d.db.NeedsMetadata(video.ID)
+	if err != nil {
+		d.logger.Error("Failed to check video metadata", "video_id", video.ID, "error", err)
+		return false
+	}
+	if !needs {
+		return false
+	}
+
+	info, err := d.fetchVideoInfo(ctx, video.ID, opts)
+	if err != nil {
+		d.logger.Warn("Failed to backfill metadata", "video_id", video.ID, "error", err)
+		return true
+	}
+	if err := d.db.UpdateVideoMetadata(video.ID, videoMetadata(info)); err != nil {
+		d.logger.Warn("Failed to update metadata", "video_id", video.ID, "error", err)
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	youtube "github.com/kkdai/youtube/v2"
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/filename"
+)
+
+// Download backends
+const (
+	BackendAuto   = "auto"   // yt-dlp, falling back to the native client when it's missing or broken
+	BackendYTDLP  = "yt-dlp" // yt-dlp only
+	BackendNative = "native" // The built-in YouTube client and ffmpeg only
+)
+
+// extractorErrors are yt-dlp messages that mean YouTube changed something
+// yt-dlp can't cope with yet, rather than a problem with the video
+var extractorErrors = []string{
+	"Unable to extract",
+	"unable to extract",
+	"Signature extraction failed",
+	"nsig extraction failed",
+	"Failed to extract any player response",
+	"ExtractorError",
+}
+
+// isExtractorError reports whether yt-dlp is missing or failed in a way the
+// native client might not
+func isExtractorError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	if classifyUnavailable(err) != "" {
+		return false
+	}
+	msg := err.Error()
+	for _, pattern := range extractorErrors {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// fallBack reports whether a failed yt-dlp call should be retried with the
+// native client
+func (d *Downloader) fallBack(err error) bool {
+	return d.backend == BackendAuto && isExtractorError(err)
+}
+
+// templateFieldRe matches yt-dlp output template fields like %(title)s
+var templateFieldRe = regexp.MustCompile(`%\(([a-z_]+)\)(0?\d*)[sd]`)
+
+// nativeFilename expands the yt-dlp output template the same way yt-dlp
+// would for the fields we know, so both backends name files alike. Unknown
+// fields become "NA", as in yt-dlp.
+func nativeFilename(tmpl string, video VideoInfo, ext string) string {
+	channel := video.Channel
+	if channel == "" {
+		channel = video.Uploader
+	}
+	uploader := video.Uploader
+	if uploader == "" {
+		uploader = channel
+	}
+	fields := map[string]string{
+		"id":             video.ID,
+		"title":          video.Title,
+		"channel":        channel,
+		"uploader":       uploader,
+		"upload_date":    video.UploadDate,
+		"playlist_index": strconv.Itoa(video.PlaylistIndex),
+		"ext":            ext,
+	}
+
+	parts := strings.Split(tmpl, string(filepath.Separator))
+	for i, part := range parts {
+		parts[i] = templateFieldRe.ReplaceAllStringFunc(part, func(field string) string {
+			m := templateFieldRe.FindStringSubmatch(field)
+			value, ok := fields[m[1]]
+			if !ok || value == "" {
+				return "NA"
+			}
+			if n, err := strconv.Atoi(value); err == nil && m[2] != "" {
+				width, _ := strconv.Atoi(m[2])
+				return fmt.Sprintf("%0*d", width, n)
+			}
+			return filename.Sanitize(value, "NA")
+		})
+	}
+	return strings.Join(parts, string(filepath.Separator))
+}
+
+// bestAudioFormat returns the audio-only format with the highest bitrate
+func bestAudioFormat(formats youtube.FormatList) (*youtube.Format, error) {
+	audio := formats.Type("audio").WithAudioChannels()
+	var best *youtube.Format
+	for i := range audio {
+		if best == nil || audio[i].Bitrate > best.Bitrate {
+			best = &audio[i]
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no audio formats available")
+	}
+	return best, nil
+}
+
+// fetchNative downloads the best audio stream with the native client and
+// converts it to the playlist's audio format with ffmpeg, inside the
+// staging directory
+func (d *Downloader) fetchNative(ctx context.Context, video VideoInfo, stagingDir string, opts PlaylistOptions) (*fetchResult, error) {
+	if opts.keepVideo() {
+		return nil, fmt.Errorf("the native client only downloads audio")
+	}
+	if opts.CookiesPath != "" {
+		d.logger.Warn("The native client doesn't use cookies; the download may fail if it needs them", "video_id", video.ID)
+	}
+
+	v, err := d.client.GetVideoContext(ctx, video.ID)
+	if err != nil {
+		return nil, fmt.Errorf("native client failed to get video %s: %w", video.ID, err)
+	}
+	format, err := bestAudioFormat(v.Formats)
+	if err != nil {
+		return nil, fmt.Errorf("native client failed for %s: %w", video.ID, err)
+	}
+	stream, _, err := d.client.GetStreamContext(ctx, v, format)
+	if err != nil {
+		return nil, fmt.Errorf("native client failed to open stream for %s: %w", video.ID, err)
+	}
+	defer stream.Close()
+
+	// Prefer the playlist entry's details, which match what yt-dlp would use
+	if video.Title == "" {
+		video.Title = v.Title
+	}
+	if video.Channel == "" && video.Uploader == "" {
+		video.Uploader = v.Author
+	}
+	filePath := filepath.Join(stagingDir, nativeFilename(opts.filenameTemplate(), video, opts.audioFormat()))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Same encoder settings as yt-dlp's --audio-quality and normalization
+	args := []string{"-y", "-loglevel", "error", "-i", "pipe:0", "-vn"}
+	args = append(args, loudnormCodecArgs(filePath, opts.audioQuality())...)
+	args = append(args, filePath)
+
+	d.logger.Info("Downloading with the native client", "video_id", video.ID, "mime_type", format.MimeType, "bitrate", format.Bitrate)
+	cmd := exec.CommandContext(ctx, d.ffmpegPath, args...)
+	cmd.Stdin = stream
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
+	}
+
+	if opts.SplitChapters {
+		d.logger.Warn("The native client can't split chapters; keeping one file", "video_id", video.ID)
+	}
+
+	return &fetchResult{
+		FilePath: filePath,
+		Media:    opts.audioMedia(),
+	}, nil
+}
+
+// fetchVideoInfoNative gets a video's metadata with the native client
+func (d *Downloader) fetchVideoInfoNative(ctx context.Context, videoID string) (VideoInfo, error) {
+	v, err := d.client.GetVideoContext(ctx, videoID)
+	if err != nil {
+		return VideoInfo{}, fmt.Errorf("native client failed: %w", err)
+	}
+
+	info := VideoInfo{
+		ID:          v.ID,
+		Title:       v.Title,
+		Description: v.Description,
+		Duration:    v.Duration.Seconds(),
+		Channel:     v.Author,
+		ChannelID:   v.ChannelID,
+		Uploader:    v.Author,
+		ViewCount:   int64(v.Views),
+	}
+	if !v.PublishDate.IsZero() {
+		info.UploadDate = v.PublishDate.Format("20060102")
+	}
+	if len(v.Thumbnails) > 0 {
+		info.Thumbnail = v.Thumbnails[len(v.Thumbnails)-1].URL
+	}
+	return info, nil
+}
+
+// listNative lists a playlist with the native client, which can't list
+// channel uploads
+func (d *Downloader) listNative(ctx context.Context, src source) (*playlistListing, error) {
+	if src.Type != database.SourcePlaylist {
+		return nil, fmt.Errorf("the native client can only list playlists")
+	}
+
+	playlist, err := d.client.GetPlaylistContext(ctx, src.ListURL)
+	if err != nil {
+		return nil, fmt.Errorf("native client failed to list playlist: %w", err)
+	}
+
+	listing := &playlistListing{Title: playlist.Title, Description: playlist.Description, Uploader: playlist.Author}
+	for i, entry := range playlist.Videos {
+		listing.Entries = append(listing.Entries, VideoInfo{
+			ID:            entry.ID,
+			Title:         entry.Title,
+			Duration:      entry.Duration.Seconds(),
+			Uploader:      entry.Author,
+			PlaylistID:    src.ID,
+			PlaylistIndex: i + 1,
+		})
+	}
+	return listing, nil
+}
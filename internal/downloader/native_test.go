@@ -0,0 +1,40 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativeFilename(t *testing.T) {
+	video := VideoInfo{ID: "abc123", Title: "AC/DC: Back in Black?", Uploader: "AC DC", PlaylistIndex: 7}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"%(title)s.%(ext)s", "ACDC Back in Black.mp3"},
+		{"%(playlist_index)03d - %(title)s [%(id)s].%(ext)s", "007 - ACDC Back in Black [abc123].mp3"},
+		{"%(channel)s/%(title)s.%(ext)s", "AC DC/ACDC Back in Black.mp3"},
+		{"%(upload_date)s %(album)s.%(ext)s", "NA NA.mp3"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, nativeFilename(tt.tmpl, video, "mp3"), tt.tmpl)
+	}
+}
+
+func TestIsExtractorError(t *testing.T) {
+	assert.True(t, isExtractorError(fmt.Errorf("yt-dlp failed: %w", exec.ErrNotFound)))
+	assert.True(t, isExtractorError(errors.New("ERROR: [youtube] abc: Unable to extract uploader id")))
+	assert.True(t, isExtractorError(errors.New("nsig extraction failed: You may experience throttling")))
+	assert.False(t, isExtractorError(errors.New("ERROR: [youtube] abc: Private video. Sign in if you've been granted access")))
+	assert.False(t, isExtractorError(errors.New("HTTP Error 429: Too Many Requests")))
+	assert.False(t, isExtractorError(nil))
+
+	d := &Downloader{backend: BackendYTDLP}
+	assert.False(t, d.fallBack(exec.ErrNotFound), "yt-dlp backend never falls back")
+	d.backend = BackendAuto
+	assert.True(t, d.fallBack(exec.ErrNotFound))
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ToolVersions are the versions of the external tools the downloader runs
+type ToolVersions struct {
+	YTDLP  string
+	FFmpeg string
+}
+
+// Preflight checks that yt-dlp and ffmpeg can be run, so a missing binary
+// fails at startup instead of on the first playlist check
+func Preflight(ctx context.Context, ytdlpPath, ffmpegPath string) (*ToolVersions, error) {
+	ytdlpVersion, err := CheckYTDLP(ctx, ytdlpPath)
+	if err != nil {
+		return nil, err
+	}
+	ffmpegVersion, err := CheckFFmpeg(ctx, ffmpegPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ToolVersions{YTDLP: ytdlpVersion, FFmpeg: ffmpegVersion}, nil
+}
+
+// CheckYTDLP returns the version of the yt-dlp binary, or an error if it
+// can't be run
+func CheckYTDLP(ctx context.Context, ytdlpPath string) (string, error) {
+	output, err := exec.CommandContext(ctx, ytdlpPath, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("yt-dlp not usable at %q (set YTDLP_PATH or install yt-dlp): %w", ytdlpPath, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CheckFFmpeg returns the version of the ffmpeg binary, or an error if it
+// can't be run
+func CheckFFmpeg(ctx context.Context, ffmpegPath string) (string, error) {
+	output, err := exec.CommandContext(ctx, ffmpegPath, "-version").Output()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg not usable at %q (set FFMPEG_PATH or install ffmpeg): %w", ffmpegPath, err)
+	}
+	return parseFFmpegVersion(string(output)), nil
+}
+
+// parseFFmpegVersion extracts the version from the first line of
+// ffmpeg -version, e.g. "ffmpeg version 6.1.1-3ubuntu5 Copyright ..."
+func parseFFmpegVersion(output string) string {
+	line := strings.SplitN(strings.TrimSpace(output), "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) >= 3 && fields[1] == "version" {
+		return fields[2]
+	}
+	return line
+}
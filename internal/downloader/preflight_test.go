@@ -0,0 +1,31 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreflight(t *testing.T) {
+	bin := t.TempDir()
+	ytdlpPath := filepath.Join(bin, "yt-dlp")
+	ffmpegPath := filepath.Join(bin, "ffmpeg")
+	require.NoError(t, os.WriteFile(ytdlpPath, []byte("#!/bin/sh\necho 2024.08.06\n"), 0755))
+	require.NoError(t, os.WriteFile(ffmpegPath, []byte("#!/bin/sh\necho 'ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023'\necho 'built with gcc'\n"), 0755))
+
+	versions, err := Preflight(context.Background(), ytdlpPath, ffmpegPath)
+	require.NoError(t, err)
+	assert.Equal(t, &ToolVersions{YTDLP: "2024.08.06", FFmpeg: "6.1.1-3ubuntu5"}, versions)
+
+	_, err = Preflight(context.Background(), filepath.Join(bin, "missing"), ffmpegPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "YTDLP_PATH")
+
+	_, err = Preflight(context.Background(), ytdlpPath, filepath.Join(bin, "missing"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "FFMPEG_PATH")
+}
@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+)
+
+// probeOutput is the part of ffprobe's JSON output we use; ffprobe reports
+// most numbers as strings
+type probeOutput struct {
+	Streams []struct {
+		CodecType  string `json:"codec_type"`
+		CodecName  string `json:"codec_name"`
+		SampleRate string `json:"sample_rate"`
+		Channels   int    `json:"channels"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// audioProbe is the audio format of a file as measured by ffprobe
+type audioProbe struct {
+	Codec      string
+	Bitrate    int // Bits per second
+	SampleRate int
+	Channels   int
+	Duration   int // Seconds, rounded
+}
+
+// parseProbeOutput reads the first audio stream from ffprobe's output. Files
+// whose only stream is audio fall back to the container's bitrate, since
+// some containers, like webm, don't report one per stream.
+func parseProbeOutput(output []byte) (audioProbe, error) {
+	var out probeOutput
+	if err := json.Unmarshal(output, &out); err != nil {
+		return audioProbe{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	var probe audioProbe
+	if seconds, err := strconv.ParseFloat(out.Format.Duration, 64); err == nil {
+		probe.Duration = int(math.Round(seconds))
+	}
+	for _, s := range out.Streams {
+		if s.CodecType != "audio" {
+			continue
+		}
+		probe.Codec = s.CodecName
+		probe.SampleRate, _ = strconv.Atoi(s.SampleRate)
+		probe.Channels = s.Channels
+		probe.Bitrate, _ = strconv.Atoi(s.BitRate)
+		if probe.Bitrate == 0 && len(out.Streams) == 1 {
+			probe.Bitrate, _ = strconv.Atoi(out.Format.BitRate)
+		}
+		return probe, nil
+	}
+	return probe, fmt.Errorf("no audio stream found")
+}
+
+// probeAudio runs ffprobe on a file and returns its audio format
+func (d *Downloader) probeAudio(ctx context.Context, filePath string) (audioProbe, error) {
+	output, err := exec.CommandContext(ctx, d.ffprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		filePath,
+	).Output()
+	if err != nil {
+		return audioProbe{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseProbeOutput(output)
+}
@@ -0,0 +1,77 @@
+package downloader
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// ProgressFunc receives download progress parsed from yt-dlp's output.
+// It is called from download workers, so it must be safe for concurrent use.
+type ProgressFunc func(videoID string, percent float64, speed, eta string)
+
+// progressRe matches lines like
+// "[download]  42.3% of    5.20MiB at    1.10MiB/s ETA 00:03" and
+// "[download] 100% of 5.20MiB in 00:00:04 at 1.10MiB/s"
+var progressRe = regexp.MustCompile(`^\[download\]\s+(\d+(?:\.\d+)?)%\s+of\s+~?\s*\S+(?:\s+in\s+\S+)?(?:\s+at\s+(.+?))?(?:\s+ETA\s+(\S+))?\s*$`)
+
+// parseProgress extracts the percentage, speed and ETA from a progress line
+func parseProgress(line string) (percent float64, speed, eta string, ok bool) {
+	m := progressRe.FindStringSubmatch(line)
+	if m == nil {
+		return 0, "", "", false
+	}
+	percent, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, "", "", false
+	}
+	return percent, m[2], m[3], true
+}
+
+// progressWriter collects yt-dlp output line by line, passing progress lines
+// to onProgress instead of keeping them, so the rest can still be parsed
+type progressWriter struct {
+	mu         sync.Mutex
+	videoID    string
+	onProgress ProgressFunc
+	out        bytes.Buffer
+	partial    []byte
+}
+
+func newProgressWriter(videoID string, onProgress ProgressFunc) *progressWriter {
+	return &progressWriter{videoID: videoID, onProgress: onProgress}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		idx := bytes.IndexByte(w.partial, '\n')
+		if idx == -1 {
+			break
+		}
+		w.line(w.partial[:idx+1])
+		w.partial = w.partial[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) line(line []byte) {
+	if percent, speed, eta, ok := parseProgress(string(bytes.TrimSpace(line))); ok {
+		if w.onProgress != nil {
+			w.onProgress(w.videoID, percent, speed, eta)
+		}
+		return
+	}
+	w.out.Write(line)
+}
+
+// String returns everything written except progress lines
+func (w *progressWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.String() + string(w.partial)
+}
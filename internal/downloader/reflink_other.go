@@ -0,0 +1,10 @@
+//go:build !linux
+
+package downloader
+
+import "errors"
+
+// reflink is only implemented on Linux
+func reflink(src, dst string) error {
+	return errors.New("reflinks are not supported on this platform")
+}
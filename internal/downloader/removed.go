@@ -0,0 +1,68 @@
+package downloader
+
+// minListedFraction is the share of a playlist's known members a listing
+// must return before missing videos are treated as removed. A listing cut
+// short by YouTube or yt-dlp must not empty the library.
+const minListedFraction = 0.5
+
+// removedVideos returns the members missing from a listing; ok is false when
+// the listing is too short to be trusted
+func removedVideos(members, listed []string) (removed []string, ok bool) {
+	if len(members) == 0 {
+		return nil, true
+	}
+	if float64(len(listed)) < float64(len(members))*minListedFraction {
+		return nil, false
+	}
+
+	seen := make(map[string]bool, len(listed))
+	for _, id := range listed {
+		seen[id] = true
+	}
+	for _, id := range members {
+		if !seen[id] {
+			removed = append(removed, id)
+		}
+	}
+	return removed, true
+}
+
+// handleRemoved marks videos the playlist no longer lists as removed and,
+// with SyncDeletions, deletes this playlist's copy of them
+func (d *Downloader) handleRemoved(playlistYoutubeID, playlistName string, listed []string, opts PlaylistOptions, callback Callback) {
+	members, err := d.db.GetPlaylistMembers(playlistYoutubeID)
+	if err != nil {
+		d.logger.Error("Failed to load playlist members", "playlist", playlistName, "error", err)
+		return
+	}
+
+	removed, ok := removedVideos(members, listed)
+	if !ok {
+		d.logger.Warn("Playlist listed too few of its known videos; not checking for removals", "playlist", playlistName, "listed", len(listed), "known", len(members))
+		return
+	}
+	if len(removed) == 0 {
+		return
+	}
+
+	d.logger.Info("Videos were removed from playlist", "playlist", playlistName, "count", len(removed))
+	if err := d.db.MarkRemovedFromPlaylist(playlistYoutubeID, removed); err != nil {
+		d.logger.Error("Failed to mark removed videos", "playlist", playlistName, "error", err)
+		return
+	}
+
+	for _, id := range removed {
+		deleted := false
+		if opts.SyncDeletions {
+			if err := d.db.RemovePlaylistMembership(id, playlistYoutubeID); err != nil {
+				d.logger.Error("Failed to delete removed video", "playlist", playlistName, "video_id", id, "error", err)
+			} else {
+				d.logger.Info("Deleted removed video", "playlist", playlistName, "video_id", id)
+				deleted = true
+			}
+		}
+		if callback != nil {
+			callback(VideoResult{VideoID: id, Removed: true, Deleted: deleted})
+		}
+	}
+}
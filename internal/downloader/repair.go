@@ -0,0 +1,84 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/sidecar"
+)
+
+// Redownload downloads a recorded video's file again, e.g. after validation
+// found it missing or corrupt, whether or not it's still in a playlist, and
+// updates its row in place. Videos that are unavailable on YouTube or have
+// failed too often are left alone; the returned bool reports whether a
+// download was attempted. Like any download it waits while the disk is
+// below MIN_FREE_SPACE.
+func (d *Downloader) Redownload(ctx context.Context, video database.Video, playlistName string, opts PlaylistOptions) (bool, error) {
+	failure, err := d.db.GetDownloadFailure(video.YoutubeID)
+	if err != nil {
+		return false, err
+	}
+	if failure != nil && (failure.Attempts >= d.retry.MaxPasses || skipUnavailable(failure, time.Now()) ||
+		(failure.Permanent && failure.Availability == "")) {
+		return false, nil
+	}
+	if err := d.waitForSpace(ctx); err != nil {
+		return false, err
+	}
+
+	// The row is rewritten from the fetched metadata, so it has to be complete
+	info, err := d.fetchVideoInfo(ctx, video.YoutubeID, opts)
+	var result *downloadResult
+	if err == nil {
+		result, err = d.downloadWithRetry(ctx, info, playlistName, opts)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			d.recordFailure(video.YoutubeID, video.PlaylistYoutubeID, err)
+		}
+		return true, err
+	}
+
+	record := downloadRecord(info, result, opts)
+	if err := d.db.RecordDownload(video.PlaylistYoutubeID, video.PlaylistTitle, record); err != nil {
+		return true, fmt.Errorf("failed to record video %s: %w", video.YoutubeID, err)
+	}
+
+	// A corrupt file saved under a different name is replaced by the new one
+	if video.FilePath != "" && video.FilePath != result.FilePath {
+		if err := os.Remove(video.FilePath); err != nil && !os.IsNotExist(err) {
+			d.logger.Warn("Failed to remove old file", "video_id", video.YoutubeID, "error", err)
+		}
+		if err := sidecar.Remove(video.FilePath); err != nil {
+			d.logger.Warn("Failed to remove old sidecars", "video_id", video.YoutubeID, "error", err)
+		}
+	}
+	d.writeSidecars(info, record, playlistName, opts)
+	if result.FilePath != "" {
+		d.relink(video.YoutubeID, result.FilePath)
+	}
+	d.upload(video.YoutubeID)
+	return true, nil
+}
+
+// relink points a video's copies in other playlist folders at its new file,
+// since hardlinks and copies still hold the old contents
+func (d *Downloader) relink(videoID, src string) {
+	links, err := d.db.GetVideoLinks(videoID)
+	if err != nil {
+		d.logger.Error("Failed to get video links", "video_id", videoID, "error", err)
+		return
+	}
+	for _, link := range links {
+		if err := os.Remove(link.Path); err != nil && !os.IsNotExist(err) {
+			d.logger.Warn("Failed to remove old copy", "video_id", videoID, "path", link.Path, "error", err)
+			continue
+		}
+		if _, err := linkFile(src, link.Path, d.linkMode); err != nil {
+			d.logger.Warn("Failed to relink", "video_id", videoID, "path", link.Path, "error", err)
+		}
+	}
+}
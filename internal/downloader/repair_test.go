@@ -0,0 +1,161 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedownload(t *testing.T) {
+	installFakeYTDLP(t, fakeYTDLP)
+
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	d := NewDownloader("ffmpeg", filepath.Join(dir, "music"), db, Options{})
+	t.Setenv("FAKE_PLAYLIST", "musicvid001")
+	require.NoError(t, d.ProcessPlaylist(context.Background(), "PL_MUSIC", "Music", PlaylistOptions{}, nil))
+
+	path, err := db.GetFilePath("musicvid001")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(path))
+	_, err = db.ValidateFiles()
+	require.NoError(t, err)
+	missing, err := db.GetVideosByStatus(database.StatusMissing)
+	require.NoError(t, err)
+	require.Len(t, missing, 1)
+
+	// The video no longer needs to be in the playlist
+	t.Setenv("FAKE_PLAYLIST", "")
+	attempted, err := d.Redownload(context.Background(), missing[0], "Music", PlaylistOptions{})
+	require.NoError(t, err)
+	assert.True(t, attempted)
+	assert.FileExists(t, path)
+	valid, err := db.GetVideosByStatus(database.StatusValid)
+	require.NoError(t, err)
+	require.Len(t, valid, 1)
+	assert.Equal(t, "Full Title musicvid001", valid[0].Title)
+
+	// Unavailable videos are marked and left alone afterwards
+	require.NoError(t, db.RecordDownload("PL_MUSIC", "Music", database.DownloadRecord{
+		YoutubeID: "failingvid1",
+		Metadata:  database.VideoMetadata{Title: "Gone"},
+		FilePath:  filepath.Join(dir, "music", "Music", "Gone [failingvid1].mp3"),
+	}))
+	_, err = db.ValidateFiles()
+	require.NoError(t, err)
+	missing, err = db.GetVideosByStatus(database.StatusMissing)
+	require.NoError(t, err)
+	require.Len(t, missing, 1)
+
+	attempted, err = d.Redownload(context.Background(), missing[0], "Music", PlaylistOptions{})
+	assert.True(t, attempted)
+	assert.Error(t, err)
+	availability, err := db.GetAvailability("failingvid1")
+	require.NoError(t, err)
+	assert.Equal(t, database.AvailabilityDeleted, availability)
+
+	attempted, err = d.Redownload(context.Background(), missing[0], "Music", PlaylistOptions{})
+	require.NoError(t, err)
+	assert.False(t, attempted)
+}
+
+func TestDownloadsKeepOtherFilesWithTheSameName(t *testing.T) {
+	installFakeYTDLP(t, fakeYTDLP)
+
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Every fake video is titled "Same Title"
+	d := NewDownloader("ffmpeg", filepath.Join(dir, "music"), db, Options{})
+	opts := PlaylistOptions{FilenameTemplate: "%(title)s.%(ext)s"}
+	shared := filepath.Join(dir, "music", "Music", "Same Title.mp3")
+	t.Setenv("FAKE_PLAYLIST", "aaaaaaaaaaa")
+	require.NoError(t, d.ProcessPlaylist(context.Background(), "PL_MUSIC", "Music", opts, nil))
+	t.Setenv("FAKE_PLAYLIST", "aaaaaaaaaaa bbbbbbbbbbb")
+	require.NoError(t, d.ProcessPlaylist(context.Background(), "PL_MUSIC", "Music", opts, nil))
+
+	for id, want := range map[string]string{
+		"aaaaaaaaaaa": shared,
+		"bbbbbbbbbbb": filepath.Join(dir, "music", "Music", "Same Title [bbbbbbbbbbb].mp3"),
+	} {
+		path, err := db.GetFilePath(id)
+		require.NoError(t, err)
+		assert.Equal(t, want, path)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "audio-"+id, string(data))
+	}
+
+	// Files the database doesn't know about are kept as well
+	mine := filepath.Join(dir, "music", "Mine", "Same Title.mp3")
+	require.NoError(t, os.MkdirAll(filepath.Dir(mine), 0755))
+	require.NoError(t, os.WriteFile(mine, []byte("mine"), 0644))
+	t.Setenv("FAKE_PLAYLIST", "ccccccccccc")
+	require.NoError(t, d.ProcessPlaylist(context.Background(), "PL_MINE", "Mine", opts, nil))
+	data, err := os.ReadFile(mine)
+	require.NoError(t, err)
+	assert.Equal(t, "mine", string(data))
+	path, err := db.GetFilePath("ccccccccccc")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "music", "Mine", "Same Title [ccccccccccc].mp3"), path)
+
+	// Repairing a video replaces its own file in place
+	require.NoError(t, os.Remove(shared))
+	_, err = db.ValidateFiles()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(shared, []byte("broken"), 0644))
+	missing, err := db.GetVideosByStatus(database.StatusMissing)
+	require.NoError(t, err)
+	require.Len(t, missing, 1)
+	attempted, err := d.Redownload(context.Background(), missing[0], "Music", opts)
+	require.NoError(t, err)
+	assert.True(t, attempted)
+	path, err = db.GetFilePath("aaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, shared, path)
+	data, err = os.ReadFile(shared)
+	require.NoError(t, err)
+	assert.Equal(t, "audio-aaaaaaaaaaa", string(data))
+	assert.NoFileExists(t, filepath.Join(dir, "music", "Music", "Same Title [aaaaaaaaaaa].mp3"))
+}
+
+func TestRedownloadWaitsForSpace(t *testing.T) {
+	installFakeYTDLP(t, fakeYTDLP)
+	freeSpace = func(dir string) (int64, error) { return 0, nil }
+	diskSpaceRetry = time.Hour
+	defer func() { freeSpace, diskSpaceRetry = FreeSpace, time.Minute }()
+
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.GetOrCreatePlaylist("PL_MUSIC", "Music")
+	require.NoError(t, err)
+	require.NoError(t, db.RecordDownload("PL_MUSIC", "Music", database.DownloadRecord{
+		YoutubeID: "musicvid001",
+		Metadata:  database.VideoMetadata{Title: "Track"},
+		FilePath:  filepath.Join(dir, "music", "Music", "Track [musicvid001].mp3"),
+	}))
+	videos, err := db.GetVideosByStatus(database.StatusValid)
+	require.NoError(t, err)
+	require.Len(t, videos, 1)
+
+	d := NewDownloader("ffmpeg", filepath.Join(dir, "music"), db, Options{MinFreeSpace: 100 << 20})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	attempted, err := d.Redownload(ctx, videos[0], "Music", PlaylistOptions{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "Paused until shutdown")
+	assert.False(t, attempted)
+	assert.NoFileExists(t, videos[0].FilePath)
+}
@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how failed downloads are retried
+type RetryPolicy struct {
+	// Attempts is the number of tries per scheduler pass, including the first
+	Attempts int
+	// BaseDelay is the wait before the first retry; it doubles on each retry
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between retries
+	MaxDelay time.Duration
+	// MaxPasses is how many scheduler passes a failing video is retried on
+	// before it is given up on
+	MaxPasses int
+}
+
+// DefaultRetryPolicy is used for any RetryPolicy fields left at zero
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 5 * time.Second,
+	MaxDelay:  2 * time.Minute,
+	MaxPasses: 5,
+}
+
+// withDefaults fills unset fields from DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Attempts <= 0 {
+		p.Attempts = DefaultRetryPolicy.Attempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if p.MaxPasses <= 0 {
+		p.MaxPasses = DefaultRetryPolicy.MaxPasses
+	}
+	return p
+}
+
+// backoff returns the wait before retry number n (1-based): exponential
+// growth capped at MaxDelay, with jitter so parallel workers don't retry in lockstep
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < n && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// Full jitter over the upper half of the window
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// permanentErrors are yt-dlp messages for failures that retrying won't fix
+var permanentErrors = []string{
+	"Video unavailable",
+	"Private video",
+	"This video has been removed",
+	"This video is no longer available",
+	"This video is not available",
+	"account associated with this video has been terminated",
+	"members-only content",
+	"Join this channel to get access",
+	"copyright claim",
+	"not made this video available in your country",
+}
+
+// isPermanentError reports whether a download error should not be retried
+func isPermanentError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	for _, pattern := range permanentErrors {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// sleepContext waits for d, returning early with the context error if ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Error classes recorded with each failed attempt, besides the availability
+// of unavailable videos
+const (
+	errorClassTransient = "transient"
+	errorClassPermanent = "permanent"
+	errorClassExtractor = "extractor" // yt-dlp is missing or can't parse YouTube
+)
+
+// errorClass sorts a download error for the attempt log
+func errorClass(err error) string {
+	if availability := classifyUnavailable(err); availability != "" {
+		return availability
+	}
+	if isPermanentError(err) {
+		return errorClassPermanent
+	}
+	if isExtractorError(err) {
+		return errorClassExtractor
+	}
+	return errorClassTransient
+}
+
+// exitCode returns the exit code of a failed yt-dlp run, or 0 if err didn't
+// come from one
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/sidecar"
+)
+
+// sidecarVideo describes a download for its sidecar, with the same album,
+// artist and title as the file's tags
+func sidecarVideo(video VideoInfo, record database.DownloadRecord, playlistName string, opts PlaylistOptions) sidecar.Video {
+	v := sidecar.Video{
+		YoutubeID:   video.ID,
+		Title:       opts.Tags.expand(opts.Tags.Title, "{song}", video, playlistName),
+		Artist:      opts.Tags.expand(opts.Tags.Artist, "{artist}", video, playlistName),
+		Album:       opts.Tags.expand(opts.Tags.Album, "{playlist}", video, playlistName),
+		VideoTitle:  video.Title,
+		Channel:     strings.TrimSuffix(video.Channel, " - Topic"),
+		ChannelID:   video.ChannelID,
+		Description: video.Description,
+		UploadDate:  record.Metadata.UploadDate,
+		Duration:    record.Metadata.Duration,
+		ViewCount:   video.ViewCount,
+		Thumbnail:   video.Thumbnail,
+		MediaType:   record.Media.MediaType,
+	}
+	if !opts.Tags.SkipTrackNumber {
+		v.Track = video.PlaylistIndex
+	}
+	return v
+}
+
+// writeSidecars writes the sidecar of a completed download, when sidecars
+// are on. Failures are only logged: the download stands and the residecar
+// command can write them later.
+func (d *Downloader) writeSidecars(video VideoInfo, record database.DownloadRecord, playlistName string, opts PlaylistOptions) {
+	if d.sidecarFormat == "" {
+		return
+	}
+	if _, err := writeSidecars(d.sidecarFormat, video, record, playlistName, opts); err != nil {
+		d.logger.Warn("Failed to write sidecar", "video_id", video.ID, "error", err)
+	}
+}
+
+// writeSidecars writes a download's sidecar, or one per chapter when it was
+// split, returning how many were written. Files that are missing get none.
+func writeSidecars(format string, video VideoInfo, record database.DownloadRecord, playlistName string, opts PlaylistOptions) (int, error) {
+	v := sidecarVideo(video, record, playlistName, opts)
+	if record.FilePath != "" {
+		if _, err := os.Stat(record.FilePath); err != nil {
+			return 0, nil
+		}
+		if err := sidecar.Write(record.FilePath, format, v); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	// Chapters are tagged as an album of their own
+	v.Album, v.Artist = video.Title, artistName(video)
+	written := 0
+	for _, t := range record.Tracks {
+		if _, err := os.Stat(t.FilePath); err != nil {
+			continue
+		}
+		v.Title, v.Track = t.Title, t.Number
+		if err := sidecar.Write(t.FilePath, format, v); err != nil {
+			return written, fmt.Errorf("track %d: %w", t.Number, err)
+		}
+		written++
+	}
+	return written, nil
+}
+
+// RewriteSidecars writes a recorded video's sidecars again in format from
+// the metadata in the database, e.g. after turning sidecars on for an
+// existing library. The tags are worked out again from the playlist's
+// settings; position is its place in the playlist, 0 when unknown. Returns how many were written: none for a video without files.
+func (d *Downloader) RewriteSidecars(v database.ExportedVideo, format string, position int, playlistName string, opts PlaylistOptions) (int, error) {
+	str := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	video := VideoInfo{
+		ID:            v.YoutubeID,
+		Title:         v.Title,
+		Description:   str(v.Description),
+		Duration:      float64(v.Duration),
+		Channel:       v.Channel,
+		ChannelID:     str(v.ChannelID),
+		PlaylistIndex: position,
+		ViewCount:     v.ViewCount,
+		Thumbnail:     str(v.ThumbnailURL),
+	}
+	record := database.DownloadRecord{
+		YoutubeID: v.YoutubeID,
+		Metadata:  database.VideoMetadata{Duration: v.Duration},
+		FilePath:  str(v.FilePath),
+		Media:     database.MediaInfo{MediaType: str(v.MediaType)},
+	}
+	if date, err := time.Parse(time.RFC3339, str(v.UploadDate)); err == nil {
+		record.Metadata.UploadDate = date
+	}
+	if record.FilePath == "" {
+		tracks, err := d.db.GetVideoTracks(v.YoutubeID)
+		if err != nil {
+			return 0, err
+		}
+		record.Tracks = tracks
+	}
+	return writeSidecars(format, video, record, playlistName, opts)
+}
@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/sidecar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessPlaylistWritesSidecars(t *testing.T) {
+	installFakeYTDLP(t, fakeYTDLP)
+	t.Setenv("FAKE_PLAYLIST", "chaptered01 aaaaaaaaaaa")
+
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	d := NewDownloader("ffmpeg", filepath.Join(dir, "music"), db, Options{SidecarFormat: sidecar.FormatJSON})
+	opts := PlaylistOptions{SplitChapters: true}
+	require.NoError(t, d.ProcessPlaylist(context.Background(), "PL_MIX", "Mixes", opts, nil))
+
+	// From the full metadata, not the flat listing
+	path, err := db.GetFilePath("aaaaaaaaaaa")
+	require.NoError(t, err)
+	data, err := os.ReadFile(sidecar.Path(path, sidecar.FormatJSON))
+	require.NoError(t, err)
+	var info map[string]any
+	require.NoError(t, json.Unmarshal(data, &info))
+	assert.Equal(t, "Full Title aaaaaaaaaaa", info["title"])
+	assert.Equal(t, "Some Artist", info["artist"])
+	assert.Equal(t, "Mixes", info["album"])
+	assert.Equal(t, "2024-01-02", info["upload_date"])
+	assert.Equal(t, float64(1000), info["view_count"])
+	assert.Equal(t, "https://www.youtube.com/watch?v=aaaaaaaaaaa", info["webpage_url"])
+
+	// Split videos get one per chapter
+	tracks, err := db.GetVideoTracks("chaptered01")
+	require.NoError(t, err)
+	require.Len(t, tracks, 2)
+	data, err = os.ReadFile(sidecar.Path(tracks[1].FilePath, sidecar.FormatJSON))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &info))
+	assert.Equal(t, "Main Theme", info["title"])
+	assert.Equal(t, "Full Title chaptered01", info["album"])
+	assert.Equal(t, float64(2), info["track"])
+
+	// Rewritten from the database in another format
+	videos, err := db.ExportedVideos(database.ListOptions{})
+	require.NoError(t, err)
+	written := 0
+	for _, v := range videos {
+		n, err := d.RewriteSidecars(v, sidecar.FormatNFO, 3, "Mixes", opts)
+		require.NoError(t, err)
+		written += n
+	}
+	assert.Equal(t, 3, written)
+	data, err = os.ReadFile(sidecar.Path(path, sidecar.FormatNFO))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<title>Full Title aaaaaaaaaaa</title>")
+	assert.Contains(t, string(data), "<track>3</track>")
+
+	// Files that are gone get no sidecar
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, sidecar.Remove(path))
+	for _, v := range videos {
+		if v.YoutubeID == "aaaaaaaaaaa" {
+			n, err := d.RewriteSidecars(v, sidecar.FormatNFO, 0, "Mixes", opts)
+			require.NoError(t, err)
+			assert.Zero(t, n)
+		}
+	}
+	assert.NoFileExists(t, sidecar.Path(path, sidecar.FormatNFO))
+}
@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// source is what a configured URL points at: a playlist, a channel's
+// uploads, or a single video
+type source struct {
+	Type    string // database.SourcePlaylist, SourceChannel or SourceVideo
+	ID      string // Stored as the playlist's youtube_id
+	ListURL string // URL whose flat listing has the videos; empty for a single video
+}
+
+// channelPathRe matches channel paths such as /@handle, /channel/UC...,
+// /c/name and /user/name, optionally followed by a tab
+var channelPathRe = regexp.MustCompile(`^/(@[\w.-]+|channel/[\w-]+|c/[\w.-]+|user/[\w.-]+)(?:/(\w+))?/?$`)
+
+// videoPathRe matches paths that name a single video
+var videoPathRe = regexp.MustCompile(`^/(?:shorts|live|embed)/([\w-]+)/?$`)
+
+// parseSource works out what a configured URL or bare playlist ID points at.
+// www., m. and music.youtube.com links are all treated as youtube.com.
+func parseSource(raw string) (source, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return source{}, fmt.Errorf("empty URL")
+	}
+
+	// Bare playlist ID
+	if !strings.Contains(raw, "/") && !strings.Contains(raw, ".") {
+		return playlistSource(raw), nil
+	}
+
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return source{}, fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "m.", "music."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	query := u.Query()
+
+	switch host {
+	case "youtu.be":
+		if list := query.Get("list"); list != "" {
+			return playlistSource(list), nil
+		}
+		if id := strings.Trim(u.Path, "/"); id != "" {
+			return source{Type: database.SourceVideo, ID: id}, nil
+		}
+	case "youtube.com":
+		if list := query.Get("list"); list != "" {
+			return playlistSource(list), nil
+		}
+		if u.Path == "/watch" && query.Get("v") != "" {
+			return source{Type: database.SourceVideo, ID: query.Get("v")}, nil
+		}
+		if m := videoPathRe.FindStringSubmatch(u.Path); m != nil {
+			return source{Type: database.SourceVideo, ID: m[1]}, nil
+		}
+		if m := channelPathRe.FindStringSubmatch(u.Path); m != nil {
+			// The channel page itself lists its tabs, not its videos
+			tab := m[2]
+			if tab == "" {
+				tab = "videos"
+			}
+			return source{
+				Type:    database.SourceChannel,
+				ID:      strings.TrimPrefix(m[1], "channel/"),
+				ListURL: "https://www.youtube.com/" + m[1] + "/" + tab,
+			}, nil
+		}
+	default:
+		return source{}, fmt.Errorf("not a YouTube URL: %s", raw)
+	}
+
+	return source{}, fmt.Errorf("unrecognised YouTube URL: %s", raw)
+}
+
+// playlistSource returns the source for a playlist ID
+func playlistSource(id string) source {
+	return source{
+		Type:    database.SourcePlaylist,
+		ID:      id,
+		ListURL: "https://www.youtube.com/playlist?list=" + url.QueryEscape(id),
+	}
+}
+
+// PlaylistID returns the ID a source is stored under: the playlist ID of a
+// playlist URL, the channel ID or handle of a channel URL, the video ID of a
+// single video, or url itself when it can't be parsed
+func PlaylistID(url string) string {
+	src, err := parseSource(url)
+	if err != nil {
+		return url
+	}
+	return src.ID
+}
+
+// ValidateURL checks that url points at a playlist, channel or video we can
+// download
+func ValidateURL(url string) error {
+	_, err := parseSource(url)
+	return err
+}
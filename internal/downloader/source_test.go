@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"testing"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := map[string]source{
+		"PL123": {database.SourcePlaylist, "PL123", "https://www.youtube.com/playlist?list=PL123"},
+		"https://www.youtube.com/playlist?list=PL123&si=x":    {database.SourcePlaylist, "PL123", "https://www.youtube.com/playlist?list=PL123"},
+		"https://music.youtube.com/playlist?list=OLAK5uy_abc": {database.SourcePlaylist, "OLAK5uy_abc", "https://www.youtube.com/playlist?list=OLAK5uy_abc"},
+		"https://www.youtube.com/watch?v=abc&list=PL123":      {database.SourcePlaylist, "PL123", "https://www.youtube.com/playlist?list=PL123"},
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42":    {database.SourceVideo, "dQw4w9WgXcQ", ""},
+		"https://music.youtube.com/watch?v=dQw4w9WgXcQ":       {database.SourceVideo, "dQw4w9WgXcQ", ""},
+		"https://youtu.be/dQw4w9WgXcQ?si=share":               {database.SourceVideo, "dQw4w9WgXcQ", ""},
+		"youtu.be/dQw4w9WgXcQ":                                {database.SourceVideo, "dQw4w9WgXcQ", ""},
+		"https://m.youtube.com/shorts/dQw4w9WgXcQ":            {database.SourceVideo, "dQw4w9WgXcQ", ""},
+		"https://www.youtube.com/@someband":                   {database.SourceChannel, "@someband", "https://www.youtube.com/@someband/videos"},
+		"https://www.youtube.com/@someband/videos":            {database.SourceChannel, "@someband", "https://www.youtube.com/@someband/videos"},
+		"https://www.youtube.com/channel/UCabc-123/streams":   {database.SourceChannel, "UCabc-123", "https://www.youtube.com/channel/UCabc-123/streams"},
+		"https://www.youtube.com/c/SomeBand":                  {database.SourceChannel, "c/SomeBand", "https://www.youtube.com/c/SomeBand/videos"},
+	}
+	for url, want := range tests {
+		got, err := parseSource(url)
+		require.NoError(t, err, url)
+		assert.Equal(t, want, got, url)
+	}
+
+	for _, url := range []string{"", "https://vimeo.com/12345", "https://www.youtube.com/feed/subscriptions"} {
+		_, err := parseSource(url)
+		assert.Error(t, err, url)
+	}
+	assert.Equal(t, "dQw4w9WgXcQ", PlaylistID("https://youtu.be/dQw4w9WgXcQ"))
+}
@@ -0,0 +1,104 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// newStagingDir creates an empty directory for one download under the
+// staging root
+func (d *Downloader) newStagingDir(videoID string) (string, error) {
+	if err := os.MkdirAll(d.tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(d.tempDir, videoID+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return dir, nil
+}
+
+// CleanStaging removes downloads left in the staging directory by a crash
+// or kill. Only call it while no downloads are running.
+func (d *Downloader) CleanStaging() error {
+	entries, err := os.ReadDir(d.tempDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read temp directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(d.tempDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove stale download %s: %w", entry.Name(), err)
+		}
+	}
+	if len(entries) > 0 {
+		d.logger.Info("Removed interrupted downloads", "count", len(entries), "dir", d.tempDir)
+	}
+	return nil
+}
+
+// promoteFile moves a finished file of videoID from the staging directory to
+// the same relative location under libraryDir and returns its final path.
+// Renames are atomic on one filesystem; across filesystems the file is
+// copied through a temporary name so the library never sees a partial file.
+//
+// Only a file recorded as videoID's own is replaced, as when Redownload
+// repairs it. Any other file already there, such as another video's with the
+// same title, is kept and the new one gets a " [id]" suffix instead; if that
+// name is taken too the download fails.
+func (d *Downloader) promoteFile(stagingDir, libraryDir, path, videoID string) (string, error) {
+	rel, err := filepath.Rel(stagingDir, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	dst := filepath.Join(libraryDir, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %w", dst, err)
+	}
+
+	candidates := []string{dst}
+	if !strings.Contains(filepath.Base(dst), videoID) {
+		ext := filepath.Ext(dst)
+		candidates = append(candidates, strings.TrimSuffix(dst, ext)+" ["+videoID+"]"+ext)
+	}
+	for _, candidate := range candidates {
+		owner, err := d.db.FileOwner(candidate)
+		if err != nil {
+			return "", err
+		}
+		own := owner == videoID
+		if !own {
+			// Claim the name first, so neither a file already there nor one a
+			// concurrent download is promoting gets replaced. The empty
+			// placeholder is swapped for the file below.
+			f, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			if errors.Is(err, fs.ErrExist) {
+				d.logger.Warn("Keeping existing file with the same name", "video_id", videoID, "path", candidate, "owner", owner)
+				continue
+			} else if err != nil {
+				return "", fmt.Errorf("failed to create %s: %w", candidate, err)
+			}
+			f.Close()
+		}
+
+		err = os.Rename(path, candidate)
+		if errors.Is(err, syscall.EXDEV) {
+			err = copyFile(path, candidate)
+		}
+		if err != nil {
+			if !own {
+				os.Remove(candidate)
+			}
+			return "", fmt.Errorf("failed to move %s into library: %w", path, err)
+		}
+		return candidate, nil
+	}
+	return "", fmt.Errorf("failed to move %s into library: %s is taken by another file", path, candidates[len(candidates)-1])
+}
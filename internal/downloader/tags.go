@@ -0,0 +1,127 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TagMapping controls the tags written to downloaded files. Album, Artist
+// and Title are templates using {playlist}, {channel}, {title}, {index},
+// {artist} and {song}; empty fields use the defaults.
+type TagMapping struct {
+	Album  string // Default "{playlist}"
+	Artist string // Default "{artist}"
+	Title  string // Default "{song}"
+
+	// SkipTrackNumber leaves the track tag unset instead of the playlist position
+	SkipTrackNumber bool
+
+	// ParseTitles splits "Artist - Title" video titles into {artist} and
+	// {song}; otherwise they are the channel and video title
+	ParseTitles bool
+}
+
+// fileTag is one metadata key and value passed to ffmpeg
+type fileTag struct {
+	Key, Value string
+}
+
+// artistName returns the channel name without the " - Topic" suffix of
+// YouTube's auto-generated artist channels
+func artistName(video VideoInfo) string {
+	channel := video.Channel
+	if channel == "" {
+		channel = video.Uploader
+	}
+	return strings.TrimSuffix(channel, " - Topic")
+}
+
+// parsedTitle returns the artist and song parsed from the video title, when
+// title parsing is on and the title could be split. Auto-generated " - Topic"
+// channels already use the bare song name as the title, so they're skipped.
+func (m TagMapping) parsedTitle(video VideoInfo) (artist, song string, ok bool) {
+	if !m.ParseTitles || strings.HasSuffix(video.Channel, " - Topic") {
+		return "", "", false
+	}
+	return parseArtistTitle(video.Title)
+}
+
+// expand fills in a tag template for a video
+func (m TagMapping) expand(tmpl, fallback string, video VideoInfo, playlistName string) string {
+	if tmpl == "" {
+		tmpl = fallback
+	}
+	artist, song, ok := m.parsedTitle(video)
+	if !ok {
+		artist, song = artistName(video), video.Title
+	}
+	return strings.NewReplacer(
+		"{playlist}", playlistName,
+		"{channel}", artistName(video),
+		"{title}", video.Title,
+		"{index}", strconv.Itoa(video.PlaylistIndex),
+		"{artist}", artist,
+		"{song}", song,
+	).Replace(tmpl)
+}
+
+// tags returns the tags for a video downloaded as a single file
+func (m TagMapping) tags(video VideoInfo, playlistName string) []fileTag {
+	tags := []fileTag{
+		{"album", m.expand(m.Album, "{playlist}", video, playlistName)},
+		{"artist", m.expand(m.Artist, "{artist}", video, playlistName)},
+		{"title", m.expand(m.Title, "{song}", video, playlistName)},
+	}
+	if !m.SkipTrackNumber && video.PlaylistIndex > 0 {
+		tags = append(tags, fileTag{"track", strconv.Itoa(video.PlaylistIndex)})
+	}
+	return tags
+}
+
+// chapterTags returns the tags for one chapter of a split video, which is
+// treated as an album of its own
+func chapterTags(video VideoInfo, number int, title string, total int) []fileTag {
+	return []fileTag{
+		{"album", video.Title},
+		{"artist", artistName(video)},
+		{"title", title},
+		{"track", fmt.Sprintf("%d/%d", number, total)},
+	}
+}
+
+// writeTags sets metadata tags on a file with ffmpeg, leaving all streams
+// (including embedded cover art) untouched. Empty values are skipped.
+func (d *Downloader) writeTags(ctx context.Context, filePath string, tags []fileTag) error {
+	tmpPath := filepath.Join(filepath.Dir(filePath), ".tags-"+filepath.Base(filePath))
+	defer os.Remove(tmpPath)
+
+	args := []string{
+		"-y",
+		"-loglevel", "error",
+		"-i", filePath,
+		"-map", "0",
+		"-map_metadata", "0",
+		"-c", "copy",
+	}
+	for _, tag := range tags {
+		if tag.Value != "" {
+			args = append(args, "-metadata", tag.Key+"="+tag.Value)
+		}
+	}
+	if strings.EqualFold(filepath.Ext(filePath), ".mp3") {
+		args = append(args, "-id3v2_version", "3")
+	}
+	args = append(args, tmpPath)
+
+	cmd := exec.CommandContext(ctx, d.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
+	}
+
+	return os.Rename(tmpPath, filePath)
+}
@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"regexp"
+	"strings"
+)
+
+// bracketRe matches one bracketed group in a title
+var bracketRe = regexp.MustCompile(`\s*[(\[【]([^()\[\]【】]*)[)\]】]`)
+
+// noiseRe matches bracket contents that describe the upload rather than the
+// song, e.g. "Official Video", "HD" or "Lyrics"
+var noiseRe = regexp.MustCompile(`(?i)^\s*(` +
+	`(official\s+)?((music|lyrics?|audio|hd|4k|hq|performance)\s+)?(video|audio|visuali[sz]er|clip|mv|m/v)(\s+(hd|4k|hq))?` +
+	`|official|lyrics?|with\s+lyrics|hd|hq|4k|1080p|720p|audio\s+only|explicit|clean|video\s+oficial|clip\s+officiel|videoclip` +
+	`)\s*$`)
+
+// titleSeparators split "Artist - Title"
+var titleSeparators = []string{" - ", " – ", " — ", " | "}
+
+// nonArtistRe matches text on the right of a separator that qualifies the
+// song rather than naming it, as in "Song - Remastered 2011" from an
+// auto-generated channel; such titles aren't split
+var nonArtistRe = regexp.MustCompile(`(?i)^((\d{4}\s+)?remaster(ed)?(\s+\d{4})?(\s+version)?|live|radio\s+edit|single\s+version|album\s+version|mono|stereo|instrumental|acoustic|bonus\s+track)$`)
+
+// cleanTitle removes bracketed noise such as "(Official Video)" and "[HD]"
+// but keeps meaningful groups like "(Remix)" or "(feat. X)"
+func cleanTitle(title string) string {
+	cleaned := bracketRe.ReplaceAllStringFunc(title, func(group string) string {
+		inner := bracketRe.FindStringSubmatch(group)[1]
+		if noiseRe.MatchString(inner) {
+			return ""
+		}
+		return group
+	})
+	return strings.Join(strings.Fields(cleaned), " ")
+}
+
+// parseArtistTitle splits a music video title such as
+// "Daft Punk - Harder Better Faster Stronger (Official Video)" into artist
+// and song. It is conservative: ok is false unless the title has exactly one
+// separator with something on both sides.
+func parseArtistTitle(title string) (artist, song string, ok bool) {
+	cleaned := cleanTitle(title)
+
+	var sep string
+	for _, s := range titleSeparators {
+		switch strings.Count(cleaned, s) {
+		case 0:
+			continue
+		case 1:
+			if sep != "" {
+				return "", "", false // Mixed separators
+			}
+			sep = s
+		default:
+			return "", "", false
+		}
+	}
+	if sep == "" {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(cleaned, sep, 2)
+	artist = strings.TrimSpace(parts[0])
+	song = strings.Trim(strings.TrimSpace(parts[1]), `"'“”‘’`)
+	if artist == "" || song == "" || nonArtistRe.MatchString(song) {
+		return "", "", false
+	}
+	return artist, song, true
+}
@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArtistTitle(t *testing.T) {
+	tests := []struct {
+		title  string
+		artist string
+		song   string
+		ok     bool
+	}{
+		{"Daft Punk - Harder, Better, Faster, Stronger (Official Video)", "Daft Punk", "Harder, Better, Faster, Stronger", true},
+		{"Rick Astley - Never Gonna Give You Up (Official Music Video)", "Rick Astley", "Never Gonna Give You Up", true},
+		{"Queen – Bohemian Rhapsody (Official Video Remastered)", "Queen", "Bohemian Rhapsody (Official Video Remastered)", true},
+		{"a-ha - Take On Me (Official Video) [Remastered in 4K]", "a-ha", "Take On Me [Remastered in 4K]", true},
+		{"Billie Eilish - bad guy (Lyrics)", "Billie Eilish", "bad guy", true},
+		{"The Weeknd - Blinding Lights (Official Audio)", "The Weeknd", "Blinding Lights", true},
+		{"Dua Lipa - Levitating (feat. DaBaby) (Official Music Video)", "Dua Lipa", "Levitating (feat. DaBaby)", true},
+		{"Avicii - Levels [HD]", "Avicii", "Levels", true},
+		{"Eminem - Lose Yourself [HD] (Official Video)", "Eminem", "Lose Yourself", true},
+		{"Kendrick Lamar | HUMBLE.", "Kendrick Lamar", "HUMBLE.", true},
+		{"Nirvana - Smells Like Teen Spirit (Official Music Video) [4K]", "Nirvana", "Smells Like Teen Spirit", true},
+		{"Tame Impala - The Less I Know The Better (Official Visualizer)", "Tame Impala", "The Less I Know The Better", true},
+		{"Stromae - Alors on danse (Clip Officiel)", "Stromae", "Alors on danse", true},
+		{"Luis Fonsi - Despacito ft. Daddy Yankee (Video Oficial)", "Luis Fonsi", "Despacito ft. Daddy Yankee", true},
+		{`Adele - "Hello"`, "Adele", "Hello", true},
+		{"Gorillaz - Feel Good Inc. (Official Video) (HQ)", "Gorillaz", "Feel Good Inc.", true},
+		{"Calvin Harris - Summer (Remix)", "Calvin Harris", "Summer (Remix)", true},
+		{"BTS (방탄소년단) 'Dynamite' Official MV", "", "", false},
+		{"Never Gonna Give You Up", "", "", false},
+		{"Lofi Hip Hop Radio - Beats to Relax/Study To - 24/7", "", "", false},
+		{"Here Comes The Sun - Remastered 2009", "", "", false},
+		{"Wonderwall - Live", "", "", false},
+		{"Artist - Song | Live at Wembley", "", "", false},
+		{" - Untitled", "", "", false},
+		{"Somebody - (Official Video)", "", "", false},
+		{"Pink Floyd - Comfortably Numb (Live) [HD]", "Pink Floyd", "Comfortably Numb (Live)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			artist, song, ok := parseArtistTitle(tt.title)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.artist, artist)
+			assert.Equal(t, tt.song, song)
+		})
+	}
+}
+
+func TestParsedTitleTags(t *testing.T) {
+	video := VideoInfo{Title: "Avicii - Levels (Official Video)", Channel: "Avicii Official"}
+
+	assert.Equal(t, []fileTag{
+		{"album", "Mix"},
+		{"artist", "Avicii Official"},
+		{"title", "Avicii - Levels (Official Video)"},
+	}, TagMapping{}.tags(video, "Mix"))
+
+	assert.Equal(t, []fileTag{
+		{"album", "Mix"},
+		{"artist", "Avicii"},
+		{"title", "Levels"},
+	}, TagMapping{ParseTitles: true}.tags(video, "Mix"))
+
+	// Auto-generated channels already have bare song titles
+	topic := VideoInfo{Title: "Levels - Radio Edit", Channel: "Avicii - Topic"}
+	_, _, ok := TagMapping{ParseTitles: true}.parsedTitle(topic)
+	assert.False(t, ok)
+}
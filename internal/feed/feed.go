@@ -0,0 +1,197 @@
+// Package feed writes playlists as RSS 2.0 podcast feeds, with the iTunes
+// tags podcast apps such as Pocket Casts insist on, so downloads can be
+// listened to from any podcast player
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// itunesNamespace is the namespace of the itunes: tags
+const itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+// Channel is a playlist as a podcast
+type Channel struct {
+	Title       string
+	Description string
+	Link        string // The playlist on YouTube
+	Author      string // The playlist's channel
+	Image       string // Cover art URL
+	Items       []Item // Newest first
+}
+
+// Item is a downloaded file as an episode
+type Item struct {
+	GUID        string // The video's YouTube ID, so players never list it twice
+	Title       string
+	Description string
+	Link        string    // The video on YouTube
+	URL         string    // Where players download the file from
+	Size        int64     // Bytes
+	Type        string    // MIME type of the file
+	Published   time.Time // Upload date
+	Duration    int       // Seconds
+	Image       string
+}
+
+// MIMEType returns the MIME type of a file in container, by its extension
+// for files without one recorded; audio/mpeg when unknown, which players
+// try anyway
+func MIMEType(container, path string) string {
+	if container == "" {
+		container = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	switch strings.ToLower(container) {
+	case "m4a", "aac":
+		return "audio/mp4"
+	case "opus", "ogg":
+		return "audio/ogg"
+	case "flac":
+		return "audio/flac"
+	case "wav":
+		return "audio/wav"
+	case "mp4", "m4v":
+		return "video/mp4"
+	case "webm":
+		return "video/webm"
+	case "mkv":
+		return "video/x-matroska"
+	default:
+		return "audio/mpeg"
+	}
+}
+
+// WriteFile writes the feed to path, replacing any already there
+func WriteFile(path string, c Channel) error {
+	data, err := Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create feed directory: %w", err)
+	}
+
+	// Written beside the file and renamed, so players never fetch half a feed
+	tmp := path + ".part"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write feed: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write feed: %w", err)
+	}
+	return nil
+}
+
+// rss is the feed document. encoding/xml has no namespace prefixes, so the
+// itunes: tags are spelled out in their names.
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Itunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title          string       `xml:"title"`
+	Link           string       `xml:"link"`
+	Description    string       `xml:"description"`
+	Generator      string       `xml:"generator"`
+	LastBuildDate  string       `xml:"lastBuildDate,omitempty"`
+	Image          *rssImage    `xml:"image"`
+	ItunesAuthor   string       `xml:"itunes:author,omitempty"`
+	ItunesSummary  string       `xml:"itunes:summary"`
+	ItunesExplicit string       `xml:"itunes:explicit"`
+	ItunesType     string       `xml:"itunes:type"`
+	ItunesImage    *itunesImage `xml:"itunes:image"`
+	Items          []rssItem    `xml:"item"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssItem struct {
+	Title          string       `xml:"title"`
+	Link           string       `xml:"link,omitempty"`
+	Description    string       `xml:"description,omitempty"`
+	GUID           rssGUID      `xml:"guid"`
+	PubDate        string       `xml:"pubDate,omitempty"`
+	Enclosure      rssEnclosure `xml:"enclosure"`
+	ItunesDuration int          `xml:"itunes:duration,omitempty"` // Seconds
+	ItunesImage    *itunesImage `xml:"itunes:image"`
+	ItunesExplicit string       `xml:"itunes:explicit"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Marshal lays out the feed. Its build date is the newest episode's, so an
+// unchanged playlist gives an unchanged feed.
+func Marshal(c Channel) ([]byte, error) {
+	ch := rssChannel{
+		Title:          c.Title,
+		Link:           c.Link,
+		Description:    c.Description,
+		Generator:      "pp-downloader",
+		ItunesAuthor:   c.Author,
+		ItunesSummary:  c.Description,
+		ItunesExplicit: "false",
+		ItunesType:     "episodic",
+	}
+	if c.Image != "" {
+		ch.Image = &rssImage{URL: c.Image, Title: c.Title, Link: c.Link}
+		ch.ItunesImage = &itunesImage{Href: c.Image}
+	}
+
+	var newest time.Time
+	for _, it := range c.Items {
+		item := rssItem{
+			Title:          it.Title,
+			Link:           it.Link,
+			Description:    it.Description,
+			GUID:           rssGUID{ID: it.GUID},
+			Enclosure:      rssEnclosure{URL: it.URL, Length: it.Size, Type: it.Type},
+			ItunesDuration: it.Duration,
+			ItunesExplicit: "false",
+		}
+		if !it.Published.IsZero() {
+			item.PubDate = it.Published.UTC().Format(time.RFC1123Z)
+			if it.Published.After(newest) {
+				newest = it.Published
+			}
+		}
+		if it.Image != "" {
+			item.ItunesImage = &itunesImage{Href: it.Image}
+		}
+		ch.Items = append(ch.Items, item)
+	}
+	if !newest.IsZero() {
+		ch.LastBuildDate = newest.UTC().Format(time.RFC1123Z)
+	}
+
+	data, err := xml.MarshalIndent(rss{Version: "2.0", Itunes: itunesNamespace, Channel: ch}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode feed: %w", err)
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
@@ -0,0 +1,77 @@
+package feed
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feeds", "Jazz.xml")
+	c := Channel{
+		Title:       "Jazz",
+		Description: "Late night jazz",
+		Link:        "https://www.youtube.com/playlist?list=PL_A",
+		Author:      "Some Channel",
+		Image:       "https://i.ytimg.com/pl.jpg",
+		Items: []Item{
+			{
+				GUID:      "vid2",
+				Title:     "So What & More",
+				Link:      "https://www.youtube.com/watch?v=vid2",
+				URL:       "https://media.example.com/Jazz/So%20What.m4a",
+				Size:      1234,
+				Type:      MIMEType("m4a", ""),
+				Published: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+				Duration:  545,
+				Image:     "https://i.ytimg.com/vid2.jpg",
+			},
+			{GUID: "vid1", Title: "Blue in Green", URL: "https://media.example.com/Jazz/Blue.mp3", Size: 99, Type: MIMEType("", "Blue.mp3")},
+		},
+	}
+	require.NoError(t, WriteFile(path, c))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	body := string(data)
+	assert.Contains(t, body, `<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">`)
+	assert.Contains(t, body, `<itunes:image href="https://i.ytimg.com/pl.jpg"></itunes:image>`, "Channel art for podcast apps")
+	assert.Contains(t, body, `<itunes:author>Some Channel</itunes:author>`)
+	assert.Contains(t, body, `<lastBuildDate>Sat, 02 Mar 2024 00:00:00 +0000</lastBuildDate>`, "Built as of the newest episode")
+	assert.Contains(t, body, `<title>So What &amp; More</title>`)
+	assert.Contains(t, body, `<enclosure url="https://media.example.com/Jazz/So%20What.m4a" length="1234" type="audio/mp4"></enclosure>`)
+	assert.Contains(t, body, `<itunes:duration>545</itunes:duration>`)
+	assert.Contains(t, body, `<guid isPermaLink="false">vid2</guid>`)
+	assert.Contains(t, body, `type="audio/mpeg"`)
+	assert.NoFileExists(t, path+".part")
+
+	// It reads back as RSS with both episodes, newest first
+	var doc struct {
+		Items []struct {
+			GUID    string `xml:"guid"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &doc))
+	require.Len(t, doc.Items, 2)
+	assert.Equal(t, "vid2", doc.Items[0].GUID)
+	assert.Equal(t, "Sat, 02 Mar 2024 00:00:00 +0000", doc.Items[0].PubDate)
+	assert.Empty(t, doc.Items[1].PubDate, "No upload date, no pubDate")
+
+	// Unchanged playlists give identical feeds
+	again, err := Marshal(c)
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+}
+
+func TestMIMEType(t *testing.T) {
+	assert.Equal(t, "audio/ogg", MIMEType("opus", "a.opus"))
+	assert.Equal(t, "video/mp4", MIMEType("", "a.mp4"))
+	assert.Equal(t, "video/webm", MIMEType("WEBM", ""))
+	assert.Equal(t, "audio/mpeg", MIMEType("", "a.unknown"))
+}
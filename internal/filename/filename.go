@@ -0,0 +1,77 @@
+// Package filename turns arbitrary titles into names that are safe to use as
+// a single path component on Linux, macOS and Windows filesystems.
+package filename
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxBytes is the longest name most filesystems accept
+const MaxBytes = 255
+
+// invalidChars can't appear in a name on at least one supported filesystem
+const invalidChars = `<>:"/\|?*`
+
+// reservedNames are device names Windows refuses as file names, with or
+// without an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Sanitize returns name with invalid and control characters removed,
+// whitespace collapsed, leading and trailing dots trimmed, reserved names
+// escaped and the result cut to MaxBytes on a UTF-8 boundary. If nothing is
+// left, the sanitized fallback (typically a YouTube ID) is used instead.
+func Sanitize(name, fallback string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == utf8.RuneError || r < 0x20 || r == 0x7f || isBidiControl(r) || strings.ContainsRune(invalidChars, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	s := trim(strings.Join(strings.Fields(b.String()), " "))
+	s = trim(truncate(s, MaxBytes))
+
+	if s == "" {
+		if fallback != "" {
+			return Sanitize(fallback, "")
+		}
+		return "_"
+	}
+
+	base, _, _ := strings.Cut(s, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		s = truncate("_"+s, MaxBytes)
+	}
+	return s
+}
+
+// trim removes dots and spaces from both ends. Trailing ones are dropped by
+// Windows and leading dots would hide the file.
+func trim(s string) string {
+	return strings.Trim(s, ". ")
+}
+
+// truncate cuts s to at most n bytes without splitting a rune
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// isBidiControl reports explicit direction overrides, which can make a name
+// display differently from how it sorts and matches
+func isBidiControl(r rune) bool {
+	return (r >= 0x202A && r <= 0x202E) || (r >= 0x2066 && r <= 0x2069)
+}
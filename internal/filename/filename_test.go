@@ -0,0 +1,63 @@
+package filename
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		fallback string
+		want     string
+	}{
+		{"plain", "Road Trip", "PL1", "Road Trip"},
+		{"invalid characters", `AC/DC: Back in Black? <Live> "1980" | *HD*`, "", "ACDC Back in Black Live 1980 HD"},
+		{"backslash", `Mix\2024`, "", "Mix2024"},
+		{"collapsed whitespace", "  lots \t of\n space  ", "", "lots of space"},
+		{"control characters", "bell\x07 and\x00 nul", "", "bell and nul"},
+		{"trailing dots", "Greatest Hits...", "", "Greatest Hits"},
+		{"leading dots", "...and Justice for All", "", "and Justice for All"},
+		{"emoji", "Chill Vibes 🌊🎧", "", "Chill Vibes 🌊🎧"},
+		{"emoji sequence", "Family 👨‍👩‍👧 songs", "", "Family 👨‍👩‍👧 songs"},
+		{"rtl text", "أغاني عربية", "", "أغاني عربية"},
+		{"bidi override", "evil‮gnp.mp3", "", "evilgnp.mp3"},
+		{"cjk", "東京事変 - 群青日和", "", "東京事変 - 群青日和"},
+		{"reserved name", "CON", "", "_CON"},
+		{"reserved name lowercase", "nul", "", "_nul"},
+		{"reserved name with extension", "aux.mp3", "", "_aux.mp3"},
+		{"reserved prefix is fine", "CONTROL", "", "CONTROL"},
+		{"empty falls back", "", "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"only invalid falls back", `???///***`, "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"only dots falls back", "...", "dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"no fallback", "|||", "", "_"},
+		{"invalid utf-8", "bad\xffbyte", "", "badbyte"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Sanitize(tt.input, tt.fallback))
+		})
+	}
+}
+
+func TestSanitizeTruncatesOnRuneBoundary(t *testing.T) {
+	// The leading byte puts the 255-byte limit inside a 3-byte rune
+	long := "a" + strings.Repeat("日", 200)
+	got := Sanitize(long, "")
+	assert.LessOrEqual(t, len(got), MaxBytes)
+	assert.True(t, utf8.ValidString(got))
+	assert.Equal(t, "a"+strings.Repeat("日", 84), got)
+
+	emoji := strings.Repeat("🎵", 100)
+	got = Sanitize(emoji, "")
+	assert.Equal(t, strings.Repeat("🎵", 63), got)
+
+	// Truncation can expose a trailing space or dot
+	got = Sanitize(strings.Repeat("x", 254)+" tail", "")
+	assert.Equal(t, strings.Repeat("x", 254), got)
+}
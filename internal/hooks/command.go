@@ -0,0 +1,48 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandTimeout stops a stuck command holding up the next pass's hooks
+const commandTimeout = 10 * time.Minute
+
+// Command runs a shell command after new downloads, for servers without a
+// hook of their own. The directories are passed in PP_NEW_DIRS, one per
+// line.
+type Command struct {
+	command string
+}
+
+// NewCommand creates a hook running command with sh -c
+func NewCommand(command string) *Command {
+	return &Command{command: command}
+}
+
+func (c *Command) Name() string { return "command" }
+
+// Run runs the command, failing when it exits non-zero
+func (c *Command) Run(ctx context.Context, dirs []string) error {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.command)
+	cmd.Env = append(os.Environ(), "PP_NEW_DIRS="+strings.Join(dirs, "\n"))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("command failed: %w: %s", err, lastLine(string(output)))
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of output, where commands
+// usually say what went wrong
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,24 @@
+package hooks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "dirs.txt")
+	c := NewCommand(`printf '%s' "$PP_NEW_DIRS" > ` + out)
+	assert.Equal(t, "command", c.Name())
+	require.NoError(t, c.Run(context.Background(), []string{"/music/Jazz", "/music/Talks"}))
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "/music/Jazz\n/music/Talks", string(data))
+
+	err = NewCommand("echo scanning; echo 'library locked' >&2; exit 3").Run(context.Background(), []string{"/music/Jazz"})
+	assert.ErrorContains(t, err, "library locked")
+}
@@ -0,0 +1,88 @@
+// Package hooks tells other software about new downloads once a pass is
+// done, so media servers pick them up without waiting for their own scans
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Hook is told which directories got new files in a pass
+type Hook interface {
+	// Name identifies the hook in logs and playlists' hooks
+	Name() string
+	// Run reacts to new files in dirs, which are absolute and sorted
+	Run(ctx context.Context, dirs []string) error
+}
+
+// Pinger is a hook whose server can be checked at startup
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ErrUnauthorized means a media server rejected the credentials, so no
+// request will succeed until they're fixed
+var ErrUnauthorized = errors.New("credentials rejected")
+
+// checkServerURL requires an absolute http or https URL
+func checkServerURL(server, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %s URL %q: must be an http or https URL", server, rawURL)
+	}
+	return nil
+}
+
+// defaultClient is used by hooks created without a client
+func defaultClient(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+	return client
+}
+
+// maxResponseSize caps the responses decoded, which for a page of a large
+// Plex library or playlist can run to megabytes
+const maxResponseSize = 16 << 20
+
+// do sends a request to a media server, which answers 2xx when it worked.
+// The body is discarded unless into is set, when it's decoded by it.
+func do(client *http.Client, server string, req *http.Request, into func(io.Reader) error) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// Leave out the URL, which may carry credentials
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("failed to reach %s: %w", server, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s: %w", server, ErrUnauthorized)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return statusError{server: server, code: resp.StatusCode}
+	}
+	if into != nil {
+		return into(io.LimitReader(resp.Body, maxResponseSize))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return nil
+}
+
+// statusError is a response other than 2xx
+type statusError struct {
+	server string
+	code   int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("%s returned %d %s", e.server, e.code, http.StatusText(e.code))
+}
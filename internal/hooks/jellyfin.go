@@ -0,0 +1,49 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Jellyfin has Jellyfin refresh its libraries. Jellyfin scans every
+// library rather than given folders, so the directories aren't sent.
+type Jellyfin struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewJellyfin creates a Jellyfin hook using an API key from Dashboard >
+// API Keys
+func NewJellyfin(baseURL, apiKey string, client *http.Client) (*Jellyfin, error) {
+	if err := checkServerURL("Jellyfin", baseURL); err != nil {
+		return nil, err
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("a Jellyfin API key is needed")
+	}
+	return &Jellyfin{baseURL: strings.TrimSuffix(baseURL, "/"), apiKey: apiKey, client: defaultClient(client)}, nil
+}
+
+func (j *Jellyfin) Name() string { return "jellyfin" }
+
+// Ping checks Jellyfin is reachable and accepts the API key
+func (j *Jellyfin) Ping(ctx context.Context) error {
+	return j.request(ctx, http.MethodGet, "/System/Info")
+}
+
+// Run starts a library refresh, which Jellyfin runs in the background
+func (j *Jellyfin) Run(ctx context.Context, dirs []string) error {
+	return j.request(ctx, http.MethodPost, "/Library/Refresh")
+}
+
+func (j *Jellyfin) request(ctx context.Context, method, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, method, j.baseURL+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("MediaBrowser Token=%q", j.apiKey))
+	return do(j.client, "Jellyfin", req, nil)
+}
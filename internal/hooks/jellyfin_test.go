@@ -0,0 +1,47 @@
+package hooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJellyfin(t *testing.T) {
+	var refreshes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != `MediaBrowser Token="api-key"` {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/System/Info":
+			w.Write([]byte(`{"ServerName": "jellyfin"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/Library/Refresh":
+			refreshes++
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	j, err := NewJellyfin(server.URL+"/", "api-key", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "jellyfin", j.Name())
+	require.NoError(t, j.Ping(context.Background()))
+	require.NoError(t, j.Run(context.Background(), []string{"/music/Lessons"}))
+	assert.Equal(t, 1, refreshes)
+
+	j, err = NewJellyfin(server.URL, "wrong", nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, j.Ping(context.Background()), ErrUnauthorized)
+
+	_, err = NewJellyfin(server.URL, "", nil)
+	assert.Error(t, err)
+	_, err = NewJellyfin("jellyfin:8096", "api-key", nil)
+	assert.Error(t, err)
+}
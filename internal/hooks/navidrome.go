@@ -0,0 +1,108 @@
+package hooks
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// subsonicVersion is the Subsonic API version the requests are written to
+const subsonicVersion = "1.16.1"
+
+// Subsonic error codes meaning the user can't do this
+const (
+	subsonicWrongCredentials = 40
+	subsonicNotAuthorized    = 50
+)
+
+// Navidrome has Navidrome scan for new files through its Subsonic API. The
+// user must be an admin. Navidrome scans the whole library, so the
+// directories aren't sent.
+type Navidrome struct {
+	baseURL  string
+	user     string
+	password string
+	client   *http.Client
+}
+
+// NewNavidrome creates a Navidrome hook for an admin user
+func NewNavidrome(baseURL, user, password string, client *http.Client) (*Navidrome, error) {
+	if err := checkServerURL("Navidrome", baseURL); err != nil {
+		return nil, err
+	}
+	if user == "" || password == "" {
+		return nil, fmt.Errorf("a Navidrome user and password are needed")
+	}
+	return &Navidrome{baseURL: strings.TrimSuffix(baseURL, "/"), user: user, password: password, client: defaultClient(client)}, nil
+}
+
+func (n *Navidrome) Name() string { return "navidrome" }
+
+// Ping checks Navidrome is reachable and accepts the user
+func (n *Navidrome) Ping(ctx context.Context) error {
+	return n.call(ctx, "ping")
+}
+
+// Run starts a scan, which Navidrome runs in the background
+func (n *Navidrome) Run(ctx context.Context, dirs []string) error {
+	return n.call(ctx, "startScan")
+}
+
+// subsonicResponse is the part of a Subsonic API response saying whether
+// the call worked
+type subsonicResponse struct {
+	Response struct {
+		Status string `json:"status"`
+		Error  struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"subsonic-response"`
+}
+
+// call makes a Subsonic API call, which answers 200 with a status saying
+// whether it worked. The password is sent as a salted hash.
+func (n *Navidrome) call(ctx context.Context, method string) error {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	s := hex.EncodeToString(salt)
+	sum := md5.Sum([]byte(n.password + s))
+	query := url.Values{
+		"u": {n.user},
+		"t": {hex.EncodeToString(sum[:])},
+		"s": {s},
+		"v": {subsonicVersion},
+		"c": {"pp-downloader"},
+		"f": {"json"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.baseURL+"/rest/"+method+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	var result subsonicResponse
+	err = do(n.client, "Navidrome", req, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&result)
+	})
+	if err != nil {
+		return err
+	}
+	if result.Response.Status == "ok" {
+		return nil
+	}
+	switch e := result.Response.Error; e.Code {
+	case subsonicWrongCredentials, subsonicNotAuthorized:
+		return fmt.Errorf("Navidrome: %w: %s", ErrUnauthorized, e.Message)
+	default:
+		return fmt.Errorf("Navidrome %s failed: %s (code %d)", method, e.Message, e.Code)
+	}
+}
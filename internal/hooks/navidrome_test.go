@@ -0,0 +1,71 @@
+package hooks
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newNavidromeServer fakes Navidrome's Subsonic API, with admin "admin" and
+// plain user "guest", both with password "pass"
+func newNavidromeServer(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+	scans := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "json", q.Get("f"))
+		assert.Empty(t, q.Get("p"), "The password is never sent")
+		sum := md5.Sum([]byte("pass" + q.Get("s")))
+		if q.Get("t") != hex.EncodeToString(sum[:]) || (q.Get("u") != "admin" && q.Get("u") != "guest") {
+			fmt.Fprint(w, `{"subsonic-response": {"status": "failed", "error": {"code": 40, "message": "Wrong username or password"}}}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/rest/ping":
+		case "/rest/startScan":
+			if q.Get("u") != "admin" {
+				fmt.Fprint(w, `{"subsonic-response": {"status": "failed", "error": {"code": 50, "message": "User not authorized"}}}`)
+				return
+			}
+			scans++
+		default:
+			fmt.Fprint(w, `{"subsonic-response": {"status": "failed", "error": {"code": 0, "message": "Not implemented"}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"subsonic-response": {"status": "ok", "version": "1.16.1"}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &scans
+}
+
+func TestNavidrome(t *testing.T) {
+	server, scans := newNavidromeServer(t)
+
+	n, err := NewNavidrome(server.URL, "admin", "pass", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "navidrome", n.Name())
+	require.NoError(t, n.Ping(context.Background()))
+	require.NoError(t, n.Run(context.Background(), []string{"/music/Jazz"}))
+	assert.Equal(t, 1, *scans)
+
+	n, err = NewNavidrome(server.URL, "admin", "wrong", nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, n.Ping(context.Background()), ErrUnauthorized)
+
+	n, err = NewNavidrome(server.URL, "guest", "pass", nil)
+	require.NoError(t, err)
+	require.NoError(t, n.Ping(context.Background()))
+	assert.ErrorIs(t, n.Run(context.Background(), nil), ErrUnauthorized, "Scans need an admin")
+
+	for _, bad := range [][3]string{{"navidrome:4533", "admin", "pass"}, {server.URL, "", "pass"}, {server.URL, "admin", ""}} {
+		_, err := NewNavidrome(bad[0], bad[1], bad[2], nil)
+		assert.Error(t, err, "%v should be rejected", bad)
+	}
+}
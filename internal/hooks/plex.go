@@ -0,0 +1,114 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Plex has a Plex library section scan the directories with new files,
+// rather than the whole library, and can mirror playlists in Plex
+type Plex struct {
+	baseURL  string
+	token    string
+	section  string
+	root     string // The library as this process sees it
+	plexRoot string // The library as Plex sees it; root when empty
+	client   *http.Client
+
+	mu        sync.Mutex
+	machineID string                    // The server's identifier, for playlist URIs
+	library   map[int]map[string]string // Item type to file, as Plex sees it, to rating key
+}
+
+// NewPlex creates a Plex hook for a library section. Directories under root
+// are scanned at the same place under plexRoot, for when Plex runs in
+// another container with the library mounted elsewhere.
+func NewPlex(baseURL, token string, section int, root, plexRoot string, client *http.Client) (*Plex, error) {
+	if err := checkServerURL("Plex", baseURL); err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, fmt.Errorf("a Plex token is needed")
+	}
+	if section <= 0 {
+		return nil, fmt.Errorf("invalid Plex library section %d", section)
+	}
+	return &Plex{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		token:    token,
+		section:  strconv.Itoa(section),
+		root:     root,
+		plexRoot: plexRoot,
+		client:   defaultClient(client),
+	}, nil
+}
+
+func (p *Plex) Name() string { return "plex" }
+
+// Ping checks Plex is reachable, accepts the token and has the section
+func (p *Plex) Ping(ctx context.Context) error {
+	err := p.call(ctx, http.MethodGet, "/library/sections/"+p.section, nil, nil)
+	var status statusError
+	if errors.As(err, &status) && status.code == http.StatusNotFound {
+		return fmt.Errorf("Plex has no library section %s", p.section)
+	}
+	return err
+}
+
+// Run asks Plex to scan each directory
+func (p *Plex) Run(ctx context.Context, dirs []string) error {
+	for _, dir := range dirs {
+		query := url.Values{"path": {p.plexPath(dir)}}
+		if err := p.call(ctx, http.MethodGet, "/library/sections/"+p.section+"/refresh", query, nil); err != nil {
+			return fmt.Errorf("failed to scan %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// plexPath maps a directory under root to where Plex sees it
+func (p *Plex) plexPath(dir string) string {
+	if p.plexRoot == "" {
+		return dir
+	}
+	rel, err := filepath.Rel(p.root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return dir
+	}
+	return path.Join(p.plexRoot, filepath.ToSlash(rel))
+}
+
+// call makes a request to Plex, which answers 200 when it worked, decoding
+// the JSON response into into when set
+func (p *Plex) call(ctx context.Context, method, endpoint string, query url.Values, into any) error {
+	u := p.baseURL + endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Plex-Token", p.token)
+	req.Header.Set("Accept", "application/json")
+	var decode func(io.Reader) error
+	if into != nil {
+		decode = func(r io.Reader) error {
+			if err := json.NewDecoder(r).Decode(into); err != nil {
+				return fmt.Errorf("failed to parse Plex response: %w", err)
+			}
+			return nil
+		}
+	}
+	return do(p.client, "Plex", req, decode)
+}
@@ -0,0 +1,71 @@
+package hooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPlexServer fakes a Plex server with library section 3, recording the
+// paths it's asked to scan
+func newPlexServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var scanned []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Token") != "plex-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/library/sections/3":
+		case "/library/sections/3/refresh":
+			scanned = append(scanned, r.URL.Query().Get("path"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &scanned
+}
+
+func TestPlexScansDirectories(t *testing.T) {
+	server, scanned := newPlexServer(t)
+
+	p, err := NewPlex(server.URL+"/", "plex-token", 3, "/music", "/data/music", nil)
+	require.NoError(t, err)
+	require.NoError(t, p.Ping(context.Background()))
+	require.NoError(t, p.Run(context.Background(), []string{"/music/Jazz", "/music/Talks/Season 1", "/elsewhere/Rock"}))
+	assert.Equal(t, []string{"/data/music/Jazz", "/data/music/Talks/Season 1", "/elsewhere/Rock"}, *scanned,
+		"Directories under the library are scanned where Plex sees it")
+
+	p, err = NewPlex(server.URL, "plex-token", 3, "/music", "", nil)
+	require.NoError(t, err)
+	*scanned = nil
+	require.NoError(t, p.Run(context.Background(), []string{"/music/Jazz"}))
+	assert.Equal(t, []string{"/music/Jazz"}, *scanned)
+}
+
+func TestPlexErrors(t *testing.T) {
+	server, _ := newPlexServer(t)
+
+	p, err := NewPlex(server.URL, "wrong", 3, "/music", "", nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, p.Ping(context.Background()), ErrUnauthorized)
+	assert.ErrorIs(t, p.Run(context.Background(), []string{"/music/Jazz"}), ErrUnauthorized)
+
+	p, err = NewPlex(server.URL, "plex-token", 4, "/music", "", nil)
+	require.NoError(t, err)
+	assert.ErrorContains(t, p.Ping(context.Background()), "no library section 4")
+
+	for _, bad := range []struct {
+		url, token string
+		section    int
+	}{{"plex:32400", "plex-token", 3}, {"http://plex:32400", "", 3}, {"http://plex:32400", "plex-token", 0}} {
+		_, err := NewPlex(bad.url, bad.token, bad.section, "/music", "", nil)
+		assert.Error(t, err, "%+v should be rejected", bad)
+	}
+}
@@ -0,0 +1,202 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// plexPageSize is how many library items are listed per request
+const plexPageSize = 500
+
+// Plex item types listed when resolving files
+const (
+	plexTypeMovie = 1
+	plexTypeTrack = 10
+)
+
+// PlexPlaylist is a playlist to mirror in Plex
+type PlexPlaylist struct {
+	Title string
+	Video bool     // A video playlist of movies, rather than an audio one of tracks
+	Files []string // In playlist order
+}
+
+// plexContainer is the envelope of every Plex JSON response
+type plexContainer struct {
+	MediaContainer struct {
+		MachineIdentifier string     `json:"machineIdentifier"`
+		TotalSize         int        `json:"totalSize"`
+		Metadata          []plexItem `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
+// plexItem is a library item or playlist
+type plexItem struct {
+	RatingKey string `json:"ratingKey"`
+	Title     string `json:"title"`
+	Smart     bool   `json:"smart"`
+	Media     []struct {
+		Part []struct {
+			File string `json:"file"`
+		} `json:"Part"`
+	} `json:"Media"`
+}
+
+// SyncPlaylist makes the Plex playlist with pl's title hold its files in
+// order, creating it if needed. Files Plex hasn't scanned yet are left out;
+// their number is returned, so the playlist can be synced again once they
+// are. Smart playlists of the same name are never touched.
+func (p *Plex) SyncPlaylist(ctx context.Context, pl PlexPlaylist) (int, error) {
+	itemType, playlistType := plexTypeTrack, "audio"
+	if pl.Video {
+		itemType, playlistType = plexTypeMovie, "video"
+	}
+	keys, missing, err := p.resolve(ctx, itemType, pl.Files)
+	if err != nil {
+		return 0, err
+	}
+
+	existing, err := p.findPlaylist(ctx, pl.Title, playlistType)
+	if err != nil {
+		return 0, err
+	}
+	if existing == "" {
+		if len(keys) == 0 {
+			return missing, nil // Plex can't create an empty playlist
+		}
+		uri, err := p.itemsURI(ctx, keys)
+		if err != nil {
+			return 0, err
+		}
+		query := url.Values{"type": {playlistType}, "title": {pl.Title}, "smart": {"0"}, "uri": {uri}}
+		if err := p.call(ctx, http.MethodPost, "/playlists", query, nil); err != nil {
+			return 0, fmt.Errorf("failed to create Plex playlist %q: %w", pl.Title, err)
+		}
+		return missing, nil
+	}
+
+	var items plexContainer
+	if err := p.call(ctx, http.MethodGet, "/playlists/"+existing+"/items", nil, &items); err != nil {
+		return 0, fmt.Errorf("failed to list Plex playlist %q: %w", pl.Title, err)
+	}
+	current := make([]string, len(items.MediaContainer.Metadata))
+	for i, item := range items.MediaContainer.Metadata {
+		current[i] = item.RatingKey
+	}
+	if slices.Equal(current, keys) {
+		return missing, nil
+	}
+
+	// Replacing every item is the simplest way to get Plex's order right
+	if err := p.call(ctx, http.MethodDelete, "/playlists/"+existing+"/items", nil, nil); err != nil {
+		return 0, fmt.Errorf("failed to clear Plex playlist %q: %w", pl.Title, err)
+	}
+	if len(keys) > 0 {
+		uri, err := p.itemsURI(ctx, keys)
+		if err != nil {
+			return 0, err
+		}
+		if err := p.call(ctx, http.MethodPut, "/playlists/"+existing+"/items", url.Values{"uri": {uri}}, nil); err != nil {
+			return 0, fmt.Errorf("failed to fill Plex playlist %q: %w", pl.Title, err)
+		}
+	}
+	return missing, nil
+}
+
+// resolve finds the library items of files, returning their rating keys in
+// order and how many files Plex doesn't know. The library is only listed
+// again when a file isn't in the last listing.
+func (p *Plex) resolve(ctx context.Context, itemType int, files []string) ([]string, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lookup := func() ([]string, int) {
+		var keys []string
+		missing := 0
+		for _, file := range files {
+			if key, ok := p.library[itemType][p.plexPath(file)]; ok {
+				keys = append(keys, key)
+			} else {
+				missing++
+			}
+		}
+		return keys, missing
+	}
+	keys, missing := lookup()
+	if missing == 0 {
+		return keys, 0, nil
+	}
+
+	library, err := p.listLibrary(ctx, itemType)
+	if err != nil {
+		return nil, 0, err
+	}
+	if p.library == nil {
+		p.library = make(map[int]map[string]string)
+	}
+	p.library[itemType] = library
+	keys, missing = lookup()
+	return keys, missing, nil
+}
+
+// listLibrary maps the file of every item of a type in the section to its
+// rating key, a page at a time
+func (p *Plex) listLibrary(ctx context.Context, itemType int) (map[string]string, error) {
+	library := make(map[string]string)
+	for start := 0; ; start += plexPageSize {
+		query := url.Values{
+			"type":                   {strconv.Itoa(itemType)},
+			"X-Plex-Container-Start": {strconv.Itoa(start)},
+			"X-Plex-Container-Size":  {strconv.Itoa(plexPageSize)},
+		}
+		var page plexContainer
+		if err := p.call(ctx, http.MethodGet, "/library/sections/"+p.section+"/all", query, &page); err != nil {
+			return nil, fmt.Errorf("failed to list the Plex library: %w", err)
+		}
+		for _, item := range page.MediaContainer.Metadata {
+			for _, media := range item.Media {
+				for _, part := range media.Part {
+					library[part.File] = item.RatingKey
+				}
+			}
+		}
+		if len(page.MediaContainer.Metadata) < plexPageSize || start+plexPageSize >= page.MediaContainer.TotalSize {
+			return library, nil
+		}
+	}
+}
+
+// findPlaylist returns the rating key of the regular playlist with a title,
+// or an empty string if there is none
+func (p *Plex) findPlaylist(ctx context.Context, title, playlistType string) (string, error) {
+	var playlists plexContainer
+	if err := p.call(ctx, http.MethodGet, "/playlists", url.Values{"playlistType": {playlistType}}, &playlists); err != nil {
+		return "", fmt.Errorf("failed to list Plex playlists: %w", err)
+	}
+	for _, pl := range playlists.MediaContainer.Metadata {
+		if pl.Title == title && !pl.Smart {
+			return pl.RatingKey, nil
+		}
+	}
+	return "", nil
+}
+
+// itemsURI is how Plex refers to a list of library items when adding them
+// to a playlist
+func (p *Plex) itemsURI(ctx context.Context, keys []string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.machineID == "" {
+		var identity plexContainer
+		if err := p.call(ctx, http.MethodGet, "/identity", nil, &identity); err != nil {
+			return "", fmt.Errorf("failed to identify the Plex server: %w", err)
+		}
+		p.machineID = identity.MediaContainer.MachineIdentifier
+	}
+	return "server://" + p.machineID + "/com.plexapp.plugins.library/library/metadata/" + strings.Join(keys, ","), nil
+}
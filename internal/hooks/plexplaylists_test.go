@@ -0,0 +1,128 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePlex is a Plex server with a music section 3 and its playlists
+type fakePlex struct {
+	files     map[string]string   // File to rating key
+	playlists map[string][]string // Rating key to items
+	titles    map[string]string   // Rating key to title
+	writes    int                 // Requests changing a playlist
+	down      bool
+}
+
+func newFakePlex(t *testing.T) (*fakePlex, *httptest.Server) {
+	t.Helper()
+	f := &fakePlex{files: map[string]string{}, playlists: map[string][]string{}, titles: map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("X-Plex-Token") != "plex-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var items []map[string]any
+		q := r.URL.Query()
+		switch path := r.URL.Path; {
+		case path == "/identity":
+			json.NewEncoder(w).Encode(map[string]any{"MediaContainer": map[string]any{"machineIdentifier": "abc123"}})
+			return
+		case path == "/library/sections/3/all":
+			assert.Equal(t, "10", q.Get("type"))
+			for file, key := range f.files {
+				items = append(items, map[string]any{"ratingKey": key, "Media": []any{map[string]any{"Part": []any{map[string]any{"file": file}}}}})
+			}
+		case path == "/playlists" && r.Method == http.MethodGet:
+			items = append(items, map[string]any{"ratingKey": "999", "title": "Jazz", "smart": true})
+			for key, title := range f.titles {
+				items = append(items, map[string]any{"ratingKey": key, "title": title})
+			}
+		case path == "/playlists" && r.Method == http.MethodPost:
+			assert.Equal(t, "audio", q.Get("type"))
+			key := "p" + q.Get("title")
+			f.titles[key], f.playlists[key] = q.Get("title"), uriKeys(q.Get("uri"))
+			f.writes++
+		case strings.HasSuffix(path, "/items"):
+			key := strings.TrimSuffix(strings.TrimPrefix(path, "/playlists/"), "/items")
+			switch r.Method {
+			case http.MethodGet:
+				for _, item := range f.playlists[key] {
+					items = append(items, map[string]any{"ratingKey": item})
+				}
+			case http.MethodDelete:
+				f.playlists[key] = nil
+				f.writes++
+			case http.MethodPut:
+				f.playlists[key] = append(f.playlists[key], uriKeys(q.Get("uri"))...)
+				f.writes++
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"MediaContainer": map[string]any{"totalSize": len(items), "Metadata": items}})
+	}))
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// uriKeys returns the rating keys of a playlist items URI
+func uriKeys(uri string) []string {
+	if !strings.HasPrefix(uri, "server://abc123/com.plexapp.plugins.library/library/metadata/") {
+		return nil
+	}
+	return strings.Split(uri[strings.LastIndex(uri, "/")+1:], ",")
+}
+
+func TestPlexSyncPlaylist(t *testing.T) {
+	f, server := newFakePlex(t)
+	f.files["/data/music/Jazz/a.mp3"] = "11"
+	f.files["/data/music/Jazz/b.mp3"] = "12"
+
+	p, err := NewPlex(server.URL, "plex-token", 3, "/music", "/data/music", nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	missing, err := p.SyncPlaylist(ctx, PlexPlaylist{Title: "Jazz", Files: []string{"/music/Jazz/b.mp3", "/music/Jazz/c.mp3", "/music/Jazz/a.mp3"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, missing, "c.mp3 hasn't been scanned yet")
+	assert.Equal(t, []string{"12", "11"}, f.playlists["pJazz"], "Created in playlist order, leaving the smart playlist alone")
+
+	// Once scanned it's added in its place
+	f.files["/data/music/Jazz/c.mp3"] = "13"
+	missing, err = p.SyncPlaylist(ctx, PlexPlaylist{Title: "Jazz", Files: []string{"/music/Jazz/b.mp3", "/music/Jazz/c.mp3", "/music/Jazz/a.mp3"}})
+	require.NoError(t, err)
+	assert.Zero(t, missing)
+	assert.Equal(t, []string{"12", "13", "11"}, f.playlists["pJazz"])
+
+	// Unchanged playlists aren't rewritten
+	writes := f.writes
+	_, err = p.SyncPlaylist(ctx, PlexPlaylist{Title: "Jazz", Files: []string{"/music/Jazz/b.mp3", "/music/Jazz/c.mp3", "/music/Jazz/a.mp3"}})
+	require.NoError(t, err)
+	assert.Equal(t, writes, f.writes)
+
+	// Removed videos leave the playlist
+	_, err = p.SyncPlaylist(ctx, PlexPlaylist{Title: "Jazz", Files: []string{"/music/Jazz/a.mp3"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"11"}, f.playlists["pJazz"])
+
+	_, err = p.SyncPlaylist(ctx, PlexPlaylist{Title: "Talks", Files: []string{"/music/Talks/new.mp3"}})
+	require.NoError(t, err)
+	assert.NotContains(t, f.titles, "pTalks", "Nothing to put in it yet")
+
+	f.down = true
+	_, err = p.SyncPlaylist(ctx, PlexPlaylist{Title: "Jazz", Files: []string{"/music/Jazz/a.mp3"}})
+	assert.ErrorContains(t, err, "503")
+}
@@ -0,0 +1,130 @@
+// Package logfile writes a log file that is rotated by size, so a watcher
+// running for months doesn't fill the disk with its log.
+package logfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Writer appends to a log file, renaming it to path.1 once a write would
+// take it past MaxSize. Older rotations shift up to path.Keep; anything
+// beyond is deleted. It is safe for concurrent use.
+type Writer struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens path for appending, creating its folder. A maxSize of 0 never
+// rotates; keep is how many rotated files are kept besides path.
+func Open(path string, maxSize int64, keep int) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	w := &Writer{path: path, maxSize: maxSize, keep: keep}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends p, rotating first if p would take the file past its size
+// limit. A single write larger than the limit still goes in one file. If
+// rotating fails, p is still written wherever the log file now is and the
+// rotation error is returned.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var rotateErr error
+	if w.file != nil && w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		rotateErr = w.rotate()
+	}
+	if w.file == nil {
+		if rotateErr != nil {
+			return 0, rotateErr
+		}
+		return 0, os.ErrClosed
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+// Close closes the current file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// open opens path for appending and picks up its current size
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files up by one, drops the oldest and starts a
+// new file. The file is reopened even when shifting fails, so logging goes
+// on. Called with mu held.
+func (w *Writer) rotate() error {
+	closeErr := w.file.Close()
+	w.file = nil
+
+	err := w.shift()
+	if openErr := w.open(); openErr != nil {
+		return openErr
+	}
+	return errors.Join(closeErr, err)
+}
+
+// shift moves path to path.1, path.1 to path.2 and so on, deleting the
+// file that would become path.keep+1
+func (w *Writer) shift() error {
+	if w.keep <= 0 {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.Remove(w.rotated(w.keep)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := w.keep - 1; i >= 1; i-- {
+		if err := os.Rename(w.rotated(i), w.rotated(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(w.path, w.rotated(1))
+}
+
+// rotated returns the name of the nth newest rotated file
+func (w *Writer) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", w.path, n)
+}
@@ -0,0 +1,109 @@
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "pp-downloader.log")
+	w, err := Open(path, 20, 2)
+	require.NoError(t, err)
+	defer w.Close()
+
+	for i := 1; i <= 4; i++ {
+		_, err := fmt.Fprintf(w, "line %d of the log\n", i)
+		require.NoError(t, err)
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "line 4 of the log\n", read(path))
+	assert.Equal(t, "line 3 of the log\n", read(path+".1"))
+	assert.Equal(t, "line 2 of the log\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3", "files beyond keep are deleted")
+}
+
+func TestWriterAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pp-downloader.log")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 15)), 0644))
+
+	w, err := Open(path, 20, 1)
+	require.NoError(t, err)
+	defer w.Close()
+
+	// The existing 15 bytes count towards the limit
+	_, err = w.Write([]byte("0123456789\n"))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789\n", string(data))
+	data, err = os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 15), string(data))
+}
+
+func TestWriterWithoutLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pp-downloader.log")
+	w, err := Open(path, 0, 5)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		_, err := w.Write([]byte("a line that never rotates\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	assert.NoFileExists(t, path+".1")
+
+	_, err = w.Write([]byte("late"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestWriterConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pp-downloader.log")
+	w, err := Open(path, 1000, 100)
+	require.NoError(t, err)
+	defer w.Close()
+
+	line := strings.Repeat("y", 49) + "\n"
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, err := w.Write([]byte(line))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every line lands whole in exactly one file
+	files, err := filepath.Glob(path + "*")
+	require.NoError(t, err)
+	total := 0
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(data), 1000)
+		for _, l := range strings.SplitAfter(string(data), "\n") {
+			if l != "" {
+				assert.Equal(t, line, l)
+				total++
+			}
+		}
+	}
+	assert.Equal(t, 500, total)
+}
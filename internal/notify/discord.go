@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Discord's limits on a webhook message
+const (
+	discordMaxEmbeds      = 10
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+)
+
+// Embed colours: green for new downloads, amber for problems, red for ones
+// stopping downloads altogether and grey for status events
+var discordColors = map[string]int{
+	EventNewDownloads:     0x2ecc71,
+	EventValidationFailed: 0xf1c40f,
+	EventDownloadFailing:  0xe67e22,
+	EventLowDiskSpace:     0xe74c3c,
+	EventYTDLPBroken:      0xe74c3c,
+	EventPlaylistChecked:  0x95a5a6,
+	EventStats:            0x95a5a6,
+}
+
+// Discord posts events to a Discord channel webhook as embeds. New
+// downloads get an embed per video, linking to it with its thumbnail.
+type Discord struct {
+	sender
+	url string
+}
+
+// NewDiscord creates a Discord notifier for a channel's webhook URL;
+// events limits which event types are sent, all when empty
+func NewDiscord(rawURL string, events []string, client *http.Client) (*Discord, error) {
+	if err := checkURL("Discord webhook", rawURL); err != nil {
+		return nil, err
+	}
+	s, err := newSender("Discord", events, client)
+	if err != nil {
+		return nil, err
+	}
+	d := &Discord{sender: s, url: rawURL}
+	d.request = d.newRequest
+	return d, nil
+}
+
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+	Thumbnail   *discordImage  `json:"thumbnail,omitempty"`
+	Footer      *discordFooter `json:"footer,omitempty"`
+}
+
+type discordImage struct {
+	URL string `json:"url"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+// discordMessageFor lays out an event as a Discord message
+func discordMessageFor(e Event) discordMessage {
+	color := discordColors[e.Type]
+	timestamp := e.Time.Format(time.RFC3339)
+
+	videos := eventVideos(e)
+	if len(videos) == 0 {
+		return discordMessage{Embeds: []discordEmbed{{
+			Title:       EventTitle(e.Type),
+			Description: truncate(e.Message, discordMaxDescription),
+			Color:       color,
+			Timestamp:   timestamp,
+		}}}
+	}
+
+	msg := discordMessage{Content: e.Message}
+	for i, v := range videos {
+		if i == discordMaxEmbeds {
+			msg.Content += fmt.Sprintf(" (%d more not shown)", len(videos)-discordMaxEmbeds)
+			break
+		}
+		embed := discordEmbed{
+			Title:       truncate(v.Title, discordMaxTitle),
+			URL:         v.URL,
+			Description: v.Channel,
+			Color:       color,
+			Timestamp:   timestamp,
+		}
+		if v.Thumbnail != "" {
+			embed.Thumbnail = &discordImage{URL: v.Thumbnail}
+		}
+		if v.Duration > 0 {
+			embed.Footer = &discordFooter{Text: formatDuration(v.Duration)}
+		}
+		msg.Embeds = append(msg.Embeds, embed)
+	}
+	return msg
+}
+
+// newRequest posts the event as an embed message
+func (d *Discord) newRequest(ctx context.Context, e Event) (*http.Request, error) {
+	body, err := json.Marshal(discordMessageFor(e))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Discord request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
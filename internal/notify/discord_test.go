@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscordEmbedsNewVideos(t *testing.T) {
+	var got discordMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d, err := NewDiscord(server.URL, nil, nil)
+	require.NoError(t, err)
+	d.deliver(context.Background(), Event{Type: EventNewDownloads, Message: "2 new videos in Jazz", Details: map[string]any{
+		"playlist": "Jazz",
+		"videos": []Video{
+			{Title: "Take Five", Channel: "Brubeck", Duration: 324, URL: "https://www.youtube.com/watch?v=aaaaaaaaaaa", Thumbnail: "https://i.ytimg.com/vi/aaaaaaaaaaa/hq.jpg"},
+			{Title: "So What", Channel: "Davis", Duration: 3725, URL: "https://www.youtube.com/watch?v=bbbbbbbbbbb"},
+		},
+	}})
+
+	assert.Equal(t, "2 new videos in Jazz", got.Content)
+	require.Len(t, got.Embeds, 2)
+	assert.Equal(t, "Take Five", got.Embeds[0].Title)
+	assert.Equal(t, "https://www.youtube.com/watch?v=aaaaaaaaaaa", got.Embeds[0].URL)
+	assert.Equal(t, "Brubeck", got.Embeds[0].Description)
+	require.NotNil(t, got.Embeds[0].Thumbnail)
+	assert.Equal(t, "https://i.ytimg.com/vi/aaaaaaaaaaa/hq.jpg", got.Embeds[0].Thumbnail.URL)
+	assert.Equal(t, "5:24", got.Embeds[0].Footer.Text)
+	assert.Nil(t, got.Embeds[1].Thumbnail)
+	assert.Equal(t, "1:02:05", got.Embeds[1].Footer.Text)
+}
+
+func TestDiscordMessage(t *testing.T) {
+	msg := discordMessageFor(Event{Type: EventLowDiskSpace, Message: "Downloads paused: 1.2G free"})
+	require.Len(t, msg.Embeds, 1)
+	assert.Equal(t, "Low disk space", msg.Embeds[0].Title)
+	assert.Equal(t, "Downloads paused: 1.2G free", msg.Embeds[0].Description)
+	assert.NotZero(t, msg.Embeds[0].Color)
+
+	// Discord allows 10 embeds a message
+	var videos []Video
+	for i := 0; i < 12; i++ {
+		videos = append(videos, Video{Title: fmt.Sprintf("Video %d", i)})
+	}
+	msg = discordMessageFor(Event{Type: EventNewDownloads, Message: "12 new videos in Jazz", Details: map[string]any{"videos": videos}})
+	assert.Len(t, msg.Embeds, discordMaxEmbeds)
+	assert.Equal(t, "12 new videos in Jazz (2 more not shown)", msg.Content)
+
+	msg = discordMessageFor(Event{Type: EventNewDownloads, Details: map[string]any{"videos": []Video{{Title: strings.Repeat("a", 300)}}}})
+	assert.Len(t, []rune(msg.Embeds[0].Title), discordMaxTitle)
+}
+
+func TestNewDiscordRejectsBadConfig(t *testing.T) {
+	_, err := NewDiscord("discord.com/api/webhooks/1/secret", nil, nil)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+	_, err = NewDiscord("https://discord.com/api/webhooks/1/secret", []string{"disk_full"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emailTimeout bounds dialing and the whole SMTP conversation
+const emailTimeout = 30 * time.Second
+
+// Email sends messages, such as the activity digest, through an SMTP
+// server. Port 465 is implicit TLS; on any other port the connection is
+// upgraded with STARTTLS when the server offers it, and a password is only
+// sent over TLS or to localhost.
+type Email struct {
+	host     string
+	addr     string // host:port
+	tls      bool
+	username string
+	password string
+	from     *mail.Address
+	to       []*mail.Address
+}
+
+// NewEmail creates an SMTP sender from from to each address in to. username
+// and password are optional; no authentication is tried without them.
+func NewEmail(host string, port int, username, password, from string, to []string) (*Email, error) {
+	if host == "" || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid SMTP server %s:%d", host, port)
+	}
+	e := &Email{
+		host:     host,
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		tls:      port == 465,
+		username: username,
+		password: password,
+	}
+	var err error
+	if e.from, err = mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("no recipients")
+	}
+	for _, addr := range to {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+		e.to = append(e.to, a)
+	}
+	return e, nil
+}
+
+// Send emails a message with plain text and HTML alternatives to every
+// recipient
+func (e *Email) Send(subject, text, html string) error {
+	msg, err := e.message(subject, text, html, time.Now())
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	var conn net.Conn
+	if e.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", e.addr, &tls.Config{ServerName: e.host})
+	} else {
+		conn, err = dialer.Dial("tcp", e.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", e.addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP server %s: %w", e.addr, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && !e.tls {
+		if err := c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if e.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := c.Mail(e.from.Address); err != nil {
+		return fmt.Errorf("SMTP server refused sender %s: %w", e.from.Address, err)
+	}
+	for _, to := range e.to {
+		if err := c.Rcpt(to.Address); err != nil {
+			return fmt.Errorf("SMTP server refused recipient %s: %w", to.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server refused the email: %w", err)
+	}
+	return c.Quit()
+}
+
+// message lays out an email as multipart/alternative, plain text first so
+// clients prefer the HTML
+func (e *Email) message(subject, text, html string, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	to := make([]string, len(e.to))
+	for i, a := range e.to {
+		to[i] = a.String()
+	}
+	var msg bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", e.from.String()},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
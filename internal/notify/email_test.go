@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTP accepts one message per connection, recording the commands and
+// message it was sent
+type fakeSMTP struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	commands []string
+	data     string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTP{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+		switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); verb {
+		case "EHLO":
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			reply("235 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailSend(t *testing.T) {
+	server := newFakeSMTP(t)
+	host, port, err := net.SplitHostPort(server.ln.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	e, err := NewEmail(host, p, "pp", "secret", "pp-downloader <pp@example.com>", []string{"me@example.com", "you@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, e.Send("Digest: 3 new ✓", "3 new tracks\n", "<p>3 new tracks</p>\n"))
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Contains(t, server.commands, "MAIL FROM:<pp@example.com>")
+	assert.Contains(t, server.commands, "RCPT TO:<me@example.com>")
+	assert.Contains(t, server.commands, "RCPT TO:<you@example.com>")
+	assert.True(t, strings.HasPrefix(server.commands[1], "AUTH PLAIN"), "Authenticates to localhost without TLS")
+
+	msg, err := mail.ReadMessage(strings.NewReader(server.data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Digest: 3 new ✓", subject)
+	assert.Equal(t, `"pp-downloader" <pp@example.com>`, msg.Header.Get("From"))
+	assert.Equal(t, "<me@example.com>, <you@example.com>", msg.Header.Get("To"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := mr.NextPart() // Decodes quoted-printable
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		parts = append(parts, part.Header.Get("Content-Type")+": "+string(body))
+	}
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8: 3 new tracks\r\n",
+		"text/html; charset=utf-8: <p>3 new tracks</p>\r\n",
+	}, parts)
+}
+
+func TestNewEmail(t *testing.T) {
+	e, err := NewEmail("smtp.example.com", 465, "", "", "pp@example.com", []string{"me@example.com"})
+	require.NoError(t, err)
+	assert.True(t, e.tls, "Port 465 is implicit TLS")
+	assert.Equal(t, "smtp.example.com:465", e.addr)
+
+	for _, bad := range []struct {
+		host string
+		port int
+		from string
+		to   []string
+	}{
+		{"", 587, "pp@example.com", []string{"me@example.com"}},
+		{"smtp.example.com", 0, "pp@example.com", []string{"me@example.com"}},
+		{"smtp.example.com", 587, "nobody", []string{"me@example.com"}},
+		{"smtp.example.com", 587, "pp@example.com", nil},
+		{"smtp.example.com", 587, "pp@example.com", []string{"me"}},
+	} {
+		_, err := NewEmail(bad.host, bad.port, "", "", bad.from, bad.to)
+		assert.Error(t, err, "%+v should be rejected", bad)
+	}
+}
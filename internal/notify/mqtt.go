@@ -0,0 +1,384 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MQTT control packet types, from MQTT 3.1.1
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPingreq    = 12
+	mqttDisconnect = 14
+)
+
+const (
+	mqttKeepAlive    = 60 * time.Second
+	mqttTimeout      = 10 * time.Second // For dialing, the handshake and each write
+	mqttMaxPacket    = 1 << 20          // Larger packets from the broker are refused
+	mqttMaxRetry     = 5 * time.Minute
+	mqttOnline       = "online"
+	mqttOffline      = "offline"
+	mqttStatusSuffix = "/status"
+)
+
+// mqttRetryDelay is the first delay before reconnecting, doubled after each
+// failed attempt up to mqttMaxRetry; swapped out in tests
+var mqttRetryDelay = time.Second
+
+// mqttConnackErrors explain the broker's reasons for refusing a connection
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client ID rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// errMQTTNoAck is a publish the broker didn't acknowledge in time
+var errMQTTNoAck = errors.New("MQTT broker didn't acknowledge a message")
+
+// MQTT publishes events to an MQTT broker as retained JSON, for home
+// automation dashboards: each on <prefix>/<event>, or
+// <prefix>/<event>/<playlist> for a playlist's events, so the latest of each
+// is waiting for subscribers that connect later. <prefix>/status is
+// "online" while connected and "offline" once the watcher stops or, through
+// the broker's last will, drops off. It sends every event, status events
+// included, with QoS 1, and reconnects with backoff whenever the broker
+// goes away; an event the broker never acknowledged is published again.
+type MQTT struct {
+	addr     string // host:port
+	tls      bool
+	clientID string
+	username string
+	password string
+	prefix   string
+	queue    chan Event
+	retry    *Event // Failed to publish when the connection dropped
+	nextID   uint16 // Packet ID of the last QoS 1 publish
+}
+
+// NewMQTT creates an MQTT notifier for broker, a tcp:// or mqtt:// URL, or
+// ssl://, tls:// or mqtts:// for TLS, publishing under prefix. username and
+// password are optional; a password needs a username.
+func NewMQTT(broker, clientID, username, password, prefix string) (*MQTT, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid MQTT broker %q: must be a URL like tcp://host:1883", broker)
+	}
+	m := &MQTT{
+		clientID: clientID,
+		username: username,
+		password: password,
+		prefix:   strings.TrimSuffix(prefix, "/"),
+		queue:    make(chan Event, webhookQueueSize),
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		m.tls, port = true, "8883"
+	default:
+		return nil, fmt.Errorf("invalid MQTT broker %q: scheme must be tcp, mqtt, ssl, tls or mqtts", broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	m.addr = net.JoinHostPort(u.Hostname(), port)
+	if password != "" && username == "" {
+		return nil, fmt.Errorf("an MQTT password needs a user name")
+	}
+	if m.prefix == "" || strings.ContainsAny(m.prefix, "+#") {
+		return nil, fmt.Errorf("invalid MQTT topic prefix %q", prefix)
+	}
+	return m, nil
+}
+
+// Notify queues an event for publishing
+func (m *MQTT) Notify(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC().Truncate(time.Second)
+	}
+	select {
+	case m.queue <- e:
+	default:
+		slog.Warn("Dropping notification: too many are waiting to be sent", "event", e.Type, "to", "mqtt")
+	}
+}
+
+// Start keeps a connection to the broker and publishes queued events until
+// ctx is cancelled, when it marks the watcher offline and disconnects
+func (m *MQTT) Start(ctx context.Context) {
+	delay := mqttRetryDelay
+	for {
+		connected, err := m.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = mqttRetryDelay
+		}
+		slog.Warn("Lost connection to MQTT broker; reconnecting", "broker", m.addr, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, mqttMaxRetry)
+	}
+}
+
+// session connects and publishes until the connection fails or ctx is
+// cancelled, reporting whether the broker accepted the connection
+func (m *MQTT) session(ctx context.Context) (bool, error) {
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if err := m.connect(conn); err != nil {
+		return false, err
+	}
+	slog.Info("Connected to MQTT broker", "broker", m.addr)
+
+	// The broker only sends acknowledgements and pings back; reading them
+	// notices a dead connection even while there is nothing to publish
+	readErr := make(chan error, 1)
+	acks := make(chan uint16, 1)
+	go func() {
+		for {
+			conn.SetReadDeadline(time.Now().Add(mqttKeepAlive * 3 / 2))
+			header, body, err := readMQTTPacket(conn)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			if header>>4 == mqttPuback && len(body) == 2 {
+				select {
+				case acks <- uint16(body[0])<<8 | uint16(body[1]):
+				default:
+				}
+			}
+		}
+	}()
+	deliver := func(topic string, payload []byte) error {
+		m.nextID++
+		if m.nextID == 0 { // Packet IDs are never 0
+			m.nextID++
+		}
+		if err := m.publishQoS1(conn, m.nextID, topic, payload); err != nil {
+			return err
+		}
+		timeout := time.After(mqttTimeout)
+		for {
+			select {
+			case id := <-acks:
+				if id == m.nextID {
+					return nil
+				}
+			case err := <-readErr:
+				return err
+			case <-timeout:
+				return errMQTTNoAck
+			}
+		}
+	}
+
+	if err := deliver(m.prefix+mqttStatusSuffix, []byte(mqttOnline)); err != nil {
+		return true, err
+	}
+	if m.retry != nil {
+		if err := m.deliverEvent(deliver, *m.retry); err != nil {
+			return true, err
+		}
+		m.retry = nil
+	}
+
+	ping := time.NewTicker(mqttKeepAlive / 2)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// A clean disconnect doesn't trigger the will, so say so first
+			m.publish(conn, m.prefix+mqttStatusSuffix, []byte(mqttOffline))
+			m.write(conn, mqttDisconnect<<4, nil)
+			return true, nil
+		case err := <-readErr:
+			return true, err
+		case <-ping.C:
+			if err := m.write(conn, mqttPingreq<<4, nil); err != nil {
+				return true, err
+			}
+		case e := <-m.queue:
+			if err := m.deliverEvent(deliver, e); err != nil {
+				m.retry = &e
+				return true, err
+			}
+		}
+	}
+}
+
+// dial opens a connection to the broker, over TLS when asked for
+func (m *MQTT) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	var err error
+	if m.tls {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", m.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach MQTT broker: %w", err)
+	}
+	return conn, nil
+}
+
+// connect sends CONNECT, with "offline" on the status topic as the will,
+// and waits for the broker to accept it
+func (m *MQTT) connect(conn net.Conn) error {
+	flags := byte(0x02 | 0x04 | 0x20) // Clean session, will, retained will
+	if m.username != "" {
+		flags |= 0x80
+	}
+	if m.password != "" {
+		flags |= 0x40
+	}
+	keepAlive := int(mqttKeepAlive / time.Second)
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = appendMQTTString(body, m.clientID)
+	body = appendMQTTString(body, m.prefix+mqttStatusSuffix)
+	body = appendMQTTString(body, mqttOffline)
+	if m.username != "" {
+		body = appendMQTTString(body, m.username)
+	}
+	if m.password != "" {
+		body = appendMQTTString(body, m.password)
+	}
+	if err := m.write(conn, mqttConnect<<4, body); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(mqttTimeout))
+	header, ack, err := readMQTTPacket(conn)
+	if err != nil {
+		return fmt.Errorf("no answer from MQTT broker: %w", err)
+	}
+	if header>>4 != mqttConnack || len(ack) != 2 {
+		return fmt.Errorf("MQTT broker sent an unexpected packet instead of CONNACK")
+	}
+	if ack[1] != 0 {
+		reason, ok := mqttConnackErrors[ack[1]]
+		if !ok {
+			reason = fmt.Sprintf("code %d", ack[1])
+		}
+		return fmt.Errorf("MQTT broker refused the connection: %s", reason)
+	}
+	return nil
+}
+
+// deliverEvent publishes an event as JSON on its topic with deliver
+func (m *MQTT) deliverEvent(deliver func(topic string, payload []byte) error, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Failed to encode notification", "event", e.Type, "to", "mqtt", "error", err)
+		return nil
+	}
+	return deliver(m.topic(e), payload)
+}
+
+// topic is where an event is published: under its playlist, when it has one
+func (m *MQTT) topic(e Event) string {
+	topic := m.prefix + "/" + e.Type
+	if playlist, _ := e.Details["playlist"].(string); playlist != "" {
+		topic += "/" + mqttTopicLevel(playlist)
+	}
+	return topic
+}
+
+// publish sends a retained message with QoS 0, for the last message
+// before disconnecting, which nothing waits on
+func (m *MQTT) publish(conn net.Conn, topic string, payload []byte) error {
+	return m.write(conn, mqttPublish<<4|0x01, append(appendMQTTString(nil, topic), payload...))
+}
+
+// publishQoS1 sends a retained message with QoS 1, which the broker
+// acknowledges with a PUBACK carrying id
+func (m *MQTT) publishQoS1(conn net.Conn, id uint16, topic string, payload []byte) error {
+	body := append(appendMQTTString(nil, topic), byte(id>>8), byte(id))
+	return m.write(conn, mqttPublish<<4|0x02|0x01, append(body, payload...))
+}
+
+// write sends a packet, giving up on a broker that stops reading
+func (m *MQTT) write(conn net.Conn, header byte, body []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(mqttTimeout))
+	packet := []byte{header}
+	for n := len(body); ; {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := conn.Write(append(packet, body...))
+	return err
+}
+
+// readMQTTPacket reads one packet, returning its first header byte and the
+// rest after the length
+func readMQTTPacket(r io.Reader) (byte, []byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, nil, err
+	}
+	header := b[0]
+	length, shift := 0, 0
+	for {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length |= int(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+	}
+	if length > mqttMaxPacket {
+		return 0, nil, fmt.Errorf("MQTT packet of %d bytes is too large", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// appendMQTTString appends s with its two-byte length
+func appendMQTTString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
+
+// mqttTopicLevel makes a playlist name usable as one topic level, replacing
+// the separator and wildcards
+func mqttTopicLevel(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
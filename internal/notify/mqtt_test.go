@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mqttMessage is a PUBLISH the fake broker received
+type mqttMessage struct {
+	topic    string
+	payload  string
+	retained bool
+}
+
+// fakeBroker accepts MQTT connections, recording what clients publish
+type fakeBroker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	connects [][]byte // CONNECT bodies
+	messages []mqttMessage
+	conns    []net.Conn
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &fakeBroker{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	header, body, err := readMQTTPacket(conn)
+	if err != nil || header>>4 != mqttConnect {
+		return
+	}
+	b.mu.Lock()
+	b.connects = append(b.connects, body)
+	b.conns = append(b.conns, conn)
+	b.mu.Unlock()
+	conn.Write([]byte{mqttConnack << 4, 2, 0, 0})
+	for {
+		header, body, err := readMQTTPacket(conn)
+		if err != nil || header>>4 == mqttDisconnect {
+			return
+		}
+		if header>>4 == mqttPublish {
+			n := int(binary.BigEndian.Uint16(body))
+			topic, payload := string(body[2:2+n]), body[2+n:]
+			if header&0x06 == 0x02 { // QoS 1 has a packet ID to acknowledge
+				conn.Write([]byte{mqttPuback << 4, 2, payload[0], payload[1]})
+				payload = payload[2:]
+			}
+			b.mu.Lock()
+			b.messages = append(b.messages, mqttMessage{topic, string(payload), header&0x01 != 0})
+			b.mu.Unlock()
+		}
+	}
+}
+
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+// received returns the messages published so far
+func (b *fakeBroker) received() []mqttMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]mqttMessage(nil), b.messages...)
+}
+
+// dropClients closes every connection, as a restarting broker would
+func (b *fakeBroker) dropClients() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+	b.conns = nil
+}
+
+func TestMQTTPublishes(t *testing.T) {
+	broker := newFakeBroker(t)
+	m, err := NewMQTT(broker.url(), "pp", "user", "pass", "home/pp/")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Start(ctx)
+		close(done)
+	}()
+
+	m.Notify(Event{Type: EventPlaylistChecked, Message: "Checked Jazz", Details: map[string]any{"playlist": "Jazz/Blues", "downloaded": 3}})
+	m.Notify(Event{Type: EventStats, Message: "Library", Details: map[string]any{"videos": 10}})
+	require.Eventually(t, func() bool { return len(broker.received()) == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	require.Eventually(t, func() bool { return len(broker.received()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	messages := broker.received()
+	assert.Equal(t, mqttMessage{"home/pp/status", "online", true}, messages[0])
+	assert.Equal(t, "home/pp/playlist_checked/Jazz_Blues", messages[1].topic, "Playlist events go under the playlist")
+	assert.True(t, messages[1].retained)
+	var e Event
+	require.NoError(t, json.Unmarshal([]byte(messages[1].payload), &e))
+	assert.Equal(t, float64(3), e.Details["downloaded"])
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, "home/pp/stats", messages[2].topic)
+	assert.Equal(t, mqttMessage{"home/pp/status", "offline", true}, messages[3], "Stopping says so before disconnecting")
+
+	// The will and credentials are in the CONNECT
+	broker.mu.Lock()
+	connect := string(broker.connects[0])
+	broker.mu.Unlock()
+	assert.Contains(t, connect, "home/pp/status")
+	assert.Contains(t, connect, "offline")
+	assert.Contains(t, connect, "user")
+	assert.Equal(t, byte(0x02|0x04|0x20|0x80|0x40), broker.connects[0][7], "Connect flags")
+}
+
+func TestMQTTReconnects(t *testing.T) {
+	mqttRetryDelay = 10 * time.Millisecond
+	defer func() { mqttRetryDelay = time.Second }()
+
+	broker := newFakeBroker(t)
+	m, err := NewMQTT(broker.url(), "pp", "", "", "pp")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Start(ctx)
+
+	require.Eventually(t, func() bool { return len(broker.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	broker.dropClients()
+	m.Notify(Event{Type: EventNewDownloads, Message: "New in Jazz", Details: map[string]any{"playlist": "Jazz"}})
+
+	require.Eventually(t, func() bool {
+		for _, msg := range broker.received() {
+			if msg.topic == "pp/new_downloads/Jazz" {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "Events are published once reconnected")
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	assert.GreaterOrEqual(t, len(broker.connects), 2)
+}
+
+func TestNewMQTT(t *testing.T) {
+	m, err := NewMQTT("mqtts://broker.local", "pp", "", "", "pp")
+	require.NoError(t, err)
+	assert.True(t, m.tls)
+	assert.Equal(t, "broker.local:8883", m.addr)
+
+	for _, bad := range [][]string{
+		{"broker.local:1883", "", "", "pp"},
+		{"http://broker.local", "", "", "pp"},
+		{"tcp://broker.local", "", "secret", "pp"},
+		{"tcp://broker.local", "", "", "pp/#"},
+	} {
+		_, err := NewMQTT(bad[0], "pp", bad[1], bad[2], bad[3])
+		assert.Error(t, err, "%v should be rejected", bad)
+	}
+}
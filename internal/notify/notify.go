@@ -0,0 +1,114 @@
+// Package notify tells someone when the downloader needs attention, so
+// problems in an unattended library don't go unnoticed
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// Event types
+const (
+	EventValidationFailed = "validation_failed" // Validation found missing or corrupt files
+	EventDownloadFailing  = "download_failing"  // Videos keep failing to download
+	EventLowDiskSpace     = "low_disk_space"    // Downloads are paused for lack of space
+	EventYTDLPBroken      = "ytdlp_broken"      // Every playlist failed in a pass
+	EventNewDownloads     = "new_downloads"     // A playlist pass downloaded new videos
+	EventPlaylistChecked  = "playlist_checked"  // A playlist pass finished, with what it did
+	EventStats            = "stats"             // Library statistics, sent periodically
+)
+
+// Events lists every event type
+var Events = []string{EventValidationFailed, EventDownloadFailing, EventLowDiskSpace, EventYTDLPBroken, EventNewDownloads, EventPlaylistChecked, EventStats}
+
+// statusEvents come every pass or every few minutes, for dashboards rather
+// than people, so backends only send them when asked to by name
+var statusEvents = map[string]bool{EventPlaylistChecked: true, EventStats: true}
+
+// Event is something worth telling the user about
+type Event struct {
+	Type    string         `json:"event"`
+	Message string         `json:"message"`
+	Time    time.Time      `json:"time"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Video is a downloaded video, as listed in new_downloads events
+type Video struct {
+	Title    string `json:"title"`
+	Channel  string `json:"channel"`
+	Duration int    `json:"duration"` // Seconds
+	URL      string `json:"url"`
+
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// eventTitles headline each event type in chat and push notifications
+var eventTitles = map[string]string{
+	EventValidationFailed: "Validation found problems",
+	EventDownloadFailing:  "Downloads keep failing",
+	EventLowDiskSpace:     "Low disk space",
+	EventYTDLPBroken:      "Every playlist is failing",
+	EventNewDownloads:     "New downloads",
+	EventPlaylistChecked:  "Playlist checked",
+	EventStats:            "Library statistics",
+}
+
+// EventTitle returns a short headline for an event type
+func EventTitle(event string) string {
+	if title, ok := eventTitles[event]; ok {
+		return title
+	}
+	return event
+}
+
+// eventVideos returns the videos a new_downloads event lists
+func eventVideos(e Event) []Video {
+	videos, _ := e.Details["videos"].([]Video)
+	return videos
+}
+
+// formatDuration formats seconds as m:ss or h:mm:ss
+func formatDuration(seconds int) string {
+	h, m, s := seconds/3600, seconds/60%60, seconds%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+// truncate shortens s to at most n runes, ending it with an ellipsis
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// Notifier sends events somewhere they will be seen. Notify must not block:
+// backends queue events and deliver them in the background.
+type Notifier interface {
+	Notify(Event)
+}
+
+// Discard drops every event; it's used when notifications are off
+var Discard Notifier = discard{}
+
+type discard struct{}
+
+func (discard) Notify(Event) {}
+
+// Multi sends every event to each of its notifiers
+type Multi []Notifier
+
+func (m Multi) Notify(e Event) {
+	for _, n := range m {
+		n.Notify(e)
+	}
+}
+
+// Func adapts a function to a Notifier
+type Func func(Event)
+
+func (f Func) Notify(e Event) { f(e) }
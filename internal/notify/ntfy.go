@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// DefaultNtfyServer is used when no ntfy server is given
+const DefaultNtfyServer = "https://ntfy.sh"
+
+// NtfyPriorities are the priorities ntfy understands, lowest first
+var NtfyPriorities = []string{"min", "low", "default", "high", "urgent"}
+
+// ntfyPriorities is each event's priority when none is configured: new
+// downloads don't buzz the phone, while problems stopping downloads do;
+// status events, when asked for, are quieter still
+var ntfyPriorities = map[string]string{
+	EventNewDownloads:     "low",
+	EventValidationFailed: "default",
+	EventDownloadFailing:  "default",
+	EventLowDiskSpace:     "high",
+	EventYTDLPBroken:      "high",
+	EventPlaylistChecked:  "min",
+	EventStats:            "min",
+}
+
+// ntfyTags are shown as emoji before each event's title
+var ntfyTags = map[string]string{
+	EventNewDownloads:     "musical_note",
+	EventValidationFailed: "mag",
+	EventDownloadFailing:  "warning",
+	EventLowDiskSpace:     "floppy_disk",
+	EventYTDLPBroken:      "rotating_light",
+	EventPlaylistChecked:  "white_check_mark",
+	EventStats:            "bar_chart",
+}
+
+// Ntfy publishes events to an ntfy topic. New downloads open the video
+// when the notification is clicked.
+type Ntfy struct {
+	sender
+	url      string
+	token    string
+	priority string // Every event's priority; by event type when empty
+}
+
+// NewNtfy creates an ntfy notifier for topic on server, DefaultNtfyServer
+// when empty. token, when set, is sent as a bearer token; priority, when
+// set, is used for every event; events limits which event types are sent,
+// all when empty.
+func NewNtfy(server, topic, token, priority string, events []string, client *http.Client) (*Ntfy, error) {
+	if server == "" {
+		server = DefaultNtfyServer
+	}
+	if err := checkURL("ntfy server", server); err != nil {
+		return nil, err
+	}
+	if topic == "" || strings.ContainsAny(topic, "/?#") {
+		return nil, fmt.Errorf("invalid ntfy topic %q", topic)
+	}
+	if priority != "" && !slices.Contains(NtfyPriorities, priority) {
+		return nil, fmt.Errorf("invalid ntfy priority %q: must be one of %v", priority, NtfyPriorities)
+	}
+	s, err := newSender("ntfy", events, client)
+	if err != nil {
+		return nil, err
+	}
+	n := &Ntfy{
+		sender:   s,
+		url:      strings.TrimSuffix(server, "/") + "/" + topic,
+		token:    token,
+		priority: priority,
+	}
+	n.request = n.newRequest
+	return n, nil
+}
+
+// newRequest publishes the event's message, listing new videos unless a
+// message template decides what is shown
+func (n *Ntfy) newRequest(ctx context.Context, e Event) (*http.Request, error) {
+	body := e.Message
+	videos := eventVideos(e)
+	if n.message == nil && len(videos) > 1 {
+		for _, v := range videos {
+			body += "\n• " + v.Title
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ntfy request: %w", err)
+	}
+	priority := n.priority
+	if priority == "" {
+		priority = ntfyPriorities[e.Type]
+	}
+	req.Header.Set("Title", EventTitle(e.Type))
+	req.Header.Set("Priority", priority)
+	req.Header.Set("Tags", ntfyTags[e.Type])
+	if len(videos) > 0 {
+		req.Header.Set("Click", videos[0].URL)
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return req, nil
+}
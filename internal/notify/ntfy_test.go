@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ntfyRequest is what the ntfy server was sent
+type ntfyRequest struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+func newNtfyServer(t *testing.T) (*httptest.Server, *ntfyRequest) {
+	t.Helper()
+	var got ntfyRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = ntfyRequest{path: r.URL.Path, header: r.Header, body: string(body)}
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+func TestNtfyPublishes(t *testing.T) {
+	server, got := newNtfyServer(t)
+
+	n, err := NewNtfy(server.URL+"/", "music", "tk_secret", "", nil, nil)
+	require.NoError(t, err)
+	n.deliver(context.Background(), Event{Type: EventNewDownloads, Message: "2 new videos in Jazz", Details: map[string]any{
+		"videos": []Video{
+			{Title: "Take Five", URL: "https://www.youtube.com/watch?v=aaaaaaaaaaa"},
+			{Title: "So What", URL: "https://www.youtube.com/watch?v=bbbbbbbbbbb"},
+		},
+	}})
+	assert.Equal(t, "/music", got.path)
+	assert.Equal(t, "2 new videos in Jazz\n• Take Five\n• So What", got.body)
+	assert.Equal(t, "New downloads", got.header.Get("Title"))
+	assert.Equal(t, "low", got.header.Get("Priority"))
+	assert.Equal(t, "https://www.youtube.com/watch?v=aaaaaaaaaaa", got.header.Get("Click"))
+	assert.Equal(t, "Bearer tk_secret", got.header.Get("Authorization"))
+
+	n.deliver(context.Background(), Event{Type: EventLowDiskSpace, Message: "Downloads paused"})
+	assert.Equal(t, "Downloads paused", got.body)
+	assert.Equal(t, "high", got.header.Get("Priority"))
+	assert.Empty(t, got.header.Get("Click"))
+}
+
+func TestNtfyPriority(t *testing.T) {
+	server, got := newNtfyServer(t)
+
+	n, err := NewNtfy(server.URL, "music", "", "urgent", nil, nil)
+	require.NoError(t, err)
+	n.deliver(context.Background(), Event{Type: EventNewDownloads, Message: "New in Jazz: Take Five"})
+	assert.Equal(t, "urgent", got.header.Get("Priority"))
+	assert.Empty(t, got.header.Get("Authorization"))
+}
+
+func TestNewNtfyRejectsBadConfig(t *testing.T) {
+	n, err := NewNtfy("", "music", "", "", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNtfyServer+"/music", n.url)
+
+	for _, topic := range []string{"", "music/jazz"} {
+		_, err := NewNtfy("", topic, "", "", nil, nil)
+		assert.Error(t, err, "topic %q should be rejected", topic)
+	}
+	_, err = NewNtfy("ntfy.example.com", "music", "", "", nil, nil)
+	assert.Error(t, err)
+	_, err = NewNtfy("", "music", "", "loud", nil, nil)
+	assert.Error(t, err)
+	_, err = NewNtfy("", "music", "", "", []string{"disk_full"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	webhookQueueSize = 100
+	webhookAttempts  = 5
+)
+
+// webhookRetryDelay is the first delay between attempts, doubled after each;
+// swapped out in tests
+var webhookRetryDelay = 5 * time.Second
+
+// Sink is a Notifier that delivers its events over the network once
+// started
+type Sink interface {
+	Notifier
+	Start(ctx context.Context)
+}
+
+// sender is what the HTTP backends share: an event filter, a message
+// template and a queue delivered in the background, retrying failures, so a
+// slow or dead endpoint never holds up the caller. When the queue is full
+// new events are dropped. The backends differ only in the request made.
+type sender struct {
+	name    string          // The backend, for errors
+	events  map[string]bool // nil sends every event but status events
+	client  *http.Client
+	queue   chan Event
+	message *template.Template // Renders each event's message; nil keeps it
+
+	// request builds the request delivering an event; it's called for each
+	// attempt, as a request body can only be read once
+	request func(ctx context.Context, e Event) (*http.Request, error)
+}
+
+// newSender checks events, which limits the event types sent to all but
+// status events when empty
+func newSender(name string, events []string, client *http.Client) (sender, error) {
+	var filter map[string]bool
+	if len(events) > 0 {
+		known := make(map[string]bool, len(Events))
+		for _, e := range Events {
+			known[e] = true
+		}
+		filter = make(map[string]bool, len(events))
+		for _, e := range events {
+			if !known[e] {
+				return sender{}, fmt.Errorf("unknown event %q: must be one of %v", e, Events)
+			}
+			filter[e] = true
+		}
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return sender{
+		name:   name,
+		events: filter,
+		client: client,
+		queue:  make(chan Event, webhookQueueSize),
+	}, nil
+}
+
+// checkURL requires an absolute http or https URL
+func checkURL(name, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %s URL: must be an http or https URL", name)
+	}
+	return nil
+}
+
+// SetMessageTemplate replaces each event's message with text rendered as a
+// Go template of the event, for services that only show a plain-text
+// message, e.g. "{{.Message}}{{range .Details.videos}}\n{{.Title}}{{end}}"
+func (s *sender) SetMessageTemplate(text string) error {
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid message template: %w", err)
+	}
+	s.message = tmpl
+	return nil
+}
+
+// Notify queues an event for delivery
+func (s *sender) Notify(e Event) {
+	if (s.events != nil && !s.events[e.Type]) || (s.events == nil && statusEvents[e.Type]) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC().Truncate(time.Second)
+	}
+	if s.message != nil {
+		var b strings.Builder
+		if err := s.message.Execute(&b, e); err != nil {
+			slog.Warn("Failed to render notification message; sending the default", "event", e.Type, "error", err)
+		} else {
+			e.Message = b.String()
+		}
+	}
+	select {
+	case s.queue <- e:
+	default:
+		slog.Warn("Dropping notification: too many are waiting to be sent", "event", e.Type, "to", s.name)
+	}
+}
+
+// Start delivers queued events until ctx is cancelled
+func (s *sender) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-s.queue:
+			s.deliver(ctx, e)
+		}
+	}
+}
+
+// deliver sends an event, retrying with backoff while the endpoint is
+// unreachable or failing
+func (s *sender) deliver(ctx context.Context, e Event) {
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		req, err := s.request(ctx, e)
+		if err != nil {
+			slog.Error("Failed to encode notification", "event", e.Type, "to", s.name, "error", err)
+			return
+		}
+		err = s.send(req)
+		if err == nil {
+			return
+		}
+		var status statusError
+		if attempt == webhookAttempts || ctx.Err() != nil || (errors.As(err, &status) && !status.retryable()) {
+			slog.Error("Failed to send notification", "event", e.Type, "to", s.name, "error", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// send makes one delivery attempt
+func (s *sender) send(req *http.Request) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Webhook URLs often embed a secret, so leave it out of the log
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("failed to reach %s: %w", s.name, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(resp.StatusCode)
+	}
+	return nil
+}
+
+// statusError is a response other than 2xx
+type statusError int
+
+func (s statusError) Error() string {
+	return fmt.Sprintf("server returned %d %s", int(s), http.StatusText(int(s)))
+}
+
+// retryable reports whether the request may succeed if sent again
+func (s statusError) retryable() bool {
+	return s >= 500 || s == http.StatusTooManyRequests || s == http.StatusRequestTimeout
+}
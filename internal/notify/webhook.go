@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Webhook POSTs events as JSON to a URL
+type Webhook struct {
+	sender
+	url   string
+	token string
+}
+
+// NewWebhook creates a webhook notifier. token, when set, is sent as a
+// bearer token; events limits which event types are sent, all when empty.
+func NewWebhook(rawURL, token string, events []string, client *http.Client) (*Webhook, error) {
+	if err := checkURL("webhook", rawURL); err != nil {
+		return nil, err
+	}
+	s, err := newSender("webhook", events, client)
+	if err != nil {
+		return nil, err
+	}
+	w := &Webhook{sender: s, url: rawURL, token: token}
+	w.request = w.newRequest
+	return w, nil
+}
+
+// newRequest posts the event as it is
+func (w *Webhook) newRequest(ctx context.Context, e Event) (*http.Request, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	return req, nil
+}
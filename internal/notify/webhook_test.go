@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookDelivers(t *testing.T) {
+	webhookRetryDelay = time.Millisecond
+	defer func() { webhookRetryDelay = 5 * time.Second }()
+
+	var mu sync.Mutex
+	var received []Event
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway) // Retried
+			return
+		}
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var e Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		received = append(received, e)
+	}))
+	defer server.Close()
+
+	w, err := NewWebhook(server.URL, "secret", []string{EventValidationFailed, EventLowDiskSpace}, nil)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Start(ctx)
+
+	w.Notify(Event{Type: EventYTDLPBroken, Message: "filtered out"})
+	w.Notify(Event{Type: EventValidationFailed, Message: "2 missing", Details: map[string]any{"missing": 2}})
+	w.Notify(Event{Type: EventLowDiskSpace, Message: "disk full"})
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, EventValidationFailed, received[0].Type)
+	assert.Equal(t, float64(2), received[0].Details["missing"])
+	assert.False(t, received[0].Time.IsZero())
+	assert.Equal(t, EventLowDiskSpace, received[1].Type)
+}
+
+func TestWebhookSkipsStatusEvents(t *testing.T) {
+	w, err := NewWebhook("http://example.com/hook", "", nil, nil)
+	require.NoError(t, err)
+	w.Notify(Event{Type: EventStats})
+	w.Notify(Event{Type: EventPlaylistChecked})
+	w.Notify(Event{Type: EventNewDownloads})
+	assert.Len(t, w.queue, 1, "Status events only go to backends asking for them")
+
+	w, err = NewWebhook("http://example.com/hook", "", []string{EventStats}, nil)
+	require.NoError(t, err)
+	w.Notify(Event{Type: EventStats})
+	assert.Len(t, w.queue, 1)
+}
+
+func TestWebhookGivesUpOnClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	w, err := NewWebhook(server.URL, "", nil, nil)
+	require.NoError(t, err)
+	w.deliver(context.Background(), Event{Type: EventYTDLPBroken})
+	assert.Equal(t, 1, requests, "A 404 won't succeed on retry")
+}
+
+func TestWebhookNeverBlocks(t *testing.T) {
+	// An endpoint that never answers
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	w, err := NewWebhook(server.URL, "", nil, nil)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Start(ctx)
+		close(done)
+	}()
+
+	start := time.Now()
+	for i := 0; i < 2*webhookQueueSize; i++ {
+		w.Notify(Event{Type: EventDownloadFailing})
+	}
+	assert.Less(t, time.Since(start), time.Second, "Notify should drop events rather than wait")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start didn't return after cancellation")
+	}
+}
+
+func TestNewWebhookRejectsBadConfig(t *testing.T) {
+	for _, bad := range []string{"", "hooks.example.com/notify", "ftp://hooks.example.com", "http://"} {
+		_, err := NewWebhook(bad, "", nil, nil)
+		assert.Error(t, err, "%q should be rejected", bad)
+	}
+	_, err := NewWebhook("https://hooks.example.com", "", []string{"disk_full"}, nil)
+	assert.Error(t, err)
+}
+
+func TestWebhookMessageTemplate(t *testing.T) {
+	w, err := NewWebhook("https://hooks.example.com", "", nil, nil)
+	require.NoError(t, err)
+	assert.Error(t, w.SetMessageTemplate("{{.Message"))
+	require.NoError(t, w.SetMessageTemplate(`{{.Details.playlist}}:{{range .Details.videos}} {{.Title}} ({{.Channel}}){{end}}`))
+
+	w.Notify(Event{Type: EventNewDownloads, Message: "2 new videos in Jazz", Details: map[string]any{
+		"playlist": "Jazz",
+		"videos":   []Video{{Title: "Take Five", Channel: "Brubeck"}, {Title: "So What", Channel: "Davis"}},
+	}})
+	e := <-w.queue
+	assert.Equal(t, "Jazz: Take Five (Brubeck) So What (Davis)", e.Message)
+
+	// A template that fails on an event keeps its message
+	require.NoError(t, w.SetMessageTemplate(`{{index .Details.videos 5}}`))
+	w.Notify(Event{Type: EventNewDownloads, Message: "1 new video in Jazz", Details: map[string]any{"videos": []Video{{}}}})
+	e = <-w.queue
+	assert.Equal(t, "1 new video in Jazz", e.Message)
+}
+
+func TestMulti(t *testing.T) {
+	var got []string
+	record := func(name string) Notifier {
+		return Func(func(e Event) { got = append(got, name+":"+e.Type) })
+	}
+	Multi{record("a"), record("b")}.Notify(Event{Type: EventNewDownloads})
+	assert.Equal(t, []string{"a:new_downloads", "b:new_downloads"}, got)
+}
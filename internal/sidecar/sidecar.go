@@ -0,0 +1,170 @@
+// Package sidecar writes metadata files next to downloads, so the details
+// only fetched from YouTube travel with the file rather than living only in
+// the database: a Kodi-style .nfo or a plain .info.json.
+package sidecar
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sidecar formats
+const (
+	FormatNFO  = "nfo"
+	FormatJSON = "json"
+)
+
+// Formats are the sidecar formats that can be written
+var Formats = []string{FormatNFO, FormatJSON}
+
+// Video is what a sidecar records about a downloaded file
+type Video struct {
+	YoutubeID   string    `json:"id"`
+	Title       string    `json:"title"`  // The file's title tag: the song when parsed
+	Artist      string    `json:"artist"` // The file's artist tag
+	Album       string    `json:"album,omitempty"`
+	Track       int       `json:"track,omitempty"` // Position in the playlist, or chapter number when split
+	VideoTitle  string    `json:"video_title"`     // The title on YouTube
+	Channel     string    `json:"channel"`
+	ChannelID   string    `json:"channel_id,omitempty"`
+	Description string    `json:"description,omitempty"`
+	UploadDate  time.Time `json:"-"`
+	Duration    int       `json:"duration"` // Seconds
+	ViewCount   int64     `json:"view_count"`
+	Thumbnail   string    `json:"thumbnail,omitempty"`
+	MediaType   string    `json:"media_type"` // audio or video
+}
+
+// URL is the video's page on YouTube
+func (v Video) URL() string {
+	return "https://www.youtube.com/watch?v=" + v.YoutubeID
+}
+
+// Path returns the sidecar of mediaPath in format: the media file's name
+// with .nfo or .info.json in place of its extension
+func Path(mediaPath, format string) string {
+	base := strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath))
+	if format == FormatJSON {
+		return base + ".info.json"
+	}
+	return base + ".nfo"
+}
+
+// Write writes the sidecar for mediaPath, replacing any already there
+func Write(mediaPath, format string, v Video) error {
+	var data []byte
+	var err error
+	switch format {
+	case FormatNFO:
+		data, err = nfo(v)
+	case FormatJSON:
+		data, err = infoJSON(v)
+	default:
+		return fmt.Errorf("unknown sidecar format %q: must be one of %v", format, Formats)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Written beside the file and renamed, so players never read half a sidecar
+	path := Path(mediaPath, format)
+	tmp := path + ".part"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes any sidecars of mediaPath, in every format. Missing ones
+// aren't an error.
+func Remove(mediaPath string) error {
+	var errs []error
+	for _, format := range Formats {
+		if err := os.Remove(Path(mediaPath, format)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// infoJSON lays out the .info.json sidecar
+func infoJSON(v Video) ([]byte, error) {
+	type info struct {
+		Video
+		URL        string `json:"webpage_url"`
+		UploadDate string `json:"upload_date,omitempty"` // YYYY-MM-DD
+	}
+	out := info{Video: v, URL: v.URL()}
+	if !v.UploadDate.IsZero() {
+		out.UploadDate = v.UploadDate.Format(time.DateOnly)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sidecar: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// kodiNFO is Kodi's <musicvideo> file, also used as <song> for audio
+type kodiNFO struct {
+	XMLName   xml.Name
+	Title     string       `xml:"title"`
+	Artist    string       `xml:"artist,omitempty"`
+	Album     string       `xml:"album,omitempty"`
+	Track     int          `xml:"track,omitempty"`
+	Plot      string       `xml:"plot,omitempty"`
+	Runtime   int          `xml:"runtime,omitempty"` // Minutes
+	Premiered string       `xml:"premiered,omitempty"`
+	Year      int          `xml:"year,omitempty"`
+	Studio    string       `xml:"studio,omitempty"`
+	Thumb     string       `xml:"thumb,omitempty"`
+	UniqueID  kodiUniqueID `xml:"uniqueid"`
+}
+
+type kodiUniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr"`
+	ID      string `xml:",chardata"`
+}
+
+// nfo lays out the Kodi .nfo sidecar
+func nfo(v Video) ([]byte, error) {
+	root := "musicvideo"
+	if v.MediaType == "audio" {
+		root = "song"
+	}
+	doc := kodiNFO{
+		XMLName:  xml.Name{Local: root},
+		Title:    v.Title,
+		Artist:   v.Artist,
+		Album:    v.Album,
+		Track:    v.Track,
+		Plot:     v.Description,
+		Studio:   v.Channel,
+		Thumb:    v.Thumbnail,
+		UniqueID: kodiUniqueID{Type: "youtube", Default: true, ID: v.YoutubeID},
+	}
+	if v.Duration > 0 {
+		doc.Runtime = (v.Duration + 59) / 60
+	}
+	if !v.UploadDate.IsZero() {
+		doc.Premiered = v.UploadDate.Format(time.DateOnly)
+		doc.Year = v.UploadDate.Year()
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sidecar: %w", err)
+	}
+	return append([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"), append(data, '\n')...), nil
+}
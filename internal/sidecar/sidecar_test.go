@@ -0,0 +1,82 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testVideo = Video{
+	YoutubeID:   "dQw4w9WgXcQ",
+	Title:       "Never Gonna Give You Up",
+	Artist:      "Rick Astley",
+	Album:       "Classics",
+	Track:       4,
+	VideoTitle:  "Rick Astley - Never Gonna Give You Up (Official Video)",
+	Channel:     "Rick Astley",
+	Description: "The official video & more <3",
+	UploadDate:  time.Date(2009, 10, 25, 0, 0, 0, 0, time.UTC),
+	Duration:    213,
+	ViewCount:   1500000000,
+	MediaType:   "audio",
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/music/Jazz/Take Five.nfo", Path("/music/Jazz/Take Five.mp3", FormatNFO))
+	assert.Equal(t, "/music/Jazz/Take Five.info.json", Path("/music/Jazz/Take Five.mp3", FormatJSON))
+}
+
+func TestWriteNFO(t *testing.T) {
+	media := filepath.Join(t.TempDir(), "song.mp3")
+	require.NoError(t, Write(media, FormatNFO, testVideo))
+
+	data, err := os.ReadFile(Path(media, FormatNFO))
+	require.NoError(t, err)
+	nfo := string(data)
+	assert.Contains(t, nfo, "<song>")
+	assert.Contains(t, nfo, "<title>Never Gonna Give You Up</title>")
+	assert.Contains(t, nfo, "<plot>The official video &amp; more &lt;3</plot>")
+	assert.Contains(t, nfo, "<runtime>4</runtime>")
+	assert.Contains(t, nfo, "<premiered>2009-10-25</premiered>")
+	assert.Contains(t, nfo, `<uniqueid type="youtube" default="true">dQw4w9WgXcQ</uniqueid>`)
+
+	video := testVideo
+	video.MediaType = "video"
+	require.NoError(t, Write(media, FormatNFO, video))
+	data, err = os.ReadFile(Path(media, FormatNFO))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<musicvideo>")
+}
+
+func TestWriteJSON(t *testing.T) {
+	media := filepath.Join(t.TempDir(), "song.mp3")
+	require.NoError(t, Write(media, FormatJSON, testVideo))
+
+	data, err := os.ReadFile(Path(media, FormatJSON))
+	require.NoError(t, err)
+	var info map[string]any
+	require.NoError(t, json.Unmarshal(data, &info))
+	assert.Equal(t, "dQw4w9WgXcQ", info["id"])
+	assert.Equal(t, "Rick Astley - Never Gonna Give You Up (Official Video)", info["video_title"])
+	assert.Equal(t, "2009-10-25", info["upload_date"])
+	assert.Equal(t, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", info["webpage_url"])
+	assert.Equal(t, float64(1500000000), info["view_count"])
+
+	assert.Error(t, Write(media, "xml", testVideo))
+}
+
+func TestRemove(t *testing.T) {
+	media := filepath.Join(t.TempDir(), "song.mp3")
+	require.NoError(t, Write(media, FormatNFO, testVideo))
+	require.NoError(t, Write(media, FormatJSON, testVideo))
+
+	require.NoError(t, Remove(media))
+	assert.NoFileExists(t, Path(media, FormatNFO))
+	assert.NoFileExists(t, Path(media, FormatJSON))
+	assert.NoError(t, Remove(media), "Missing sidecars are fine")
+}
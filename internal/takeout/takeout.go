@@ -0,0 +1,225 @@
+// Package takeout reads the playlists in a Google Takeout export of a
+// YouTube account
+package takeout
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Playlist is one playlist's CSV file in the export
+type Playlist struct {
+	Name       string // From the file name
+	YoutubeID  string // Empty when the export doesn't say
+	Path       string
+	Videos     []Video // In playlist order
+	Malformed  int     // Rows skipped for a bad video ID, timestamp or quoting
+	Duplicates int     // Rows repeating a video
+}
+
+// Video is a video listed in a playlist
+type Video struct {
+	YoutubeID string
+	AddedAt   time.Time // Zero when the row has no timestamp
+}
+
+// videoIDRe matches a YouTube video ID
+var videoIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// timeLayouts are the forms of timestamps Takeout has used
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+}
+
+// Read finds the playlists in dir, an unpacked Takeout export or any folder
+// in it, sorted by name. Newer exports have a <name>-videos.csv per playlist
+// with the IDs in playlists.csv; older ones a <name>.csv with the ID in a
+// header block above the videos. Other CSV files, such as subscriptions,
+// are ignored.
+func Read(dir string) ([]Playlist, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !e.IsDir() && strings.EqualFold(filepath.Ext(path), ".csv") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read takeout directory: %w", err)
+	}
+
+	ids := make(map[string]string) // Playlist IDs by title, from playlists.csv
+	var playlists []Playlist
+	for _, path := range files {
+		records, broken, err := readCSV(path)
+		if err != nil {
+			return nil, err
+		}
+		if titles, ok := readIndex(records); ok {
+			for title, id := range titles {
+				ids[title] = id
+			}
+			continue
+		}
+		p, ok := readPlaylist(records)
+		if !ok {
+			continue
+		}
+		p.Path = path
+		p.Malformed += broken
+		p.Name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), "-videos")
+		playlists = append(playlists, p)
+	}
+
+	for i, p := range playlists {
+		if p.YoutubeID == "" {
+			playlists[i].YoutubeID = ids[p.Name]
+		}
+	}
+	sort.Slice(playlists, func(i, j int) bool { return playlists[i].Name < playlists[j].Name })
+	return playlists, nil
+}
+
+// readCSV reads every row of a CSV file, which may have rows of different
+// lengths and a byte order mark, and counts the rows too broken to read
+func readCSV(path string) ([][]string, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var records [][]string
+	broken := 0
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			broken++
+			continue
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if len(records) == 0 && len(record) > 0 {
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+		}
+		records = append(records, record)
+	}
+	return records, broken, nil
+}
+
+// column returns the index of the named column in a header row, or -1
+func column(header []string, name string) int {
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// field returns a row's value in column i, or "" when the row is short
+func field(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// readIndex reads playlists.csv, which lists each playlist's ID and title;
+// false for any other file
+func readIndex(records [][]string) (map[string]string, bool) {
+	if len(records) == 0 {
+		return nil, false
+	}
+	header := records[0]
+	idCol, titleCol := column(header, "Playlist ID"), column(header, "Playlist Title (Original)")
+	if idCol < 0 || titleCol < 0 {
+		return nil, false
+	}
+	ids := make(map[string]string)
+	for _, row := range records[1:] {
+		if id, title := field(row, idCol), field(row, titleCol); id != "" && title != "" {
+			ids[title] = id
+		}
+	}
+	return ids, true
+}
+
+// readPlaylist reads the videos below a "Video ID" header, and the playlist
+// ID from any header block above it; false when there's no such header
+func readPlaylist(records [][]string) (Playlist, bool) {
+	var p Playlist
+	start := -1
+	for i, row := range records {
+		if column(row, "Video ID") >= 0 {
+			start = i
+			break
+		}
+		if idCol := column(row, "Playlist ID"); idCol >= 0 && i+1 < len(records) {
+			p.YoutubeID = field(records[i+1], idCol)
+		}
+	}
+	if start < 0 {
+		return p, false
+	}
+
+	header := records[start]
+	idCol := column(header, "Video ID")
+	timeCol := column(header, "Playlist Video Creation Timestamp")
+	if timeCol < 0 {
+		timeCol = column(header, "Time Added")
+	}
+	seen := make(map[string]bool)
+	for _, row := range records[start+1:] {
+		v, ok := parseVideo(field(row, idCol), field(row, timeCol))
+		switch {
+		case !ok:
+			p.Malformed++
+		case seen[v.YoutubeID]:
+			p.Duplicates++
+		default:
+			seen[v.YoutubeID] = true
+			p.Videos = append(p.Videos, v)
+		}
+	}
+	return p, true
+}
+
+// parseVideo parses a row's video ID and optional timestamp
+func parseVideo(id, added string) (Video, bool) {
+	if !videoIDRe.MatchString(id) {
+		return Video{}, false
+	}
+	v := Video{YoutubeID: id}
+	if added == "" {
+		return v, true
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, added); err == nil {
+			v.AddedAt = t.UTC()
+			return v, true
+		}
+	}
+	return Video{}, false
+}
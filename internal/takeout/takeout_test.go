@@ -0,0 +1,72 @@
+package takeout
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	playlists := filepath.Join(dir, "Takeout", "YouTube and YouTube Music", "playlists")
+
+	// Newer exports: an index of IDs and a file of videos per playlist
+	writeFile(t, filepath.Join(playlists, "playlists.csv"), "\ufeffPlaylist ID,Add new videos to top,Playlist Title (Original),Playlist Title (Original) Language,Playlist Create Timestamp,Playlist Update Timestamp,Playlist Video Order,Playlist Visibility\n"+
+		"PL_JAZZ,False,Late Jazz,,2023-01-01T10:00:00+00:00,2023-01-02T10:00:00+00:00,Manual,Private\n")
+	writeFile(t, filepath.Join(playlists, "Late Jazz-videos.csv"), "\ufeffVideo ID,Playlist Video Creation Timestamp\n"+
+		"aaaaaaaaaaa,2023-01-01T10:00:00+00:00\n"+
+		"not-an-id,2023-01-01T10:00:00+00:00\n"+
+		"bbbbbbbbbbb,yesterday\n"+
+		"ccccccccccc,2023-01-03T10:00:00+00:00\n"+
+		"aaaaaaaaaaa,2023-01-04T10:00:00+00:00\n"+
+		"\n"+
+		"ddddddddddd\n")
+
+	// Older exports: the playlist's details above its videos
+	writeFile(t, filepath.Join(dir, "Takeout", "YouTube", "playlists", "Talks.csv"), "Playlist Id,Channel Id,Time Created,Time Updated,Title,Description,Visibility\n"+
+		"PL_TALKS,UC_ME,2019-05-01 08:00:00 UTC,2019-05-02 08:00:00 UTC,Talks,,Public\n"+
+		"\n"+
+		"Video Id,Time Added\n"+
+		"eeeeeeeeeee,2019-05-01 08:00:00 UTC\n")
+
+	// No ID anywhere, and files that aren't playlists
+	writeFile(t, filepath.Join(playlists, "Watch later-videos.csv"), "Video ID,Playlist Video Creation Timestamp\nfffffffffff,\n")
+	writeFile(t, filepath.Join(dir, "Takeout", "YouTube and YouTube Music", "subscriptions", "subscriptions.csv"), "Channel Id,Channel Url,Channel Title\nUC_X,https://www.youtube.com/channel/UC_X,X\n")
+
+	got, err := Read(dir)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+
+	jazz := got[0]
+	assert.Equal(t, "Late Jazz", jazz.Name, "Named after the file")
+	assert.Equal(t, "PL_JAZZ", jazz.YoutubeID, "ID from playlists.csv")
+	assert.Equal(t, []Video{
+		{YoutubeID: "aaaaaaaaaaa", AddedAt: time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{YoutubeID: "ccccccccccc", AddedAt: time.Date(2023, 1, 3, 10, 0, 0, 0, time.UTC)},
+		{YoutubeID: "ddddddddddd"},
+	}, jazz.Videos)
+	assert.Equal(t, 2, jazz.Malformed, "A bad ID and a bad timestamp")
+	assert.Equal(t, 1, jazz.Duplicates)
+
+	talks := got[1]
+	assert.Equal(t, "Talks", talks.Name)
+	assert.Equal(t, "PL_TALKS", talks.YoutubeID, "ID from the header block")
+	assert.Equal(t, []Video{{YoutubeID: "eeeeeeeeeee", AddedAt: time.Date(2019, 5, 1, 8, 0, 0, 0, time.UTC)}}, talks.Videos)
+
+	assert.Equal(t, "Watch later", got[2].Name)
+	assert.Empty(t, got[2].YoutubeID)
+	assert.Len(t, got[2].Videos, 1)
+
+	_, err = Read(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// rcloneStatTimeout bounds looking up one object
+const rcloneStatTimeout = time.Minute
+
+// rclone's exit codes when the directory or file doesn't exist
+const (
+	rcloneDirNotFound  = 3
+	rcloneFileNotFound = 4
+)
+
+// Rclone uploads with the rclone binary, to any remote it's configured for
+type Rclone struct {
+	path   string // The rclone binary
+	remote string // Destination, e.g. "b2:bucket/music"
+}
+
+// NewRclone creates a remote uploading under remote, in rclone's
+// remote:path form, with the rclone binary at path
+func NewRclone(path, remote string) *Rclone {
+	return &Rclone{path: path, remote: remote}
+}
+
+// Name identifies the remote in logs
+func (r *Rclone) Name() string {
+	return "rclone " + r.remote
+}
+
+// dest is where key goes on the remote
+func (r *Rclone) dest(key string) string {
+	if strings.HasSuffix(r.remote, ":") || strings.HasSuffix(r.remote, "/") {
+		return r.remote + key
+	}
+	return r.remote + "/" + key
+}
+
+// Upload copies a file with rclone copyto, which skips it when an identical
+// copy is already there
+func (r *Rclone) Upload(ctx context.Context, localPath, key string) error {
+	output, err := exec.CommandContext(ctx, r.path, "copyto", localPath, r.dest(key)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("rclone copyto failed: %w: %s", err, lastLine(output))
+	}
+	return nil
+}
+
+// Stat looks key up with rclone lsjson --stat
+func (r *Rclone) Stat(ctx context.Context, key string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, rcloneStatTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.path, "lsjson", "--stat", r.dest(key))
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && (exit.ExitCode() == rcloneDirNotFound || exit.ExitCode() == rcloneFileNotFound) {
+		return 0, fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("rclone lsjson failed: %w: %s", err, lastLine(stderr.Bytes()))
+	}
+
+	var entry struct {
+		Size  int64
+		IsDir bool
+	}
+	if err := json.Unmarshal(output, &entry); err != nil {
+		return 0, fmt.Errorf("failed to parse rclone lsjson output: %w", err)
+	}
+	if entry.IsDir {
+		return 0, fmt.Errorf("%s is a directory: %w", key, fs.ErrNotExist)
+	}
+	return entry.Size, nil
+}
+
+// lastLine returns the last non-empty line of output, where rclone says
+// what went wrong
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,61 @@
+package upload
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRclone copies to and lists $FAKE_RCLONE_DIR for the remote "fake:"
+const fakeRclone = `#!/bin/sh
+case "$1" in
+copyto)
+	dest="$FAKE_RCLONE_DIR/${3#fake:}"
+	mkdir -p "$(dirname "$dest")" && cp "$2" "$dest"
+	;;
+lsjson)
+	path="$FAKE_RCLONE_DIR/${3#fake:}"
+	if [ ! -f "$path" ]; then
+		echo "ERROR : error in ListJSON: object not found" >&2
+		exit 3
+	fi
+	printf '{"Path":"%s","Size":%d,"IsDir":false}\n' "$(basename "$path")" "$(wc -c < "$path")"
+	;;
+*)
+	echo "unknown command $1" >&2
+	exit 1
+	;;
+esac
+`
+
+func TestRclone(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "rclone")
+	require.NoError(t, os.WriteFile(bin, []byte(fakeRclone), 0755))
+	remoteDir := t.TempDir()
+	t.Setenv("FAKE_RCLONE_DIR", remoteDir)
+
+	r := NewRclone(bin, "fake:music")
+	assert.Equal(t, "fake:music/Jazz/a.mp3", r.dest("Jazz/a.mp3"))
+	assert.Equal(t, "gdrive:Jazz/a.mp3", NewRclone(bin, "gdrive:").dest("Jazz/a.mp3"))
+
+	local := filepath.Join(t.TempDir(), "Take Five.mp3")
+	require.NoError(t, os.WriteFile(local, []byte("audio"), 0644))
+	ctx := context.Background()
+	require.NoError(t, r.Upload(ctx, local, "Jazz/Take Five.mp3"))
+	assert.FileExists(t, filepath.Join(remoteDir, "music", "Jazz", "Take Five.mp3"))
+
+	size, err := r.Stat(ctx, "Jazz/Take Five.mp3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+
+	_, err = r.Stat(ctx, "Jazz/Missing.mp3")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	err = r.Upload(ctx, filepath.Join(t.TempDir(), "gone.mp3"), "Jazz/gone.mp3")
+	assert.ErrorContains(t, err, "rclone copyto failed")
+}
@@ -0,0 +1,256 @@
+// Package upload copies downloads to remote storage once they're recorded,
+// in the background, so a slow or unreachable remote never holds up the
+// next download
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// uploadAttempts is how many times a video's upload is tried before it's
+// left for the next start
+const uploadAttempts = 5
+
+// uploadRetryDelay is the first delay between attempts, doubled after each;
+// swapped out in tests
+var uploadRetryDelay = 30 * time.Second
+
+// Remote is remote storage holding a copy of the library, with each file
+// under its path relative to the music directory, its key
+type Remote interface {
+	// Name identifies the remote in logs
+	Name() string
+	// Upload copies a local file to key, replacing any object there
+	Upload(ctx context.Context, localPath, key string) error
+	// Stat returns the size of the object at key, or an error wrapping
+	// fs.ErrNotExist when there is none
+	Stat(ctx context.Context, key string) (int64, error)
+}
+
+// Options tunes a Queue
+type Options struct {
+	// DeleteLocal deletes the local copy once uploaded, unless the video
+	// is linked into other playlists' folders, which need the file
+	DeleteLocal bool
+
+	// Logger receives upload events; defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// Queue uploads recorded downloads to a remote one video at a time,
+// retrying failures with backoff. Which videos wait is kept in the database
+// as their storage location, so uploads cut short by a restart resume.
+type Queue struct {
+	remote Remote
+	db     *database.Database
+	root   string // Keys are relative to it
+	opts   Options
+	logger *slog.Logger
+	wake   chan struct{}
+
+	mu     sync.Mutex
+	failed map[string]bool // Given up on until the next start or download
+}
+
+// NewQueue creates a queue uploading the files under root to remote
+func NewQueue(remote Remote, db *database.Database, root string, opts Options) *Queue {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Queue{
+		remote: remote,
+		db:     db,
+		root:   root,
+		opts:   opts,
+		logger: logger.With("remote", remote.Name()),
+		wake:   make(chan struct{}, 1),
+		failed: make(map[string]bool),
+	}
+}
+
+// Enqueue marks a recorded download as waiting to be uploaded. It never
+// blocks: the upload happens once Start gets to it.
+func (q *Queue) Enqueue(youtubeID string) {
+	if err := q.db.QueueUpload(youtubeID); err != nil {
+		q.logger.Warn("Failed to queue upload", "video_id", youtubeID, "error", err)
+		return
+	}
+	q.mu.Lock()
+	delete(q.failed, youtubeID)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start uploads waiting videos, starting with any left by a previous run,
+// until ctx is cancelled
+func (q *Queue) Start(ctx context.Context) {
+	for {
+		q.Drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+	}
+}
+
+// Drain uploads waiting videos until none are left but those given up on,
+// for runs that exit once done
+func (q *Queue) Drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		ids, err := q.db.PendingUploads()
+		if err != nil {
+			q.logger.Error("Failed to list pending uploads", "error", err)
+			return
+		}
+		tried := false
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				return
+			}
+			q.mu.Lock()
+			failed := q.failed[id]
+			q.mu.Unlock()
+			if !failed {
+				q.process(ctx, id)
+				tried = true
+			}
+		}
+		if !tried {
+			return
+		}
+	}
+}
+
+// process uploads a video, retrying with backoff. A video that still fails
+// is left waiting until the next start, or until it's downloaded again.
+func (q *Queue) process(ctx context.Context, youtubeID string) {
+	delay := uploadRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := q.upload(ctx, youtubeID)
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if attempt == uploadAttempts || errors.Is(err, fs.ErrNotExist) {
+			q.logger.Error("Failed to upload video; it's tried again after a restart", "video_id", youtubeID, "attempts", attempt, "error", err)
+			q.mu.Lock()
+			q.failed[youtubeID] = true
+			q.mu.Unlock()
+			return
+		}
+		q.logger.Warn("Failed to upload video; retrying", "video_id", youtubeID, "attempt", attempt, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// upload copies a video's file, or its chapter tracks, to the remote and
+// records where it's now kept
+func (q *Queue) upload(ctx context.Context, youtubeID string) error {
+	files, err := q.files(youtubeID)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		key, err := q.key(file)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(file); err != nil {
+			return err // Missing files can't be uploaded however often it's tried
+		}
+		if err := q.remote.Upload(ctx, file, key); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+	}
+
+	location := database.StorageBoth
+	if q.opts.DeleteLocal {
+		links, err := q.db.GetVideoLinks(youtubeID)
+		if err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			location = database.StorageRemote
+		}
+	}
+	// Recorded before deleting, so a failure never leaves a row pointing at
+	// a local file that's gone
+	if err := q.db.SetStorageLocation(youtubeID, location); err != nil {
+		return err
+	}
+	if location == database.StorageRemote {
+		for _, file := range files {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				q.logger.Warn("Failed to delete uploaded file", "path", file, "error", err)
+			}
+		}
+	}
+	q.logger.Info("Uploaded video", "video_id", youtubeID, "files", len(files), "storage_location", location)
+	return nil
+}
+
+// files returns a video's file, or its tracks when it was split
+func (q *Queue) files(youtubeID string) ([]string, error) {
+	path, err := q.db.GetFilePath(youtubeID)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		return []string{path}, nil
+	}
+	tracks, err := q.db.GetVideoTracks(youtubeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("video %s has no files: %w", youtubeID, fs.ErrNotExist)
+	}
+	files := make([]string, len(tracks))
+	for i, t := range tracks {
+		files[i] = t.FilePath
+	}
+	return files, nil
+}
+
+// key is where a local file is kept on the remote: its path relative to
+// the music directory, with forward slashes
+func (q *Queue) key(path string) (string, error) {
+	rel, err := filepath.Rel(q.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the music directory %s", path, q.root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Stat returns the size of the uploaded copy of a local file, for
+// validating files only kept remotely
+func (q *Queue) Stat(ctx context.Context, path string) (int64, error) {
+	key, err := q.key(path)
+	if err != nil {
+		return 0, err
+	}
+	return q.remote.Stat(ctx, key)
+}
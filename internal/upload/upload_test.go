@@ -0,0 +1,205 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memRemote keeps the size of each uploaded object
+type memRemote struct {
+	mu       sync.Mutex
+	objects  map[string]int64
+	failures int // Uploads failing before they start working
+	attempts int
+}
+
+func newMemRemote() *memRemote {
+	return &memRemote{objects: make(map[string]int64)}
+}
+
+func (m *memRemote) Name() string { return "mem" }
+
+func (m *memRemote) Upload(ctx context.Context, localPath, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if m.failures > 0 {
+		m.failures--
+		return fmt.Errorf("connection reset")
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	m.objects[key] = info.Size()
+	return nil
+}
+
+func (m *memRemote) Stat(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	size, ok := m.objects[key]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+	}
+	return size, nil
+}
+
+// newTestLibrary returns a database with playlist PL_A and its music
+// directory
+func newTestLibrary(t *testing.T) (*database.Database, string) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.GetOrCreatePlaylist("PL_A", "A")
+	require.NoError(t, err)
+	return db, filepath.Join(dir, "music")
+}
+
+// writeFile creates a file under root, returning its path
+func writeFile(t *testing.T, root, rel string) string {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("audio"), 0644))
+	return path
+}
+
+func recordFile(t *testing.T, db *database.Database, root, id, rel string) string {
+	t.Helper()
+	path := writeFile(t, root, rel)
+	require.NoError(t, db.RecordDownload("PL_A", "A", database.DownloadRecord{
+		YoutubeID: id, Metadata: database.VideoMetadata{Title: id}, FilePath: path, FileSize: 5,
+	}))
+	return path
+}
+
+func storageLocation(t *testing.T, db *database.Database, id string) string {
+	t.Helper()
+	location, err := db.GetStorageLocation(id)
+	require.NoError(t, err)
+	return location
+}
+
+func TestQueueUploads(t *testing.T) {
+	db, root := newTestLibrary(t)
+	single := recordFile(t, db, root, "aaaaaaaaaaa", "A/Take Five.mp3")
+	linked := recordFile(t, db, root, "ccccccccccc", "A/So What.mp3")
+	_, err := db.GetOrCreatePlaylist("PL_B", "B")
+	require.NoError(t, err)
+	require.NoError(t, db.AddVideoLink("ccccccccccc", "PL_B", writeFile(t, root, "B/So What.mp3"), "hardlink"))
+	tracks := []database.Track{
+		{Number: 1, Title: "Intro", FilePath: writeFile(t, root, "A/Mix/01 - Intro.mp3"), FileSize: 5},
+		{Number: 2, Title: "Outro", FilePath: writeFile(t, root, "A/Mix/02 - Outro.mp3"), FileSize: 5},
+	}
+	require.NoError(t, db.RecordDownload("PL_A", "A", database.DownloadRecord{
+		YoutubeID: "bbbbbbbbbbb", Metadata: database.VideoMetadata{Title: "Mix"}, Tracks: tracks,
+	}))
+	recordFile(t, db, root, "ddddddddddd", "A/Not Queued.mp3")
+	assert.Empty(t, storageLocation(t, db, "ddddddddddd"), "Only queued videos have a storage location")
+
+	remote := newMemRemote()
+	q := NewQueue(remote, db, root, Options{DeleteLocal: true})
+	for _, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc"} {
+		q.Enqueue(id)
+		assert.Equal(t, database.StorageLocal, storageLocation(t, db, id), "Waits for the queue")
+	}
+	q.Drain(context.Background())
+
+	assert.Equal(t, map[string]int64{
+		"A/Take Five.mp3": 5, "A/So What.mp3": 5, "A/Mix/01 - Intro.mp3": 5, "A/Mix/02 - Outro.mp3": 5,
+	}, remote.objects)
+	assert.Equal(t, database.StorageRemote, storageLocation(t, db, "aaaaaaaaaaa"))
+	assert.NoFileExists(t, single)
+	assert.Equal(t, database.StorageRemote, storageLocation(t, db, "bbbbbbbbbbb"))
+	assert.NoFileExists(t, tracks[0].FilePath)
+	assert.Equal(t, database.StorageBoth, storageLocation(t, db, "ccccccccccc"), "Linked videos keep their file")
+	assert.FileExists(t, linked)
+
+	size, err := q.Stat(context.Background(), single)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+	_, err = q.Stat(context.Background(), filepath.Join(root, "A", "Unknown.mp3"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = q.Stat(context.Background(), "/elsewhere/a.mp3")
+	assert.ErrorContains(t, err, "outside the music directory")
+
+	// A new download of an uploaded video is uploaded again
+	recordFile(t, db, root, "aaaaaaaaaaa", "A/Take Five.mp3")
+	assert.Equal(t, database.StorageLocal, storageLocation(t, db, "aaaaaaaaaaa"))
+}
+
+func TestQueueRetries(t *testing.T) {
+	delay := uploadRetryDelay
+	uploadRetryDelay = time.Millisecond
+	t.Cleanup(func() { uploadRetryDelay = delay })
+
+	db, root := newTestLibrary(t)
+	recordFile(t, db, root, "aaaaaaaaaaa", "A/a.mp3")
+	remote := newMemRemote()
+	remote.failures = 2
+	q := NewQueue(remote, db, root, Options{})
+	q.Enqueue("aaaaaaaaaaa")
+	q.Drain(context.Background())
+	assert.Equal(t, 3, remote.attempts)
+	assert.Equal(t, database.StorageBoth, storageLocation(t, db, "aaaaaaaaaaa"), "Kept locally without DeleteLocal")
+
+	// Given up on after every attempt fails, until it's queued again
+	recordFile(t, db, root, "bbbbbbbbbbb", "A/b.mp3")
+	remote.attempts, remote.failures = 0, 100
+	q.Enqueue("bbbbbbbbbbb")
+	q.Drain(context.Background())
+	assert.Equal(t, uploadAttempts, remote.attempts)
+	assert.Equal(t, database.StorageLocal, storageLocation(t, db, "bbbbbbbbbbb"), "Still waits, for the next start")
+	q.Drain(context.Background())
+	assert.Equal(t, uploadAttempts, remote.attempts)
+
+	remote.failures = 0
+	q.Enqueue("bbbbbbbbbbb")
+	q.Drain(context.Background())
+	assert.Equal(t, database.StorageBoth, storageLocation(t, db, "bbbbbbbbbbb"))
+
+	// Missing files aren't retried
+	path := recordFile(t, db, root, "ccccccccccc", "A/c.mp3")
+	require.NoError(t, os.Remove(path))
+	remote.attempts = 0
+	q.Enqueue("ccccccccccc")
+	q.Drain(context.Background())
+	assert.Zero(t, remote.attempts)
+	assert.Equal(t, database.StorageLocal, storageLocation(t, db, "ccccccccccc"))
+}
+
+func TestQueueStartResumesPendingUploads(t *testing.T) {
+	db, root := newTestLibrary(t)
+	recordFile(t, db, root, "aaaaaaaaaaa", "A/a.mp3")
+	recordFile(t, db, root, "bbbbbbbbbbb", "A/b.mp3")
+	require.NoError(t, db.QueueUpload("aaaaaaaaaaa"), "Left by a previous run")
+
+	q := NewQueue(newMemRemote(), db, root, Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Eventually(t, func() bool { return storageLocation(t, db, "aaaaaaaaaaa") == database.StorageBoth }, 5*time.Second, 10*time.Millisecond)
+	q.Enqueue("bbbbbbbbbbb")
+	require.Eventually(t, func() bool { return storageLocation(t, db, "bbbbbbbbbbb") == database.StorageBoth }, 5*time.Second, 10*time.Millisecond)
+}
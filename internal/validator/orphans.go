@@ -0,0 +1,125 @@
+package validator
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// orphanMinAge keeps FindOrphans away from files a running download has
+// just moved into the library but not yet recorded
+const orphanMinAge = 10 * time.Minute
+
+var orphanIDRe = regexp.MustCompile(database.DefaultLibraryIDPattern)
+
+// FindOrphans walks the output directory for media files that no video,
+// playlist link or chapter track points at. Symlinks, covers and other
+// sidecar files, yt-dlp temp files and hidden folders such as the staging
+// directory are skipped.
+func (v *Validator) FindOrphans() ([]database.LibraryFile, error) {
+	known, err := v.db.GetKnownFilePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-orphanMinAge)
+	var orphans []database.LibraryFile
+	err = filepath.WalkDir(v.outputDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			v.logger.Warn("Skipping path during orphan scan", "path", path, "error", err)
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if path != v.outputDir && strings.HasPrefix(entry.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || tempFileRe.MatchString(entry.Name()) || known[path] {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if f, ok := database.ParseLibraryFile(path, info.Size(), orphanIDRe); ok {
+			orphans = append(orphans, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s for orphaned files: %w", v.outputDir, err)
+	}
+	return orphans, nil
+}
+
+// AdoptOrphans records orphaned files as downloads of the video ID in their
+// name, in the playlist whose folder they are in; playlists maps playlist
+// folders to YouTube IDs. Known videos whose recorded file is gone take the
+// orphan instead. Files without an ID, outside a playlist folder, or whose
+// video already has a file are left alone. It returns how many were adopted.
+func (v *Validator) AdoptOrphans(orphans []database.LibraryFile, playlists map[string]string) (int, error) {
+	byPlaylist := make(map[string][]database.LibraryFile)
+	for _, f := range orphans {
+		rel, err := filepath.Rel(v.outputDir, f.Path)
+		if err != nil {
+			continue
+		}
+		folder := filepath.Join(v.outputDir, strings.SplitN(rel, string(filepath.Separator), 2)[0])
+		playlistID, ok := playlists[folder]
+		switch {
+		case f.YoutubeID == "":
+			v.logger.Info("Not adopting file: no video ID in its name", "path", f.Path)
+		case !ok:
+			v.logger.Info("Not adopting file: not in a configured playlist's folder", "path", f.Path)
+		default:
+			byPlaylist[playlistID] = append(byPlaylist[playlistID], f)
+		}
+	}
+
+	ids := make([]string, 0, len(byPlaylist))
+	for id := range byPlaylist {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	adopted := 0
+	for _, playlistID := range ids {
+		stats, err := v.db.ImportLibrary(playlistID, byPlaylist[playlistID])
+		if err != nil {
+			return adopted, err
+		}
+		adopted += stats.Imported + stats.Updated
+		if stats.Existing > 0 {
+			v.logger.Info("Not adopting files whose videos already have a file", "playlist_id", playlistID, "files", stats.Existing)
+		}
+	}
+	return adopted, nil
+}
+
+// DeleteOrphans removes orphaned files, returning how many were removed and
+// the space reclaimed
+func (v *Validator) DeleteOrphans(orphans []database.LibraryFile) (int, int64) {
+	var deleted int
+	var freed int64
+	for _, f := range orphans {
+		if err := os.Remove(f.Path); err != nil {
+			v.logger.Error("Failed to remove orphaned file", "path", f.Path, "error", err)
+			continue
+		}
+		deleted++
+		freed += f.Size
+	}
+	return deleted, freed
+}
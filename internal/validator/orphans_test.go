@@ -0,0 +1,76 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrphans(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	music := filepath.Join(dir, "music")
+	old := time.Now().Add(-time.Hour)
+	write := func(name string, modTime time.Time) string {
+		path := filepath.Join(music, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("12345"), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+
+	recorded := write("Mix/Song [aaaaaaaaaaa].mp3", old)
+	require.NoError(t, db.AddVideo("aaaaaaaaaaa", "PL_MIX", "Mix", database.VideoMetadata{Title: "Song"}))
+	require.NoError(t, db.UpdateFileInfo("aaaaaaaaaaa", recorded, 5, ""))
+
+	// Moved on disk, so the recorded path is gone
+	require.NoError(t, db.AddVideo("bbbbbbbbbbb", "PL_MIX", "Mix", database.VideoMetadata{Title: "Moved"}))
+	require.NoError(t, db.UpdateFileInfo("bbbbbbbbbbb", filepath.Join(music, "Mix", "Old [bbbbbbbbbbb].mp3"), 5, ""))
+	moved := write("Mix/Moved [bbbbbbbbbbb].mp3", old)
+
+	stray := write("Mix/Stray [ccccccccccc].mp3", old)
+	unnamed := write("Mix/Untitled.m4a", old)
+	outside := write("Loose [ddddddddddd].opus", old)
+	write("Mix/cover.jpg", old)
+	write("Mix/Song [eeeeeeeeeee].temp.mp3", old)
+	write(".tmp/staging/Half [fffffffffff].mp3", old)
+	write("Mix/Fresh [ggggggggggg].mp3", time.Now())
+	require.NoError(t, os.Symlink(recorded, filepath.Join(music, "Mix", "Link [hhhhhhhhhhh].mp3")))
+
+	v := NewValidator(db, music, time.Hour, Options{})
+	orphans, err := v.FindOrphans()
+	require.NoError(t, err)
+	var paths []string
+	for _, f := range orphans {
+		paths = append(paths, f.Path)
+	}
+	assert.ElementsMatch(t, []string{moved, stray, unnamed, outside}, paths)
+
+	adopted, err := v.AdoptOrphans(orphans, map[string]string{filepath.Join(music, "Mix"): "PL_MIX"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, adopted)
+	path, err := db.GetFilePath("bbbbbbbbbbb")
+	require.NoError(t, err)
+	assert.Equal(t, moved, path, "The known video takes the orphan")
+	path, err = db.GetFilePath("ccccccccccc")
+	require.NoError(t, err)
+	assert.Equal(t, stray, path)
+
+	orphans, err = v.FindOrphans()
+	require.NoError(t, err)
+	require.Len(t, orphans, 2)
+	deleted, freed := v.DeleteOrphans(orphans)
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, int64(10), freed)
+	assert.NoFileExists(t, unnamed)
+	assert.NoFileExists(t, outside)
+	assert.FileExists(t, recorded)
+}
@@ -0,0 +1,136 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// truncatedFile is a file that decodes shorter than its recorded duration
+type truncatedFile struct {
+	video  database.Video
+	actual time.Duration
+	err    error // Set when ffprobe couldn't read the file at all
+}
+
+// probeDuration returns a file's duration as reported by ffprobe
+func probeDuration(ctx context.Context, ffprobePath, filePath string) (time.Duration, error) {
+	output, err := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		filePath,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected ffprobe output %q", strings.TrimSpace(string(output)))
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// truncated reports whether actual falls short of expected by more than
+// the larger of the two tolerances
+func (o Options) truncated(expected, actual time.Duration) bool {
+	tolerance := max(o.DurationTolerance, time.Duration(float64(expected)*o.DurationTolerancePercent/100))
+	return expected-actual > tolerance
+}
+
+// probeDurations runs ffprobe over every valid file with a recorded
+// duration and marks those cut short, e.g. by yt-dlp being killed
+// mid-conversion, as corrupt. It returns how many it marked.
+func (v *Validator) probeDurations(ctx context.Context) (int, error) {
+	// Without ffprobe every file would look unreadable
+	if _, err := exec.LookPath(v.opts.FFprobePath); err != nil {
+		return 0, fmt.Errorf("skipping duration check: %w", err)
+	}
+	videos, err := v.db.GetVideosByStatus(database.StatusValid)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := make(chan database.Video)
+	var mu sync.Mutex
+	var truncated []truncatedFile
+
+	var wg sync.WaitGroup
+	for i := 0; i < v.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for video := range jobs {
+				actual, err := probeDuration(ctx, v.opts.FFprobePath, video.FilePath)
+				if ctx.Err() != nil {
+					continue
+				}
+				mu.Lock()
+				switch {
+				case err != nil:
+					truncated = append(truncated, truncatedFile{video: video, err: err})
+				case v.opts.truncated(time.Duration(video.Duration)*time.Second, actual):
+					truncated = append(truncated, truncatedFile{video: video, actual: actual})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	probed := 0
+	for _, video := range videos {
+		if video.FilePath == "" || video.Duration <= 0 {
+			continue // Split into chapter tracks, or nothing to compare against
+		}
+		if video.StorageLocation == database.StorageRemote {
+			continue // No local copy to probe
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- video
+		probed++
+		if probed%v.opts.ProgressEvery == 0 {
+			v.logger.Info("Probing files for truncation", "files", probed)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, t := range truncated {
+		var reason string
+		if t.err != nil {
+			reason = fmt.Sprintf("unreadable: %v", t.err)
+		} else {
+			reason = fmt.Sprintf("truncated: %s long, expected %s",
+				t.actual.Round(time.Second), time.Duration(t.video.Duration)*time.Second)
+		}
+		if err := v.db.SetValidationStatus(t.video.YoutubeID, database.StatusCorrupt, reason); err != nil {
+			return 0, err
+		}
+		v.logger.Warn("Corrupt file", "video_id", t.video.YoutubeID, "path", t.video.FilePath, "reason", reason)
+	}
+	return len(truncated), ctx.Err()
+}
+
+// logCorrupt lists every file marked corrupt, so they can be inspected
+func (v *Validator) logCorrupt() {
+	videos, err := v.db.GetVideosByStatus(database.StatusCorrupt)
+	if err != nil {
+		v.logger.Error("Failed to list corrupt files", "error", err)
+		return
+	}
+	if len(videos) == 0 {
+		return
+	}
+	v.logger.Warn("Library has corrupt files", "files", len(videos))
+	for _, video := range videos {
+		v.logger.Warn("Corrupt file", "video_id", video.YoutubeID, "path", video.FilePath, "reason", video.ValidationError)
+	}
+}
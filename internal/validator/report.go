@@ -0,0 +1,112 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+)
+
+// ValidationReport is the state of the library after a validation pass.
+// Entries are sorted by video ID so reports from different passes diff
+// cleanly.
+type ValidationReport struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Deep        bool           `json:"deep"`    // Files were re-hashed and probed
+	Checked     int            `json:"checked"` // Files checked by this pass
+	Total       int            `json:"total"`   // Videos recorded
+	Counts      map[string]int `json:"counts"`  // Videos per validation status
+	Broken      []ReportEntry  `json:"broken"`  // Missing and corrupt videos
+
+	Sample *SampleResult `json:"sample,omitempty"` // Set after a sampled verification
+}
+
+// SampleResult is the outcome of re-hashing a sample of the library
+type SampleResult struct {
+	Size            int  `json:"size"`             // Videos re-hashed
+	Mismatches      int  `json:"mismatches"`       // Videos that no longer match their checksum
+	DeepRecommended bool `json:"deep_recommended"` // Mismatches suggest checking every file
+}
+
+// ReportEntry is a missing or corrupt video
+type ReportEntry struct {
+	YoutubeID string   `json:"youtube_id"`
+	Title     string   `json:"title"`
+	Status    string   `json:"status"`
+	FilePath  string   `json:"file_path"`
+	Error     string   `json:"error,omitempty"` // Why the file isn't valid
+	Playlists []string `json:"playlists"`       // YouTube IDs of every playlist the video is in
+}
+
+// Report builds a ValidationReport from the statuses currently recorded
+func (v *Validator) Report(deep bool, checked int) (*ValidationReport, error) {
+	counts, err := v.db.GetStatusCounts()
+	if err != nil {
+		return nil, err
+	}
+	report := &ValidationReport{
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		Deep:        deep,
+		Checked:     checked,
+		Counts:      counts,
+		Broken:      []ReportEntry{},
+	}
+	for _, n := range counts {
+		report.Total += n
+	}
+
+	for _, status := range []string{database.StatusMissing, database.StatusCorrupt} {
+		videos, err := v.db.GetVideosByStatus(status)
+		if err != nil {
+			return nil, err
+		}
+		for _, video := range videos {
+			playlists, err := v.db.GetVideoPlaylists(video.YoutubeID)
+			if err != nil {
+				return nil, err
+			}
+			if playlists == nil {
+				playlists = []string{}
+			}
+			report.Broken = append(report.Broken, ReportEntry{
+				YoutubeID: video.YoutubeID,
+				Title:     video.Title,
+				Status:    status,
+				FilePath:  video.FilePath,
+				Error:     video.ValidationError,
+				Playlists: playlists,
+			})
+		}
+	}
+	sort.Slice(report.Broken, func(i, j int) bool { return report.Broken[i].YoutubeID < report.Broken[j].YoutubeID })
+	return report, nil
+}
+
+// WriteFile writes the report to path as indented JSON, replacing any
+// earlier report only once the new one is complete
+func (r *ValidationReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode validation report: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create validation report: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(data, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write validation report: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move validation report into place: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package validator
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// tempFileRe matches intermediate files yt-dlp and ffmpeg leave behind when
+// a download is killed: partial downloads (.part, .part-Frag3, .ytdl),
+// per-format streams awaiting a merge (.f251.webm) and conversion output
+// (.temp.mp3)
+var tempFileRe = regexp.MustCompile(`(\.part(-Frag\d+)?|\.ytdl|\.temp\.\w+|\.f\d+\.\w+(\.part)?)$`)
+
+// TempCleanupStats summarises a CleanupTempFiles pass
+type TempCleanupStats struct {
+	Files int   // Files removed, or that would be removed in a dry run
+	Bytes int64 // Space reclaimed
+}
+
+// CleanupTempFiles removes yt-dlp temp files under the output directory that
+// haven't been modified for minAge. Files recorded in the database are never
+// touched. With dryRun set, matches are only logged.
+func (v *Validator) CleanupTempFiles(minAge time.Duration, dryRun bool) (TempCleanupStats, error) {
+	var stats TempCleanupStats
+
+	known, err := v.db.GetKnownFilePaths()
+	if err != nil {
+		return stats, err
+	}
+
+	cutoff := time.Now().Add(-minAge)
+	err = filepath.WalkDir(v.outputDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Keep going past unreadable folders
+			v.logger.Warn("Skipping path during temp file cleanup", "path", path, "error", err)
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !tempFileRe.MatchString(entry.Name()) || known[path] {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		if dryRun {
+			v.logger.Info("Would remove temp file", "path", path, "bytes", info.Size())
+		} else {
+			if err := os.Remove(path); err != nil {
+				v.logger.Error("Failed to remove temp file", "path", path, "error", err)
+				return nil
+			}
+			v.logger.Info("Removed temp file", "path", path, "bytes", info.Size())
+		}
+		stats.Files++
+		stats.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to scan %s for temp files: %w", v.outputDir, err)
+	}
+
+	if dryRun {
+		v.logger.Info("Temp file cleanup (dry run)", "files", stats.Files, "bytes", stats.Bytes)
+	} else {
+		v.logger.Info("Temp file cleanup", "files", stats.Files, "bytes", stats.Bytes)
+	}
+	return stats, nil
+}
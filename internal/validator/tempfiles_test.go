@@ -0,0 +1,62 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanupTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	music := filepath.Join(dir, "music")
+	old := time.Now().Add(-48 * time.Hour)
+	write := func(name string, modTime time.Time) string {
+		path := filepath.Join(music, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("12345"), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+
+	orphans := []string{
+		write("Mix/Song [abc].webm.part", old),
+		write("Mix/Song [abc].f251.webm", old),
+		write("Mix/Song [abc].temp.mp3", old),
+		write("Mix/Song [abc].webm.part-Frag12", old),
+	}
+	recent := write("Mix/Other [def].webm.part", time.Now())
+	finished := write("Mix/Song [ghi].mp3", old)
+
+	// A completed file that happens to match a temp pattern is kept when recorded
+	recorded := write("Mix/Live [jkl].f137.mp4", old)
+	require.NoError(t, db.AddVideo("jkl", "PL_MIX", "Mix", database.VideoMetadata{Title: "Live"}))
+	require.NoError(t, db.UpdateFileInfo("jkl", recorded, 5, ""))
+
+	v := NewValidator(db, music, time.Hour, Options{})
+
+	stats, err := v.CleanupTempFiles(24*time.Hour, true)
+	require.NoError(t, err)
+	assert.Equal(t, TempCleanupStats{Files: 4, Bytes: 20}, stats)
+	for _, path := range orphans {
+		assert.FileExists(t, path, "Dry run must not delete anything")
+	}
+
+	stats, err = v.CleanupTempFiles(24*time.Hour, false)
+	require.NoError(t, err)
+	assert.Equal(t, TempCleanupStats{Files: 4, Bytes: 20}, stats)
+	for _, path := range orphans {
+		assert.NoFileExists(t, path)
+	}
+	assert.FileExists(t, recent, "Files still being written are left alone")
+	assert.FileExists(t, finished)
+	assert.FileExists(t, recorded)
+}
@@ -1,33 +1,119 @@
 package validator
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
 	"os"
 	"time"
 
 	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/notify"
 )
 
+// notifyMaxVideos caps the broken videos listed in a notification
+const notifyMaxVideos = 20
+
 type Validator struct {
-	db            *database.Database
-	outputDir     string
-	checkInterval time.Duration
-	stopChan      chan struct{}
+	db             *database.Database
+	outputDir      string
+	checkInterval  time.Duration
+	opts           Options
+	logger         *slog.Logger
+	notifiedBroken int // Broken videos in the last notification
+}
+
+// Options controls how often files are validated and how hard deep
+// validation may hit the disk
+type Options struct {
+	// MaxAge is how long a file's last check stays good; files not
+	// checked within it are checked to still exist
+	MaxAge time.Duration
+
+	// DeepInterval is how often every file is re-hashed and compared with
+	// its stored checksum; 0 turns deep validation off
+	DeepInterval time.Duration
+
+	MaxBytesPerSecond int64 // Caps deep validation's reads; 0 means unthrottled
+	ProgressEvery     int   // Log progress after this many files
+	Workers           int   // Files checked or probed at once
+
+	// With FFprobePath set, deep validation also probes each file's duration
+	// and marks files shorter than recorded by more than the larger
+	// tolerance as corrupt
+	FFprobePath              string
+	DurationTolerance        time.Duration
+	DurationTolerancePercent float64
+
+	// ReportPath, when set, is where every pass that checked files writes
+	// a ValidationReport as JSON
+	ReportPath string
+
+	// With SampleSize or SamplePercent set, a sample of the files with
+	// checksums is re-hashed once no file was verified within
+	// SampleInterval, favouring those verified longest ago; a cheaper
+	// alternative to DeepInterval. A mismatch recommends a full deep pass,
+	// and with EscalateSample starts one.
+	SampleSize     int
+	SamplePercent  float64
+	SampleInterval time.Duration
+	EscalateSample bool
+
+	// InWindow, when set, reports whether heavy work may run at a time;
+	// deep passes and re-downloads wait for it
+	InWindow func(time.Time) bool
+
+	// Redownload, when set, is called after each validation pass for every
+	// missing or corrupt file; it reports whether a download was attempted
+	Redownload func(ctx context.Context, video database.Video) (bool, error)
+
+	// StatRemote, when set, checks the uploaded copy of files only kept
+	// remotely on deep and sampled passes; see database.ValidateOptions
+	StatRemote func(ctx context.Context, path string) (int64, error)
+
+	// Notifier is told when a pass leaves missing or corrupt files
+	Notifier notify.Notifier
+
+	// Logger receives validation events; defaults to slog.Default()
+	Logger *slog.Logger
 }
 
-func NewValidator(db *database.Database, outputDir string, checkInterval time.Duration) *Validator {
+// NewValidator creates a Validator that looks for due validation every
+// checkInterval
+func NewValidator(db *database.Database, outputDir string, checkInterval time.Duration, opts Options) *Validator {
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 7 * 24 * time.Hour
+	}
+	if opts.ProgressEvery <= 0 {
+		opts.ProgressEvery = 1000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.Notifier == nil {
+		opts.Notifier = notify.Discard
+	}
+	if opts.SampleInterval <= 0 {
+		opts.SampleInterval = 24 * time.Hour
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
 	return &Validator{
 		db:            db,
 		outputDir:     outputDir,
 		checkInterval: checkInterval,
-		stopChan:      make(chan struct{}),
+		opts:          opts,
+		logger:        opts.Logger,
 	}
 }
 
-// Start begins the periodic validation process
-func (v *Validator) Start() {
+// Start runs validation every checkInterval until ctx is cancelled, which
+// also interrupts a pass in progress
+func (v *Validator) Start(ctx context.Context) {
 	// Run first validation immediately
-	v.RunValidation()
+	v.runValidation(ctx)
 
 	// Then run on the specified interval
 	ticker := time.NewTicker(v.checkInterval)
@@ -36,97 +122,339 @@ func (v *Validator) Start() {
 	for {
 		select {
 		case <-ticker.C:
-			v.RunValidation()
-		case <-v.stopChan:
-			log.Println("Validation service stopped")
+			v.runValidation(ctx)
+		case <-ctx.Done():
+			v.logger.Info("Validation service stopped")
 			return
 		}
 	}
 }
 
-// Stop gracefully shuts down the validation service
-func (v *Validator) Stop() {
-	close(v.stopChan)
+// runValidation runs a validation pass for Start, logging its errors
+func (v *Validator) runValidation(ctx context.Context) {
+	if _, err := v.RunValidation(ctx); err != nil && ctx.Err() == nil {
+		v.logger.Error("Validation failed", "error", err)
+	}
+}
+
+// RunValidation performs a deep validation pass or sampled verification
+// when one is due, and otherwise checks that files not validated within
+// MaxAge still exist. It returns a report of the library afterwards, which
+// is also written to ReportPath, or nil when no files needed validating.
+func (v *Validator) RunValidation(ctx context.Context) (*ValidationReport, error) {
+	if v.opts.DeepInterval > 0 {
+		due, err := v.db.NeedsVerification(v.opts.DeepInterval)
+		switch {
+		case err != nil:
+			v.logger.Error("Failed to check for files needing deep validation", "error", err)
+		case due && !v.inWindow():
+			v.logger.Info("Deep validation is due; waiting for the schedule to allow it")
+		case due:
+			return v.finish(ctx, true, v.DeepValidate(ctx), nil)
+		}
+	}
+
+	if v.sampling() {
+		due, err := v.sampleDue()
+		switch {
+		case err != nil:
+			v.logger.Error("Failed to check whether sampled verification is due", "error", err)
+		case due && !v.inWindow():
+			v.logger.Info("Sampled verification is due; waiting for the schedule to allow it")
+		case due:
+			return v.runSample(ctx)
+		}
+	}
+
+	videos, err := v.db.GetVideosNeedingValidation(v.opts.MaxAge)
+	if err != nil {
+		return nil, err
+	}
+	if len(videos) == 0 {
+		v.logger.Debug("No files need validation at this time")
+		return nil, nil
+	}
+	validated, err := v.validate(ctx, videos)
+	if err != nil {
+		return nil, err
+	}
+	return v.finish(ctx, false, validated, nil)
+}
+
+// ValidateAll checks every file now, also re-hashing and probing them with
+// deep, and returns a report of the library afterwards
+func (v *Validator) ValidateAll(ctx context.Context, deep bool) (*ValidationReport, error) {
+	if deep {
+		return v.finish(ctx, true, v.DeepValidate(ctx), nil)
+	}
+	validated, err := v.validate(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.finish(ctx, false, validated, nil)
 }
 
-// RunValidation performs a single validation pass
-func (v *Validator) RunValidation() {
-	log.Println("Starting file validation...")
+// validate checks that the files of the given videos, or of every video
+// when nil, still exist
+func (v *Validator) validate(ctx context.Context, youtubeIDs []string) (int, error) {
+	v.logger.Info("Starting file validation")
 	start := time.Now()
+	validated, err := v.db.ValidateFilesWithOptions(ctx, database.ValidateOptions{
+		ProgressEvery: v.opts.ProgressEvery,
+		Workers:       v.opts.Workers,
+		YoutubeIDs:    youtubeIDs,
+	})
+	if err != nil {
+		return validated, fmt.Errorf("validation stopped after %d files: %w", validated, err)
+	}
+	v.logger.Info("Validation completed", "files", validated, "elapsed", time.Since(start).Round(time.Millisecond))
+	return validated, nil
+}
+
+// finish downloads broken files again, if enabled, then reports on the
+// library and writes the report to ReportPath
+func (v *Validator) finish(ctx context.Context, deep bool, checked int, sample *SampleResult) (*ValidationReport, error) {
+	v.redownloadBroken(ctx)
 
-	// Get videos that need validation (older than 1 week by default)
-	videos, err := v.db.GetVideosNeedingValidation(7 * 24 * time.Hour)
+	report, err := v.Report(deep, checked)
 	if err != nil {
-		log.Printf("Error getting videos for validation: %v", err)
-		return
+		return nil, err
 	}
+	report.Sample = sample
+	v.logger.Info("Library checked", "videos", report.Total,
+		"missing", report.Counts[database.StatusMissing], "corrupt", report.Counts[database.StatusCorrupt])
+	v.notifyBroken(report)
+	if v.opts.ReportPath != "" {
+		if err := report.WriteFile(v.opts.ReportPath); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
 
-	if len(videos) == 0 {
-		log.Println("No files need validation at this time")
+// notifyBroken sends a notification when a pass leaves missing or corrupt
+// files, unless the last one already reported as many
+func (v *Validator) notifyBroken(report *ValidationReport) {
+	broken := len(report.Broken)
+	if broken == 0 || broken == v.notifiedBroken {
+		v.notifiedBroken = broken
 		return
 	}
+	v.notifiedBroken = broken
+
+	videos := report.Broken
+	if len(videos) > notifyMaxVideos {
+		videos = videos[:notifyMaxVideos]
+	}
+	v.opts.Notifier.Notify(notify.Event{
+		Type: notify.EventValidationFailed,
+		Message: fmt.Sprintf("Validation found %d missing and %d corrupt files",
+			report.Counts[database.StatusMissing], report.Counts[database.StatusCorrupt]),
+		Details: map[string]any{
+			"missing": report.Counts[database.StatusMissing],
+			"corrupt": report.Counts[database.StatusCorrupt],
+			"deep":    report.Deep,
+			"videos":  videos,
+		},
+	})
+}
+
+// DeepValidate re-hashes every file not verified within DeepInterval and
+// marks those that no longer match their checksum as corrupt, then probes
+// the rest for truncation and logs every corrupt file. It returns how many
+// files it checked.
+func (v *Validator) DeepValidate(ctx context.Context) int {
+	v.logger.Info("Starting deep validation", "max_bytes_per_second", v.opts.MaxBytesPerSecond)
+	start := time.Now()
 
-	log.Printf("Validating %d files...", len(videos))
-	validated, err := v.db.ValidateFiles()
+	validated, err := v.db.ValidateFilesWithOptions(ctx, database.ValidateOptions{
+		VerifyChecksums:   true,
+		VerifyMaxAge:      v.opts.DeepInterval,
+		MaxBytesPerSecond: v.opts.MaxBytesPerSecond,
+		ProgressEvery:     v.opts.ProgressEvery,
+		Workers:           v.opts.Workers,
+		StatRemote:        v.opts.StatRemote,
+	})
 	if err != nil {
-		log.Printf("Error during validation: %v", err)
-		return
+		v.logger.Error("Deep validation stopped", "files", validated, "error", err)
+		return validated
 	}
 
-	log.Printf("Validation completed in %s. %d files validated.",
-		time.Since(start).Round(time.Millisecond), validated)
+	if v.opts.FFprobePath != "" {
+		truncated, err := v.probeDurations(ctx)
+		if err != nil {
+			v.logger.Error("Failed to probe durations", "error", err)
+		}
+		if truncated > 0 {
+			v.logger.Warn("Marked truncated files as corrupt", "files", truncated)
+		}
+	}
+	v.logCorrupt()
+
+	v.logger.Info("Deep validation completed", "files", validated, "elapsed", time.Since(start).Round(time.Millisecond))
+	return validated
+}
+
+// sampling reports whether sampled verification is configured
+func (v *Validator) sampling() bool {
+	return v.opts.SampleSize > 0 || v.opts.SamplePercent > 0
 }
 
-// CleanupMissingFiles removes database entries for files that no longer exist
-func (v *Validator) CleanupMissingFiles() (int, error) {
-	log.Println("Cleaning up missing files...")
+// sampleDue reports whether no file was re-hashed within SampleInterval
+func (v *Validator) sampleDue() (bool, error) {
+	verified, err := v.db.VerifiedSince(time.Now().Add(-v.opts.SampleInterval))
+	return !verified, err
+}
 
-	tx, err := v.db.Begin()
+// runSample re-hashes a sample of files and, when any no longer match,
+// recommends or starts a full deep pass
+func (v *Validator) runSample(ctx context.Context) (*ValidationReport, error) {
+	sample, err := v.SampleValidate(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if sample.Mismatches > 0 {
+		if v.opts.EscalateSample {
+			v.logger.Warn("Sampled verification found changed files; starting a full deep validation", "changed", sample.Mismatches, "files", sample.Size)
+			return v.finish(ctx, true, v.DeepValidate(ctx), sample)
+		}
+		v.logger.Warn("Sampled verification found changed files; a full deep validation is recommended (pp-downloader validate --deep)",
+			"changed", sample.Mismatches, "files", sample.Size)
 	}
-	defer tx.Rollback()
+	return v.finish(ctx, false, sample.Size, sample)
+}
 
-	// Get all videos with missing files
-	rows, err := tx.Query(`
-		SELECT youtube_id, file_path 
-		FROM videos 
-		WHERE file_path IS NOT NULL 
-		  AND validation_status = 'missing'
-	`)
+// SampleValidate re-hashes SampleSize files, or SamplePercent of those with
+// checksums, picked at random but favouring those verified longest ago,
+// and counts the ones that no longer match
+func (v *Validator) SampleValidate(ctx context.Context) (*SampleResult, error) {
+	size := v.opts.SampleSize
+	if v.opts.SamplePercent > 0 {
+		total, err := v.db.CountVerifiable()
+		if err != nil {
+			return nil, err
+		}
+		size = int(math.Ceil(float64(total) * v.opts.SamplePercent / 100))
+	}
+	ids, err := v.db.SampleForVerification(size)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	defer rows.Close()
 
-	var deleted int
+	result := &SampleResult{Size: len(ids)}
+	if len(ids) == 0 {
+		return result, nil
+	}
+	v.logger.Info("Starting sampled verification", "files", len(ids))
+	start := time.Now()
+	if _, err := v.db.ValidateFilesWithOptions(ctx, database.ValidateOptions{
+		VerifyChecksums:   true,
+		MaxBytesPerSecond: v.opts.MaxBytesPerSecond,
+		ProgressEvery:     v.opts.ProgressEvery,
+		Workers:           v.opts.Workers,
+		YoutubeIDs:        ids,
+		StatRemote:        v.opts.StatRemote,
+	}); err != nil {
+		return nil, fmt.Errorf("sampled verification stopped: %w", err)
+	}
 
-	for rows.Next() {
-		var youtubeID, filePath string
-		if err := rows.Scan(&youtubeID, &filePath); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			continue
+	corrupt, err := v.db.GetVideosByStatus(database.StatusCorrupt)
+	if err != nil {
+		return nil, err
+	}
+	sampled := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		sampled[id] = true
+	}
+	for _, video := range corrupt {
+		if sampled[video.YoutubeID] && video.ValidationError == database.ReasonChecksumMismatch {
+			result.Mismatches++
+		}
+	}
+	result.DeepRecommended = result.Mismatches > 0
+	v.logger.Info("Sampled verification completed", "files", result.Size, "changed", result.Mismatches,
+		"elapsed", time.Since(start).Round(time.Millisecond))
+	return result, nil
+}
+
+// inWindow reports whether the schedule allows heavy work now
+func (v *Validator) inWindow() bool {
+	return v.opts.InWindow == nil || v.opts.InWindow(time.Now())
+}
+
+// redownloadBroken downloads every missing or corrupt file again
+func (v *Validator) redownloadBroken(ctx context.Context) {
+	if v.opts.Redownload == nil || !v.inWindow() {
+		return
+	}
+
+	var broken []database.Video
+	for _, status := range []string{database.StatusMissing, database.StatusCorrupt} {
+		videos, err := v.db.GetVideosByStatus(status)
+		if err != nil {
+			v.logger.Error("Failed to get broken files", "status", status, "error", err)
+			return
 		}
+		broken = append(broken, videos...)
+	}
+	if len(broken) == 0 {
+		return
+	}
 
+	v.logger.Info("Downloading missing or corrupt files again", "files", len(broken))
+	var repaired, failed, skipped int
+	for _, video := range broken {
+		if ctx.Err() != nil {
+			break
+		}
+		attempted, err := v.opts.Redownload(ctx, video)
+		switch {
+		case !attempted:
+			skipped++
+		case err != nil:
+			failed++
+			v.logger.Error("Failed to download file again", "video_id", video.YoutubeID, "title", video.Title, "error", err)
+		default:
+			repaired++
+			v.logger.Info("Downloaded file again", "video_id", video.YoutubeID, "title", video.Title)
+		}
+	}
+	v.logger.Info("Repaired broken files", "repaired", repaired, "failed", failed, "skipped", skipped)
+}
+
+// CleanupMissingFiles removes the videos whose files are recorded as
+// missing and still aren't on disk, and returns them. With dryRun nothing
+// is removed; the videos that would be are returned.
+func (v *Validator) CleanupMissingFiles(dryRun bool) ([]database.Video, error) {
+	v.logger.Info("Cleaning up missing files")
+
+	videos, err := v.db.GetVideosByStatus(database.StatusMissing)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []database.Video
+	for _, video := range videos {
 		// Double-check the file doesn't exist
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			// File is confirmed missing, delete the record
-			_, err := tx.Exec(`
-				DELETE FROM videos 
-				WHERE youtube_id = ?
-			`, youtubeID)
-			if err != nil {
-				log.Printf("Error deleting record for missing file %s: %v", youtubeID, err)
+		if video.FilePath == "" {
+			continue
+		}
+		if _, err := os.Stat(video.FilePath); !os.IsNotExist(err) {
+			continue
+		}
+		if !dryRun {
+			if err := v.db.DeleteVideo(video.YoutubeID, false); err != nil {
+				v.logger.Error("Failed to delete record of missing file", "video_id", video.YoutubeID, "error", err)
 				continue
 			}
-			deleted++
 		}
+		removed = append(removed, video)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return 0, err
+	if dryRun {
+		v.logger.Info("Would clean up missing files", "files", len(removed))
+	} else {
+		v.logger.Info("Cleaned up missing files", "files", len(removed))
 	}
-
-	log.Printf("Cleaned up %d missing files", deleted)
-	return deleted, nil
+	return removed, nil
 }
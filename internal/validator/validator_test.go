@@ -0,0 +1,341 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sampiiiii/pp-downloader/internal/database"
+	"github.com/sampiiiii/pp-downloader/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunValidationDeep(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	path := filepath.Join(dir, "track.mp3")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0644))
+	sum, err := database.FileChecksum(path)
+	require.NoError(t, err)
+	require.NoError(t, db.AddVideo("vid1", "PL_A", "A", database.VideoMetadata{Title: "track"}))
+	require.NoError(t, db.UpdateFileInfo("vid1", path, 5, sum))
+
+	status := func() string {
+		videos, err := db.ListVideos(database.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, videos, 1)
+		return videos[0].ValidationStatus
+	}
+
+	v := NewValidator(db, dir, time.Hour, Options{DeepInterval: 30 * 24 * time.Hour, MaxBytesPerSecond: 1 << 20})
+	due, err := db.NeedsVerification(30 * 24 * time.Hour)
+	require.NoError(t, err)
+	assert.True(t, due, "Never verified files are due")
+
+	v.RunValidation(context.Background())
+	assert.Equal(t, "valid", status())
+	due, err = db.NeedsVerification(30 * 24 * time.Hour)
+	require.NoError(t, err)
+	assert.False(t, due)
+
+	// Bit rot goes unnoticed until the next deep pass is due
+	require.NoError(t, os.WriteFile(path, []byte("jello"), 0644))
+	v.DeepValidate(context.Background())
+	assert.Equal(t, "valid", status(), "Recently verified files are only checked to exist")
+
+	v = NewValidator(db, dir, time.Hour, Options{DeepInterval: time.Nanosecond})
+	v.DeepValidate(context.Background())
+	assert.Equal(t, "corrupt", status())
+}
+
+func TestRunValidationOnlyStale(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, id := range []string{"fresh", "stale"} {
+		path := filepath.Join(dir, id+".mp3")
+		require.NoError(t, os.WriteFile(path, []byte(id), 0644))
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", database.VideoMetadata{Title: id}))
+		require.NoError(t, db.UpdateFileInfo(id, path, int64(len(id)), ""))
+		require.NoError(t, os.Remove(path))
+	}
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("UPDATE videos SET last_validated = '2000-01-01 00:00:00' WHERE youtube_id = 'stale'")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	v := NewValidator(db, dir, time.Hour, Options{MaxAge: 24 * time.Hour})
+	v.RunValidation(context.Background())
+
+	missing, err := db.GetVideosByStatus(database.StatusMissing)
+	require.NoError(t, err)
+	require.Len(t, missing, 1, "Files validated within MaxAge aren't checked again")
+	assert.Equal(t, "stale", missing[0].YoutubeID)
+}
+
+func TestTruncated(t *testing.T) {
+	opts := Options{DurationTolerance: 5 * time.Second, DurationTolerancePercent: 2}
+	assert.False(t, opts.truncated(300*time.Second, 295*time.Second))
+	assert.True(t, opts.truncated(60*time.Second, 54*time.Second))
+	// 2% of an hour is more than 5 seconds
+	assert.False(t, opts.truncated(time.Hour, time.Hour-time.Minute))
+	assert.True(t, opts.truncated(time.Hour, time.Hour-2*time.Minute))
+	assert.False(t, opts.truncated(60*time.Second, 61*time.Second))
+}
+
+func TestDeepValidateProbesDurations(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// The fake ffprobe reports each file's contents as its duration
+	ffprobe := filepath.Join(dir, "ffprobe")
+	require.NoError(t, os.WriteFile(ffprobe, []byte("#!/bin/sh\neval last=\\${$#}\ncat \"$last\"\n"), 0755))
+
+	for id, contents := range map[string]string{"whole": "299.6", "cut": "150.2", "garbage": "not audio"} {
+		path := filepath.Join(dir, id+".mp3")
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", database.VideoMetadata{Title: id, Duration: 300}))
+		require.NoError(t, db.UpdateFileInfo(id, path, int64(len(contents)), ""))
+	}
+	_, err = db.ValidateFiles()
+	require.NoError(t, err)
+
+	v := NewValidator(db, dir, time.Hour, Options{
+		DeepInterval:             time.Hour,
+		FFprobePath:              ffprobe,
+		DurationTolerance:        5 * time.Second,
+		DurationTolerancePercent: 2,
+	})
+	v.DeepValidate(context.Background())
+
+	corrupt, err := db.GetVideosByStatus(database.StatusCorrupt)
+	require.NoError(t, err)
+	var ids []string
+	for _, video := range corrupt {
+		ids = append(ids, video.YoutubeID)
+	}
+	assert.Equal(t, []string{"cut", "garbage"}, ids)
+
+	// Without ffprobe the check is skipped rather than failing every file
+	require.NoError(t, db.SetValidationStatus("cut", database.StatusValid, ""))
+	v = NewValidator(db, dir, time.Hour, Options{DeepInterval: time.Hour, FFprobePath: filepath.Join(dir, "missing")})
+	_, err = v.probeDurations(context.Background())
+	assert.Error(t, err)
+	valid, err := db.GetVideosByStatus(database.StatusValid)
+	require.NoError(t, err)
+	assert.Len(t, valid, 2)
+}
+
+func TestRunValidationRedownloads(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, id := range []string{"gone", "kept"} {
+		path := filepath.Join(dir, id+".mp3")
+		require.NoError(t, os.WriteFile(path, []byte(id), 0644))
+		sum, err := database.FileChecksum(path)
+		require.NoError(t, err)
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", database.VideoMetadata{Title: id}))
+		require.NoError(t, db.UpdateFileInfo(id, path, 4, sum))
+	}
+	require.NoError(t, os.Remove(filepath.Join(dir, "gone.mp3")))
+
+	var redownloaded []string
+	v := NewValidator(db, dir, time.Hour, Options{
+		DeepInterval: time.Hour, // Due, as nothing was verified yet
+		Redownload: func(ctx context.Context, video database.Video) (bool, error) {
+			redownloaded = append(redownloaded, video.YoutubeID)
+			return true, db.SetValidationStatus(video.YoutubeID, database.StatusValid, "")
+		},
+	})
+	v.RunValidation(context.Background())
+	assert.Equal(t, []string{"gone"}, redownloaded)
+
+	missing, err := db.GetVideosByStatus(database.StatusMissing)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestRunValidationOutsideWindow(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.AddVideo("gone", "PL_A", "A", database.VideoMetadata{Title: "gone"}))
+	require.NoError(t, db.UpdateFileInfo("gone", filepath.Join(dir, "gone.mp3"), 4, "abc"))
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("UPDATE videos SET last_validated = '2000-01-01 00:00:00'")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	redownloads := 0
+	inWindow := false
+	v := NewValidator(db, dir, time.Hour, Options{
+		DeepInterval: time.Hour,
+		InWindow:     func(time.Time) bool { return inWindow },
+		Redownload: func(ctx context.Context, video database.Video) (bool, error) {
+			redownloads++
+			return true, nil
+		},
+	})
+	report, err := v.RunValidation(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.False(t, report.Deep, "Deep passes wait for the window")
+	assert.Equal(t, 0, redownloads, "Re-downloads wait for the window")
+	assert.Equal(t, 1, report.Counts[database.StatusMissing], "Cheap checks still run")
+
+	inWindow = true
+	report, err = v.RunValidation(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.True(t, report.Deep)
+	assert.Equal(t, 1, redownloads)
+}
+
+func TestValidationNotifies(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.AddVideo("gone", "PL_A", "A", database.VideoMetadata{Title: "gone"}))
+	require.NoError(t, db.UpdateFileInfo("gone", filepath.Join(dir, "gone.mp3"), 4, ""))
+
+	var events []notify.Event
+	v := NewValidator(db, dir, time.Hour, Options{
+		Notifier: notify.Func(func(e notify.Event) { events = append(events, e) }),
+	})
+	_, err = v.ValidateAll(context.Background(), false)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, notify.EventValidationFailed, events[0].Type)
+	assert.Equal(t, 1, events[0].Details["missing"])
+
+	_, err = v.ValidateAll(context.Background(), false)
+	require.NoError(t, err)
+	assert.Len(t, events, 1, "The same broken files aren't reported every pass")
+}
+
+func TestValidationReport(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, id := range []string{"present", "gone"} {
+		path := filepath.Join(dir, id+".mp3")
+		require.NoError(t, os.WriteFile(path, []byte(id), 0644))
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", database.VideoMetadata{Title: id}))
+		require.NoError(t, db.UpdateFileInfo(id, path, int64(len(id)), ""))
+	}
+	require.NoError(t, os.Remove(filepath.Join(dir, "gone.mp3")))
+
+	reportPath := filepath.Join(dir, "report.json")
+	v := NewValidator(db, dir, time.Hour, Options{ReportPath: reportPath})
+	report, err := v.ValidateAll(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Checked)
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, map[string]int{"valid": 1, "missing": 1}, report.Counts)
+	require.Len(t, report.Broken, 1)
+	assert.Equal(t, ReportEntry{
+		YoutubeID: "gone",
+		Title:     "gone",
+		Status:    "missing",
+		FilePath:  filepath.Join(dir, "gone.mp3"),
+		Playlists: []string{"PL_A"},
+	}, report.Broken[0])
+
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	var written ValidationReport
+	require.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, report.GeneratedAt.Unix(), written.GeneratedAt.Unix())
+	assert.Equal(t, report.Broken, written.Broken)
+
+	// A dry run lists the row without deleting it
+	removed, err := v.CleanupMissingFiles(true)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "gone", removed[0].YoutubeID)
+	exists, err := db.VideoExists("gone")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	removed, err = v.CleanupMissingFiles(false)
+	require.NoError(t, err)
+	assert.Len(t, removed, 1)
+	exists, err = db.VideoExists("gone")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestSampledVerification(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, id := range []string{"old", "new1", "new2", "new3"} {
+		path := filepath.Join(dir, id+".mp3")
+		require.NoError(t, os.WriteFile(path, []byte(id), 0644))
+		sum, err := database.FileChecksum(path)
+		require.NoError(t, err)
+		require.NoError(t, db.AddVideo(id, "PL_A", "A", database.VideoMetadata{Title: id}))
+		require.NoError(t, db.UpdateFileInfo(id, path, int64(len(id)), sum))
+	}
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("UPDATE videos SET last_verified = datetime('now', '-1 hour') WHERE youtube_id != 'old'")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	// The file never verified is always picked over recently verified ones
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.mp3"), []byte("olb"), 0644))
+	v := NewValidator(db, dir, time.Hour, Options{SampleSize: 1, SampleInterval: time.Minute})
+	report, err := v.RunValidation(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, report.Sample)
+	assert.Equal(t, SampleResult{Size: 1, Mismatches: 1, DeepRecommended: true}, *report.Sample)
+	corrupt, err := db.GetVideosByStatus(database.StatusCorrupt)
+	require.NoError(t, err)
+	require.Len(t, corrupt, 1)
+	assert.Equal(t, "old", corrupt[0].YoutubeID)
+
+	report, err = v.RunValidation(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report == nil || report.Sample == nil, "A sample was verified within SampleInterval")
+
+	// Escalating re-hashes every file after a mismatch
+	tx, err = db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("UPDATE videos SET last_verified = datetime('now', '-1 hour')")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new3.mp3"), []byte("newt"), 0644))
+	v = NewValidator(db, dir, time.Hour, Options{SamplePercent: 100, SampleInterval: time.Minute, EscalateSample: true})
+	report, err = v.RunValidation(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, report.Sample)
+	assert.Equal(t, 4, report.Sample.Size)
+	assert.Equal(t, 2, report.Sample.Mismatches)
+	assert.True(t, report.Deep)
+	assert.Equal(t, 2, report.Counts[database.StatusCorrupt])
+}
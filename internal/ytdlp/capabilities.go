@@ -0,0 +1,261 @@
+package ytdlp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Capabilities describes what the installed yt-dlp build can do
+type Capabilities struct {
+	Version     string
+	Options     map[string]bool // long options listed by --help
+	Libraries   map[string]bool // optional Python libraries, e.g. mutagen
+	Executables map[string]bool // helper binaries, e.g. ffmpeg, AtomicParsley
+
+	warned sync.Map
+}
+
+var (
+	optionRe = regexp.MustCompile(`--[A-Za-z0-9][A-Za-z0-9-]*`)
+	nameRe   = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_]*)`)
+)
+
+// Probe runs yt-dlp's own introspection output to build a capability set
+func Probe(ctx context.Context, binary string) (*Capabilities, error) {
+	version, err := Version(ctx, binary)
+	if err != nil {
+		return nil, err
+	}
+
+	help, err := exec.CommandContext(ctx, binary, "--help").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get yt-dlp help: %w", err)
+	}
+
+	// Without a URL yt-dlp exits non-zero after printing the debug header,
+	// so only the output matters here
+	verbose, _ := exec.CommandContext(ctx, binary, "--verbose").CombinedOutput()
+
+	caps := &Capabilities{Version: version}
+	caps.Options = ParseHelp(string(help))
+	caps.Libraries, caps.Executables = ParseVerbose(string(verbose))
+	return caps, nil
+}
+
+// ParseHelp extracts the long option names from yt-dlp --help output
+func ParseHelp(output string) map[string]bool {
+	options := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "-") {
+			continue
+		}
+		// The option column ends where the description starts
+		if idx := strings.Index(line, "  "); idx != -1 {
+			line = line[:idx]
+		}
+		for _, opt := range optionRe.FindAllString(line, -1) {
+			options[opt] = true
+		}
+	}
+	return options
+}
+
+// ParseVerbose extracts optional libraries and helper executables from the
+// debug header printed by yt-dlp --verbose
+func ParseVerbose(output string) (libraries, executables map[string]bool) {
+	libraries = make(map[string]bool)
+	executables = make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(line, "[debug]")
+		line = strings.TrimSpace(line)
+
+		var target map[string]bool
+		switch {
+		case strings.HasPrefix(line, "Optional libraries:"):
+			target = libraries
+			line = strings.TrimPrefix(line, "Optional libraries:")
+		case strings.HasPrefix(line, "exe versions:"):
+			target = executables
+			line = strings.TrimPrefix(line, "exe versions:")
+		default:
+			continue
+		}
+
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" || entry == "none" {
+				continue
+			}
+			// Entries look like "mutagen-1.47.0" or "ffmpeg 6.1.1 (setts)"
+			if m := nameRe.FindStringSubmatch(entry); m != nil {
+				target[strings.ToLower(m[1])] = true
+			}
+		}
+	}
+	return libraries, executables
+}
+
+// Supports reports whether yt-dlp accepts the given long option.
+// A nil Capabilities means the probe didn't run, so everything is assumed supported.
+func (c *Capabilities) Supports(option string) bool {
+	if c == nil || len(c.Options) == 0 {
+		return true
+	}
+	return c.Options[option]
+}
+
+// CanEmbedThumbnail reports whether yt-dlp has the post-processor dependencies
+// needed to embed a thumbnail into a file with the given extension
+func (c *Capabilities) CanEmbedThumbnail(ext string) bool {
+	if c == nil {
+		return true
+	}
+	if !c.Supports("--embed-thumbnail") {
+		return false
+	}
+	if len(c.Libraries) == 0 && len(c.Executables) == 0 {
+		// The debug header couldn't be read, so dependencies are unknown
+		return true
+	}
+
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "mp3", "mkv", "mka":
+		return c.Executables["ffmpeg"]
+	case "m4a", "mp4", "m4v", "mov":
+		return c.Libraries["mutagen"] || c.Executables["atomicparsley"]
+	case "ogg", "opus", "flac":
+		return c.Libraries["mutagen"] && c.Executables["ffmpeg"]
+	default:
+		return false
+	}
+}
+
+// MissingForThumbnail names what yt-dlp lacks to embed a thumbnail into a file
+// with the given extension, such as "ffmpeg" or "--embed-thumbnail" for builds
+// too old to have the option. It returns "" when embedding already works or
+// when no dependency would help, as for formats that can't hold cover art.
+func (c *Capabilities) MissingForThumbnail(ext string) string {
+	if c.CanEmbedThumbnail(ext) {
+		return ""
+	}
+	if !c.Supports("--embed-thumbnail") {
+		return "--embed-thumbnail"
+	}
+
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "mp3", "mkv", "mka":
+		return "ffmpeg"
+	case "m4a", "mp4", "m4v", "mov":
+		return "mutagen or AtomicParsley"
+	case "ogg", "opus", "flac":
+		if !c.Libraries["mutagen"] {
+			return "mutagen"
+		}
+		return "ffmpeg"
+	default:
+		return ""
+	}
+}
+
+// warnOnce logs message the first time it is seen for key
+func (c *Capabilities) warnOnce(key, message string, args ...any) {
+	if c == nil {
+		return
+	}
+	if _, seen := c.warned.LoadOrStore(key, true); !seen {
+		slog.Warn(message, args...)
+	}
+}
+
+// Args builds a yt-dlp argument list, dropping options the installed build
+// doesn't support instead of letting the whole command fail
+type Args struct {
+	caps    *Capabilities
+	args    []string
+	dropped []string
+	secrets map[int]bool // Indexes into args of values that must not be logged
+}
+
+// NewArgs creates an argument builder that consults caps
+func NewArgs(caps *Capabilities) *Args {
+	return &Args{caps: caps}
+}
+
+// Add appends an option and its values, returning false if it was dropped.
+// Only options yt-dlp can do without, such as progress output, belong here.
+func (a *Args) Add(option string, values ...string) bool {
+	if !a.caps.Supports(option) {
+		a.dropped = append(a.dropped, option)
+		a.caps.warnOnce(option, "Installed yt-dlp doesn't support an option; continuing without it", "option", option)
+		return false
+	}
+	a.args = append(a.args, option)
+	a.args = append(a.args, values...)
+	return true
+}
+
+// AddRequired is like Add for an option the command can't run correctly
+// without, such as where to write the file; an unsupported one is an error
+// rather than dropped
+func (a *Args) AddRequired(option string, values ...string) error {
+	if !a.caps.Supports(option) {
+		return fmt.Errorf("installed yt-dlp doesn't support %s", option)
+	}
+	a.args = append(a.args, option)
+	a.args = append(a.args, values...)
+	return nil
+}
+
+// AddSecret is like AddRequired for an option whose values are credentials
+// or point at them; they are hidden by Redacted
+func (a *Args) AddSecret(option string, values ...string) error {
+	start := len(a.args) + 1
+	if err := a.AddRequired(option, values...); err != nil {
+		return err
+	}
+	if a.secrets == nil {
+		a.secrets = make(map[int]bool)
+	}
+	for i := start; i < len(a.args); i++ {
+		a.secrets[i] = true
+	}
+	return nil
+}
+
+// AddPositional appends arguments that are not options, such as URLs
+func (a *Args) AddPositional(values ...string) {
+	a.args = append(a.args, values...)
+}
+
+// List returns the assembled arguments
+func (a *Args) List() []string {
+	return a.args
+}
+
+// Redacted returns the arguments with secret values masked, for logging
+func (a *Args) Redacted() []string {
+	redacted := make([]string, len(a.args))
+	for i, arg := range a.args {
+		if a.secrets[i] {
+			arg = "<redacted>"
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// Dropped returns the options that were left out
+func (a *Args) Dropped() []string {
+	return a.dropped
+}
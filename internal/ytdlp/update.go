@@ -0,0 +1,74 @@
+package ytdlp
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Version returns the version reported by yt-dlp --version
+func Version(ctx context.Context, binary string) (string, error) {
+	output, err := exec.CommandContext(ctx, binary, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get yt-dlp version: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Update runs yt-dlp -U and returns its last line of output, e.g.
+// "Updated yt-dlp to stable@2024.08.06" or "yt-dlp is up to date (...)".
+// Installs managed by pip or a package manager can't self-update and fail.
+func Update(ctx context.Context, binary string) (string, error) {
+	output, err := exec.CommandContext(ctx, binary, "-U").CombinedOutput()
+	summary := lastLine(string(output))
+	if err != nil {
+		return summary, fmt.Errorf("yt-dlp -U failed: %w: %s", err, summary)
+	}
+	return summary, nil
+}
+
+// CompareVersions compares yt-dlp's date-based versions such as 2024.08.06
+// or nightly 2024.08.06.232808, returning -1, 0 or 1
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts splits a version into numbers, ignoring a channel prefix
+// like "stable@" and anything non-numeric
+func versionParts(version string) []int {
+	if idx := strings.LastIndex(version, "@"); idx != -1 {
+		version = version[idx+1:]
+	}
+	var parts []int
+	for _, field := range strings.Split(strings.TrimSpace(version), ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,35 @@
+package ytdlp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, CompareVersions("2024.08.06", "2024.08.06"))
+	assert.Equal(t, -1, CompareVersions("2023.12.30", "2024.08.06"))
+	assert.Equal(t, 1, CompareVersions("2024.10.07", "2024.8.6"), "Leading zeros don't matter")
+	assert.Equal(t, 1, CompareVersions("2024.08.06.232808", "2024.08.06"), "Nightlies are newer than the release")
+	assert.Equal(t, 0, CompareVersions("stable@2024.08.06", "2024.08.06"))
+}
+
+func TestUpdate(t *testing.T) {
+	bin := t.TempDir()
+	ok := filepath.Join(bin, "ok")
+	require.NoError(t, os.WriteFile(ok, []byte("#!/bin/sh\necho 'Current version: stable@2024.07.01'\necho 'Updated yt-dlp to stable@2024.08.06'\n"), 0755))
+	pip := filepath.Join(bin, "pip")
+	require.NoError(t, os.WriteFile(pip, []byte("#!/bin/sh\necho 'ERROR: You installed yt-dlp with pip or using the wheel from PyPi; Use that to update' >&2\nexit 100\n"), 0755))
+
+	summary, err := Update(context.Background(), ok)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated yt-dlp to stable@2024.08.06", summary)
+
+	_, err = Update(context.Background(), pip)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "installed yt-dlp with pip")
+}